@@ -0,0 +1,306 @@
+// Package api exposes an ExchangeEngine over HTTP: JSON requests for submit, cancel and
+// queries, and Server-Sent Events for the trade stream.
+//
+// It is a thin adapter kept out of the core packages so they stay dependency-free
+// (only the standard library is used here). Requests are translated into domain.Orders
+// and routed through the ExchangeEngine; the engine remains the single source of truth.
+//
+// Endpoints:
+//
+//	POST   /orders                        submit an order (waits for the outcome)
+//	DELETE /orders/{symbol}/{id}          cancel an order
+//	GET    /orders/{symbol}/{id}          queue position of a resting order
+//	GET    /depth/{symbol}?levels=N       aggregated depth (default 20 levels)
+//	GET    /ticker/{symbol}               session statistics
+//	GET    /trades/{symbol}/stream        public trade tape (text/event-stream)
+//	GET    /trades/{symbol}/stream?feed=private  every trade, incl. self-matches and hidden fills
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"lightning-exchange/matching"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Server serves the HTTP API for a fixed set of symbols
+// It takes over consumption of those symbols' trade buffers: trades are fanned out to
+// stream subscribers and returned to the pool, so nothing else may consume them.
+type Server struct {
+	exchange *matching.ExchangeEngine
+	mux      *http.ServeMux
+	hubs     map[string]*tradeHub // immutable after NewServer
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer creates the server and starts a trade pump for each symbol
+// Only the listed symbols are served, so clients can't create engines at will.
+func NewServer(exchange *matching.ExchangeEngine, symbols []string) *Server {
+	s := &Server{
+		exchange: exchange,
+		mux:      http.NewServeMux(),
+		hubs:     make(map[string]*tradeHub, len(symbols)),
+		stop:     make(chan struct{}),
+	}
+	for _, symbol := range symbols {
+		hub := newTradeHub()
+		s.hubs[symbol] = hub
+		consumer := exchange.GetEngine(symbol).GetTradeBuffer().NewTradeConsumerBatchSafe()
+		s.wg.Add(1)
+		go s.pumpTrades(consumer, hub)
+	}
+
+	s.mux.HandleFunc("POST /orders", s.handleSubmit)
+	s.mux.HandleFunc("DELETE /orders/{symbol}/{id}", s.handleCancel)
+	s.mux.HandleFunc("GET /orders/{symbol}/{id}", s.handleQueuePosition)
+	s.mux.HandleFunc("GET /depth/{symbol}", s.handleDepth)
+	s.mux.HandleFunc("GET /ticker/{symbol}", s.handleTicker)
+	s.mux.HandleFunc("GET /trades/{symbol}/stream", s.handleTradeStream)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close stops the trade pumps and ends all trade streams
+// The engines keep running; stop the ExchangeEngine separately.
+func (s *Server) Close() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// engine returns the engine of a served symbol, or writes 404
+func (s *Server) engine(w http.ResponseWriter, symbol string) *matching.MatchingEngine {
+	if _, ok := s.hubs[symbol]; !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown symbol"))
+		return nil
+	}
+	return s.exchange.GetEngine(symbol)
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	order, err := req.toOrder()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	engine := s.engine(w, order.Symbol)
+	if engine == nil {
+		return
+	}
+
+	result, err := engine.SubmitOrderWithResult(order)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, matching.ErrDuplicateOrderID) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newSubmitResponse(order.ID, result))
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	engine := s.engine(w, r.PathValue("symbol"))
+	if engine == nil {
+		return
+	}
+	cancelled, err := engine.CancelOrderSync(r.PathValue("id"))
+	if err == nil && !cancelled {
+		// Unknown or already finished (e.g. a duplicate cancel): nothing was cancelled
+		err = matching.ErrOrderNotFound
+	}
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, matching.ErrOrderNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleQueuePosition(w http.ResponseWriter, r *http.Request) {
+	engine := s.engine(w, r.PathValue("symbol"))
+	if engine == nil {
+		return
+	}
+	ordersAhead, qtyAhead, found := engine.QueuePosition(r.PathValue("id"))
+	if !found {
+		writeError(w, http.StatusNotFound, errors.New("order not resting"))
+		return
+	}
+	writeJSON(w, http.StatusOK, QueuePositionResponse{OrdersAhead: ordersAhead, QuantityAhead: qtyAhead})
+}
+
+func (s *Server) handleDepth(w http.ResponseWriter, r *http.Request) {
+	engine := s.engine(w, r.PathValue("symbol"))
+	if engine == nil {
+		return
+	}
+	levels := 20
+	if v := r.URL.Query().Get("levels"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("levels must be a positive integer"))
+			return
+		}
+		levels = n
+	}
+	depth, err := newDepthResponse(engine, levels)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, depth)
+}
+
+func (s *Server) handleTicker(w http.ResponseWriter, r *http.Request) {
+	engine := s.engine(w, r.PathValue("symbol"))
+	if engine == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, engine.GetTicker())
+}
+
+// handleTradeStream streams trades as Server-Sent Events, one JSON TradeEvent per event
+// The default public feed leaves out trades that aren't domain.Trade.IsPublic; feed=private
+// streams everything. The API has no authentication, so expose the private feed only
+// behind access control.
+func (s *Server) handleTradeStream(w http.ResponseWriter, r *http.Request) {
+	hub, ok := s.hubs[r.PathValue("symbol")]
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown symbol"))
+		return
+	}
+	var private bool
+	switch r.URL.Query().Get("feed") {
+	case "", "public":
+	case "private":
+		private = true
+	default:
+		writeError(w, http.StatusBadRequest, errors.New(`feed must be "public" or "private"`))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+
+	sub := hub.subscribe(private)
+	defer hub.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case event := <-sub:
+			data, _ := json.Marshal(event)
+			if _, err := w.Write(append(append([]byte("data: "), data...), '\n', '\n')); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// tradePollInterval is how long a trade pump sleeps when its buffer is empty
+// The trade buffer only offers non-blocking reads; a short sleep keeps an idle pump cheap.
+const tradePollInterval = time.Millisecond
+
+// pumpTrades drains a symbol's trade buffer, fans trades out and returns them to the pool
+func (s *Server) pumpTrades(consumer *matching.TradeConsumerBatchSafe, hub *tradeHub) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		trades := consumer.ConsumeBatch(128)
+		if len(trades) == 0 {
+			time.Sleep(tradePollInterval)
+			continue
+		}
+		for _, trade := range trades {
+			hub.publish(newTradeEvent(trade), trade.IsPublic())
+			trade.Destroy()
+		}
+	}
+}
+
+// subscriberBuffer is how many trades a slow stream subscriber may fall behind
+const subscriberBuffer = 1024
+
+// tradeHub fans trade events out to stream subscribers
+// Private subscribers get every event, public ones only public trades.
+// A subscriber that falls more than subscriberBuffer events behind misses events
+// rather than stalling the pump (and, through a full trade buffer, the engine).
+type tradeHub struct {
+	mu   sync.Mutex
+	subs map[chan TradeEvent]bool // subscriber -> private
+}
+
+func newTradeHub() *tradeHub {
+	return &tradeHub{subs: make(map[chan TradeEvent]bool)}
+}
+
+func (h *tradeHub) subscribe(private bool) chan TradeEvent {
+	ch := make(chan TradeEvent, subscriberBuffer)
+	h.mu.Lock()
+	h.subs[ch] = private
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *tradeHub) unsubscribe(ch chan TradeEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+func (h *tradeHub) publish(event TradeEvent, public bool) {
+	h.mu.Lock()
+	for ch, private := range h.subs {
+		if !public && !private {
+			continue
+		}
+		select {
+		case ch <- event:
+		default: // slow subscriber: drop
+		}
+	}
+	h.mu.Unlock()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
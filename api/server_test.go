@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"lightning-exchange/matching"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer 启动一个只服务 BTCUSDT 的 HTTP 服务
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	exchange := matching.NewExchangeEngine()
+	server := NewServer(exchange, []string{"BTCUSDT"})
+	ts := httptest.NewServer(server)
+	t.Cleanup(func() {
+		ts.Close()
+		server.Close()
+		if engine, ok := exchange.GetExistingEngine("BTCUSDT"); ok {
+			engine.Stop()
+		}
+	})
+	return ts
+}
+
+// do 发送请求并解码 JSON 响应
+func do(t *testing.T, method, url, body string, out any) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+// TestSubmitQueryCancel 下单、查询深度/排队位置、撤单
+func TestSubmitQueryCancel(t *testing.T) {
+	ts := newTestServer(t)
+
+	var result SubmitResponse
+	status := do(t, "POST", ts.URL+"/orders", `{"id":"S1","symbol":"BTCUSDT","user_id":"u1","side":"sell","price":50000,"quantity":5}`, &result)
+	if status != http.StatusOK || result.Role != "maker" || result.RestedQty != 5 {
+		t.Fatalf("submit: status %d result %+v", status, result)
+	}
+	do(t, "POST", ts.URL+"/orders", `{"id":"S2","symbol":"BTCUSDT","user_id":"u2","side":"sell","price":50000,"quantity":3}`, nil)
+	// 重复的订单 ID 被拒绝，不覆盖已挂的 S2
+	if status := do(t, "POST", ts.URL+"/orders", `{"id":"S2","symbol":"BTCUSDT","user_id":"u3","side":"sell","price":50010,"quantity":9}`, nil); status != http.StatusConflict {
+		t.Fatalf("duplicate order ID: status %d, want 409", status)
+	}
+
+	var depth DepthResponse
+	if status := do(t, "GET", ts.URL+"/depth/BTCUSDT?levels=5", "", &depth); status != http.StatusOK ||
+		len(depth.Asks) != 1 || depth.Asks[0] != (DepthLevel{Price: 50000, Quantity: 8, Orders: 2}) {
+		t.Fatalf("depth: status %d %+v", status, depth)
+	}
+
+	var position QueuePositionResponse
+	if status := do(t, "GET", ts.URL+"/orders/BTCUSDT/S2", "", &position); status != http.StatusOK ||
+		position != (QueuePositionResponse{OrdersAhead: 1, QuantityAhead: 5}) {
+		t.Fatalf("queue position: status %d %+v", status, position)
+	}
+
+	if status := do(t, "DELETE", ts.URL+"/orders/BTCUSDT/S1", "", nil); status != http.StatusNoContent {
+		t.Fatalf("cancel: status %d", status)
+	}
+	if status := do(t, "GET", ts.URL+"/orders/BTCUSDT/S1", "", nil); status != http.StatusNotFound {
+		t.Errorf("cancelled order still found: status %d", status)
+	}
+	// 重复撤单没有撤掉任何订单：404，而不是 204
+	if status := do(t, "DELETE", ts.URL+"/orders/BTCUSDT/S1", "", nil); status != http.StatusNotFound {
+		t.Errorf("duplicate cancel: status %d, want 404", status)
+	}
+
+	// 请求校验与未知交易对
+	var apiErr ErrorResponse
+	if status := do(t, "POST", ts.URL+"/orders", `{"id":"B1","symbol":"BTCUSDT","user_id":"u","side":"up","price":1,"quantity":1}`, &apiErr); status != http.StatusBadRequest || apiErr.Error == "" {
+		t.Errorf("bad side: status %d %+v", status, apiErr)
+	}
+	if status := do(t, "POST", ts.URL+"/orders", `{"id":"B1","symbol":"ETHUSDT","user_id":"u","side":"buy","price":1,"quantity":1}`, nil); status != http.StatusNotFound {
+		t.Errorf("unknown symbol: status %d", status)
+	}
+}
+
+// TestTradeStream 成交通过 SSE 推送给订阅者
+func TestTradeStream(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/trades/BTCUSDT/stream")
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+
+	do(t, "POST", ts.URL+"/orders", `{"id":"S1","symbol":"BTCUSDT","user_id":"u1","side":"sell","price":50000,"quantity":5}`, nil)
+	var result SubmitResponse
+	do(t, "POST", ts.URL+"/orders", `{"id":"B1","symbol":"BTCUSDT","user_id":"u2","side":"buy","type":"market","quantity":2}`, &result)
+	if result.Role != "taker" || result.TakenQty != 2 {
+		t.Fatalf("market buy result %+v", result)
+	}
+
+	events := make(chan TradeEvent, 1)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data: ")); ok {
+				var event TradeEvent
+				json.Unmarshal(line, &event)
+				events <- event
+				return
+			}
+		}
+	}()
+	select {
+	case event := <-events:
+		if event.Price != 50000 || event.Quantity != 2 || event.BuyOrderID != "B1" || event.SellOrderID != "S1" {
+			t.Errorf("unexpected trade event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no trade event received")
+	}
+}
+
+// TestTradeStreamVisibility 自成交只出现在私有流，公共流只推送公开成交
+func TestTradeStreamVisibility(t *testing.T) {
+	ts := newTestServer(t)
+
+	subscribe := func(query string) <-chan TradeEvent {
+		resp, err := http.Get(ts.URL + "/trades/BTCUSDT/stream" + query)
+		if err != nil {
+			t.Fatalf("subscribe %q: %v", query, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("subscribe %q: status %d", query, resp.StatusCode)
+		}
+		events := make(chan TradeEvent, 16)
+		go func() {
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if line, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data: ")); ok {
+					var event TradeEvent
+					json.Unmarshal(line, &event)
+					events <- event
+				}
+			}
+		}()
+		return events
+	}
+	next := func(events <-chan TradeEvent, feed string) TradeEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: no trade event received", feed)
+			return TradeEvent{}
+		}
+	}
+
+	public := subscribe("")
+	private := subscribe("?feed=private")
+
+	// 默认 STPNone：u1 与自己成交，随后 u2 正常成交
+	do(t, "POST", ts.URL+"/orders", `{"id":"S1","symbol":"BTCUSDT","user_id":"u1","side":"sell","price":50000,"quantity":5}`, nil)
+	do(t, "POST", ts.URL+"/orders", `{"id":"B1","symbol":"BTCUSDT","user_id":"u1","side":"buy","price":50000,"quantity":2}`, nil)
+	do(t, "POST", ts.URL+"/orders", `{"id":"B2","symbol":"BTCUSDT","user_id":"u2","side":"buy","price":50000,"quantity":3}`, nil)
+
+	if event := next(private, "private"); event.BuyOrderID != "B1" || !event.SelfMatch {
+		t.Errorf("private first event %+v, want self-match B1", event)
+	}
+	if event := next(private, "private"); event.BuyOrderID != "B2" || event.SelfMatch {
+		t.Errorf("private second event %+v, want public B2", event)
+	}
+	if event := next(public, "public"); event.BuyOrderID != "B2" || event.SelfMatch {
+		t.Errorf("public first event %+v, want B2 (self-match filtered)", event)
+	}
+
+	if status := do(t, "GET", ts.URL+"/trades/BTCUSDT/stream?feed=all", "", nil); status != http.StatusBadRequest {
+		t.Errorf("unknown feed: status %d", status)
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"lightning-exchange/domain"
+	"strconv"
+	"time"
+)
+
+// TradeFormatter serializes trades for export (audit logs, downstream interop)
+// Format must not retain trade: trades come from a pool and are recycled after Destroy.
+type TradeFormatter interface {
+	Format(trade *domain.Trade) ([]byte, error)
+}
+
+var (
+	_ TradeFormatter = JSONTradeFormatter{}
+	_ TradeFormatter = FIXTradeFormatter{}
+)
+
+// TradeRecord is the complete JSON form of a trade written by JSONTradeFormatter
+// Unlike TradeEvent (the public stream) it carries the private fields too: user IDs,
+// tags and the raw visibility flags.
+type TradeRecord struct {
+	ID           string            `json:"id"`
+	Symbol       string            `json:"symbol"`
+	Price        int64             `json:"price"`
+	Quantity     int64             `json:"quantity"`
+	BuyOrderID   string            `json:"buy_order_id"`
+	SellOrderID  string            `json:"sell_order_id"`
+	BuyUserID    string            `json:"buy_user_id"`
+	SellUserID   string            `json:"sell_user_id"`
+	IsBuyerMaker bool              `json:"is_buyer_maker"`
+	Timestamp    time.Time         `json:"timestamp"`
+	Seq          int64             `json:"seq"`
+	Visibility   domain.Visibility `json:"visibility,omitempty"`
+	TakerTag     string            `json:"taker_tag,omitempty"`
+	MakerTag     string            `json:"maker_tag,omitempty"`
+}
+
+// NewTradeRecord copies every field of a trade
+func NewTradeRecord(trade *domain.Trade) TradeRecord {
+	return TradeRecord{
+		ID:           trade.ID,
+		Symbol:       trade.Symbol,
+		Price:        trade.Price,
+		Quantity:     trade.Quantity,
+		BuyOrderID:   trade.BuyOrderID,
+		SellOrderID:  trade.SellOrderID,
+		BuyUserID:    trade.BuyUserID,
+		SellUserID:   trade.SellUserID,
+		IsBuyerMaker: trade.IsBuyerMaker,
+		Timestamp:    trade.Timestamp,
+		Seq:          trade.Seq,
+		Visibility:   trade.Visibility,
+		TakerTag:     trade.TakerTag,
+		MakerTag:     trade.MakerTag,
+	}
+}
+
+// JSONTradeFormatter writes a trade as one TradeRecord JSON object (no trailing newline)
+type JSONTradeFormatter struct{}
+
+// Format implements TradeFormatter
+func (JSONTradeFormatter) Format(trade *domain.Trade) ([]byte, error) {
+	return json.Marshal(NewTradeRecord(trade))
+}
+
+// FIX tags written by FIXTradeFormatter: standard TradeCaptureReport tags where FIX has
+// one, user-defined tags (20000+) for the engine's own fields
+const (
+	fixMsgType      = 35    // AE = TradeCaptureReport
+	fixLastPx       = 31    // Trade price
+	fixLastQty      = 32    // Trade quantity
+	fixOrderID      = 37    // The side's order ID
+	fixSide         = 54    // 1 = buy, 2 = sell
+	fixSymbol       = 55    // Symbol
+	fixTransactTime = 60    // Trade time, UTC with nanoseconds (fixTimeLayout)
+	fixPartyID      = 448   // The side's UserID
+	fixNoSides      = 552   // Always 2: buy side, then sell side
+	fixTradeID      = 1003  // Trade ID
+	fixAggressor    = 1057  // Y = taker, N = maker
+	fixBookSeq      = 20001 // Trade.Seq
+	fixVisibility   = 20002 // Trade.Visibility bits, omitted when public
+	fixOrderTag     = 20003 // The side's order Tag, omitted when empty
+)
+
+// fixTimeLayout is FIX UTCTimestamp with nanosecond precision
+const fixTimeLayout = "20060102-15:04:05.000000000"
+
+// FIXTradeFormatter writes a trade as FIX-style tag=value fields, each followed by Delimiter
+// Laid out like a TradeCaptureReport (35=AE) with a two-entry side group, buy side first.
+// It is not a session-level FIX message: there is no header, body length or checksum.
+type FIXTradeFormatter struct {
+	Delimiter byte // Field separator; 0 = SOH (0x01), '|' is common for logs
+}
+
+// Format implements TradeFormatter
+func (f FIXTradeFormatter) Format(trade *domain.Trade) ([]byte, error) {
+	delim := f.Delimiter
+	if delim == 0 {
+		delim = 0x01
+	}
+	b := make([]byte, 0, 256)
+	field := func(tag int, value string) {
+		b = strconv.AppendInt(b, int64(tag), 10)
+		b = append(b, '=')
+		b = append(b, value...)
+		b = append(b, delim)
+	}
+	yesNo := func(v bool) string {
+		if v {
+			return "Y"
+		}
+		return "N"
+	}
+	buyerTag, sellerTag := trade.TakerTag, trade.MakerTag
+	if trade.IsBuyerMaker {
+		buyerTag, sellerTag = sellerTag, buyerTag
+	}
+
+	field(fixMsgType, "AE")
+	field(fixTradeID, trade.ID)
+	field(fixSymbol, trade.Symbol)
+	field(fixLastPx, strconv.FormatInt(trade.Price, 10))
+	field(fixLastQty, strconv.FormatInt(trade.Quantity, 10))
+	field(fixTransactTime, trade.Timestamp.UTC().Format(fixTimeLayout))
+	field(fixBookSeq, strconv.FormatInt(trade.Seq, 10))
+	if trade.Visibility != 0 {
+		field(fixVisibility, strconv.Itoa(int(trade.Visibility)))
+	}
+
+	field(fixNoSides, "2")
+	sides := []struct {
+		side, orderID, userID, tag string
+		aggressor                  bool
+	}{
+		{"1", trade.BuyOrderID, trade.BuyUserID, buyerTag, !trade.IsBuyerMaker},
+		{"2", trade.SellOrderID, trade.SellUserID, sellerTag, trade.IsBuyerMaker},
+	}
+	for _, s := range sides {
+		field(fixSide, s.side)
+		field(fixOrderID, s.orderID)
+		field(fixPartyID, s.userID)
+		field(fixAggressor, yesNo(s.aggressor))
+		if s.tag != "" {
+			field(fixOrderTag, s.tag)
+		}
+	}
+	return b, nil
+}
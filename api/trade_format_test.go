@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"lightning-exchange/domain"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+// sampleTrade 覆盖所有字段的成交：卖方为 taker，带标签和可见性标记
+func sampleTrade() *domain.Trade {
+	return &domain.Trade{
+		ID:           "T42",
+		Symbol:       "BTCUSDT",
+		Price:        50010,
+		Quantity:     7,
+		Timestamp:    time.Date(2024, 1, 2, 9, 30, 0, 123456789, time.UTC),
+		IsBuyerMaker: true,
+		Visibility:   domain.VisibilityHidden,
+		BuyOrderID:   "B1",
+		SellOrderID:  "S9",
+		BuyUserID:    "maker-1",
+		SellUserID:   "taker-2",
+		Seq:          1024,
+		TakerTag:     "algo-7",
+		MakerTag:     "mm",
+	}
+}
+
+// TestJSONTradeFormatterRoundTrip JSON 导出后解析回来字段完全一致
+func TestJSONTradeFormatterRoundTrip(t *testing.T) {
+	trade := sampleTrade()
+	data, err := JSONTradeFormatter{}.Format(trade)
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	var record TradeRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	want := NewTradeRecord(trade)
+	if !record.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("timestamp %v, want %v", record.Timestamp, want.Timestamp)
+	}
+	record.Timestamp = want.Timestamp
+	if record != want {
+		t.Errorf("round trip:\n got %+v\nwant %+v", record, want)
+	}
+}
+
+// TestFIXTradeFormatterGolden FIX 风格输出与 golden 文件一致（go test -update 重新生成）
+func TestFIXTradeFormatterGolden(t *testing.T) {
+	got, err := FIXTradeFormatter{Delimiter: '|'}.Format(sampleTrade())
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	got = append(got, '\n')
+
+	golden := filepath.Join("testdata", "trade_fix.golden")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("FIX output differs from %s:\n got %s\nwant %s", golden, got, want)
+	}
+
+	// 默认分隔符为 SOH
+	soh, _ := FIXTradeFormatter{}.Format(sampleTrade())
+	if !bytes.Equal(soh, bytes.ReplaceAll(got[:len(got)-1], []byte("|"), []byte{0x01})) {
+		t.Errorf("default delimiter is not SOH: %q", soh)
+	}
+}
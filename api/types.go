@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"lightning-exchange/domain"
+	"lightning-exchange/matching"
+	"lightning-exchange/orderbook"
+	"time"
+)
+
+// OrderRequest is the JSON body of POST /orders
+type OrderRequest struct {
+	ID          string `json:"id"`
+	Symbol      string `json:"symbol"`
+	UserID      string `json:"user_id"`
+	SessionID   string `json:"session_id,omitempty"`
+	Side        string `json:"side"`                    // "buy" | "sell"
+	Type        string `json:"type,omitempty"`          // "limit" (default) | "market"
+	TimeInForce string `json:"time_in_force,omitempty"` // "GTC" (default) | "IOC"
+	Price       int64  `json:"price,omitempty"`         // ticks; required for limit orders
+	Quantity    int64  `json:"quantity"`
+	Tag         string `json:"tag,omitempty"` // opaque, copied onto the order's trades
+}
+
+// toOrder validates the request and builds a pooled domain.Order
+func (req OrderRequest) toOrder() (*domain.Order, error) {
+	if req.ID == "" || req.Symbol == "" || req.UserID == "" {
+		return nil, errors.New("id, symbol and user_id are required")
+	}
+	if req.Quantity <= 0 {
+		return nil, errors.New("quantity must be positive")
+	}
+
+	var side domain.Side
+	switch req.Side {
+	case "buy":
+		side = domain.SideBuy
+	case "sell":
+		side = domain.SideSell
+	default:
+		return nil, errors.New(`side must be "buy" or "sell"`)
+	}
+
+	orderType := domain.OrderTypeLimit
+	switch req.Type {
+	case "", "limit":
+		if req.Price <= 0 {
+			return nil, errors.New("limit orders need a positive price")
+		}
+	case "market":
+		orderType = domain.OrderTypeMarket
+	default:
+		return nil, errors.New(`type must be "limit" or "market"`)
+	}
+
+	tif := domain.TimeInForceGTC
+	switch req.TimeInForce {
+	case "", "GTC":
+	case "IOC":
+		tif = domain.TimeInForceIOC
+	default:
+		return nil, errors.New(`time_in_force must be "GTC" or "IOC"`)
+	}
+
+	order := domain.NewLimitOrder(req.ID, req.Symbol, req.UserID, side, req.Price, req.Quantity)
+	order.Type = orderType
+	order.TimeInForce = tif
+	order.SessionID = req.SessionID
+	order.Tag = req.Tag
+	return order, nil
+}
+
+// SubmitResponse is the outcome of POST /orders
+type SubmitResponse struct {
+	ID        string `json:"id"`
+	Role      string `json:"role"` // "taker" | "maker" | "both" | "none"
+	Trades    int    `json:"trades"`
+	TakenQty  int64  `json:"taken_qty"`
+	RestedQty int64  `json:"rested_qty"`
+}
+
+func newSubmitResponse(id string, result matching.SubmitResult) SubmitResponse {
+	return SubmitResponse{
+		ID:        id,
+		Role:      roleNames[result.Role],
+		Trades:    result.Trades,
+		TakenQty:  result.TakenQty,
+		RestedQty: result.RestedQty,
+	}
+}
+
+var roleNames = map[matching.MakerTaker]string{
+	matching.RoleNone:  "none",
+	matching.RoleTaker: "taker",
+	matching.RoleMaker: "maker",
+	matching.RoleBoth:  "both",
+}
+
+// QueuePositionResponse is the result of GET /orders/{symbol}/{id}
+type QueuePositionResponse struct {
+	OrdersAhead   int   `json:"orders_ahead"`
+	QuantityAhead int64 `json:"quantity_ahead"`
+}
+
+// DepthLevel is one aggregated price level
+type DepthLevel struct {
+	Price    int64 `json:"price"`
+	Quantity int64 `json:"quantity"`
+	Orders   int   `json:"orders"`
+}
+
+// DepthResponse is the result of GET /depth/{symbol}
+// Seq orders it against the trade stream: trades with a greater seq are not yet reflected.
+type DepthResponse struct {
+	Seq  int64        `json:"seq"`
+	Bids []DepthLevel `json:"bids"`
+	Asks []DepthLevel `json:"asks"`
+}
+
+// newDepthResponse reads both sides in one consistent view on the matching thread
+func newDepthResponse(engine *matching.MatchingEngine, levels int) (DepthResponse, error) {
+	var bids, asks []orderbook.PriceLevel
+	var seq int64
+	err := engine.WithFrozenView(func(book orderbook.ReadOnlyBook) {
+		bids, asks = book.GetDepth(levels)
+		seq = book.Seq()
+	})
+	return DepthResponse{Seq: seq, Bids: toDepthLevels(bids), Asks: toDepthLevels(asks)}, err
+}
+
+func toDepthLevels(levels []orderbook.PriceLevel) []DepthLevel {
+	out := make([]DepthLevel, len(levels))
+	for i, level := range levels {
+		out[i] = DepthLevel{Price: level.Price, Quantity: level.Quantity, Orders: level.Orders}
+	}
+	return out
+}
+
+// TradeEvent is one trade on the stream
+type TradeEvent struct {
+	ID           string    `json:"id"`
+	Symbol       string    `json:"symbol"`
+	Price        int64     `json:"price"`
+	Quantity     int64     `json:"quantity"`
+	BuyOrderID   string    `json:"buy_order_id"`
+	SellOrderID  string    `json:"sell_order_id"`
+	IsBuyerMaker bool      `json:"is_buyer_maker"`
+	Timestamp    time.Time `json:"timestamp"`
+	Seq          int64     `json:"seq"`
+
+	// Why the trade is off the public tape; only ever set on the private feed
+	SelfMatch bool `json:"self_match,omitempty"`
+	Hidden    bool `json:"hidden,omitempty"`
+}
+
+// newTradeEvent copies a trade so the pooled original can be destroyed
+func newTradeEvent(trade *domain.Trade) TradeEvent {
+	return TradeEvent{
+		ID:           trade.ID,
+		Symbol:       trade.Symbol,
+		Price:        trade.Price,
+		Quantity:     trade.Quantity,
+		BuyOrderID:   trade.BuyOrderID,
+		SellOrderID:  trade.SellOrderID,
+		IsBuyerMaker: trade.IsBuyerMaker,
+		Timestamp:    trade.Timestamp,
+		Seq:          trade.Seq,
+		SelfMatch:    trade.Visibility&domain.VisibilitySelfMatch != 0,
+		Hidden:       trade.Visibility&domain.VisibilityHidden != 0,
+	}
+}
+
+// ErrorResponse is the body of every non-2xx response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -1,134 +1,76 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"lightning-exchange/domain"
 	"lightning-exchange/matching"
+	"lightning-exchange/orderbook"
+	"lightning-exchange/orderflow"
 	"runtime"
-	"sync/atomic"
 	"time"
 )
 
 func main() {
-	fmt.Println("=== 交易所撮合系统性能测试 ===")
-
-	// 创建撮合引擎
-	engine := matching.NewMatchingEngine("BTCUSDT")
-	engine.Start()
-	defer engine.Stop()
-
-	// 测试参数
-	testDuration := 5 * time.Second
-	numCPU := runtime.NumCPU()
-	numWorkers := numCPU - 2 // 1 个给撮合线程，1 个给系统/GC
-	if numWorkers < 1 {
-		numWorkers = 1
-	}
-
-	var (
-		orderCount atomic.Int64
-		tradeCount atomic.Int64
-	)
-
-	// 消费 trades（使用 Disruptor）
-	go func() {
-		tradeBuffer := engine.GetTradeBuffer()
-		consumer := tradeBuffer.NewTradeConsumerBatchSafe()
-		for {
-			trade, ok := consumer.TryConsume()
-			if ok && trade != nil {
-				trade.Destroy() // 归还到对象池
-				tradeCount.Add(1)
-			} else {
-				runtime.Gosched()
-			}
-		}
-	}()
-
-	fmt.Printf("开始测试...\n")
-	fmt.Printf("CPU 核心数: %d\n", numCPU)
-	fmt.Printf("生产者数量: %d (NumCPU - 2)\n", numWorkers)
-	fmt.Printf("测试时长: %v\n\n", testDuration)
-
-	startTime := time.Now()
-	stopChan := make(chan struct{})
-
-	// 启动多个生产者
-	for w := 0; w < numWorkers; w++ {
-		go func(workerID int) {
-			orderID := 0
-			for {
-				select {
-				case <-stopChan:
-					return
-				default:
-					// 交替发送买单和卖单，价格有重叠以产生成交
-					var side domain.Side
-					var price int64
-					if orderID%2 == 0 {
-						side = domain.SideBuy
-						price = 50000 + int64(orderID%200) // 买单：50000-50199
-					} else {
-						side = domain.SideSell
-						price = 50000 + int64(orderID%200) // 卖单：50000-50199（价格重叠）
-					}
+	// 订单流参数：相同参数 + 相同种子 => 完全相同的订单序列，便于跨版本对比
+	flow := orderflow.DefaultConfig()
+	flag.Int64Var(&flow.Seed, "seed", flow.Seed, "随机种子（第 i 个生产者使用 seed+i）")
+	flag.Int64Var(&flow.MidPrice, "mid", flow.MidPrice, "限价单价格分布中心")
+	flag.Float64Var(&flow.PriceStdDev, "stddev", flow.PriceStdDev, "限价单价格标准差（tick）")
+	flag.Float64Var(&flow.MarketRatio, "market", flow.MarketRatio, "市价单比例")
+	flag.Float64Var(&flow.CancelRatio, "cancel", flow.CancelRatio, "撤单比例")
+	flag.Float64Var(&flow.MeanSize, "size", flow.MeanSize, "平均订单数量")
+	flag.IntVar(&flow.Users, "users", flow.Users, "用户数")
+	testDuration := flag.Duration("duration", 5*time.Second, "测试时长")
+	producers := flag.Int("producers", 0, "生产者数量（0 = NumCPU - 2）")
+	orderBuf := flag.Int("orderbuf", 0, "订单 RingBuffer 大小（2 的幂，0 = 默认 64K）")
+	tradeBuf := flag.Int("tradebuf", 0, "成交 RingBuffer 大小（2 的幂，0 = 默认 64K）")
+	flag.Parse()
 
-					order := domain.NewLimitOrder(
-						fmt.Sprintf("w%d-order-%d", workerID, orderID),
-						"BTCUSDT",
-						fmt.Sprintf("user-%d", workerID),
-						side,
-						price,
-						1,
-					)
-					engine.SubmitOrder(order)
-					orderCount.Add(1)
-					orderID++
-				}
-			}
-		}(w)
-	}
+	fmt.Println("=== 交易所撮合系统性能测试 ===")
 
-	// 实时显示进度
-	ticker := time.NewTicker(1 * time.Second)
-	go func() {
-		for range ticker.C {
-			elapsed := time.Since(startTime)
-			orders := orderCount.Load()
-			trades := tradeCount.Load()
+	cfg := matching.BenchConfig{
+		Duration:        *testDuration,
+		Producers:       *producers,
+		OrderBufferSize: *orderBuf,
+		TradeBufferSize: *tradeBuf,
+		Flow:            flow,
+		// 实时显示进度
+		Progress: func(elapsed time.Duration, orders, trades int64) {
 			qps := float64(orders) / elapsed.Seconds()
 			tps := float64(trades) / elapsed.Seconds()
 			fmt.Printf("[%.0fs] 订单: %d (%.0f/s) | 成交: %d (%.0f/s)\n",
 				elapsed.Seconds(), orders, qps, trades, tps)
-		}
-	}()
-
-	// 等待测试时间
-	time.Sleep(testDuration)
-	close(stopChan)
-	ticker.Stop()
+		},
+	}
+	numWorkers := cfg.Producers
+	if numWorkers <= 0 {
+		numWorkers = max(runtime.NumCPU()-2, 1) // 1 个给撮合线程，1 个给系统/GC
+	}
 
-	// 等待处理完成
-	time.Sleep(500 * time.Millisecond)
+	fmt.Printf("开始测试...\n")
+	fmt.Printf("CPU 核心数: %d\n", runtime.NumCPU())
+	fmt.Printf("生产者数量: %d\n", numWorkers)
+	fmt.Printf("测试时长: %v\n", *testDuration)
+	fmt.Printf("订单流: seed=%d mid=%d stddev=%.1f market=%.2f cancel=%.2f size=%.1f users=%d\n\n",
+		flow.Seed, flow.MidPrice, flow.PriceStdDev, flow.MarketRatio, flow.CancelRatio, flow.MeanSize, flow.Users)
 
-	elapsed := time.Since(startTime)
-	totalOrders := orderCount.Load()
-	totalTrades := tradeCount.Load()
+	result := matching.BenchmarkThroughput(cfg)
 
 	// 计算性能指标
-	qps := float64(totalOrders) / elapsed.Seconds()
-	tps := float64(totalTrades) / elapsed.Seconds()
-	avgLatency := elapsed.Seconds() * 1e6 / float64(totalOrders)
-	matchRate := float64(totalTrades) / float64(totalOrders) * 100
+	qps := result.QPS
+	avgLatency := result.Elapsed.Seconds() * 1e6 / float64(result.Orders)
+	matchRate := float64(result.Trades) / float64(result.Orders) * 100
 
 	// 输出结果
 	fmt.Println("\n=== 性能测试结果 ===")
-	fmt.Printf("测试时长:     %v\n", elapsed)
-	fmt.Printf("总订单数:     %d\n", totalOrders)
-	fmt.Printf("总成交数:     %d\n", totalTrades)
+	fmt.Printf("测试时长:     %v\n", result.Elapsed)
+	fmt.Printf("总订单数:     %d\n", result.Orders)
+	fmt.Printf("总成交数:     %d\n", result.Trades)
 	fmt.Printf("订单吞吐量:   %.0f orders/sec\n", qps)
-	fmt.Printf("成交吞吐量:   %.0f trades/sec\n", tps)
+	fmt.Printf("成交吞吐量:   %.0f trades/sec\n", result.TPS)
 	fmt.Printf("平均延迟:     %.2f μs/order\n", avgLatency)
+	fmt.Printf("延迟分位:     P50 %v | P99 %v | P99.9 %v | Max %v (%d 个采样)\n",
+		result.LatencyP50, result.LatencyP99, result.LatencyP999, result.LatencyMax, result.LatencySamples)
 	fmt.Printf("撮合率:       %.2f%%\n", matchRate)
 
 	// 性能评级
@@ -146,21 +88,27 @@ func main() {
 	}
 
 	// 订单簿状态
-	orderBook := engine.GetOrderBook()
 	fmt.Println("\n=== 订单簿状态 ===")
-	fmt.Printf("最佳买价:     %d\n", orderBook.GetBestBid())
-	fmt.Printf("最佳卖价:     %d\n", orderBook.GetBestAsk())
+	fmt.Printf("最佳买价:     %d\n", bestPrice(result.Bids))
+	fmt.Printf("最佳卖价:     %d\n", bestPrice(result.Asks))
 
-	bids, asks := orderBook.GetDepth(5)
 	fmt.Println("\n买单深度 (前5档):")
-	for i, level := range bids {
+	for i, level := range result.Bids {
 		fmt.Printf("  %d. 价格: %d, 数量: %d, 订单数: %d\n",
 			i+1, level.Price, level.Quantity, level.Orders)
 	}
 
 	fmt.Println("\n卖单深度 (前5档):")
-	for i, level := range asks {
+	for i, level := range result.Asks {
 		fmt.Printf("  %d. 价格: %d, 数量: %d, 订单数: %d\n",
 			i+1, level.Price, level.Quantity, level.Orders)
 	}
 }
+
+// bestPrice 返回深度第一档价格（空则为 0）
+func bestPrice(levels []orderbook.PriceLevel) int64 {
+	if len(levels) == 0 {
+		return 0
+	}
+	return levels[0].Price
+}
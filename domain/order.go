@@ -19,8 +19,37 @@ type OrderType int
 const (
 	OrderTypeLimit OrderType = iota
 	OrderTypeMarket
+	OrderTypeStop // market order once the last trade price moves through TriggerPrice
+	OrderTypeMIT  // market-if-touched: market order once the price comes back to TriggerPrice
 )
 
+// TimeInForce controls what happens to the unfilled remainder of a limit order
+type TimeInForce int
+
+const (
+	TimeInForceGTC TimeInForce = iota // good-till-cancel: remainder rests in the book (default)
+	TimeInForceIOC                    // immediate-or-cancel: remainder is cancelled after matching
+)
+
+// ExecInst is a set of execution instructions carried by an order (bitfield)
+// One field instead of a bool per instruction keeps Order compact; a new instruction
+// takes the next free bit. Combine with |, test with Has.
+type ExecInst uint16
+
+const (
+	ExecPostOnly  ExecInst = 1 << iota // must add liquidity: rejected if it would trade on arrival
+	ExecAllOrNone                      // trades only if completely filled on arrival, else cancelled untraded
+	ExecHidden                         // rests without being shown in public depth
+	ExecLastLook                       // maker may veto matches via the engine's last-look handler
+	ExecMidpoint                       // resting: trades at the displayed BBO midpoint, not its own price (dark pool)
+	ExecTopLevelOnly                   // market: fills only if the best opposite level alone covers it, else cancelled untraded
+)
+
+// Has reports whether every instruction in inst is set
+func (e ExecInst) Has(inst ExecInst) bool {
+	return e&inst == inst
+}
+
 // OrderStatus represents the current status of an order
 type OrderStatus int
 
@@ -29,6 +58,8 @@ const (
 	OrderStatusPartialFilled
 	OrderStatusFilled
 	OrderStatusCancelled
+	OrderStatusExpired
+	OrderStatusRejected
 )
 
 // Order represents a trading order
@@ -39,7 +70,7 @@ const (
 type Order struct {
 	// Hot fields (frequently accessed during matching) - first 64 bytes (one cache line)
 	ID          string      // 16 bytes (string header)
-	Price       int64       // 8 bytes
+	Price       Price       // 8 bytes
 	Quantity    int64       // 8 bytes
 	Filled      int64       // 8 bytes
 	Side        Side        // 8 bytes (enum stored as int64)
@@ -51,6 +82,23 @@ type Order struct {
 	// Cold fields: accessed only during creation/logging (second cache line)
 	UserID    string    // 16 bytes - user who placed the order
 	Timestamp time.Time // 24 bytes - order placement time
+	Synthetic bool      // 1 byte - seeded from an L2 snapshot, not real order flow (provenance, not an instruction)
+	ExecInst  ExecInst  // 2 bytes - execution instruction bits (PostOnly, AllOrNone, Hidden, LastLook, ...)
+	ExpireAt  time.Time // 24 bytes - good-till-date expiry (zero = good-till-cancel)
+	SessionID string    // 16 bytes - client connection; "" = not tied to a session (no cancel-on-disconnect)
+	Tag       string    // 16 bytes - opaque client tag (strategy ID, routing hint), copied onto the order's trades
+
+	TriggerPrice Price       // 8 bytes - activation price for OrderTypeStop / OrderTypeMIT
+	TimeInForce  TimeInForce // 8 bytes - GTC rests the remainder, IOC cancels it
+
+	// Market orders: stop sweeping once prices get worse than the best opposite price at
+	// arrival by more than this many basis points, cancelling the remainder (0 = unlimited)
+	MaxSlippageBps int64 // 8 bytes
+
+	// Iceberg: only a slice of the order is displayed at a time; see IsIceberg
+	DisplayQty    int64 // 8 bytes - visible slice size (0 = not an iceberg)
+	DisplayQtyMax int64 // 8 bytes - if > DisplayQty, each slice is drawn at random from [DisplayQty, DisplayQtyMax]
+	ShownQty      int64 // 8 bytes - quantity left in the current visible slice (maintained by the order book)
 }
 
 // can replace by zero gc lib, but it's enough I think
@@ -63,7 +111,7 @@ func init() {
 }
 
 // NewLimitOrder creates a new limit order
-func NewLimitOrder(id, symbol, userID string, side Side, price, quantity int64) *Order {
+func NewLimitOrder(id, symbol, userID string, side Side, price Price, quantity int64) *Order {
 	order := orderPool.Get().(*Order)
 	order.ID = id
 	order.Symbol = symbol
@@ -78,6 +126,38 @@ func NewLimitOrder(id, symbol, userID string, side Side, price, quantity int64)
 	return order
 }
 
+// IsPostOnly reports whether the order must only add liquidity
+func (o *Order) IsPostOnly() bool { return o.ExecInst.Has(ExecPostOnly) }
+
+// IsAllOrNone reports whether the order must fill completely on arrival or not at all
+func (o *Order) IsAllOrNone() bool { return o.ExecInst.Has(ExecAllOrNone) }
+
+// IsHidden reports whether the order is excluded from public depth while resting
+func (o *Order) IsHidden() bool { return o.ExecInst.Has(ExecHidden) }
+
+// IsLastLook reports whether the order's matches are offered to the last-look handler
+func (o *Order) IsLastLook() bool { return o.ExecInst.Has(ExecLastLook) }
+
+// IsMidpoint reports whether the order executes at the displayed midpoint when matched while resting
+func (o *Order) IsMidpoint() bool { return o.ExecInst.Has(ExecMidpoint) }
+
+// IsTopLevelOnly reports whether the order must fill completely at the best opposite level or not at all
+func (o *Order) IsTopLevelOnly() bool { return o.ExecInst.Has(ExecTopLevelOnly) }
+
+// IsIceberg reports whether the order displays only a slice (DisplayQty) of its quantity
+// The hidden reserve refills the slice each time it is consumed, at the back of the
+// price level's queue: a resting iceberg trades one slice per pass through the queue.
+func (o *Order) IsIceberg() bool { return o.DisplayQty > 0 }
+
+// MatchableQuantity returns how much of a resting order can trade right now:
+// the current slice for an iceberg, the whole remainder otherwise
+func (o *Order) MatchableQuantity() int64 {
+	if o.IsIceberg() {
+		return o.ShownQty
+	}
+	return o.RemainingQuantity()
+}
+
 // IsFilled returns true if the order is fully filled
 func (o *Order) IsFilled() bool {
 	return o.Filled >= o.Quantity
@@ -103,6 +183,11 @@ func (o *Order) Cancel() {
 	o.Status = OrderStatusCancelled
 }
 
+// Expire marks the order as expired (good-till-date reached)
+func (o *Order) Expire() {
+	o.Status = OrderStatusExpired
+}
+
 func (o *Order) Destroy() {
 	o.Reset()
 	orderPool.Put(o)
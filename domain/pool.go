@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// TrimPools drops every idle Order and Trade held by the object pools and returns
+// the freed memory to the OS
+//
+// sync.Pool only releases objects after two GC cycles (primary -> victim cache -> freed),
+// so after a burst the pools can pin a large number of objects until GC happens to run
+// twice. TrimPools forces both cycles immediately, then scavenges the heap.
+//
+// Cost: two full GCs (and it empties every sync.Pool in the process, not just these).
+// Call it from an idle period after a burst, never from the matching hot path.
+func TrimPools() {
+	runtime.GC()         // pooled objects move to the victim cache
+	debug.FreeOSMemory() // second GC frees the victim cache, then returns memory to the OS
+}
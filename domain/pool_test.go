@@ -0,0 +1,19 @@
+package domain
+
+import "testing"
+
+// TestTrimPools 清理后对象池不再返回清理前放回的对象，下一次 Get 得到新对象
+func TestTrimPools(t *testing.T) {
+	// 直接放回带标记的对象：Destroy 会先 Reset，无法区分新旧
+	orderPool.Put(&Order{ID: "pooled"})
+	tradePool.Put(&Trade{ID: "pooled"})
+
+	TrimPools()
+
+	if order := orderPool.Get().(*Order); order.ID == "pooled" {
+		t.Error("order pool returned an object pooled before TrimPools")
+	}
+	if trade := tradePool.Get().(*Trade); trade.ID == "pooled" {
+		t.Error("trade pool returned an object pooled before TrimPools")
+	}
+}
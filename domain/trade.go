@@ -8,16 +8,17 @@ import (
 // Trade represents a matched trade between two orders
 // Memory layout optimization: Hot fields (frequently accessed during persistence/broadcast)
 // are placed in the first CPU cache line (64 bytes) to improve cache hit rate.
-// Cache line 1 (64 bytes): Price, Quantity, Timestamp, Symbol, IsBuyerMaker
+// Cache line 1 (64 bytes): Price, Quantity, Timestamp, Symbol, IsBuyerMaker, Visibility
 // Cache line 2 (64 bytes): ID, BuyOrderID, SellOrderID, BuyUserID, SellUserID
 type Trade struct {
 	// Hot fields: accessed during persistence and broadcast (first 64 bytes)
-	Price     int64     // 8 bytes - trade execution price
+	Price     Price     // 8 bytes - trade execution price
 	Quantity  int64     // 8 bytes - trade quantity
 	Timestamp time.Time // 24 bytes - trade execution time
 	Symbol    string    // 16 bytes - trading pair
 	IsBuyerMaker bool   // 1 byte - maker/taker flag (padded to 8 bytes)
-	_         [7]byte   // 7 bytes - explicit padding for clarity
+	Visibility Visibility // 1 byte - public tape flags (0 = public)
+	_         [6]byte   // 6 bytes - explicit padding for clarity
 	
 	// Cold fields: accessed only for logging/audit (second cache line)
 	ID          string // 16 bytes - unique trade ID
@@ -25,6 +26,36 @@ type Trade struct {
 	SellOrderID string // 16 bytes - sell order ID
 	BuyUserID   string // 16 bytes - buyer user ID
 	SellUserID  string // 16 bytes - seller user ID
+	Seq         int64  // 8 bytes - book sequence after this fill (orders trades against depth snapshots)
+	TakerTag    string // 16 bytes - taker order's Tag (post-trade attribution)
+	MakerTag    string // 16 bytes - maker order's Tag
+}
+
+// Visibility flags why a trade is kept off the public trade tape (0 = public)
+// Private feeds (the traders involved, surveillance, clearing) see every trade;
+// a public tape should print only trades with IsPublic.
+type Visibility uint8
+
+const (
+	VisibilitySelfMatch Visibility = 1 << iota // Buyer and seller are the same UserID (wash trade)
+	VisibilityHidden                           // A hidden (ExecHidden) order took part (dark execution)
+)
+
+// IsPublic reports whether the trade belongs on the public tape
+func (t *Trade) IsPublic() bool {
+	return t.Visibility == 0
+}
+
+// visibilityOf derives a trade's Visibility from its two orders
+func visibilityOf(buyOrder, sellOrder *Order) Visibility {
+	var v Visibility
+	if buyOrder.UserID == sellOrder.UserID {
+		v |= VisibilitySelfMatch
+	}
+	if buyOrder.IsHidden() || sellOrder.IsHidden() {
+		v |= VisibilityHidden
+	}
+	return v
 }
 
 var tradePool = sync.Pool{
@@ -33,8 +64,14 @@ var tradePool = sync.Pool{
 	},
 }
 
-// NewTrade creates a new trade from the pool
-func NewTrade(id, symbol string, price, quantity int64, buyOrder, sellOrder *Order) *Trade {
+// NewTrade creates a new trade from the pool, timestamped with the wall clock
+func NewTrade(id, symbol string, price Price, quantity int64, buyOrder, sellOrder *Order) *Trade {
+	return NewTradeAt(id, symbol, price, quantity, buyOrder, sellOrder, time.Now())
+}
+
+// NewTradeAt creates a new trade from the pool with an explicit execution timestamp
+// Used by engines running on an injected clock (replay/backtest)
+func NewTradeAt(id, symbol string, price Price, quantity int64, buyOrder, sellOrder *Order, timestamp time.Time) *Trade {
 	trade := tradePool.Get().(*Trade)
 	trade.ID = id
 	trade.Symbol = symbol
@@ -44,8 +81,13 @@ func NewTrade(id, symbol string, price, quantity int64, buyOrder, sellOrder *Ord
 	trade.SellOrderID = sellOrder.ID
 	trade.BuyUserID = buyOrder.UserID
 	trade.SellUserID = sellOrder.UserID
-	trade.Timestamp = time.Now()
+	trade.Timestamp = timestamp
 	trade.IsBuyerMaker = buyOrder.Timestamp.Before(sellOrder.Timestamp)
+	trade.TakerTag, trade.MakerTag = sellOrder.Tag, buyOrder.Tag
+	if !trade.IsBuyerMaker {
+		trade.TakerTag, trade.MakerTag = buyOrder.Tag, sellOrder.Tag
+	}
+	trade.Visibility = visibilityOf(buyOrder, sellOrder)
 	return trade
 }
 
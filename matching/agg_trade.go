@@ -0,0 +1,54 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"time"
+)
+
+// AggTrade summarizes all fills of one taker order (the "aggTrade" stream)
+// Emitted once per incoming order that traded, after matching completes,
+// in addition to the individual per-maker trades.
+type AggTrade struct {
+	Symbol       string
+	TakerOrderID string
+	TakerUserID  string
+	TakerSide    domain.Side
+	TotalQty     int64 // Sum of fill quantities
+	Notional     int64 // Sum of price * quantity across fills (exact)
+	AvgPrice     int64 // Volume-weighted average price: Notional / TotalQty (truncated)
+	TradeCount   int   // Number of maker fills
+	FirstTradeID string
+	LastTradeID  string
+	Timestamp    time.Time
+}
+
+// SetAggTradeHandler enables aggregated trades and installs their callback (nil disables)
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetAggTradeHandler(handler func(AggTrade)) {
+	me.runOnMatchingThread(func() {
+		me.onAggTrade = handler
+	})
+}
+
+// newAggTrade builds the aggregate for a taker from the trades it generated
+// The VWAP is accumulated as an exact integer notional across all levels, then divided once
+func newAggTrade(taker *domain.Order, trades []*domain.Trade) AggTrade {
+	agg := AggTrade{
+		Symbol:       taker.Symbol,
+		TakerOrderID: taker.ID,
+		TakerUserID:  taker.UserID,
+		TakerSide:    taker.Side,
+		TradeCount:   len(trades),
+		FirstTradeID: trades[0].ID,
+		LastTradeID:  trades[len(trades)-1].ID,
+		Timestamp:    trades[len(trades)-1].Timestamp,
+	}
+	for _, trade := range trades {
+		agg.TotalQty += trade.Quantity
+		agg.Notional += trade.Price * trade.Quantity
+	}
+	if agg.TotalQty > 0 {
+		agg.AvgPrice = agg.Notional / agg.TotalQty
+	}
+	return agg
+}
@@ -0,0 +1,67 @@
+package matching
+
+import (
+	"errors"
+	"lightning-exchange/domain"
+	"time"
+)
+
+// ErrAmendLosesPriority is returned for an amend that changes the price or raises the quantity
+// Such a change forfeits time priority; do it explicitly as a cancel plus a new order.
+var ErrAmendLosesPriority = errors.New("amend would lose priority: cancel and resubmit")
+
+// OrderAmend lists the attributes AmendOrder changes; nil fields are left as they are
+type OrderAmend struct {
+	Price       *int64              // must equal the current price (price changes lose priority)
+	Quantity    *int64              // new total quantity, filled part included; may only go down
+	TimeInForce *domain.TimeInForce // IOC on a resting order cancels its remainder
+	ExpireAt    *time.Time          // new GTD expiry; the zero time makes the order good-till-cancel
+}
+
+// AmendOrder changes a resting order while keeping its exact queue position
+// Only priority-preserving amends are accepted: expiry and time-in-force changes are
+// applied in place, and a lower quantity works like ReduceOrder. The order's list element
+// is never removed and re-inserted. An amend that changes the price or raises the quantity
+// is rejected as a whole with ErrAmendLosesPriority; nothing is applied. So is one that
+// would remove the order (IOC, or Quantity down to the filled part) before MinRestTime,
+// with ErrMinRestTimeNotMet.
+// Being risk-neutral or risk-reducing, amends share ReduceOrder's lane ahead of new orders.
+// Blocks until applied.
+func (me *MatchingEngine) AmendOrder(orderID string, amend OrderAmend) error {
+	return me.callOnLane(me.amendChan, func() error {
+		order := me.orderBook.GetOrder(orderID)
+		if order == nil {
+			return ErrOrderNotFound
+		}
+		if amend.Price != nil && *amend.Price != order.Price {
+			return ErrAmendLosesPriority
+		}
+		if amend.Quantity != nil {
+			if *amend.Quantity > order.Quantity {
+				return ErrAmendLosesPriority
+			}
+			if *amend.Quantity < order.Filled {
+				return ErrReduceExceedsRemaining
+			}
+		}
+		removes := (amend.Quantity != nil && *amend.Quantity == order.Filled) ||
+			(amend.TimeInForce != nil && *amend.TimeInForce == domain.TimeInForceIOC)
+		if removes && !me.minRestTimeMet(order) {
+			return ErrMinRestTimeNotMet
+		}
+
+		if amend.ExpireAt != nil && !amend.ExpireAt.Equal(order.ExpireAt) {
+			me.orderBook.SetExpiry(order, *amend.ExpireAt)
+		}
+		if amend.Quantity != nil && *amend.Quantity < order.Quantity {
+			me.orderBook.ReduceOrder(order, order.Quantity-*amend.Quantity)
+		}
+		if amend.TimeInForce != nil && me.orderBook.GetOrder(orderID) == order {
+			order.TimeInForce = *amend.TimeInForce
+			if order.TimeInForce == domain.TimeInForceIOC {
+				me.orderBook.CancelOrder(orderID)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,29 @@
+package matching
+
+// CancelOrders cancels several orders in one matching-thread pass and reports each outcome
+// ok[i] is true if ids[i] was resting or pending as a conditional order and is now
+// cancelled; unknown, already-finished and duplicate IDs, and orders protected by the
+// minimum rest time, are false. The whole batch is one command: no incoming order is
+// matched between two of its cancels, so a strategy pulling its quotes never trades
+// against half of them. Being risk-reducing, it rides ReduceOrder's lane ahead of queued
+// new orders. Blocks until applied; if the engine stops first every entry is false.
+func (me *MatchingEngine) CancelOrders(ids []string) []bool {
+	ok := make([]bool, len(ids))
+	err := me.callOnLane(me.amendChan, func() error {
+		for i, id := range ids {
+			ok[i] = me.cancelOne(id)
+		}
+		return nil
+	})
+	if err != nil {
+		// The matching thread may still be writing ok: hand back a fresh slice
+		return make([]bool, len(ids))
+	}
+	return ok
+}
+
+// cancelOne applies one cancel of a batch and reports whether it took effect (matching thread only)
+func (me *MatchingEngine) cancelOne(orderID string) bool {
+	cancelled, _ := me.applyCancel(orderID)
+	return cancelled
+}
@@ -0,0 +1,98 @@
+package matching
+
+import "time"
+
+// CircuitBreakerConfig configures the automatic halt on rapid price moves
+// The breaker trips when a trade prints more than MaxMoveBps away from the price
+// Window trades earlier. The engine then halts for Cooldown and resumes by itself.
+type CircuitBreakerConfig struct {
+	MaxMoveBps int64         // Largest allowed move in basis points (1/100 %) over Window trades (0 = off)
+	Window     int           // Number of trades the move is measured over
+	Cooldown   time.Duration // How long the engine stays halted after tripping
+}
+
+// CircuitBreakerTripped is emitted when a rapid price move halts the engine
+type CircuitBreakerTripped struct {
+	Symbol         string
+	ReferencePrice int64     // Price at the start of the window
+	TripPrice      int64     // Price of the trade that tripped the breaker
+	HaltedAt       time.Time // Engine clock time of the trip
+	ResumeAt       time.Time // When trading resumes automatically
+}
+
+// circuitBreaker tracks the last Window trade prices (matching thread only)
+type circuitBreaker struct {
+	cfg    CircuitBreakerConfig
+	prices []int64 // ring of the previous trade prices
+	next   int     // slot of the oldest price once the ring is full
+	count  int
+}
+
+// newCircuitBreaker returns nil when the breaker is disabled
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.MaxMoveBps <= 0 || cfg.Window <= 0 {
+		return nil
+	}
+	return &circuitBreaker{cfg: cfg, prices: make([]int64, cfg.Window)}
+}
+
+// observe records a trade price and reports the reference price if the move trips the breaker
+func (cb *circuitBreaker) observe(price int64) (reference int64, tripped bool) {
+	if cb.count == len(cb.prices) {
+		reference = cb.prices[cb.next]
+	} else if cb.count > 0 {
+		reference = cb.prices[0]
+	}
+
+	cb.prices[cb.next] = price
+	cb.next = (cb.next + 1) % len(cb.prices)
+	if cb.count < len(cb.prices) {
+		cb.count++
+	}
+
+	if reference <= 0 {
+		return 0, false
+	}
+	move := price - reference
+	if move < 0 {
+		move = -move
+	}
+	return reference, move*10000 > cb.cfg.MaxMoveBps*reference
+}
+
+// reset forgets the window so trading resumes against a fresh reference price
+func (cb *circuitBreaker) reset() {
+	cb.next, cb.count = 0, 0
+}
+
+// SetCircuitBreakerHandler installs a callback notified each time the circuit breaker trips
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetCircuitBreakerHandler(handler func(CircuitBreakerTripped)) {
+	me.runOnMatchingThread(func() {
+		me.onCircuitBreaker = handler
+	})
+}
+
+// checkCircuitBreaker feeds a trade price to the breaker and halts the engine if it trips
+// Called from executeTrade; the aggressor being matched stops sweeping immediately.
+func (me *MatchingEngine) checkCircuitBreaker(price int64) {
+	reference, tripped := me.breaker.observe(price)
+	if !tripped {
+		return
+	}
+	me.breaker.reset()
+
+	now := me.now()
+	resumeAt := now.Add(me.breaker.cfg.Cooldown)
+	me.halt(resumeAt)
+
+	if me.onCircuitBreaker != nil {
+		me.onCircuitBreaker(CircuitBreakerTripped{
+			Symbol:         me.symbol,
+			ReferencePrice: reference,
+			TripPrice:      price,
+			HaltedAt:       now,
+			ResumeAt:       resumeAt,
+		})
+	}
+}
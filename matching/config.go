@@ -0,0 +1,270 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"lightning-exchange/orderbook"
+	"math/rand"
+	"time"
+)
+
+// SymbolConfig holds per-symbol engine settings
+// Start from DefaultSymbolConfig() and override fields as needed.
+type SymbolConfig struct {
+	// TreeType selects the price tree implementation for both sides of the book
+	TreeType orderbook.PriceTreeType
+
+	// BucketSize is the sharded tree bucket size (power of 2); 0 derives it from ExpectedTickSpread
+	// Smaller buckets waste less of the fixed per-bucket array when prices are clustered;
+	// larger buckets keep the bucket tree shallow when prices are spread out.
+	BucketSize int64
+
+	// ExpectedTickSpread is the expected width of the active price range, in ticks
+	// Used only when BucketSize is 0; see orderbook.BucketSizeForSpread
+	ExpectedTickSpread int64
+
+	// PriceOrdering flips which price direction is better for each side (inverse contracts)
+	// Threaded into price tree construction; see orderbook.PriceOrderingInverted
+	PriceOrdering orderbook.PriceOrdering
+
+	// MaxBookDepth keeps only the best MaxBookDepth price levels per side (0 = unlimited)
+	// Limit orders that would rest past the last kept level are rejected with
+	// ErrBeyondBookDepth; a new better level on a full side prunes the worst level,
+	// cancelling previously accepted far orders (logged and reported to OnOrderPruned).
+	MaxBookDepth int
+
+	// OnOrderPruned is notified of each resting order cancelled by MaxBookDepth pruning
+	// Runs ON THE MATCHING THREAD and must not block.
+	OnOrderPruned func(order *domain.Order)
+
+	// ExpirySweepBatch caps how many GTD orders are expired per matching-loop iteration
+	// Spreads a burst of simultaneous expiries (e.g. at a round minute) over several
+	// iterations so incoming orders aren't stalled behind one long sweep. <= 0 means unbounded.
+	ExpirySweepBatch int
+
+	// TickSize is the minimum price increment for limit orders (0 disables the check)
+	TickSize int64
+
+	// TickPolicy selects whether off-tick limit prices are rejected (default) or snapped
+	TickPolicy TickPolicy
+
+	// MidpointRounding picks the tick a midpoint (domain.ExecMidpoint) execution rounds to
+	// when the displayed midpoint falls between ticks; see midpoint.go
+	MidpointRounding MidpointRounding
+
+	// MaxOpenOrdersPerUser caps the resting orders a single UserID may hold (0 = unlimited)
+	// A non-marketable limit order from a user already at the cap is rejected with
+	// ErrTooManyOpenOrders; a marketable one still trades and its remainder is cancelled
+	// instead of resting. Cancels, fills and expiries free capacity.
+	MaxOpenOrdersPerUser int
+
+	// MeasureCancelLatency records tick-to-cancel latency (CancelOrder to applied) for Metrics()
+	// Off by default: costs one wall-clock read per cancel on each side of the queue and a
+	// histogram update on the matching thread.
+	MeasureCancelLatency bool
+
+	// MinRestTime is the minimum quote life: a cancel for an order accepted less than
+	// MinRestTime ago is rejected with ErrMinRestTimeNotMet (0 = disabled), as is an amend
+	// or reduce that would remove it (see AmendOrder, ReduceOrder). Measured on
+	// Clock from the order's acceptance timestamp. Expiry, session cancels and fills
+	// are not restricted.
+	MinRestTime time.Duration
+
+	// UnknownCancel selects how a cancel for an order that is not open (never seen, already
+	// filled, cancelled or expired) is reported: silently ignored (default) or rejected
+	UnknownCancel UnknownCancelPolicy
+
+	// Clock supplies order acceptance, trade, GTD expiry and session timestamps
+	// nil uses the wall clock; inject a controllable clock for deterministic replay
+	Clock Clock
+
+	// Simulation runs the engine on a VirtualClock advanced by the timestamps of incoming
+	// orders, for backtests at full speed (Clock is ignored); see simulation.go
+	Simulation bool
+
+	// Rand is the engine's source of randomness: iceberg slice sizes (see domain.Order.DisplayQtyMax)
+	// nil seeds one from the wall clock; inject a seeded one for reproducible tests and
+	// backtests. Used on the matching thread only, so it must not be shared with other engines.
+	Rand *rand.Rand
+
+	// TradeIDs supplies trade IDs; nil uses an IDGenerator with prefix "T" (T1, T2, ...)
+	// Called on the matching thread for every trade, so it must be fast; see IDProvider.
+	TradeIDs IDProvider
+
+	// OrderOverflow selects what SubmitOrder does when the order buffer is full
+	OrderOverflow OverflowPolicy
+
+	// OnOrderDropped is notified of each order discarded under OverflowDropOldest
+	// Runs on the SUBMITTING goroutine (not the matching thread) and must not block.
+	OnOrderDropped func(order *domain.Order)
+
+	// FillHistoryOrders enables GetFills, retaining fill history for this many orders
+	// (0 = off). Oldest histories are evicted first. Memory cost is roughly
+	// FillHistoryOrders * average fills per order * ~100 bytes.
+	FillHistoryOrders int
+
+	// FillReporting selects one FillEvent per trade (FillPerFill, default) or one per
+	// aggressor order (FillPerOrder) for the handler installed with SetFillHandler
+	FillReporting FillReporting
+
+	// CircuitBreaker auto-halts the engine on rapid price moves (zero value = off)
+	// Protects against cascading liquidations: on a trip the current aggressor stops
+	// sweeping (its remainder is cancelled), new orders are rejected with
+	// ErrTradingHalted for Cooldown, and trading then resumes by itself.
+	CircuitBreaker CircuitBreakerConfig
+
+	// PriceBand rejects limit orders priced too far from a reference price with
+	// ErrOutsidePriceBand (zero value = off). Before the first trade the reference is the
+	// price set with MatchingEngine.SetReferencePrice; see PriceBandReference.
+	PriceBand PriceBandConfig
+
+	// MarketProtectionBps turns every market order into an IOC limit at the last trade price
+	// moved this many basis points against it, so it cannot sweep past that band; the
+	// remainder is cancelled (0 = off, market orders sweep as deep as the book goes).
+	// Before the first trade the price set with MatchingEngine.SetReferencePrice is used.
+	MarketProtectionBps int64
+
+	// TradeThrough selects reject (default) or slide for aggressors that would trade through
+	// the protected quote set with MatchingEngine.SetProtectedQuote. Protection itself is off
+	// until a protected quote is set.
+	TradeThrough TradeThroughPolicy
+
+	// MaxMatchIterations caps the match-loop iterations spent on one incoming order (<= 0 = unbounded)
+	// A defensive guard against a book inconsistency spinning the matching thread forever;
+	// when hit the loop stops, the order's remainder is cancelled and MatchLoopAborted is
+	// emitted. Keep it well above the deepest legitimate sweep.
+	MaxMatchIterations int
+
+	// PriorityAudit cross-checks every match against the book: the resting order filled
+	// must be the highest-priority eligible one (price, then time). Violations are logged
+	// and emitted as PriorityViolation. A correctness watchdog for tests and stress runs;
+	// it walks the queue ahead of each filled order, so leave it off in production.
+	PriorityAudit bool
+
+	// BatchTradePublish publishes each order's trades with one TradeRingBufferBatchSafe.PublishBatch
+	// instead of one Publish per trade, cutting semaphore round-trips on multi-level sweeps.
+	// Trade order and content are unchanged; consumers may see a sweep's trades appear at once.
+	BatchTradePublish bool
+
+	// OrderBufferSize and TradeBufferSize size the order and trade ring buffers in slots
+	// (power of 2; 0 = DefaultBufferSize). Larger buffers absorb longer bursts at the cost
+	// of memory and worse cache locality.
+	OrderBufferSize int
+	TradeBufferSize int
+
+	// EventBufferSize enables the unified order + trade feed (Events) with this many slots
+	// (0 = off). Independent of the trade buffer, which keeps receiving every trade.
+	// Lossless: a full buffer blocks matching until the consumer reads (see Events).
+	EventBufferSize int
+}
+
+// DefaultBufferSize is the order and trade ring buffer size used when SymbolConfig leaves it 0
+const DefaultBufferSize = 65536
+
+// bufferSizes resolves the order and trade ring buffer sizes
+func (cfg SymbolConfig) bufferSizes() (orders, trades int) {
+	orders, trades = cfg.OrderBufferSize, cfg.TradeBufferSize
+	if orders <= 0 {
+		orders = DefaultBufferSize
+	}
+	if trades <= 0 {
+		trades = DefaultBufferSize
+	}
+	return orders, trades
+}
+
+// tradeIDs resolves the trade ID source
+func (cfg SymbolConfig) tradeIDs() IDProvider {
+	if cfg.TradeIDs != nil {
+		return cfg.TradeIDs
+	}
+	return NewIDGenerator("T")
+}
+
+// OverflowPolicy selects how a full order buffer is handled
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the submitter until the matching thread frees a slot (default)
+	// Lossless: every submitted order is processed exactly once.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest never blocks: the oldest unprocessed order is discarded to make room
+	// Opt-in, for feeds that prefer freshness over completeness. Gives up the exactly-once
+	// guarantee: dropped orders are marked rejected with ErrOrderDropped and reported to
+	// OnOrderDropped, and a SubmitOrderSync caller waiting on one gets ErrOrderDropped.
+	OverflowDropOldest
+)
+
+// UnknownCancelPolicy selects how a cancel for an order that is not open is reported
+// Either way the cancel has no effect: a late or duplicate cancel never touches the book.
+type UnknownCancelPolicy int
+
+const (
+	// UnknownCancelIgnore treats it as a no-op: CancelOrderSync returns (false, nil) (default)
+	UnknownCancelIgnore UnknownCancelPolicy = iota
+
+	// UnknownCancelReject rejects it with ErrOrderNotFound: CancelOrderSync returns the error
+	// and an asynchronous CancelOrder reports it to the cancel-reject handler, so a client
+	// that sent two cancels gets exactly one success and one reject
+	UnknownCancelReject
+)
+
+// Clock is a source of time for a MatchingEngine
+// Implementations must be safe for concurrent use: besides the matching thread,
+// the GTD expiry timer reads it from its own goroutine.
+// An injected Clock only changes where time comes from; for backtests where order
+// timestamps should drive time, use SymbolConfig.Simulation instead.
+type Clock interface {
+	Now() time.Time
+}
+
+// TickPolicy selects how a limit price that is not a multiple of TickSize is handled
+type TickPolicy int
+
+const (
+	// TickReject rejects off-tick orders with ErrOffTick (default)
+	TickReject TickPolicy = iota
+
+	// TickSnap rounds off-tick prices to a valid tick, toward the less aggressive side:
+	// buys round DOWN and sells round UP, so snapping never makes an order pay more
+	// (or receive less) than the price the user entered.
+	TickSnap
+)
+
+// MidpointRounding selects how an off-tick midpoint execution price is rounded
+// The tick is TickSize, or 1 when TickSize is 0 (a midpoint of an odd spread is a half-unit).
+type MidpointRounding int
+
+const (
+	// MidpointFavorResting rounds in the resting midpoint order's favor (default):
+	// up when it sells, down when it buys
+	MidpointFavorResting MidpointRounding = iota
+
+	// MidpointFavorAggressor rounds in the incoming order's favor
+	MidpointFavorAggressor
+)
+
+// DefaultExpirySweepBatch is the default number of GTD orders expired per loop iteration
+const DefaultExpirySweepBatch = 256
+
+// DefaultMaxMatchIterations is the default match-loop guard (one per resting order consumed)
+const DefaultMaxMatchIterations = 1 << 20
+
+// DefaultSymbolConfig returns the settings used by NewMatchingEngine
+func DefaultSymbolConfig() SymbolConfig {
+	return SymbolConfig{
+		TreeType:         orderbook.ShardedType,
+		BucketSize:       orderbook.DefaultBucketSize,
+		ExpirySweepBatch: DefaultExpirySweepBatch,
+
+		MaxMatchIterations: DefaultMaxMatchIterations,
+	}
+}
+
+// bucketSize resolves the effective sharded tree bucket size
+func (c SymbolConfig) bucketSize() int64 {
+	if c.BucketSize > 0 {
+		return c.BucketSize
+	}
+	return orderbook.BucketSizeForSpread(c.ExpectedTickSpread)
+}
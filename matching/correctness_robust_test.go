@@ -1,8 +1,16 @@
 package matching
 
 import (
+	"errors"
 	"fmt"
 	"lightning-exchange/domain"
+	"lightning-exchange/orderbook"
+	"lightning-exchange/orderflow"
+	"log/slog"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -22,6 +30,19 @@ func waitForCondition(condition func() bool, timeout time.Duration, checkInterva
 	return false
 }
 
+// bestPrice 在撮合线程上读取一侧最优价（引擎运行时测试 goroutine 直接读订单簿会产生数据竞争）
+func bestPrice(engine *MatchingEngine, side domain.Side) (price int64) {
+	engine.callOnMatchingThread(func() error {
+		if side == domain.SideBuy {
+			price = engine.orderBook.GetBestBid()
+		} else {
+			price = engine.orderBook.GetBestAsk()
+		}
+		return nil
+	})
+	return price
+}
+
 // TestOrderFinalStateConsistencyRobust 订单最终状态一致性测试（改进版）
 // 使用条件等待而非固定 sleep，更可靠
 func TestOrderFinalStateConsistencyRobust(t *testing.T) {
@@ -369,7 +390,11 @@ func TestHappenBeforeSemanticsRobust(t *testing.T) {
 
 // TestConcurrentStressRobust 并发压力测试（改进版）
 func TestConcurrentStressRobust(t *testing.T) {
-	engine := NewMatchingEngine("BTCUSDT")
+	cfg := DefaultSymbolConfig()
+	cfg.PriorityAudit = true // 压力测试同时做公平性审计
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	var violations atomic.Int64
+	engine.SetPriorityViolationHandler(func(PriorityViolation) { violations.Add(1) })
 	engine.Start()
 	defer engine.Stop()
 	
@@ -478,6 +503,9 @@ func TestConcurrentStressRobust(t *testing.T) {
 	// 停止消费者
 	close(stopChan)
 	consumerWg.Wait()
+	if n := violations.Load(); n != 0 {
+		t.Errorf("公平性审计发现 %d 次违反价格时间优先", n)
+	}
 	
 	// 验证
 	t.Logf("\n=== 并发压力测试（改进版 - 严格模式）===")
@@ -513,3 +541,3668 @@ func TestConcurrentStressRobust(t *testing.T) {
 		t.Logf("✓ 成交数量精确匹配: %d", actualTrades)
 	}
 }
+
+// TestCancelWithoutFollowingOrders 撤单在没有后续订单时也应及时处理
+// 之前撮合循环阻塞在 Consume()，只有下一笔订单到达时才会处理撤单
+func TestCancelWithoutFollowingOrders(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	order := domain.NewLimitOrder("SELL-1", "BTCUSDT", "seller-1", domain.SideSell, 50000, 100)
+	engine.SubmitOrder(order)
+
+	if !waitForCondition(func() bool {
+		return bestPrice(engine, domain.SideSell) == 50000
+	}, time.Second, time.Millisecond) {
+		t.Fatal("order did not rest in the book")
+	}
+
+	// 只发送撤单，不再发送任何订单
+	engine.CancelOrder("SELL-1")
+
+	if !waitForCondition(func() bool {
+		return bestPrice(engine, domain.SideSell) == 0
+	}, time.Second, time.Millisecond) {
+		t.Fatal("cancel was not processed without a following order")
+	}
+}
+
+// TestTradeConsumeBatch 批量消费：不超过 max，且不会等待凑满批次
+func TestTradeConsumeBatch(t *testing.T) {
+	rb := NewTradeRingBufferBatchSafe(1024)
+	consumer := rb.NewTradeConsumerBatchSafe()
+
+	if batch := consumer.ConsumeBatch(10); batch != nil {
+		t.Fatalf("expected nil from empty buffer, got %d trades", len(batch))
+	}
+
+	for i := 0; i < 25; i++ {
+		rb.Publish(&domain.Trade{ID: fmt.Sprintf("T%d", i)})
+	}
+
+	var got []*domain.Trade
+	for len(got) < 25 {
+		batch := consumer.ConsumeBatch(10)
+		if len(batch) == 0 {
+			t.Fatalf("expected more trades, got %d so far", len(got))
+		}
+		if len(batch) > 10 {
+			t.Fatalf("batch exceeds max: %d", len(batch))
+		}
+		got = append(got, batch...)
+	}
+
+	for i, trade := range got {
+		if trade.ID != fmt.Sprintf("T%d", i) {
+			t.Fatalf("trade %d out of order: %s", i, trade.ID)
+		}
+	}
+
+	if batch := consumer.ConsumeBatch(10); batch != nil {
+		t.Errorf("expected nil after draining, got %d trades", len(batch))
+	}
+}
+
+// TestResetSessionStats 会话统计重置不影响订单簿
+func TestResetSessionStats(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrder(domain.NewLimitOrder("S1", "BTCUSDT", "seller", domain.SideSell, 50000, 100))
+	engine.SubmitOrder(domain.NewLimitOrder("S2", "BTCUSDT", "seller", domain.SideSell, 50100, 100))
+	engine.SubmitOrder(domain.NewLimitOrder("B1", "BTCUSDT", "buyer", domain.SideBuy, 50100, 150))
+
+	if !waitForCondition(func() bool {
+		return engine.GetTicker().TradeCount == 2
+	}, time.Second, time.Millisecond) {
+		t.Fatalf("expected 2 trades, ticker: %+v", engine.GetTicker())
+	}
+
+	ticker := engine.GetTicker()
+	if ticker.High != 50100 || ticker.Low != 50000 || ticker.Volume != 150 || ticker.LastPrice != 50100 {
+		t.Errorf("unexpected ticker: %+v", ticker)
+	}
+	if ticker.VWAP != (50000*100+50100*50)/150 {
+		t.Errorf("unexpected VWAP: %d", ticker.VWAP)
+	}
+
+	before := ticker.SessionStart
+	engine.ResetSessionStats()
+
+	if !waitForCondition(func() bool {
+		return engine.GetTicker().SessionStart.After(before)
+	}, time.Second, time.Millisecond) {
+		t.Fatal("session reset was not applied")
+	}
+
+	ticker = engine.GetTicker()
+	if ticker.TradeCount != 0 || ticker.Volume != 0 || ticker.High != 0 || ticker.VWAP != 0 {
+		t.Errorf("expected zeroed stats after reset, got %+v", ticker)
+	}
+
+	// 剩余挂单不受影响
+	if ask := engine.GetOrderBook().GetBestAsk(); ask != 50100 {
+		t.Errorf("expected resting ask 50100 to survive reset, got %d", ask)
+	}
+}
+
+// TestLastLookVeto 带 LastLook 标记的挂单可以拒绝撮合
+func TestLastLookVeto(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.SetLastLookHandler(func(aggressor, resting *domain.Order) bool {
+		return resting.UserID != "picky-maker"
+	})
+	engine.Start()
+	defer engine.Stop()
+
+	picky := domain.NewLimitOrder("S1", "BTCUSDT", "picky-maker", domain.SideSell, 50000, 100)
+	picky.ExecInst |= domain.ExecLastLook
+	engine.SubmitOrder(picky)
+	engine.SubmitOrder(domain.NewLimitOrder("S2", "BTCUSDT", "maker", domain.SideSell, 50000, 100))
+
+	taker := domain.NewLimitOrder("B1", "BTCUSDT", "taker", domain.SideBuy, 50000, 100)
+	engine.SubmitOrder(taker)
+
+	if !waitForCondition(func() bool {
+		return engine.GetTicker().TradeCount == 1
+	}, time.Second, time.Millisecond) {
+		t.Fatalf("expected 1 trade, ticker: %+v", engine.GetTicker())
+	}
+
+	consumer := engine.GetTradeBuffer().NewTradeConsumerBatchSafe()
+	trade, ok := consumer.TryConsume()
+	if !ok || trade.SellOrderID != "S2" {
+		t.Fatalf("expected match against S2 (S1 vetoed), got %+v", trade)
+	}
+	if picky.Filled != 0 {
+		t.Errorf("vetoed order should not be filled, filled %d", picky.Filled)
+	}
+}
+
+// TestSelfTradeDecrementBoth 自成交在 DecrementBoth 模式下不产生公开成交
+func TestSelfTradeDecrementBoth(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+
+	var selfMatches []SelfMatch
+	var selfMu sync.Mutex
+	engine.SetSelfTradePrevention(STPDecrementBoth)
+	engine.SetSelfMatchHandler(func(m SelfMatch) {
+		selfMu.Lock()
+		selfMatches = append(selfMatches, m)
+		selfMu.Unlock()
+	})
+	engine.Start()
+	defer engine.Stop()
+
+	own := domain.NewLimitOrder("S1", "BTCUSDT", "alice", domain.SideSell, 50000, 60)
+	engine.SubmitOrder(own)
+	engine.SubmitOrder(domain.NewLimitOrder("S2", "BTCUSDT", "bob", domain.SideSell, 50000, 100))
+
+	// alice 的买单先与自己的卖单相抵 60，剩余 40 与 bob 成交
+	aggressor := domain.NewLimitOrder("B1", "BTCUSDT", "alice", domain.SideBuy, 50000, 100)
+	engine.SubmitOrder(aggressor)
+
+	if !waitForCondition(func() bool {
+		return engine.GetTicker().TradeCount == 1
+	}, time.Second, time.Millisecond) {
+		t.Fatalf("expected exactly 1 public trade, ticker: %+v", engine.GetTicker())
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	ticker := engine.GetTicker()
+	if ticker.TradeCount != 1 || ticker.Volume != 40 {
+		t.Errorf("public tape should exclude the self-match: %+v", ticker)
+	}
+
+	selfMu.Lock()
+	defer selfMu.Unlock()
+	if len(selfMatches) != 1 || selfMatches[0].Quantity != 60 || selfMatches[0].RestingOrderID != "S1" {
+		t.Fatalf("unexpected self-match events: %+v", selfMatches)
+	}
+
+	if own.Status != domain.OrderStatusCancelled {
+		t.Errorf("fully decremented resting order should be removed, status %d", own.Status)
+	}
+	if ask := engine.GetOrderBook().GetBestAsk(); ask != 50000 {
+		t.Errorf("expected bob's remainder to rest at 50000, got %d", ask)
+	}
+	if _, asks := engine.GetOrderBook().GetDepth(1); len(asks) != 1 || asks[0].Quantity != 60 || asks[0].Orders != 1 {
+		t.Errorf("unexpected asks after self-match: %+v", asks)
+	}
+}
+
+// TestDepthSubscriberCoalescing 深度订阅按间隔合并推送，多个订阅者互不影响
+func TestDepthSubscriberCoalescing(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	fast := engine.SubscribeDepth(1, 10*time.Millisecond)
+	defer fast.Close()
+	slow := engine.SubscribeDepth(5, 50*time.Millisecond)
+	defer slow.Close()
+
+	for i := 0; i < 1000; i++ {
+		engine.SubmitOrder(domain.NewLimitOrder(fmt.Sprintf("S%d", i), "BTCUSDT", "seller",
+			domain.SideSell, 50000+int64(i%10), 1))
+	}
+
+	// 等待订阅者收到满足条件的快照
+	waitForSnapshot := func(sub *DepthSubscriber, match func(DepthSnapshot) bool) bool {
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case snap := <-sub.C:
+				if match(snap) {
+					return true
+				}
+			case <-deadline:
+				return false
+			}
+		}
+	}
+
+	if !waitForSnapshot(fast, func(snap DepthSnapshot) bool {
+		return len(snap.Asks) == 1 && snap.Asks[0].Price == 50000 && snap.Asks[0].Orders == 100
+	}) {
+		t.Error("fast subscriber never saw the full top level")
+	}
+	if !waitForSnapshot(slow, func(snap DepthSnapshot) bool {
+		return len(snap.Asks) == 5 && snap.Asks[4].Price == 50004 && snap.Asks[4].Orders == 100
+	}) {
+		t.Error("slow subscriber never saw 5 full levels")
+	}
+}
+
+// TestExpirySweepBatching 大量 GTD 订单同时到期时，每次循环最多处理 ExpirySweepBatch 个
+func TestExpirySweepBatching(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.ExpirySweepBatch = 500
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	if engine.ExpirySweepBatch() != 500 {
+		t.Fatalf("expected batch size 500, got %d", engine.ExpirySweepBatch())
+	}
+
+	numOrders := 10000
+	expireAt := time.Now().Add(-time.Second) // 全部同时到期
+	orders := make([]*domain.Order, numOrders)
+	for i := 0; i < numOrders; i++ {
+		order := domain.NewLimitOrder(fmt.Sprintf("GTD-%d", i), "BTCUSDT", "user", domain.SideSell,
+			50000+int64(i%100), 1)
+		order.ExpireAt = expireAt
+		engine.orderBook.AddOrder(order)
+		orders[i] = order
+	}
+
+	// 直接驱动扫描（模拟每次循环迭代），记录单次耗时
+	var maxStall time.Duration
+	iterations := 0
+	for engine.orderBook.HasPendingExpiries() {
+		start := time.Now()
+		engine.sweepExpired()
+		if d := time.Since(start); d > maxStall {
+			maxStall = d
+		}
+		iterations++
+	}
+
+	if iterations < numOrders/500 {
+		t.Errorf("expected sweep spread over at least %d iterations, got %d", numOrders/500, iterations)
+	}
+	if maxStall > 20*time.Millisecond {
+		t.Errorf("single sweep stalled %v", maxStall)
+	}
+	t.Logf("10k 订单到期，迭代 %d 次，单次最大耗时 %v", iterations, maxStall)
+
+	for _, order := range orders {
+		if order.Status != domain.OrderStatusExpired {
+			t.Fatalf("order %s not expired, status %d", order.ID, order.Status)
+		}
+	}
+	if ask := engine.GetOrderBook().GetBestAsk(); ask != 0 {
+		t.Errorf("expected empty book, best ask %d", ask)
+	}
+}
+
+// TestExpiryWhileIdle 没有新订单时 GTD 订单也能按时过期
+func TestExpiryWhileIdle(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	order := domain.NewLimitOrder("GTD-1", "BTCUSDT", "user", domain.SideBuy, 49000, 100)
+	order.ExpireAt = time.Now().Add(20 * time.Millisecond)
+	engine.SubmitOrder(order)
+
+	if !waitForCondition(func() bool {
+		return bestPrice(engine, domain.SideBuy) == 49000
+	}, time.Second, time.Millisecond) {
+		t.Fatal("GTD order did not rest")
+	}
+
+	if !waitForCondition(func() bool {
+		return bestPrice(engine, domain.SideBuy) == 0
+	}, time.Second, time.Millisecond) {
+		t.Fatal("GTD order did not expire while the engine was idle")
+	}
+
+	// 没有待过期订单时定时器停止；新的 GTD 订单把定时器指向它的过期时间
+	armed := func() (at int64) {
+		engine.callOnMatchingThread(func() error {
+			at = engine.armedExpiry
+			return nil
+		})
+		return at
+	}
+	if at := armed(); at != 0 {
+		t.Errorf("expiry timer still armed for %d with nothing pending", at)
+	}
+	order = domain.NewLimitOrder("GTD-2", "BTCUSDT", "user", domain.SideBuy, 49000, 100)
+	order.ExpireAt = time.Now().Add(time.Hour)
+	engine.SubmitOrderSync(order)
+	if at := armed(); at != order.ExpireAt.UnixNano() {
+		t.Errorf("expiry timer armed for %d, want %d", at, order.ExpireAt.UnixNano())
+	}
+}
+
+// TestAggTrade 一笔吃单扫多个价位时产生一条聚合成交
+func TestAggTrade(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+
+	aggs := make(chan AggTrade, 10)
+	engine.SetAggTradeHandler(func(agg AggTrade) {
+		aggs <- agg
+	})
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrder(domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 50000, 30))
+	engine.SubmitOrder(domain.NewLimitOrder("S2", "BTCUSDT", "m2", domain.SideSell, 50000, 20))
+	engine.SubmitOrder(domain.NewLimitOrder("S3", "BTCUSDT", "m3", domain.SideSell, 50010, 100))
+	engine.SubmitOrder(domain.NewLimitOrder("B1", "BTCUSDT", "taker", domain.SideBuy, 50010, 80))
+
+	select {
+	case agg := <-aggs:
+		if agg.TakerOrderID != "B1" || agg.TradeCount != 3 || agg.TotalQty != 80 {
+			t.Errorf("unexpected aggregate: %+v", agg)
+		}
+		wantNotional := int64(50000*30 + 50000*20 + 50010*30)
+		if agg.Notional != wantNotional || agg.AvgPrice != wantNotional/80 {
+			t.Errorf("unexpected VWAP: notional %d avg %d", agg.Notional, agg.AvgPrice)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no aggregated trade emitted")
+	}
+
+	select {
+	case agg := <-aggs:
+		t.Errorf("expected a single aggregate, got another: %+v", agg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// TestSubmitOrderSync 同步提交返回后立即可见（read-your-writes）
+func TestSubmitOrderSync(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+
+	// 先异步提交一批订单，同步订单必须排在它们之后处理
+	for i := 0; i < 1000; i++ {
+		engine.SubmitOrder(domain.NewLimitOrder(fmt.Sprintf("S%d", i), "BTCUSDT", "seller",
+			domain.SideSell, 50100, 1))
+	}
+
+	order := domain.NewLimitOrder("B1", "BTCUSDT", "buyer", domain.SideBuy, 50000, 100)
+	if err := engine.SubmitOrderSync(order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bids, asks := engine.GetOrderBook().GetDepth(1)
+	if len(bids) != 1 || bids[0].Price != 50000 {
+		t.Errorf("order not visible right after SubmitOrderSync: %+v", bids)
+	}
+	if len(asks) != 1 || asks[0].Orders != 1000 {
+		t.Errorf("async orders ahead of the sync order were not all processed: %+v", asks)
+	}
+
+	engine.Stop()
+}
+
+// TestTickSizeSnapAndReject 非整 tick 价格：拒绝或向不激进方向取整
+func TestTickSizeSnapAndReject(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.TickSize = 10
+
+	// 拒绝模式（默认）
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	off := domain.NewLimitOrder("B0", "BTCUSDT", "buyer", domain.SideBuy, 50005, 100)
+	if err := engine.SubmitOrderSync(off); !errors.Is(err, ErrOffTick) {
+		t.Errorf("expected ErrOffTick, got %v", err)
+	}
+	if off.Status != domain.OrderStatusRejected {
+		t.Errorf("expected rejected status, got %d", off.Status)
+	}
+	if bid := engine.GetOrderBook().GetBestBid(); bid != 0 {
+		t.Errorf("rejected order must not rest, best bid %d", bid)
+	}
+	engine.Stop()
+
+	// 取整模式：买单向下，卖单向上
+	cfg.TickPolicy = TickSnap
+	engine = NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	buy := domain.NewLimitOrder("B1", "BTCUSDT", "buyer", domain.SideBuy, 50009, 100)
+	sell := domain.NewLimitOrder("S1", "BTCUSDT", "seller", domain.SideSell, 50011, 100)
+	onTick := domain.NewLimitOrder("S2", "BTCUSDT", "seller", domain.SideSell, 50030, 100)
+	for _, order := range []*domain.Order{buy, sell, onTick} {
+		if err := engine.SubmitOrderSync(order); err != nil {
+			t.Fatalf("unexpected error for %s: %v", order.ID, err)
+		}
+	}
+
+	if buy.Price != 50000 {
+		t.Errorf("buy should snap down to 50000, got %d", buy.Price)
+	}
+	if sell.Price != 50020 {
+		t.Errorf("sell should snap up to 50020, got %d", sell.Price)
+	}
+	if onTick.Price != 50030 {
+		t.Errorf("on-tick price must not change, got %d", onTick.Price)
+	}
+	if bid, ask := engine.GetOrderBook().GetBestBid(), engine.GetOrderBook().GetBestAsk(); bid != 50000 || ask != 50020 {
+		t.Errorf("unexpected book after snapping: bid %d ask %d", bid, ask)
+	}
+
+	// 买单价格小于一个 tick 时向下取整为 0，应拒绝
+	tiny := domain.NewLimitOrder("B2", "BTCUSDT", "buyer", domain.SideBuy, 5, 100)
+	if err := engine.SubmitOrderSync(tiny); !errors.Is(err, ErrOffTick) {
+		t.Errorf("expected ErrOffTick for buy snapping to zero, got %v", err)
+	}
+}
+
+// TestOnTradeCallback 每笔成交在发布前同步回调
+func TestOnTradeCallback(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	var seen []string
+	engine.OnTrade(func(trade *domain.Trade) {
+		seen = append(seen, trade.ID) // 只复制字段，不保留指针
+	})
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrder(domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 50000, 10))
+	engine.SubmitOrder(domain.NewLimitOrder("S2", "BTCUSDT", "m2", domain.SideSell, 50000, 10))
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50000, 20)); err != nil {
+		t.Fatal(err)
+	}
+
+	// SubmitOrderSync 返回时回调已在撮合线程执行完毕
+	if len(seen) != 2 {
+		t.Fatalf("expected 2 callbacks, got %v", seen)
+	}
+
+	consumer := engine.GetTradeBuffer().NewTradeConsumerBatchSafe()
+	for i := 0; i < 2; i++ {
+		trade, ok := consumer.TryConsume()
+		if !ok || trade.ID != seen[i] {
+			t.Errorf("published trade %d does not match callback order: %v", i, seen)
+		}
+	}
+
+	engine.OnTrade(nil)
+	engine.SubmitOrder(domain.NewLimitOrder("S3", "BTCUSDT", "m3", domain.SideSell, 50000, 10))
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "t", domain.SideBuy, 50000, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 {
+		t.Errorf("callback should be disabled, got %v", seen)
+	}
+}
+
+// TestReduceOrderKeepsPriority 减量不丢失时间优先级
+func TestReduceOrderKeepsPriority(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	first := domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 50000, 100)
+	second := domain.NewLimitOrder("S2", "BTCUSDT", "m2", domain.SideSell, 50000, 100)
+	engine.SubmitOrderSync(first)
+	engine.SubmitOrderSync(second)
+
+	if err := engine.ReduceOrder("S1", 101); !errors.Is(err, ErrReduceExceedsRemaining) {
+		t.Errorf("expected ErrReduceExceedsRemaining, got %v", err)
+	}
+	if err := engine.ReduceOrder("missing", 1); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound, got %v", err)
+	}
+	if err := engine.ReduceOrder("S1", 0); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity, got %v", err)
+	}
+	if err := engine.ReduceOrder("S1", 60); err != nil {
+		t.Fatalf("reduce: %v", err)
+	}
+
+	if _, asks := engine.GetOrderBook().GetDepth(1); asks[0].Quantity != 140 || asks[0].Orders != 2 {
+		t.Errorf("unexpected level after reduce: %+v", asks)
+	}
+
+	// 随后到达的吃单先成交 S1（仍在队首），且只能成交减量后的 40
+	var fills []string
+	engine.OnTrade(func(trade *domain.Trade) {
+		fills = append(fills, fmt.Sprintf("%s:%d", trade.SellOrderID, trade.Quantity))
+	})
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50000, 50))
+
+	if len(fills) != 2 || fills[0] != "S1:40" || fills[1] != "S2:10" {
+		t.Errorf("expected S1 to keep priority with reduced size, fills %v", fills)
+	}
+	if first.Status != domain.OrderStatusFilled {
+		t.Errorf("S1 should be filled after its reduced quantity traded, status %d", first.Status)
+	}
+
+	// 减到 0 等同撤单
+	if err := engine.ReduceOrder("S2", 90); err != nil {
+		t.Fatalf("reduce to zero: %v", err)
+	}
+	if ask := engine.GetOrderBook().GetBestAsk(); ask != 0 {
+		t.Errorf("fully reduced order should be removed, best ask %d", ask)
+	}
+}
+
+// recordingLogger 记录日志消息，用于验证撮合决策日志
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) Enabled(level slog.Level) bool { return true }
+
+func (l *recordingLogger) LogAttrs(level slog.Level, msg string, attrs ...slog.Attr) {
+	l.mu.Lock()
+	l.msgs = append(l.msgs, msg)
+	l.mu.Unlock()
+}
+
+// TestMatchingDecisionLogging 关键决策点输出结构化日志
+func TestMatchingDecisionLogging(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.TickSize = 10
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	logger := &recordingLogger{}
+	engine.SetLogger(logger)
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m", domain.SideSell, 50000, 10))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50000, 10))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "t", domain.SideBuy, 50001, 10))
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	want := []string{
+		"order accepted", "price level created", "best price changed", // S1 挂单
+		"order accepted", "match executed", "price level removed", "best price changed", // B1 成交
+		"order rejected", // B2 不在 tick 上
+	}
+	if fmt.Sprint(logger.msgs) != fmt.Sprint(want) {
+		t.Errorf("unexpected log sequence:\n got %v\nwant %v", logger.msgs, want)
+	}
+}
+
+// TestEstimateCostToFillMatchesExecution 估算成本与实际撮合结果一致
+func TestEstimateCostToFillMatchesExecution(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	book := engine.orderBook
+	engine.Start()
+	defer engine.Stop()
+
+	for i, level := range []struct{ price, qty int64 }{{50000, 30}, {50000, 20}, {50010, 40}, {50025, 100}} {
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("S%d", i), "BTCUSDT", "m", domain.SideSell, level.price, level.qty))
+	}
+
+	var cost, avg int64
+	var full bool
+	var partialFull bool
+	engine.callOnMatchingThread(func() error {
+		cost, avg, full = book.EstimateCostToFill(domain.SideBuy, 120)
+		_, _, partialFull = book.EstimateCostToFill(domain.SideBuy, 1000)
+		return nil
+	})
+	if !full || partialFull {
+		t.Errorf("fullyFilled flags wrong: 120 -> %v, 1000 -> %v", full, partialFull)
+	}
+
+	// 实际撮合同样数量
+	var actualCost, actualQty int64
+	engine.OnTrade(func(trade *domain.Trade) {
+		actualCost += trade.Price * trade.Quantity
+		actualQty += trade.Quantity
+	})
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 60000, 120))
+
+	if actualQty != 120 || cost != actualCost || avg != actualCost/actualQty {
+		t.Errorf("estimate cost %d avg %d, actual cost %d qty %d", cost, avg, actualCost, actualQty)
+	}
+}
+
+// manualClock 手动推进的时钟（用于回放/回测）
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// TestInjectedClock 注入时钟后订单、成交、GTD 过期和会话统计都使用该时钟
+func TestInjectedClock(t *testing.T) {
+	start := time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)
+	clock := &manualClock{now: start}
+	cfg := DefaultSymbolConfig()
+	cfg.Clock = clock
+
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	if got := engine.GetTicker().SessionStart; !got.Equal(start) {
+		t.Errorf("session start %v, want %v", got, start)
+	}
+
+	sell := domain.NewLimitOrder("S1", "BTCUSDT", "maker", domain.SideSell, 50000, 10)
+	engine.SubmitOrderSync(sell)
+	if !sell.Timestamp.Equal(start) {
+		t.Errorf("order accepted at %v, want %v", sell.Timestamp, start)
+	}
+
+	clock.Advance(time.Second)
+	var trades []*domain.Trade
+	engine.OnTrade(func(trade *domain.Trade) { trades = append(trades, trade) })
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "taker", domain.SideBuy, 50000, 4))
+	if len(trades) != 1 || !trades[0].Timestamp.Equal(start.Add(time.Second)) || trades[0].IsBuyerMaker {
+		t.Fatalf("unexpected trades: %+v", trades)
+	}
+
+	// GTD 过期只随注入时钟推进
+	gtd := domain.NewLimitOrder("B2", "BTCUSDT", "u", domain.SideBuy, 49000, 5)
+	gtd.ExpireAt = start.Add(time.Minute)
+	engine.SubmitOrderSync(gtd)
+
+	time.Sleep(10 * expiryCheckInterval)
+	if bestPrice(engine, domain.SideBuy) != 49000 {
+		t.Fatal("order expired before the injected clock reached ExpireAt")
+	}
+
+	clock.Advance(time.Minute)
+	if !waitForCondition(func() bool {
+		return bestPrice(engine, domain.SideBuy) == 0
+	}, time.Second, time.Millisecond) {
+		t.Error("order not expired after advancing the injected clock")
+	}
+}
+
+// TestMaxOpenOrdersPerUser 超过每用户挂单上限的订单被拒绝，撤单后释放额度
+func TestMaxOpenOrdersPerUser(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.MaxOpenOrdersPerUser = 2
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	for i := 1; i <= 2; i++ {
+		if err := engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("A%d", i), "BTCUSDT", "alice", domain.SideBuy, 49000, 1)); err != nil {
+			t.Fatalf("order %d: %v", i, err)
+		}
+	}
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("A3", "BTCUSDT", "alice", domain.SideBuy, 49000, 1)); !errors.Is(err, ErrTooManyOpenOrders) {
+		t.Fatalf("expected ErrTooManyOpenOrders, got %v", err)
+	}
+	// 上限按用户独立计算
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "bob", domain.SideSell, 51000, 1)); err != nil {
+		t.Fatalf("other user rejected: %v", err)
+	}
+
+	engine.CancelOrder("A1")
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("A4", "BTCUSDT", "alice", domain.SideBuy, 49000, 1)); err != nil {
+		t.Fatalf("order after cancel rejected: %v", err)
+	}
+
+	// 成交同样释放额度
+	engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "bob", domain.SideSell, 49000, 1))
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("A5", "BTCUSDT", "alice", domain.SideBuy, 48000, 1)); err != nil {
+		t.Fatalf("order after fill rejected: %v", err)
+	}
+
+	// 上限只限制挂单：达到上限的用户仍可发送可成交的限价单，剩余部分撤销而不挂单
+	engine.SubmitOrderSync(domain.NewLimitOrder("B3", "BTCUSDT", "bob", domain.SideSell, 49500, 2))
+	crossing := domain.NewLimitOrder("A6", "BTCUSDT", "alice", domain.SideBuy, 49500, 3)
+	if err := engine.SubmitOrderSync(crossing); err != nil {
+		t.Fatalf("marketable order at the cap rejected: %v", err)
+	}
+	if crossing.Filled != 2 || crossing.Status != domain.OrderStatusCancelled {
+		t.Errorf("A6 filled %d status %v, want 2 filled and the remainder cancelled", crossing.Filled, crossing.Status)
+	}
+	if n := engine.orderBook.OpenOrderCount("alice"); n != 2 {
+		t.Errorf("alice holds %d resting orders, want the cap of 2", n)
+	}
+}
+
+// TestCancelSession 断线撤单只撤销该会话的挂单，同一用户的其他会话不受影响
+func TestCancelSession(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	submit := func(id, session string, price int64) *domain.Order {
+		order := domain.NewLimitOrder(id, "BTCUSDT", "alice", domain.SideBuy, price, 10)
+		order.SessionID = session
+		engine.SubmitOrderSync(order)
+		return order
+	}
+	submit("A1", "conn-1", 49000)
+	submit("A2", "conn-1", 49100)
+	submit("A3", "conn-2", 49000)
+	submit("A4", "", 48000)
+
+	// 部分成交的订单同样会被撤销
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "bob", domain.SideSell, 49100, 4))
+
+	engine.CancelSession("conn-1")
+	engine.CancelSession("unknown")
+
+	var remaining []string
+	engine.callOnMatchingThread(func() error {
+		for _, id := range []string{"A1", "A2", "A3", "A4"} {
+			if engine.orderBook.GetOrder(id) != nil {
+				remaining = append(remaining, id)
+			}
+		}
+		return nil
+	})
+	if fmt.Sprint(remaining) != "[A3 A4]" {
+		t.Errorf("expected only A3 and A4 to remain, got %v", remaining)
+	}
+	if bids, _ := engine.GetOrderBook().GetDepth(5); len(bids) != 2 || bids[0].Price != 49000 || bids[0].Quantity != 10 {
+		t.Errorf("unexpected bids after session cancel: %+v", bids)
+	}
+}
+
+// TestRejectWrongSymbol 路由错误的订单被拒绝，不会与本交易对的流动性撮合
+func TestRejectWrongSymbol(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "maker", domain.SideSell, 50000, 10))
+
+	misrouted := domain.NewLimitOrder("B1", "ETHUSDT", "taker", domain.SideBuy, 50000, 10)
+	if err := engine.SubmitOrderSync(misrouted); !errors.Is(err, ErrWrongSymbol) {
+		t.Fatalf("expected ErrWrongSymbol, got %v", err)
+	}
+	if misrouted.Status != domain.OrderStatusRejected || misrouted.Filled != 0 {
+		t.Errorf("misrouted order status %v filled %d", misrouted.Status, misrouted.Filled)
+	}
+	if _, asks := engine.GetOrderBook().GetDepth(1); len(asks) != 1 || asks[0].Quantity != 10 {
+		t.Errorf("resting liquidity touched: %+v", asks)
+	}
+}
+
+// TestL3FeedReconstructsBook 按 L3 事件重建的订单簿与引擎订单簿一致
+func TestL3FeedReconstructsBook(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	var events []orderbook.L3Event
+	engine.SetL3Handler(func(event orderbook.L3Event) { events = append(events, event) })
+
+	for i := 0; i < 60; i++ {
+		side, price := domain.SideBuy, int64(49990-i%6*5)
+		if i%3 == 0 {
+			side, price = domain.SideSell, int64(49985+i%5*5) // 部分会与买单交叉成交
+		}
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("o%d", i), "BTCUSDT", "u", side, price, int64(3+i%7)))
+		switch i % 10 {
+		case 4:
+			engine.CancelOrder(fmt.Sprintf("o%d", i-1))
+		case 7:
+			engine.ReduceOrder(fmt.Sprintf("o%d", i-2), 1)
+		}
+	}
+	engine.callOnMatchingThread(func() error { return nil }) // 等待之前的撤单处理完毕
+
+	seen := make(map[orderbook.L3EventType]int)
+	for _, event := range events {
+		seen[event.Type]++
+	}
+	if seen[orderbook.L3Add] == 0 || seen[orderbook.L3Cancel] == 0 || seen[orderbook.L3Execute] == 0 {
+		t.Fatalf("expected all event types, got %v", seen)
+	}
+
+	type restingOrder struct {
+		side     domain.Side
+		price    int64
+		quantity int64
+	}
+	book := make(map[string]*restingOrder)
+	for i, event := range events {
+		if event.Seq != int64(i+1) {
+			t.Fatalf("sequence gap: event %d has seq %d", i, event.Seq)
+		}
+		switch event.Type {
+		case orderbook.L3Add:
+			book[event.OrderID] = &restingOrder{event.Side, event.Price, event.Quantity}
+		case orderbook.L3Cancel, orderbook.L3Execute:
+			order := book[event.OrderID]
+			if order == nil || order.quantity < event.Quantity {
+				t.Fatalf("event %+v for unknown or smaller order", event)
+			}
+			if order.quantity -= event.Quantity; order.quantity == 0 {
+				delete(book, event.OrderID)
+			}
+		}
+	}
+
+	depth := func(side domain.Side) map[int64]int64 {
+		levels := make(map[int64]int64)
+		for _, order := range book {
+			if order.side == side {
+				levels[order.price] += order.quantity
+			}
+		}
+		return levels
+	}
+	bids, asks := engine.GetOrderBook().GetDepth(100)
+	for side, actual := range map[domain.Side][]orderbook.PriceLevel{domain.SideBuy: bids, domain.SideSell: asks} {
+		rebuilt := depth(side)
+		if len(rebuilt) != len(actual) {
+			t.Fatalf("side %v: rebuilt %d levels, book has %d", side, len(rebuilt), len(actual))
+		}
+		for _, level := range actual {
+			if rebuilt[level.Price] != level.Quantity {
+				t.Errorf("side %v price %d: rebuilt %d, book %d", side, level.Price, rebuilt[level.Price], level.Quantity)
+			}
+		}
+	}
+
+	// ApplyL3 在空订单簿上重放事件：逐订单（含队列顺序）与引擎订单簿一致
+	replica := orderbook.NewOrderBook("BTCUSDT")
+	if err := replica.ApplyL3(events); err != nil {
+		t.Fatalf("ApplyL3: %v", err)
+	}
+	if replica.Seq() != int64(len(events)) {
+		t.Errorf("replica seq %d, want %d", replica.Seq(), len(events))
+	}
+	type queued struct {
+		id        string
+		side      domain.Side
+		price     int64
+		remaining int64
+	}
+	queue := func(snapshot orderbook.BookSnapshot) []queued {
+		out := make([]queued, len(snapshot.Orders))
+		for i, o := range snapshot.Orders {
+			out[i] = queued{o.ID, o.Side, o.Price, o.Quantity - o.Filled}
+		}
+		return out
+	}
+	var source orderbook.BookSnapshot
+	engine.callOnMatchingThread(func() error { source = engine.orderBook.Snapshot(); return nil })
+	if got, want := queue(replica.Snapshot()), queue(source); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed book:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+// TestLatencyHistogram 分桶边界连续，分位数误差在 25% 以内
+func TestLatencyHistogram(t *testing.T) {
+	for ns := int64(0); ns < 1<<16; ns++ {
+		i := latencyBucket(ns)
+		if ns > latencyBucketUpper(i) || (i > 0 && ns <= latencyBucketUpper(i-1)) {
+			t.Fatalf("value %d mapped to bucket %d with bounds (%d, %d]", ns, i, latencyBucketUpper(i-1), latencyBucketUpper(i))
+		}
+	}
+	if i := latencyBucket(1<<63 - 1); i >= latencyBuckets {
+		t.Fatalf("max duration mapped out of range: %d", i)
+	}
+
+	var h latencyHistogram
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Microsecond)
+	}
+	for _, c := range []struct {
+		q    float64
+		want time.Duration
+	}{{0.50, 500 * time.Microsecond}, {0.99, 990 * time.Microsecond}} {
+		got := h.quantile(c.q)
+		if got < c.want || float64(got) > float64(c.want)*1.25 {
+			t.Errorf("p%v = %v, want within [%v, +25%%]", c.q*100, got, c.want)
+		}
+	}
+	if h.quantile(1) != time.Millisecond {
+		t.Errorf("p100 = %v, want max 1ms", h.quantile(1))
+	}
+}
+
+// TestCancelLatencyMetrics 撤单处理延迟被记录并通过 Metrics() 暴露
+func TestCancelLatencyMetrics(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.MeasureCancelLatency = true
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("B%d", i)
+		engine.SubmitOrderSync(domain.NewLimitOrder(id, "BTCUSDT", "u", domain.SideBuy, 49000, 1))
+		engine.CancelOrder(id)
+	}
+	// 撤单排在其后提交的订单之前处理
+	engine.SubmitOrderSync(domain.NewLimitOrder("barrier", "BTCUSDT", "u", domain.SideBuy, 48000, 1))
+
+	m := engine.Metrics()
+	if m.CancelsProcessed != 10 {
+		t.Fatalf("expected 10 cancels recorded, got %d", m.CancelsProcessed)
+	}
+	if m.CancelLatencyP50 <= 0 || m.CancelLatencyP50 > m.CancelLatencyP99 || m.CancelLatencyP99 > m.CancelLatencyMax {
+		t.Errorf("inconsistent percentiles: %+v", m)
+	}
+
+	// 默认关闭，不记录
+	quiet := NewMatchingEngine("BTCUSDT")
+	quiet.Start()
+	defer quiet.Stop()
+	quiet.CancelOrder("missing")
+	quiet.SubmitOrderSync(domain.NewLimitOrder("barrier", "BTCUSDT", "u", domain.SideBuy, 48000, 1))
+	if n := quiet.Metrics().CancelsProcessed; n != 0 {
+		t.Errorf("expected no cancels recorded when disabled, got %d", n)
+	}
+}
+
+// TestWithFrozenView 冻结视图内的多次查询看到同一时刻的状态
+func TestWithFrozenView(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "u", domain.SideBuy, 49990, 5))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "u", domain.SideSell, 50010, 7))
+
+	// 后台持续下单并立即撤单，冻结视图内不应观察到撕裂状态
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			id := fmt.Sprintf("N%d", i)
+			engine.SubmitOrder(domain.NewLimitOrder(id, "BTCUSDT", "n", domain.SideBuy, 50000, 1))
+			engine.CancelOrder(id)
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		err := engine.WithFrozenView(func(view orderbook.ReadOnlyBook) {
+			bid := view.GetBestBid()
+			bids, _ := view.GetDepth(1)
+			level := view.LevelAt(domain.SideBuy, bid)
+			if len(bids) != 1 || bids[0].Price != bid || bids[0] != level || level.Quantity != view.VolumeInRange(domain.SideBuy, bid, bid) {
+				t.Errorf("torn view: bid %d depth %+v level %+v", bid, bids, level)
+			}
+			if ask := view.LevelAt(domain.SideSell, view.GetBestAsk()); ask.Quantity != 7 {
+				t.Errorf("unexpected ask level %+v", ask)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	<-done
+}
+
+// TestFillQualityMetrics 扫档数、价格改善和部分成交率按主动单统计
+func TestFillQualityMetrics(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	for i, price := range []int64{100, 101, 102} {
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("a%d", i), "BTCUSDT", "maker", domain.SideSell, price, 5))
+	}
+	// 限价 103 扫 3 档共 12：改善 3*5 + 2*5 + 1*2 = 27，每单位 2.25
+	engine.SubmitOrderSync(domain.NewLimitOrder("sweep", "BTCUSDT", "taker", domain.SideBuy, 103, 12))
+	// 按限价成交 2、剩余 3 挂单：无改善，部分成交
+	engine.SubmitOrderSync(domain.NewLimitOrder("b0", "BTCUSDT", "maker", domain.SideBuy, 90, 2))
+	engine.SubmitOrderSync(domain.NewLimitOrder("partial", "BTCUSDT", "taker", domain.SideSell, 90, 5))
+
+	m := engine.Metrics()
+	if m.AggressiveOrders != 2 {
+		t.Fatalf("expected 2 aggressive orders (resting makers excluded), got %d", m.AggressiveOrders)
+	}
+	if m.AvgLevelsSwept != 2 || m.PartialFillRate != 0.5 {
+		t.Errorf("levels %.2f partial rate %.2f, want 2 and 0.5", m.AvgLevelsSwept, m.PartialFillRate)
+	}
+	if m.PriceImprovedOrders != 1 || m.AvgPriceImprovement != 2.25 {
+		t.Errorf("improved %d by %.2f, want 1 by 2.25", m.PriceImprovedOrders, m.AvgPriceImprovement)
+	}
+}
+
+// TestSyncEngine 同步引擎直接返回成交，无需轮询；与异步引擎处理同一订单流的结果完全一致
+func TestSyncEngine(t *testing.T) {
+	se := NewSyncEngine("BTCUSDT")
+	if trades, err := se.SubmitOrder(domain.NewLimitOrder("s1", "BTCUSDT", "maker", domain.SideSell, 50000, 3)); err != nil || len(trades) != 0 {
+		t.Fatalf("resting order: %d trades, err %v", len(trades), err)
+	}
+	trades, err := se.SubmitOrder(domain.NewLimitOrder("b1", "BTCUSDT", "taker", domain.SideBuy, 50000, 2))
+	if err != nil || len(trades) != 1 || trades[0].Quantity != 2 || trades[0].SellOrderID != "s1" {
+		t.Fatalf("expected one trade of 2 against s1, got %d trades, err %v", len(trades), err)
+	}
+	if ok, err := se.CancelOrder("s1"); !ok || err != nil || se.GetOrderBook().GetBestAsk() != 0 {
+		t.Fatalf("cancel: err %v, best ask %d", err, se.GetOrderBook().GetBestAsk())
+	}
+	if _, err := se.SubmitOrder(domain.NewLimitOrder("bad", "ETHUSDT", "u", domain.SideBuy, 50000, 1)); !errors.Is(err, ErrWrongSymbol) {
+		t.Errorf("expected ErrWrongSymbol, got %v", err)
+	}
+
+	// 同一确定性订单流分别喂给两个引擎
+	tradeKey := func(trade *domain.Trade) string {
+		return fmt.Sprintf("%s/%s@%d×%d", trade.BuyOrderID, trade.SellOrderID, trade.Price, trade.Quantity)
+	}
+	engine := NewMatchingEngine("BTCUSDT")
+	var async []string
+	engine.OnTrade(func(trade *domain.Trade) { async = append(async, tradeKey(trade)) })
+	engine.Start()
+	defer engine.Stop()
+
+	se = NewSyncEngine("BTCUSDT")
+	var direct []string
+	asyncFlow, syncFlow := orderflow.NewGenerator(orderflow.DefaultConfig()), orderflow.NewGenerator(orderflow.DefaultConfig())
+	for i := 0; i < 5000; i++ {
+		a, b := asyncFlow.Next(), syncFlow.Next()
+		if a.Type == orderflow.ActionCancel {
+			engine.CancelOrderSync(a.CancelID)
+			se.CancelOrder(b.CancelID)
+			continue
+		}
+		engine.SubmitOrderSync(a.Order)
+		trades, _ := se.SubmitOrder(b.Order)
+		for _, trade := range trades {
+			direct = append(direct, tradeKey(trade))
+		}
+	}
+
+	if len(direct) == 0 || !reflect.DeepEqual(async, direct) {
+		t.Fatalf("trade streams differ: async %d trades, sync %d", len(async), len(direct))
+	}
+	asyncBids, asyncAsks := engine.GetOrderBook().GetDepth(1000)
+	syncBids, syncAsks := se.GetOrderBook().GetDepth(1000)
+	if !reflect.DeepEqual(asyncBids, syncBids) || !reflect.DeepEqual(asyncAsks, syncAsks) {
+		t.Error("books differ after the same flow")
+	}
+}
+
+// TestMidpointExecution 暗单按公开 BBO 中间价成交；中间价不在 tick 上时按策略取整，且不劣于双方限价
+func TestMidpointExecution(t *testing.T) {
+	cases := []struct {
+		name     string
+		tick     int64
+		rounding MidpointRounding
+		darkAt   int64 // 暗单（卖）挂单价
+		buyAt    int64 // 主动买单限价
+		want     int64
+	}{
+		{"favor resting rounds up", 0, MidpointFavorResting, 100, 104, 102},
+		{"favor aggressor rounds down", 0, MidpointFavorAggressor, 100, 104, 101},
+		{"tick 4 favor resting", 4, MidpointFavorResting, 100, 104, 104},
+		{"tick 4 favor aggressor", 4, MidpointFavorAggressor, 100, 104, 100},
+		{"midpoint below dark limit", 0, MidpointFavorResting, 104, 104, 104},
+		{"midpoint above aggressor limit", 0, MidpointFavorResting, 100, 101, 101},
+	}
+	for _, tc := range cases {
+		cfg := DefaultSymbolConfig()
+		cfg.TickSize = tc.tick
+		cfg.MidpointRounding = tc.rounding
+		se := NewSyncEngineWithConfig("BTCUSDT", cfg)
+
+		// 公开报价 96 / 108，中间价 102（tick 为 0 时再错开 1 变成 101.5）
+		bid, ask := int64(96), int64(108)
+		if tc.tick == 0 {
+			bid = 95
+		}
+		se.SubmitOrder(domain.NewLimitOrder("bid", "BTCUSDT", "mm", domain.SideBuy, bid, 5))
+		se.SubmitOrder(domain.NewLimitOrder("ask", "BTCUSDT", "mm", domain.SideSell, ask, 5))
+		dark := domain.NewLimitOrder("dark", "BTCUSDT", "dark", domain.SideSell, tc.darkAt, 3)
+		dark.ExecInst = domain.ExecHidden | domain.ExecMidpoint
+		se.SubmitOrder(dark)
+
+		trades, err := se.SubmitOrder(domain.NewLimitOrder("buy", "BTCUSDT", "taker", domain.SideBuy, tc.buyAt, 2))
+		if err != nil || len(trades) != 1 || trades[0].SellOrderID != "dark" {
+			t.Fatalf("%s: expected one trade against the dark order, got %d (err %v)", tc.name, len(trades), err)
+		}
+		if trades[0].Price != tc.want {
+			t.Errorf("%s: executed at %d, want %d", tc.name, trades[0].Price, tc.want)
+		}
+	}
+
+	// 普通挂单不受影响：按挂单价成交
+	se := NewSyncEngine("BTCUSDT")
+	se.SubmitOrder(domain.NewLimitOrder("bid", "BTCUSDT", "mm", domain.SideBuy, 90, 5))
+	se.SubmitOrder(domain.NewLimitOrder("ask", "BTCUSDT", "mm", domain.SideSell, 100, 5))
+	if trades, _ := se.SubmitOrder(domain.NewLimitOrder("buy", "BTCUSDT", "taker", domain.SideBuy, 100, 1)); len(trades) != 1 || trades[0].Price != 100 {
+		t.Errorf("lit order should trade at its own price, got %+v", trades)
+	}
+
+	// 反向合约：买方偏好更高的价格，限价按 Crosses 截断
+	inverted := []struct {
+		name     string
+		rounding MidpointRounding
+		darkAt   int64 // 暗单（卖）挂单价，越低对卖方越有利
+		want     int64
+	}{
+		{"inverted favor resting", MidpointFavorResting, 99, 97},
+		{"inverted favor aggressor", MidpointFavorAggressor, 99, 98},
+		{"inverted midpoint past dark limit", MidpointFavorAggressor, 97, 97},
+	}
+	for _, tc := range inverted {
+		cfg := DefaultSymbolConfig()
+		cfg.PriceOrdering = orderbook.PriceOrderingInverted
+		cfg.MidpointRounding = tc.rounding
+		se := NewSyncEngineWithConfig("BTCUSD-INV", cfg)
+
+		// 公开报价 100 / 95，中间价 97.5
+		se.SubmitOrder(domain.NewLimitOrder("bid", "BTCUSD-INV", "mm", domain.SideBuy, 100, 5))
+		se.SubmitOrder(domain.NewLimitOrder("ask", "BTCUSD-INV", "mm", domain.SideSell, 95, 5))
+		dark := domain.NewLimitOrder("dark", "BTCUSD-INV", "dark", domain.SideSell, tc.darkAt, 3)
+		dark.ExecInst = domain.ExecHidden | domain.ExecMidpoint
+		se.SubmitOrder(dark)
+
+		trades, _ := se.SubmitOrder(domain.NewLimitOrder("buy", "BTCUSD-INV", "taker", domain.SideBuy, 90, 2))
+		if len(trades) != 1 || trades[0].SellOrderID != "dark" || trades[0].Price != tc.want {
+			t.Errorf("%s: want one trade against the dark order at %d, got %+v", tc.name, tc.want, trades)
+		}
+	}
+}
+
+// TestEnginePeekMatch 引擎级预览与真实首笔撮合一致：跳过 last look 否决的挂单，暗单按中间价
+func TestEnginePeekMatch(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("bid", "BTCUSDT", "mm", domain.SideBuy, 96, 5))
+	engine.SubmitOrderSync(domain.NewLimitOrder("ask", "BTCUSDT", "mm", domain.SideSell, 108, 5))
+	dark := domain.NewLimitOrder("dark", "BTCUSDT", "dark", domain.SideSell, 100, 3)
+	dark.ExecInst = domain.ExecHidden | domain.ExecMidpoint | domain.ExecLastLook
+	engine.SubmitOrderSync(dark)
+
+	taker := domain.NewLimitOrder("buy", "BTCUSDT", "taker", domain.SideBuy, 104, 2)
+	if ok, price, qty := engine.PeekMatch(taker); !ok || price != 102 || qty != 2 {
+		t.Errorf("midpoint peek: %v %d %d, want true 102 2", ok, price, qty)
+	}
+
+	// last look 否决的挂单被跳过，同档后面的订单接手
+	engine.SubmitOrderSync(domain.NewLimitOrder("lit", "BTCUSDT", "mm", domain.SideSell, 100, 1))
+	engine.SetLastLookHandler(func(_, resting *domain.Order) bool { return resting.ID != "dark" })
+	if ok, price, qty := engine.PeekMatch(taker); !ok || price != 100 || qty != 1 {
+		t.Errorf("last-look peek: %v %d %d, want true 100 1", ok, price, qty)
+	}
+	engine.SubmitOrderSync(taker)
+	if taker.Filled != 1 || dark.Filled != 0 {
+		t.Errorf("real match: taker filled %d, dark filled %d; want 1 and 0", taker.Filled, dark.Filled)
+	}
+}
+
+// TestTradeTags 订单标签按吃单/挂单角色带到成交上；对象池复用后标签被清空
+func TestTradeTags(t *testing.T) {
+	se := NewSyncEngine("BTCUSDT")
+	maker := domain.NewLimitOrder("s1", "BTCUSDT", "mm", domain.SideSell, 50000, 2)
+	maker.Tag = "quoter"
+	se.SubmitOrder(maker)
+	taker := domain.NewLimitOrder("b1", "BTCUSDT", "algo", domain.SideBuy, 50000, 1)
+	taker.Tag = "strategy-7"
+	trades, _ := se.SubmitOrder(taker)
+	if len(trades) != 1 || trades[0].TakerTag != "strategy-7" || trades[0].MakerTag != "quoter" {
+		t.Fatalf("buy taker: expected taker/maker tags strategy-7/quoter, got %+v", trades)
+	}
+
+	// 卖方吃单：角色互换
+	se.SubmitOrder(domain.NewLimitOrder("b2", "BTCUSDT", "mm", domain.SideBuy, 49999, 1))
+	seller := domain.NewLimitOrder("s2", "BTCUSDT", "algo", domain.SideSell, 49999, 1)
+	seller.Tag = "hedger"
+	trades, _ = se.SubmitOrder(seller)
+	if len(trades) != 1 || trades[0].TakerTag != "hedger" || trades[0].MakerTag != "" {
+		t.Fatalf("sell taker: expected taker tag hedger and untagged maker, got %+v", trades)
+	}
+
+	trades[0].Reset()
+	taker.Reset()
+	if trades[0].TakerTag != "" || taker.Tag != "" {
+		t.Error("Reset should clear tags before pool reuse")
+	}
+}
+
+// TestCancelOrders 批量撤单：存在、不存在、重复和条件单混合，逐个返回结果
+func TestCancelOrders(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	for i := 0; i < 3; i++ {
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("b%d", i), "BTCUSDT", "u", domain.SideBuy, int64(49990+i), 1))
+	}
+	stop := domain.NewLimitOrder("stop", "BTCUSDT", "u", domain.SideSell, 0, 1)
+	stop.Type, stop.TriggerPrice = domain.OrderTypeStop, 49000
+	engine.SubmitOrderSync(stop)
+
+	got := engine.CancelOrders([]string{"b0", "missing", "b2", "b0", "stop"})
+	if want := []bool{true, false, true, false, true}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("CancelOrders = %v, want %v", got, want)
+	}
+	if bids, _ := engine.GetOrderBook().GetDepth(10); len(bids) != 1 || bids[0].Price != 49991 {
+		t.Errorf("expected only b1 left, got %+v", bids)
+	}
+	if n := engine.PendingStopCount(); n != 0 {
+		t.Errorf("stop order still pending: %d", n)
+	}
+	if got := engine.CancelOrders(nil); len(got) != 0 {
+		t.Errorf("empty batch should return an empty result, got %v", got)
+	}
+}
+
+// sequencerIDs 模拟外部集中分配的成交 ID
+type sequencerIDs struct{ next int }
+
+func (s *sequencerIDs) Next() string {
+	s.next++
+	return fmt.Sprintf("SEQ-%06d", s.next)
+}
+
+// TestTradeIDProvider 外部 IDProvider 生成的 ID 出现在发布到成交缓冲区的成交上
+func TestTradeIDProvider(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.TradeIDs = &sequencerIDs{next: 41}
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("s1", "BTCUSDT", "maker", domain.SideSell, 50000, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("s2", "BTCUSDT", "maker", domain.SideSell, 50001, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("b1", "BTCUSDT", "taker", domain.SideBuy, 50001, 2))
+
+	consumer := engine.GetTradeBuffer().NewTradeConsumerBatchSafe()
+	var ids []string
+	for trade, ok := consumer.TryConsume(); ok; trade, ok = consumer.TryConsume() {
+		ids = append(ids, trade.ID)
+		trade.Destroy()
+	}
+	if want := []string{"SEQ-000042", "SEQ-000043"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("trade IDs %v, want %v", ids, want)
+	}
+
+	// 默认仍使用内部 IDGenerator
+	se := NewSyncEngine("BTCUSDT")
+	se.SubmitOrder(domain.NewLimitOrder("s", "BTCUSDT", "maker", domain.SideSell, 50000, 1))
+	if trades, _ := se.SubmitOrder(domain.NewLimitOrder("b", "BTCUSDT", "taker", domain.SideBuy, 50000, 1)); len(trades) != 1 || trades[0].ID != "T1" {
+		t.Errorf("default provider: expected trade T1, got %+v", trades)
+	}
+}
+
+// TestMatchReport 同步提交返回一份完整报告：吃单成交、剩余挂单、状态，以及被触发止损单作为挂单方的成交
+func TestMatchReport(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("s1", "BTCUSDT", "maker", domain.SideSell, 50000, 2))
+	engine.SubmitOrderSync(domain.NewLimitOrder("s2", "BTCUSDT", "maker", domain.SideSell, 50001, 1))
+	stop := domain.NewLimitOrder("stop", "BTCUSDT", "stopper", domain.SideSell, 0, 1)
+	stop.Type, stop.TriggerPrice = domain.OrderTypeStop, 50001
+	engine.SubmitOrderSync(stop)
+
+	// 吃掉两档共 3，剩余 2 挂在 50001；成交价 50001 触发止损卖单，吃掉剩余中的 1
+	report, err := engine.SubmitOrderWithReport(domain.NewLimitOrder("b1", "BTCUSDT", "taker", domain.SideBuy, 50001, 5))
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if report.OrderID != "b1" || report.RestedQty != 1 || report.Status != domain.OrderStatusPartialFilled {
+		t.Errorf("unexpected summary: %+v", report)
+	}
+	var got []string
+	for _, view := range report.Trades {
+		got = append(got, fmt.Sprintf("%s@%d×%d maker=%v", view.CounterpartyOrderID, view.Price, view.Quantity, view.Maker))
+	}
+	want := []string{"s1@50000×2 maker=false", "s2@50001×1 maker=false", "stop@50001×1 maker=true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trades %v, want %v", got, want)
+	}
+
+	// 被拒绝的订单：报告为空成交，状态为拒绝
+	report, err = engine.SubmitOrderWithReport(domain.NewLimitOrder("bad", "ETHUSDT", "u", domain.SideBuy, 50000, 1))
+	if !errors.Is(err, ErrWrongSymbol) || report.Status != domain.OrderStatusRejected || len(report.Trades) != 0 {
+		t.Errorf("rejected order: %+v, err %v", report, err)
+	}
+}
+
+// TestFillReporting 多价位扫单：逐笔模式每笔成交一条事件，按单模式只有一条汇总事件
+func TestFillReporting(t *testing.T) {
+	sweep := func(mode FillReporting) []FillEvent {
+		cfg := DefaultSymbolConfig()
+		cfg.FillReporting = mode
+		engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+
+		var events []FillEvent
+		engine.SetFillHandler(func(event FillEvent) {
+			events = append(events, event)
+		})
+		engine.Start()
+		defer engine.Stop()
+
+		engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 50000, 30))
+		engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "m2", domain.SideSell, 50010, 20))
+		engine.SubmitOrderSync(domain.NewLimitOrder("S3", "BTCUSDT", "m3", domain.SideSell, 50020, 40))
+		if len(events) != 0 {
+			t.Fatalf("resting makers must not emit fill events: %+v", events)
+		}
+		// 扫三个价位成交 90，剩余 10 挂单
+		if err := engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "taker", domain.SideBuy, 50020, 100)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return events
+	}
+
+	perFill := sweep(FillPerFill)
+	if len(perFill) != 3 {
+		t.Fatalf("per-fill: expected 3 events, got %d", len(perFill))
+	}
+	wantQty := []int64{30, 20, 40}
+	wantPrice := []int64{50000, 50010, 50020}
+	var cum int64
+	for i, event := range perFill {
+		cum += wantQty[i]
+		if event.OrderID != "B1" || event.FillCount != 1 || event.Quantity != wantQty[i] ||
+			event.AvgPrice != wantPrice[i] || event.CumQty != cum || event.LeavesQty != 100-cum {
+			t.Errorf("per-fill event %d: %+v", i, event)
+		}
+	}
+
+	perOrder := sweep(FillPerOrder)
+	if len(perOrder) != 1 {
+		t.Fatalf("per-order: expected 1 event, got %d", len(perOrder))
+	}
+	event := perOrder[0]
+	wantNotional := int64(50000*30 + 50010*20 + 50020*40)
+	if event.OrderID != "B1" || event.FillCount != 3 || event.Quantity != 90 ||
+		event.CumQty != 90 || event.LeavesQty != 10 {
+		t.Errorf("per-order event: %+v", event)
+	}
+	if event.Notional != wantNotional || event.AvgPrice != wantNotional/90 {
+		t.Errorf("per-order VWAP: notional %d avg %d", event.Notional, event.AvgPrice)
+	}
+	if event.LastTradeID != perFill[2].LastTradeID {
+		t.Errorf("per-order event should end at the last trade: %s vs %s", event.LastTradeID, perFill[2].LastTradeID)
+	}
+}
+
+// TestReferencePrice 启动时注入参考价：首笔成交前价格带即生效，成交后默认改用最新成交价
+func TestReferencePrice(t *testing.T) {
+	newEngine := func(reference PriceBandReference) *MatchingEngine {
+		cfg := DefaultSymbolConfig()
+		cfg.PriceBand = PriceBandConfig{MaxDeviationBps: 500, Reference: reference} // ±5%
+		engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+		engine.Start()
+		return engine
+	}
+
+	engine := newEngine(BandFromLastTrade)
+	defer engine.Stop()
+
+	// 没有参考价也没有成交：不检查
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("B0", "BTCUSDT", "u1", domain.SideBuy, 10000, 1)); err != nil {
+		t.Fatalf("no reference yet, got %v", err)
+	}
+
+	engine.SetReferencePrice(50000)
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "u2", domain.SideSell, 60000, 1)); !errors.Is(err, ErrOutsidePriceBand) {
+		t.Errorf("order 20%% above the seeded reference: got %v, want ErrOutsidePriceBand", err)
+	}
+	if _, asks := engine.GetOrderBook().GetDepth(1); len(asks) != 0 {
+		t.Errorf("rejected order rests in the book: %+v", asks)
+	}
+
+	// 带内成交于 52000 后，价格带以最新成交价为中心
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "u2", domain.SideSell, 52000, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "u1", domain.SideBuy, 52000, 1))
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("S3", "BTCUSDT", "u2", domain.SideSell, 54500, 1)); err != nil {
+		t.Errorf("within 5%% of the last trade: got %v", err)
+	}
+
+	// 固定参考价模式：成交后仍以注入的参考价为中心
+	fixed := newEngine(BandFromReferencePrice)
+	defer fixed.Stop()
+	fixed.SetReferencePrice(50000)
+	fixed.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "u2", domain.SideSell, 52000, 1))
+	fixed.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "u1", domain.SideBuy, 52000, 1))
+	if err := fixed.SubmitOrderSync(domain.NewLimitOrder("S3", "BTCUSDT", "u2", domain.SideSell, 54500, 1)); !errors.Is(err, ErrOutsidePriceBand) {
+		t.Errorf("fixed reference: got %v, want ErrOutsidePriceBand", err)
+	}
+
+	// 参考价同时作为熔断窗口的起点：首笔成交即可触发
+	cfg := DefaultSymbolConfig()
+	cfg.CircuitBreaker = CircuitBreakerConfig{MaxMoveBps: 100, Window: 10, Cooldown: time.Minute}
+	breaker := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	breaker.Start()
+	defer breaker.Stop()
+	breaker.SetReferencePrice(50000)
+	breaker.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "u2", domain.SideSell, 51000, 1))
+	breaker.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "u1", domain.SideBuy, 51000, 1))
+	if err := breaker.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "u1", domain.SideBuy, 50000, 1)); !errors.Is(err, ErrTradingHalted) {
+		t.Errorf("first trade 2%% from the reference should trip the breaker: got %v", err)
+	}
+}
+
+// TestCancelOlderThan 按受理时间清理遗留挂单：不受 MinRestTime 限制，新单保留
+func TestCancelOlderThan(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)}
+	cfg := DefaultSymbolConfig()
+	cfg.Clock = clock
+	cfg.MinRestTime = time.Hour
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("old-b1", "BTCUSDT", "u1", domain.SideBuy, 49900, 10))
+	engine.SubmitOrderSync(domain.NewLimitOrder("old-s1", "BTCUSDT", "u2", domain.SideSell, 50100, 10))
+	clock.Advance(time.Minute)
+	cutoff := clock.Now()
+	engine.SubmitOrderSync(domain.NewLimitOrder("new-b2", "BTCUSDT", "u3", domain.SideBuy, 49900, 5))
+
+	cancelled, err := engine.CancelOlderThan(cutoff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cancelled) != 2 || cancelled[0] != "old-b1" || cancelled[1] != "old-s1" {
+		t.Errorf("cancelled %v, want [old-b1 old-s1]", cancelled)
+	}
+	bids, asks := engine.GetOrderBook().GetDepth(5)
+	if len(bids) != 1 || bids[0].Quantity != 5 || len(asks) != 0 {
+		t.Errorf("unexpected book after cleanup: bids %+v asks %+v", bids, asks)
+	}
+}
+
+// TestPriorityAudit 公平性审计：混合冰山单、last look 否决与自成交防护的订单流不应报违规；
+// 人为指定排在队列后面或更差价位的对手单时应报违规
+func TestPriorityAudit(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.PriorityAudit = true
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+
+	var violations []PriorityViolation
+	engine.SetPriorityViolationHandler(func(v PriorityViolation) { violations = append(violations, v) })
+	engine.SetSelfTradePrevention(STPDecrementBoth)
+	vetoes := 0
+	engine.SetLastLookHandler(func(aggressor, resting *domain.Order) bool {
+		vetoes++
+		return vetoes%2 == 0
+	})
+	engine.Start()
+	defer engine.Stop()
+
+	flow := orderflow.NewGenerator(orderflow.DefaultConfig())
+	for i := 0; i < 5000; i++ {
+		action := flow.Next()
+		if action.Type == orderflow.ActionCancel {
+			engine.CancelOrderSync(action.CancelID)
+			continue
+		}
+		order := action.Order
+		if order.Type == domain.OrderTypeLimit {
+			switch i % 10 {
+			case 3:
+				order.ExecInst |= domain.ExecLastLook
+			case 7:
+				order.DisplayQty = max(order.Quantity/3, 1)
+			}
+		}
+		engine.SubmitOrderSync(order)
+	}
+	if vetoes == 0 {
+		t.Fatal("flow exercised no last-look vetoes")
+	}
+	if len(violations) != 0 {
+		t.Fatalf("%d priority violations, first: %+v", len(violations), violations[0])
+	}
+
+	// 直接审计人为选错的对手单（在撮合线程上调用）
+	engine = NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.SetPriorityViolationHandler(func(v PriorityViolation) { violations = append(violations, v) })
+	engine.Start()
+	defer engine.Stop()
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 10, 5))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "m2", domain.SideSell, 10, 5))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S3", "BTCUSDT", "m3", domain.SideSell, 11, 5))
+	var skipped, worse PriorityViolation
+	engine.WithFrozenView(func(orderbook.ReadOnlyBook) {
+		book := engine.orderBook
+		taker := domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 11, 5)
+		engine.auditPriority(taker, book.GetOrder("S2"), 10)
+		engine.auditPriority(taker, book.GetOrder("S3"), 11)
+		skipped, worse = violations[0], violations[1]
+	})
+	if skipped.RestingOrderID != "S2" || skipped.ExpectedOrderID != "S1" {
+		t.Errorf("queue skip not reported: %+v", skipped)
+	}
+	if worse.RestingOrderID != "S3" || worse.ExpectedPrice != 10 || worse.ExpectedOrderID != "S1" {
+		t.Errorf("worse price level not reported: %+v", worse)
+	}
+}
+
+// TestTopLevelOnlyMarket 仅限最优档的全部成交市价单：最优档不足则整单撤销，不向更深价位扫单
+func TestTopLevelOnlyMarket(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.SetLastLookHandler(func(aggressor, resting *domain.Order) bool { return false })
+	engine.Start()
+	defer engine.Stop()
+
+	var prices []int64
+	engine.OnTrade(func(trade *domain.Trade) { prices = append(prices, trade.Price) })
+
+	market := func(id string, qty int64) *domain.Order {
+		o := domain.NewLimitOrder(id, "BTCUSDT", "taker", domain.SideBuy, 0, qty)
+		o.Type = domain.OrderTypeMarket
+		o.ExecInst = domain.ExecTopLevelOnly
+		return o
+	}
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 100, 30))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "m2", domain.SideSell, 101, 50))
+
+	// 最优档只有 30，买 40：不成交、整单撤销（普通市价单会扫到 101）
+	short := market("B1", 40)
+	engine.SubmitOrderSync(short)
+	if len(prices) != 0 || short.Status != domain.OrderStatusCancelled || short.Filled != 0 {
+		t.Errorf("insufficient top level: trades at %v, status %v, filled %d", prices, short.Status, short.Filled)
+	}
+	if _, asks := engine.GetOrderBook().GetDepth(5); len(asks) != 2 || asks[0].Quantity != 30 {
+		t.Errorf("book touched by a cancelled order: %+v", asks)
+	}
+
+	// 最优档足够：只在 100 成交
+	fits := market("B2", 20)
+	engine.SubmitOrderSync(fits)
+	if len(prices) != 1 || prices[0] != 100 || fits.Status != domain.OrderStatusFilled {
+		t.Errorf("fillable at top: trades at %v, status %v", prices, fits.Status)
+	}
+
+	// 最优档量够但部分被 last look 否决：剩余撤销，不扫下一档
+	vetoed := domain.NewLimitOrder("S3", "BTCUSDT", "m3", domain.SideSell, 100, 10)
+	vetoed.ExecInst = domain.ExecLastLook
+	engine.SubmitOrderSync(vetoed)
+	partial := market("B3", 15)
+	engine.SubmitOrderSync(partial)
+	if partial.Filled != 10 || partial.Status != domain.OrderStatusCancelled {
+		t.Errorf("vetoed remainder: filled %d, status %v", partial.Filled, partial.Status)
+	}
+	for _, price := range prices {
+		if price != 100 {
+			t.Errorf("traded beyond the top level at %d", price)
+		}
+	}
+
+	// 限价单不支持该指令
+	limit := domain.NewLimitOrder("B4", "BTCUSDT", "taker", domain.SideBuy, 101, 5)
+	limit.ExecInst = domain.ExecTopLevelOnly
+	if err := engine.SubmitOrderSync(limit); !errors.Is(err, ErrTopLevelOnlyLimit) {
+		t.Errorf("limit order: got %v, want ErrTopLevelOnlyLimit", err)
+	}
+}
+
+// TestEngineUptime 启动时间、运行时长、循环计数和最后处理时间；撮合线程卡住时 Health 仍可响应但时间戳冻结
+func TestEngineUptime(t *testing.T) {
+	start := time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)
+	clock := &manualClock{now: start}
+	cfg := DefaultSymbolConfig()
+	cfg.Clock = clock
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+
+	if h := engine.Health(); !h.StartedAt.IsZero() || h.Uptime != 0 || !h.LastProcessedAt.IsZero() {
+		t.Errorf("not started: %+v", h)
+	}
+	engine.Start()
+	defer engine.Stop()
+
+	clock.Advance(time.Minute)
+	for i := 0; i < 3; i++ {
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("B%d", i), "BTCUSDT", "u1", domain.SideBuy, 49900, 1))
+	}
+	clock.Advance(time.Hour)
+
+	h := engine.Health()
+	if !h.StartedAt.Equal(start) || h.Uptime != time.Hour+time.Minute || !h.LastProcessedAt.Equal(start.Add(time.Minute)) {
+		t.Errorf("unexpected liveness: started %v uptime %v last %v", h.StartedAt, h.Uptime, h.LastProcessedAt)
+	}
+	if m := engine.Metrics(); m.OrdersProcessed != 3 || m.LoopIterations < 3 {
+		t.Errorf("unexpected counters: %d orders, %d iterations", m.OrdersProcessed, m.LoopIterations)
+	}
+
+	// 控制命令阻塞撮合线程：Health 照常返回，最后处理时间不再前进
+	frozen, release := make(chan struct{}), make(chan struct{})
+	go engine.WithFrozenView(func(orderbook.ReadOnlyBook) {
+		close(frozen)
+		<-release
+	})
+	<-frozen
+	engine.SubmitOrder(domain.NewLimitOrder("B9", "BTCUSDT", "u1", domain.SideBuy, 49900, 1))
+	clock.Advance(time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	if h := engine.Health(); !h.LastProcessedAt.Equal(start.Add(time.Minute)) {
+		t.Errorf("stalled engine advanced LastProcessedAt to %v", h.LastProcessedAt)
+	}
+
+	close(release)
+	if !waitForCondition(func() bool { return engine.Metrics().OrdersProcessed == 4 }, time.Second, time.Millisecond) {
+		t.Fatal("engine did not resume")
+	}
+	if h := engine.Health(); !h.LastProcessedAt.Equal(start.Add(time.Hour + 2*time.Minute)) {
+		t.Errorf("LastProcessedAt %v after resuming", h.LastProcessedAt)
+	}
+
+	// 模拟模式：虚拟时钟在首个订单前为零值，启动时间取首个订单的虚拟时间
+	simCfg := DefaultSymbolConfig()
+	simCfg.Simulation = true
+	sim := NewMatchingEngineWithConfig("ETHUSDT", simCfg)
+	sim.Start()
+	defer sim.Stop()
+	if h := sim.Health(); !h.StartedAt.IsZero() || h.Uptime != 0 {
+		t.Errorf("simulation before the first order: started %v uptime %v", h.StartedAt, h.Uptime)
+	}
+	first := domain.NewLimitOrder("E1", "ETHUSDT", "u1", domain.SideBuy, 3000, 1)
+	first.Timestamp = start
+	sim.SubmitOrderSync(first)
+	if h := sim.Health(); !h.StartedAt.Equal(start) {
+		t.Errorf("simulation StartedAt %v, want the first order's time %v", h.StartedAt, start)
+	}
+}
+
+// TestMarketOrderSlippageCap 市价单滑点保护：薄盘口下扫到超出 到达时最优价 ± bps 的价位即停止，剩余撤销
+func TestMarketOrderSlippageCap(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	var prices []int64
+	engine.OnTrade(func(trade *domain.Trade) { prices = append(prices, trade.Price) })
+
+	market := func(id string, side domain.Side, qty, bps int64) *domain.Order {
+		o := domain.NewLimitOrder(id, "BTCUSDT", "taker", side, 0, qty)
+		o.Type = domain.OrderTypeMarket
+		o.MaxSlippageBps = bps
+		return o
+	}
+	for i, price := range []int64{10000, 10100, 10300, 11000} {
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("S%d", i), "BTCUSDT", "m", domain.SideSell, price, 10))
+	}
+	for i, price := range []int64{9000, 8900, 8500} {
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("B%d", i), "BTCUSDT", "m", domain.SideBuy, price, 10))
+	}
+
+	// 买 40，上限 3%：界限 10300，成交 30，11000 档不动
+	buy := market("MB", domain.SideBuy, 40, 300)
+	engine.SubmitOrderSync(buy)
+	if !reflect.DeepEqual(prices, []int64{10000, 10100, 10300}) {
+		t.Errorf("buy sweep traded at %v", prices)
+	}
+	if buy.Filled != 30 || buy.Status != domain.OrderStatusCancelled {
+		t.Errorf("buy: filled %d, status %v; want 30 and cancelled", buy.Filled, buy.Status)
+	}
+	if _, asks := engine.GetOrderBook().GetDepth(5); len(asks) != 1 || asks[0].Price != 11000 || asks[0].Quantity != 10 {
+		t.Errorf("level past the bound was touched: %+v", asks)
+	}
+
+	// 卖 30，上限 2%：界限 8820，成交 20，8500 档不动
+	prices = prices[:0]
+	sell := market("MS", domain.SideSell, 30, 200)
+	engine.SubmitOrderSync(sell)
+	if !reflect.DeepEqual(prices, []int64{9000, 8900}) || sell.Filled != 20 || sell.Status != domain.OrderStatusCancelled {
+		t.Errorf("sell sweep: trades at %v, filled %d, status %v", prices, sell.Filled, sell.Status)
+	}
+
+	// 默认不限：照常扫单
+	prices = prices[:0]
+	engine.SubmitOrderSync(market("MB2", domain.SideBuy, 5, 0))
+	if len(prices) != 1 || prices[0] != 11000 {
+		t.Errorf("uncapped market order: trades at %v", prices)
+	}
+}
+
+// TestPartialFillRestsBehindSameLevel 部分成交后剩余挂到已有同价位买单的队尾（两种价格树）
+// 用 last look 否决先到的买单，构造出同价位已有买单、又有可成交卖单的盘口
+func TestPartialFillRestsBehindSameLevel(t *testing.T) {
+	for _, treeType := range []orderbook.PriceTreeType{orderbook.HashMapListType, orderbook.ShardedType} {
+		cfg := DefaultSymbolConfig()
+		cfg.TreeType = treeType
+		engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+		engine.SetLastLookHandler(func(aggressor, resting *domain.Order) bool { return aggressor.ID != "B0" })
+		engine.Start()
+
+		lastLook := domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 50000, 10)
+		lastLook.ExecInst = domain.ExecLastLook
+		engine.SubmitOrderSync(lastLook)
+		engine.SubmitOrderSync(domain.NewLimitOrder("B0", "BTCUSDT", "u0", domain.SideBuy, 50000, 8)) // 被否决，挂单
+
+		// B1 成交 10 后剩余 5 挂在 50000，应排在 B0 之后
+		taker := domain.NewLimitOrder("B1", "BTCUSDT", "u1", domain.SideBuy, 50000, 15)
+		engine.SubmitOrderSync(taker)
+		if taker.Filled != 10 {
+			t.Fatalf("tree %d: B1 filled %d, want 10", treeType, taker.Filled)
+		}
+
+		var queue []string
+		var volume int64
+		engine.WithFrozenView(func(orderbook.ReadOnlyBook) {
+			for _, order := range engine.orderBook.GetBestBuyOrders() {
+				queue = append(queue, order.ID)
+			}
+			volume = engine.orderBook.GetLevel(domain.SideBuy, 50000).Volume
+		})
+		if !reflect.DeepEqual(queue, []string{"B0", "B1"}) || volume != 13 {
+			t.Errorf("tree %d: level queue %v volume %d, want [B0 B1] and 13", treeType, queue, volume)
+		}
+
+		// 卖单先成交排在前面的 B0
+		var makers []string
+		engine.OnTrade(func(trade *domain.Trade) { makers = append(makers, trade.BuyOrderID) })
+		engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "m2", domain.SideSell, 50000, 10))
+		if !reflect.DeepEqual(makers, []string{"B0", "B1"}) {
+			t.Errorf("tree %d: sell matched %v, want B0 then B1", treeType, makers)
+		}
+		engine.Stop()
+	}
+}
+
+// TestMarketOrderProtection 市价单保护：按最新成交价 ± 缓冲转为 IOC 限价，不在带外成交，剩余撤销
+func TestMarketOrderProtection(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.MarketProtectionBps = 100 // 1%
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	var prices []int64
+	engine.OnTrade(func(trade *domain.Trade) { prices = append(prices, trade.Price) })
+	market := func(id string, side domain.Side, qty int64) *domain.Order {
+		o := domain.NewLimitOrder(id, "BTCUSDT", "taker", side, 0, qty)
+		o.Type = domain.OrderTypeMarket
+		return o
+	}
+
+	// 没有成交价也没有参考价：普通市价单
+	engine.SubmitOrderSync(domain.NewLimitOrder("S0", "BTCUSDT", "m", domain.SideSell, 10000, 1))
+	engine.SubmitOrderSync(market("M0", domain.SideBuy, 1))
+	if len(prices) != 1 || prices[0] != 10000 {
+		t.Fatalf("seed trade: %v", prices)
+	}
+
+	// 最新成交价 10000，买单上限 10100：成交 20，10200 档不动
+	prices = prices[:0]
+	for i, price := range []int64{10050, 10100, 10200} {
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("S%d", i+1), "BTCUSDT", "m", domain.SideSell, price, 10))
+	}
+	buy := market("M1", domain.SideBuy, 30)
+	engine.SubmitOrderSync(buy)
+	if !reflect.DeepEqual(prices, []int64{10050, 10100}) {
+		t.Errorf("protected buy traded at %v", prices)
+	}
+	if buy.Filled != 20 || buy.Status != domain.OrderStatusCancelled {
+		t.Errorf("protected buy: filled %d, status %v", buy.Filled, buy.Status)
+	}
+	if _, asks := engine.GetOrderBook().GetDepth(5); len(asks) != 1 || asks[0].Price != 10200 {
+		t.Errorf("asks past the band touched: %+v", asks)
+	}
+
+	// 最新成交价变为 10100，卖单下限 9999
+	prices = prices[:0]
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "m", domain.SideBuy, 10000, 10))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "m", domain.SideBuy, 9990, 10))
+	sell := market("M2", domain.SideSell, 20)
+	engine.SubmitOrderSync(sell)
+	if !reflect.DeepEqual(prices, []int64{10000}) || sell.Filled != 10 {
+		t.Errorf("protected sell: trades at %v, filled %d", prices, sell.Filled)
+	}
+}
+
+// TestDuplicateCancel 重复撤单与成交后撤单：只有第一次生效，之后的撤单不改动订单簿
+func TestDuplicateCancel(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "mm", domain.SideBuy, 49990, 1)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if ok, err := engine.CancelOrderSync("B1"); !ok || err != nil {
+		t.Fatalf("first cancel: got (%v, %v), want (true, nil)", ok, err)
+	}
+	// 第二次撤单：订单已不存在，默认忽略
+	if ok, err := engine.CancelOrderSync("B1"); ok || err != nil {
+		t.Fatalf("duplicate cancel: got (%v, %v), want (false, nil)", ok, err)
+	}
+
+	// 成交后撤单：不会复活订单，也不会动到同价位的其他订单
+	maker := domain.NewLimitOrder("S1", "BTCUSDT", "mm", domain.SideSell, 50000, 2)
+	for _, order := range []*domain.Order{
+		maker,
+		domain.NewLimitOrder("S2", "BTCUSDT", "mm", domain.SideSell, 50000, 3),
+		domain.NewLimitOrder("B2", "BTCUSDT", "taker", domain.SideBuy, 50000, 2),
+	} {
+		if err := engine.SubmitOrderSync(order); err != nil {
+			t.Fatalf("submit %s: %v", order.ID, err)
+		}
+	}
+	if ok, err := engine.CancelOrderSync("S1"); ok || err != nil {
+		t.Fatalf("cancel after fill: got (%v, %v), want (false, nil)", ok, err)
+	}
+	if maker.Status != domain.OrderStatusFilled {
+		t.Errorf("filled order status changed to %v by a late cancel", maker.Status)
+	}
+	if _, _, found := engine.QueuePosition("S1"); found {
+		t.Error("late cancel resurrected the filled order")
+	}
+	if _, asks := engine.GetOrderBook().GetDepth(1); len(asks) != 1 || asks[0].Quantity != 3 || asks[0].Orders != 1 {
+		t.Errorf("late cancel corrupted the level: %+v", asks)
+	}
+
+	// UnknownCancelReject：重复撤单报 ErrOrderNotFound，异步撤单恰好报告一次
+	cfg := DefaultSymbolConfig()
+	cfg.UnknownCancel = UnknownCancelReject
+	strict := NewSyncEngineWithConfig("BTCUSDT", cfg)
+	if _, err := strict.SubmitOrder(domain.NewLimitOrder("B1", "BTCUSDT", "mm", domain.SideBuy, 49990, 1)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if ok, err := strict.CancelOrder("B1"); !ok || err != nil {
+		t.Fatalf("strict first cancel: got (%v, %v), want (true, nil)", ok, err)
+	}
+	if ok, err := strict.CancelOrder("B1"); ok || !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("strict duplicate cancel: got (%v, %v), want (false, ErrOrderNotFound)", ok, err)
+	}
+
+	async := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	async.Start()
+	defer async.Stop()
+	var rejects []error
+	async.SetCancelRejectHandler(func(orderID string, err error) {
+		rejects = append(rejects, err)
+	})
+	if err := async.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "mm", domain.SideBuy, 49990, 1)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	async.CancelOrder("B1")
+	async.CancelOrder("B1")
+	// 撤单通道先于控制命令处理：同步撤单返回时两次异步撤单都已处理（同步撤单的拒绝不进回调）
+	if _, err := async.CancelOrderSync("B1"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("sync duplicate cancel: %v", err)
+	}
+	if len(rejects) != 1 || !errors.Is(rejects[0], ErrOrderNotFound) {
+		t.Errorf("expected exactly one ErrOrderNotFound reject, got %v", rejects)
+	}
+}
+
+// TestPriceLevelFIFOUnderChurn 同一价位持续挂单、吃单、撤单交错进行，
+// 成交必须严格按到达顺序逐个消耗队首，不跳单、不插队
+func TestPriceLevelFIFOUnderChurn(t *testing.T) {
+	const makers = 3000
+	for _, treeType := range []orderbook.PriceTreeType{orderbook.HashMapListType, orderbook.ShardedType} {
+		cfg := DefaultSymbolConfig()
+		cfg.TreeType = treeType
+		engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+
+		// 回调在撮合线程上运行，Stop 返回后读取
+		var sellIDs []string
+		var sellQty []int64
+		engine.OnTrade(func(trade *domain.Trade) {
+			sellIDs = append(sellIDs, trade.SellOrderID)
+			sellQty = append(sellQty, trade.Quantity)
+		})
+		engine.Start()
+
+		orders := make([]*domain.Order, makers)
+		index := make(map[string]int, makers)
+		for i := range orders {
+			id := fmt.Sprintf("S%d", i)
+			orders[i] = domain.NewLimitOrder(id, "BTCUSDT", "mm", domain.SideSell, 50000, int64(1+i%5))
+			index[id] = i
+		}
+
+		var submitted atomic.Int64
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() { // 挂单方：按编号顺序到达，同步提交让吃单与撤单穿插其间
+			defer wg.Done()
+			for _, order := range orders {
+				engine.SubmitOrderSync(order)
+				submitted.Add(1)
+			}
+		}()
+		go func() { // 吃单方：IOC 买单从队首吃，从不挂单；平均吃量略小于挂量，队列逐渐加深
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; submitted.Load() < makers; i++ {
+				taker := domain.NewLimitOrder(fmt.Sprintf("B%d", i), "BTCUSDT", "taker", domain.SideBuy, 50000, 1+rng.Int63n(4))
+				taker.TimeInForce = domain.TimeInForceIOC
+				engine.SubmitOrderSync(taker)
+			}
+		}()
+		go func() { // 撤单方：撤掉最近提交、多半仍在排队的挂单，制造队列中间的删除
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(2))
+			for n := submitted.Load(); n < makers; n = submitted.Load() {
+				if n > 16 {
+					engine.CancelOrder(fmt.Sprintf("S%d", n-1-rng.Int63n(16)))
+				}
+				runtime.Gosched()
+			}
+		}()
+		wg.Wait()
+
+		// 清空剩余挂单
+		sweep := domain.NewLimitOrder("B-final", "BTCUSDT", "taker", domain.SideBuy, 50000, 5*makers)
+		sweep.TimeInForce = domain.TimeInForceIOC
+		if err := engine.SubmitOrderSync(sweep); err != nil {
+			t.Fatalf("tree %d: sweep: %v", treeType, err)
+		}
+		engine.Stop()
+
+		// 成交的挂单编号单调不减；越过的挂单必须已全部成交或已撤单
+		filled := make([]int64, makers)
+		last := 0
+		for k, id := range sellIDs {
+			i := index[id]
+			if i < last {
+				t.Fatalf("tree %d: trade %d filled %s after S%d (out of turn)", treeType, k, id, last)
+			}
+			for skipped := last; skipped < i; skipped++ {
+				order := orders[skipped]
+				if order.Status != domain.OrderStatusCancelled && filled[skipped] != order.Quantity {
+					t.Fatalf("tree %d: %s skipped with %d/%d filled (status %v)",
+						treeType, order.ID, filled[skipped], order.Quantity, order.Status)
+				}
+			}
+			filled[i] += sellQty[k]
+			last = i
+		}
+
+		for i, order := range orders {
+			if filled[i] != order.Filled {
+				t.Fatalf("tree %d: %s traded %d but Filled=%d", treeType, order.ID, filled[i], order.Filled)
+			}
+			if order.Status != domain.OrderStatusCancelled && order.Status != domain.OrderStatusFilled {
+				t.Fatalf("tree %d: %s left in status %v after the sweep", treeType, order.ID, order.Status)
+			}
+		}
+		if bids, asks := engine.GetOrderBook().GetDepth(1); len(bids) != 0 || len(asks) != 0 {
+			t.Errorf("tree %d: book not empty after the sweep: bids %+v asks %+v", treeType, bids, asks)
+		}
+	}
+}
+
+// TestEngineEventFeed 统一事件流：订单事件与成交按因果顺序交错，共用一个连续序号
+func TestEngineEventFeed(t *testing.T) {
+	if NewMatchingEngine("BTCUSDT").Events() != nil {
+		t.Fatal("event feed enabled by default")
+	}
+
+	cfg := DefaultSymbolConfig()
+	cfg.EventBufferSize = 64
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	var outcomes []OrderEventType
+	engine.SetOrderEventHandler(func(event OrderEvent) { outcomes = append(outcomes, event.Type) })
+	engine.Start()
+	defer engine.Stop()
+
+	for _, order := range []*domain.Order{
+		domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 50000, 1),
+		domain.NewLimitOrder("S2", "BTCUSDT", "m2", domain.SideSell, 50010, 1),
+		domain.NewLimitOrder("B1", "BTCUSDT", "t1", domain.SideBuy, 50010, 2),
+	} {
+		if err := engine.SubmitOrderSync(order); err != nil {
+			t.Fatalf("submit %s: %v", order.ID, err)
+		}
+	}
+
+	// 订单事件记为 "ID:类型"，成交记为 "T:卖单ID"
+	var got []string
+	for seq := int64(1); seq <= 8; seq++ {
+		var event EngineEvent
+		select {
+		case event = <-engine.Events():
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not delivered (got %v)", seq, got)
+		}
+		if event.Seq != seq {
+			t.Fatalf("event Seq = %d, want %d", event.Seq, seq)
+		}
+		switch event.Kind {
+		case EngineEventOrder:
+			got = append(got, fmt.Sprintf("%s:%d", event.Order.OrderID, event.Order.Type))
+		case EngineEventTrade:
+			got = append(got, "T:"+event.Trade.SellOrderID)
+		}
+	}
+	accepted, resting, filled := OrderEventAccepted, OrderEventResting, OrderEventFilled
+	want := []string{
+		fmt.Sprintf("S1:%d", accepted), fmt.Sprintf("S1:%d", resting),
+		fmt.Sprintf("S2:%d", accepted), fmt.Sprintf("S2:%d", resting),
+		fmt.Sprintf("B1:%d", accepted), "T:S1", "T:S2", fmt.Sprintf("B1:%d", filled),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("event feed %v, want %v", got, want)
+	}
+
+	// 专用通道不受影响：成交缓冲仍收到每笔成交，订单事件回调只收到结果
+	consumer := engine.GetTradeBuffer().NewTradeConsumerBatchSafe()
+	if trades := consumer.ConsumeBatch(10); len(trades) != 2 {
+		t.Errorf("trade buffer got %d trades, want 2", len(trades))
+	}
+	if !reflect.DeepEqual(outcomes, []OrderEventType{resting, resting, filled}) {
+		t.Errorf("order event handler got %v", outcomes)
+	}
+
+	// 消费者停滞：事件流满时撮合线程阻塞，但 Stop 仍能让它放弃发送并退出
+	cfg.EventBufferSize = 1
+	stalled := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	stalled.Start()
+	stalled.SubmitOrder(domain.NewLimitOrder("S1", "BTCUSDT", "m1", domain.SideSell, 50000, 1))
+	if !waitForCondition(func() bool { return len(stalled.Events()) == 1 }, time.Second, time.Millisecond) {
+		t.Fatal("accepted event not delivered")
+	}
+	stalled.Stop()
+	if !waitForCondition(func() bool { return stalled.Metrics().OrdersProcessed == 1 }, time.Second, time.Millisecond) {
+		t.Error("matching thread still blocked on the event feed after Stop")
+	}
+}
+
+
+// TestDuplicateOrderID 与挂单或待触发止损单重复的订单 ID 被拒绝，原订单不受影响
+func TestDuplicateOrderID(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "u1", domain.SideSell, 50000, 5)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	dup := domain.NewLimitOrder("S1", "BTCUSDT", "u2", domain.SideSell, 50010, 3)
+	if err := engine.SubmitOrderSync(dup); !errors.Is(err, ErrDuplicateOrderID) || dup.Status != domain.OrderStatusRejected {
+		t.Fatalf("duplicate of a resting order: err %v status %v", err, dup.Status)
+	}
+
+	stop := domain.NewLimitOrder("STOP1", "BTCUSDT", "u3", domain.SideBuy, 0, 1)
+	stop.Type, stop.TriggerPrice = domain.OrderTypeStop, 51000
+	engine.SubmitOrderSync(stop)
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("STOP1", "BTCUSDT", "u3", domain.SideBuy, 49000, 1)); !errors.Is(err, ErrDuplicateOrderID) {
+		t.Fatalf("duplicate of a pending stop: %v", err)
+	}
+
+	// 原订单仍可查询和撤单
+	if _, _, found := engine.QueuePosition("S1"); !found {
+		t.Fatal("original order orphaned by the duplicate")
+	}
+	if ok, err := engine.CancelOrderSync("S1"); !ok || err != nil {
+		t.Fatalf("cancel original: (%v, %v)", ok, err)
+	}
+
+	// 订单结束后 ID 可以复用
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "u1", domain.SideSell, 50000, 2)); err != nil {
+		t.Errorf("reuse of a finished order's ID: %v", err)
+	}
+	if _, asks := engine.GetOrderBook().GetDepth(5); len(asks) != 1 || asks[0].Quantity != 2 {
+		t.Errorf("asks %+v, want only the reused S1 x 2", asks)
+	}
+}
+
+// TestDepthSubscriberClock 快照时间取引擎时钟；重复 Close 不 panic
+func TestDepthSubscriberClock(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)}
+	cfg := DefaultSymbolConfig()
+	cfg.Clock = clock
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	sub := engine.SubscribeDepth(5, 5*time.Millisecond)
+	select {
+	case snap := <-sub.C:
+		if !snap.Timestamp.Equal(clock.Now()) {
+			t.Errorf("snapshot stamped %v, want the engine clock %v", snap.Timestamp, clock.Now())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no snapshot")
+	}
+	sub.Close()
+	sub.Close()
+}
+
+// TestRingBufferDropOldest 丢弃模式：满时覆盖最旧元素，消费 + 丢弃恰好覆盖全部元素且不重复
+func TestRingBufferDropOldest(t *testing.T) {
+	rb := NewRingBufferSemaphoreBatchSafe(4)
+	var dropped []string
+	rb.SetDropOldest(func(order *domain.Order) { dropped = append(dropped, order.ID) })
+
+	for i := 0; i < 6; i++ {
+		rb.Publish(domain.NewLimitOrder(fmt.Sprintf("o%d", i), "BTCUSDT", "u", domain.SideBuy, 50000, 1))
+	}
+	if fmt.Sprint(dropped) != "[o0 o1]" {
+		t.Fatalf("expected oldest two dropped, got %v", dropped)
+	}
+	consumer := rb.NewConsumerBatchSafe()
+	for i := 2; i < 6; i++ {
+		if order := consumer.Consume(); order.ID != fmt.Sprintf("o%d", i) {
+			t.Fatalf("expected o%d, got %s", i, order.ID)
+		}
+	}
+
+	// 并发：慢消费者 + 快生产者
+	const total = 20000
+	rb = NewRingBufferSemaphoreBatchSafe(64)
+	var droppedCount atomic.Int64
+	rb.SetDropOldest(func(*domain.Order) { droppedCount.Add(1) })
+	orders := make([]*domain.Order, total)
+	for i := range orders {
+		orders[i] = domain.NewLimitOrder("o", "BTCUSDT", "u", domain.SideBuy, int64(i+1), 1)
+	}
+	go func() {
+		for _, order := range orders {
+			rb.Publish(order)
+		}
+		rb.Publish(nil) // 结束标记（可能被丢弃，由计数兜底）
+	}()
+
+	consumer = rb.NewConsumerBatchSafe()
+	var consumed, last int64
+	for consumed+droppedCount.Load() < total {
+		order := consumer.Consume()
+		if order == nil {
+			continue
+		}
+		if order.Price <= last {
+			t.Fatalf("out of order or duplicate: %d after %d", order.Price, last)
+		}
+		last = order.Price
+		consumed++
+		if consumed%100 == 0 {
+			time.Sleep(10 * time.Microsecond)
+		}
+	}
+	if consumed+droppedCount.Load() != total {
+		t.Errorf("consumed %d + dropped %d != %d", consumed, droppedCount.Load(), total)
+	}
+}
+
+// TestRingBufferMultiProducer 多生产者并发发布：每个元素恰好被消费一次，不读到未写完的槽位
+// 缓冲区很小以频繁绕圈；配合 go test -race 检查槽位读写的 happens-before
+func TestRingBufferMultiProducer(t *testing.T) {
+	const producers = 8
+	const perProducer = 5000
+	rb := NewRingBufferSemaphoreBatchSafe(16)
+
+	for p := 0; p < producers; p++ {
+		go func(p int) {
+			for i := 0; i < perProducer; i++ {
+				// Price 编码生产者，Quantity 编码序号
+				rb.Publish(domain.NewLimitOrder(fmt.Sprintf("p%d-%d", p, i), "BTCUSDT", "u", domain.SideBuy, int64(p+1), int64(i+1)))
+			}
+		}(p)
+	}
+
+	consumer := rb.NewConsumerBatchSafe()
+	var next [producers]int64
+	for n := 0; n < producers*perProducer; n++ {
+		order := consumer.Consume()
+		if order == nil {
+			t.Fatalf("read an unpublished slot after %d entries", n)
+		}
+		p := order.Price - 1
+		if want := fmt.Sprintf("p%d-%d", p, order.Quantity-1); order.ID != want {
+			t.Fatalf("torn entry: id %s, fields say %s", order.ID, want)
+		}
+		// 同一生产者的元素按发布顺序到达，缺失或重复都会打破连续性
+		if order.Quantity != next[p]+1 {
+			t.Fatalf("producer %d: expected seq %d, got %d", p, next[p]+1, order.Quantity)
+		}
+		next[p] = order.Quantity
+	}
+	for p, got := range next {
+		if got != perProducer {
+			t.Errorf("producer %d: consumed %d of %d", p, got, perProducer)
+		}
+	}
+}
+
+// TestOverflowDropOldest 引擎配置丢弃模式后，缓冲区满时提交不阻塞，被丢弃订单标记为拒绝并通知
+func TestOverflowDropOldest(t *testing.T) {
+	dropped := make(chan *domain.Order, 10)
+	cfg := DefaultSymbolConfig()
+	cfg.OrderOverflow = OverflowDropOldest
+	cfg.OnOrderDropped = func(order *domain.Order) { dropped <- order }
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+
+	// 引擎未启动：填满缓冲区后再多提交 2 笔
+	size := len(engine.orderBuffer.buffer)
+	first := domain.NewLimitOrder("first", "BTCUSDT", "u", domain.SideBuy, 49000, 1)
+	engine.SubmitOrder(first)
+	for i := 1; i < size+2; i++ {
+		engine.SubmitOrder(domain.NewLimitOrder(fmt.Sprintf("o%d", i), "BTCUSDT", "u", domain.SideBuy, 49000, 1))
+	}
+
+	if len(dropped) != 2 {
+		t.Fatalf("expected 2 dropped orders, got %d", len(dropped))
+	}
+	if order := <-dropped; order != first || order.Status != domain.OrderStatusRejected {
+		t.Errorf("expected the oldest order to be dropped and rejected, got %s (%v)", order.ID, order.Status)
+	}
+
+	engine.Start()
+	defer engine.Stop()
+	// 启动时缓冲区可能仍满，这一笔可能再挤掉一笔旧单：挂单数 + 丢弃数 = 提交总数
+	engine.SubmitOrderSync(domain.NewLimitOrder("last", "BTCUSDT", "u", domain.SideBuy, 49000, 1))
+	bids, _ := engine.GetOrderBook().GetDepth(1)
+	if total := bids[0].Orders + 1 + len(dropped); total != size+3 {
+		t.Errorf("resting %d + dropped %d != submitted %d", bids[0].Orders, 1+len(dropped), size+3)
+	}
+}
+
+// TestMarketIfTouched MIT 与止损单方向相反；触发后按因果顺序作为市价单撮合，可级联触发
+func TestMarketIfTouched(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	var prices []int64
+	var takers []string
+	engine.OnTrade(func(trade *domain.Trade) {
+		prices = append(prices, trade.Price)
+		takers = append(takers, trade.BuyOrderID)
+	})
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m", domain.SideSell, 50000, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "m", domain.SideSell, 50200, 5))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B0", "BTCUSDT", "m", domain.SideBuy, 49900, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50000, 1)) // 最新成交价 50000
+
+	conditional := func(id string, orderType domain.OrderType, side domain.Side, trigger int64) *domain.Order {
+		order := domain.NewLimitOrder(id, "BTCUSDT", "c", side, 0, 1)
+		order.Type = orderType
+		order.TriggerPrice = trigger
+		engine.SubmitOrderSync(order)
+		return order
+	}
+	// 买入止损在价格上涨到 50100 时触发；买入 MIT 在价格回落到 49900 时触发
+	stop := conditional("STOP", domain.OrderTypeStop, domain.SideBuy, 50100)
+	mit := conditional("MIT", domain.OrderTypeMIT, domain.SideBuy, 49900)
+	cancelled := conditional("MIT-X", domain.OrderTypeMIT, domain.SideBuy, 49950)
+	engine.CancelOrder("MIT-X")
+
+	if len(prices) != 1 {
+		t.Fatalf("conditional orders must not trade before being triggered, trades at %v", prices)
+	}
+
+	// 卖单打到 49900：MIT 触发并买入 50200，进而触发止损单
+	engine.SubmitOrderSync(domain.NewLimitOrder("S3", "BTCUSDT", "t", domain.SideSell, 49900, 1))
+
+	if fmt.Sprint(prices) != "[50000 49900 50200 50200]" || fmt.Sprint(takers[2:]) != "[MIT STOP]" {
+		t.Fatalf("unexpected trade sequence: prices %v buyers %v", prices, takers)
+	}
+	if !mit.IsFilled() || !stop.IsFilled() || cancelled.Status != domain.OrderStatusCancelled {
+		t.Errorf("statuses: MIT %v, STOP %v, cancelled MIT %v", mit.Status, stop.Status, cancelled.Status)
+	}
+
+	// 条件已满足的 MIT 提交后立即执行（卖出 MIT：最新价 50200 已高于触发价）
+	engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "m", domain.SideBuy, 49000, 1))
+	immediate := conditional("MIT-NOW", domain.OrderTypeMIT, domain.SideSell, 50100)
+	if !immediate.IsFilled() {
+		t.Errorf("sell MIT with trigger below the last price should execute immediately, status %v", immediate.Status)
+	}
+}
+
+// TestGetFills 订单完成后仍可查询逐笔成交；超过容量时淘汰最早的订单
+func TestGetFills(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.FillHistoryOrders = 3
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m", domain.SideSell, 50000, 3))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "m", domain.SideSell, 50100, 5))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50100, 7))
+
+	fills := engine.GetFills("B1")
+	if len(fills) != 2 || fills[0].Price != 50000 || fills[0].Quantity != 3 || fills[0].CounterpartyOrderID != "S1" ||
+		fills[1].Price != 50100 || fills[1].Quantity != 4 || fills[1].CounterpartyOrderID != "S2" {
+		t.Fatalf("unexpected fills for B1: %+v", fills)
+	}
+	var notional, qty int64
+	for _, f := range fills {
+		notional += f.Price * f.Quantity
+		qty += f.Quantity
+	}
+	if avg := notional / qty; avg != (50000*3+50100*4)/7 {
+		t.Errorf("average fill price %d", avg)
+	}
+	if f := engine.GetFills("S1"); len(f) != 1 || f[0].CounterpartyOrderID != "B1" || f[0].TradeID != fills[0].TradeID {
+		t.Errorf("unexpected fills for completed maker S1: %+v", f)
+	}
+
+	// 容量为 3：已记录 B1、S1、S2，B2 加入后最早的 B1 被淘汰
+	engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "t", domain.SideBuy, 50100, 1))
+	if engine.GetFills("B1") != nil {
+		t.Error("expected B1 history to be evicted")
+	}
+	if len(engine.GetFills("S2")) != 2 || len(engine.GetFills("B2")) != 1 {
+		t.Error("recent histories should be retained")
+	}
+
+	if NewMatchingEngine("BTCUSDT").GetFills("B1") != nil {
+		t.Error("fill history should be off by default")
+	}
+}
+
+// TestCancelUnknownSymbol 对不存在的交易对撤单不会创建引擎
+func TestCancelUnknownSymbol(t *testing.T) {
+	exchange := NewExchangeEngine()
+	exchange.CancelOrder("BTCUSTD", "order-1") // 拼写错误的交易对
+
+	if _, ok := exchange.GetExistingEngine("BTCUSTD"); ok {
+		t.Fatal("cancel on an unknown symbol created an engine")
+	}
+	if n := len(exchange.engines.Load().(map[string]*MatchingEngine)); n != 0 {
+		t.Errorf("expected no engines, got %d", n)
+	}
+
+	// 已存在的交易对照常撤单
+	engine := exchange.GetEngine("BTCUSDT")
+	defer engine.Stop()
+	exchange.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "u", domain.SideBuy, 49000, 1))
+	exchange.CancelOrder("BTCUSDT", "B1")
+	if !waitForCondition(func() bool {
+		return bestPrice(engine, domain.SideBuy) == 0
+	}, time.Second, time.Millisecond) {
+		t.Error("cancel on an existing symbol was not applied")
+	}
+	if existing, ok := exchange.GetExistingEngine("BTCUSDT"); !ok || existing != engine {
+		t.Error("GetExistingEngine should return the running engine")
+	}
+}
+
+// TestInvertedPriceOrdering 反向合约：买方价格越低越激进，卖方价格越高越激进
+func TestInvertedPriceOrdering(t *testing.T) {
+	for _, treeType := range []orderbook.PriceTreeType{orderbook.ShardedType, orderbook.HashMapListType} {
+		cfg := DefaultSymbolConfig()
+		cfg.TreeType = treeType
+		cfg.PriceOrdering = orderbook.PriceOrderingInverted
+		engine := NewMatchingEngineWithConfig("BTCUSD-INV", cfg)
+		engine.Start()
+
+		for i, price := range []int64{110, 100} {
+			engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("B%d", i), "BTCUSD-INV", "m", domain.SideBuy, price, 5))
+		}
+		for i, price := range []int64{80, 95} {
+			engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("S%d", i), "BTCUSD-INV", "m", domain.SideSell, price, 5))
+		}
+		book := engine.GetOrderBook()
+		if book.GetBestBid() != 100 || book.GetBestAsk() != 95 {
+			t.Fatalf("tree %v: expected best bid 100 / best ask 95, got %d / %d", treeType, book.GetBestBid(), book.GetBestAsk())
+		}
+
+		// 买价 92 <= 卖价 95 可成交；<= 80 不成立，只吃 95 一档
+		var prices []int64
+		engine.OnTrade(func(trade *domain.Trade) { prices = append(prices, trade.Price) })
+		taker := domain.NewLimitOrder("T", "BTCUSD-INV", "t", domain.SideBuy, 92, 8)
+		engine.SubmitOrderSync(taker)
+		if fmt.Sprint(prices) != "[95]" || taker.Filled != 5 {
+			t.Errorf("tree %v: trades %v, taker filled %d", treeType, prices, taker.Filled)
+		}
+		// 剩余部分挂为新的最优买价
+		if book.GetBestBid() != 92 || book.GetBestAsk() != 80 {
+			t.Errorf("tree %v: after sweep best bid %d / best ask %d", treeType, book.GetBestBid(), book.GetBestAsk())
+		}
+		engine.Stop()
+	}
+}
+
+// TestConsumeTimeout 空闲时按时返回 false，有数据时立即返回
+func TestConsumeTimeout(t *testing.T) {
+	rb := NewRingBufferSemaphoreBatchSafe(16)
+	consumer := rb.NewConsumerBatchSafe()
+
+	start := time.Now()
+	if order, ok := consumer.ConsumeTimeout(20 * time.Millisecond); ok || order != nil {
+		t.Fatalf("expected timeout on empty buffer, got %v", order)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("timeout returned after %v", elapsed)
+	}
+
+	order := domain.NewLimitOrder("o1", "BTCUSDT", "u", domain.SideBuy, 50000, 1)
+	rb.Publish(order)
+	if got, ok := consumer.ConsumeTimeout(time.Second); !ok || got != order {
+		t.Fatalf("expected queued order, got %v (%v)", got, ok)
+	}
+
+	// 等待期间到达的元素唤醒消费者
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		rb.Publish(order)
+	}()
+	start = time.Now()
+	got, ok := consumer.ConsumeTimeout(time.Second)
+	if !ok || got != order || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected order to arrive during wait, got %v (%v) after %v", got, ok, time.Since(start))
+	}
+
+	// 缓冲区满（丢弃模式）时定时器到期：唤醒令牌不阻塞，也不挤掉任何订单
+	rb = NewRingBufferSemaphoreBatchSafe(4)
+	var dropped []string
+	rb.SetDropOldest(func(order *domain.Order) { dropped = append(dropped, order.ID) })
+	for i := 0; i < 4; i++ {
+		rb.Publish(domain.NewLimitOrder(fmt.Sprintf("o%d", i), "BTCUSDT", "u", domain.SideBuy, 50000, 1))
+	}
+	woken := make(chan struct{})
+	go func() {
+		rb.wakeConsumer()
+		close(woken)
+	}()
+	select {
+	case <-woken:
+	case <-time.After(time.Second):
+		t.Fatal("timeout wake-up blocked on a full buffer")
+	}
+	if len(dropped) != 0 {
+		t.Fatalf("timeout wake-up dropped %v", dropped)
+	}
+	consumer = rb.NewConsumerBatchSafe()
+	for i := 0; i < 4; i++ {
+		if got, ok := consumer.ConsumeTimeout(time.Second); !ok || got.ID != fmt.Sprintf("o%d", i) {
+			t.Fatalf("expected o%d, got %v (%v)", i, got, ok)
+		}
+	}
+}
+
+// TestMarketableLimitSweep 可成交限价单扫过 3 档：每笔成交价等于对应挂单档位价格，
+// GTC 剩余挂单，IOC 剩余撤销；最后一档部分成交时该档剩余量正确
+func TestMarketableLimitSweep(t *testing.T) {
+	for _, tif := range []domain.TimeInForce{domain.TimeInForceGTC, domain.TimeInForceIOC} {
+		engine := NewMatchingEngine("BTCUSDT")
+		engine.Start()
+
+		// 卖单 3 档 + 超出限价的第 4 档
+		for i, level := range []struct{ price, qty int64 }{{50000, 2}, {50010, 3}, {50020, 10}, {50030, 5}} {
+			engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("S%d", i), "BTCUSDT", "m", domain.SideSell, level.price, level.qty))
+		}
+		var trades []*domain.Trade
+		engine.OnTrade(func(trade *domain.Trade) { trades = append(trades, trade) })
+
+		// 限价 50025：吃完 50000、50010、50020 三档，剩余 20 - 2 - 3 - 10 = 5
+		taker := domain.NewLimitOrder("B", "BTCUSDT", "t", domain.SideBuy, 50025, 20)
+		taker.TimeInForce = tif
+		engine.SubmitOrderSync(taker)
+
+		want := []struct{ price, qty int64 }{{50000, 2}, {50010, 3}, {50020, 10}}
+		if len(trades) != len(want) {
+			t.Fatalf("tif %v: expected %d trades, got %d", tif, len(want), len(trades))
+		}
+		for i, w := range want {
+			if trades[i].Price != w.price || trades[i].Quantity != w.qty {
+				t.Errorf("tif %v: trade %d at %d x %d, want %d x %d", tif, i, trades[i].Price, trades[i].Quantity, w.price, w.qty)
+			}
+		}
+
+		book := engine.GetOrderBook()
+		if book.GetBestAsk() != 50030 {
+			t.Errorf("tif %v: best ask %d, want 50030", tif, book.GetBestAsk())
+		}
+		bids, _ := book.GetDepth(1)
+		if tif == domain.TimeInForceGTC {
+			if len(bids) != 1 || bids[0].Price != 50025 || bids[0].Quantity != 5 || taker.Status != domain.OrderStatusPartialFilled {
+				t.Errorf("GTC remainder should rest at 50025 x 5, bids %+v status %v", bids, taker.Status)
+			}
+		} else if len(bids) != 0 || taker.Status != domain.OrderStatusCancelled || taker.Filled != 15 {
+			t.Errorf("IOC remainder should be cancelled, bids %+v status %v filled %d", bids, taker.Status, taker.Filled)
+		}
+
+		// 跨两档，最后一档 50040 只部分成交
+		trades = nil
+		engine.SubmitOrderSync(domain.NewLimitOrder("S4", "BTCUSDT", "m", domain.SideSell, 50040, 5))
+		partial := domain.NewLimitOrder("B2", "BTCUSDT", "t", domain.SideBuy, 50040, 7)
+		partial.TimeInForce = tif
+		engine.SubmitOrderSync(partial)
+		if len(trades) != 2 || trades[0].Price != 50030 || trades[0].Quantity != 5 || trades[1].Price != 50040 || trades[1].Quantity != 2 {
+			t.Errorf("tif %v: unexpected partial sweep trades %d", tif, len(trades))
+		}
+		if _, asks := book.GetDepth(1); len(asks) != 1 || asks[0].Price != 50040 || asks[0].Quantity != 3 || !partial.IsFilled() {
+			t.Errorf("tif %v: partially filled level should keep 3, asks %+v", tif, asks)
+		}
+		engine.Stop()
+	}
+}
+
+// TestMaxBookDepth 每侧只保留最优 K 档：更差价位的新挂单被拒绝，更优的新档位会淘汰最差档
+func TestMaxBookDepth(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.MaxBookDepth = 3
+	var prunedIDs []string
+	cfg.OnOrderPruned = func(order *domain.Order) { prunedIDs = append(prunedIDs, order.ID) }
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	submit := func(id string, side domain.Side, price int64) error {
+		return engine.SubmitOrderSync(domain.NewLimitOrder(id, "BTCUSDT", "u", side, price, 1))
+	}
+	for i, price := range []int64{49990, 49980, 49970} {
+		if err := submit(fmt.Sprintf("B%d", i), domain.SideBuy, price); err != nil {
+			t.Fatalf("bid %d: %v", price, err)
+		}
+	}
+
+	if err := submit("far", domain.SideBuy, 49960); !errors.Is(err, ErrBeyondBookDepth) {
+		t.Fatalf("expected ErrBeyondBookDepth, got %v", err)
+	}
+	// 已有档位和第 K 档以内的价格不受影响
+	if err := submit("join", domain.SideBuy, 49970); err != nil {
+		t.Fatalf("joining the last kept level rejected: %v", err)
+	}
+	// 更优的新档位淘汰最差档（包括之前已接受的订单）
+	if err := submit("better", domain.SideBuy, 49995); err != nil {
+		t.Fatalf("better level rejected: %v", err)
+	}
+	bids, _ := engine.GetOrderBook().GetDepth(10)
+	if len(bids) != 3 || bids[0].Price != 49995 || bids[2].Price != 49980 {
+		t.Errorf("unexpected bids after pruning: %+v", bids)
+	}
+	var pruned *domain.Order
+	engine.callOnMatchingThread(func() error {
+		pruned = engine.orderBook.GetOrder("join")
+		return nil
+	})
+	if pruned != nil {
+		t.Error("order on the pruned level should have been cancelled")
+	}
+	// 被淘汰的订单逐一通知（B2 与 join 同在 49970 档）
+	if len(prunedIDs) != 2 || prunedIDs[0] != "B2" || prunedIDs[1] != "join" {
+		t.Errorf("pruned notifications %v, want [B2 join]", prunedIDs)
+	}
+
+	// 两侧分别计算深度
+	if err := submit("S-far", domain.SideSell, 60000); err != nil {
+		t.Errorf("ask side has room: %v", err)
+	}
+}
+
+// TestTradeConsumerLag 消费者滞后：包含已读入本地缓存但尚未返回的 Trade
+func TestTradeConsumerLag(t *testing.T) {
+	rb := NewTradeRingBufferBatchSafe(1024)
+	consumer := rb.NewTradeConsumerBatchSafe()
+
+	if lag := consumer.Lag(); lag != 0 {
+		t.Fatalf("empty buffer lag = %d, want 0", lag)
+	}
+
+	for i := 0; i < 10; i++ {
+		rb.Publish(&domain.Trade{ID: fmt.Sprintf("T%d", i)})
+	}
+	if lag := consumer.Lag(); lag != 10 {
+		t.Fatalf("lag after publishing = %d, want 10", lag)
+	}
+
+	// 第一次 TryConsume 会把 10 个全部读入本地缓存，只返回 1 个
+	for i := 0; i < 3; i++ {
+		if _, ok := consumer.TryConsume(); !ok {
+			t.Fatalf("TryConsume %d failed", i)
+		}
+	}
+	if lag := consumer.Lag(); lag != 7 {
+		t.Errorf("lag after consuming 3 = %d, want 7", lag)
+	}
+
+	consumer.ConsumeBatch(100)
+	if lag := consumer.Lag(); lag != 0 {
+		t.Errorf("lag after draining = %d, want 0", lag)
+	}
+}
+
+// TestMinRestTime 最短挂单时间：窗口内撤单被拒绝，到期后可以撤单
+func TestMinRestTime(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)}
+	cfg := DefaultSymbolConfig()
+	cfg.Clock = clock
+	cfg.MinRestTime = 100 * time.Millisecond
+
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	// 先安装回调：控制命令与撤单走不同通道，之后的同步提交保证回调已生效
+	rejected := make(chan error, 1)
+	engine.SetCancelRejectHandler(func(orderID string, err error) {
+		if orderID == "B1" {
+			rejected <- err
+		}
+	})
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "mm", domain.SideBuy, 49990, 1)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	// 窗口结束前 1ns：拒绝
+	clock.Advance(cfg.MinRestTime - time.Nanosecond)
+	if _, err := engine.CancelOrderSync("B1"); !errors.Is(err, ErrMinRestTimeNotMet) {
+		t.Fatalf("cancel inside window: expected ErrMinRestTimeNotMet, got %v", err)
+	}
+	if engine.GetOrderBook().GetBestBid() != 49990 {
+		t.Fatal("rejected cancel removed the order")
+	}
+
+	// 改单为 IOC、数量改到已成交部分、全额减量同样会移除订单：一并拒绝
+	ioc, filled := domain.TimeInForceIOC, int64(0)
+	if err := engine.AmendOrder("B1", OrderAmend{TimeInForce: &ioc}); !errors.Is(err, ErrMinRestTimeNotMet) {
+		t.Errorf("amend to IOC inside window: expected ErrMinRestTimeNotMet, got %v", err)
+	}
+	if err := engine.AmendOrder("B1", OrderAmend{Quantity: &filled}); !errors.Is(err, ErrMinRestTimeNotMet) {
+		t.Errorf("amend quantity to filled inside window: expected ErrMinRestTimeNotMet, got %v", err)
+	}
+	if err := engine.ReduceOrder("B1", 1); !errors.Is(err, ErrMinRestTimeNotMet) {
+		t.Errorf("full reduce inside window: expected ErrMinRestTimeNotMet, got %v", err)
+	}
+	if engine.GetOrderBook().GetBestBid() != 49990 {
+		t.Fatal("rejected amend removed the order")
+	}
+
+	// 异步撤单通过回调报告拒绝
+	engine.CancelOrder("B1")
+	select {
+	case err := <-rejected:
+		if !errors.Is(err, ErrMinRestTimeNotMet) {
+			t.Errorf("async cancel rejected with %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("async cancel rejection not reported")
+	}
+
+	// 恰好到期：允许撤单
+	clock.Advance(time.Nanosecond)
+	if _, err := engine.CancelOrderSync("B1"); err != nil {
+		t.Fatalf("cancel after window: %v", err)
+	}
+	if engine.GetOrderBook().GetBestBid() != 0 {
+		t.Error("order still resting after cancel")
+	}
+}
+
+// TestSubmitResultRole 同步提交返回订单的 maker/taker 角色
+func TestSubmitResultRole(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	submit := func(order *domain.Order) SubmitResult {
+		t.Helper()
+		result, err := engine.SubmitOrderWithResult(order)
+		if err != nil {
+			t.Fatalf("submit %s: %v", order.ID, err)
+		}
+		return result
+	}
+
+	// 纯挂单：maker
+	got := submit(domain.NewLimitOrder("S1", "BTCUSDT", "seller", domain.SideSell, 50000, 5))
+	if want := (SubmitResult{RestedQty: 5, Role: RoleMaker}); got != want {
+		t.Errorf("resting order: got %+v, want %+v", got, want)
+	}
+
+	// 完全成交：taker
+	got = submit(domain.NewLimitOrder("B1", "BTCUSDT", "buyer", domain.SideBuy, 50000, 2))
+	if want := (SubmitResult{Trades: 1, TakenQty: 2, Role: RoleTaker}); got != want {
+		t.Errorf("fully matched order: got %+v, want %+v", got, want)
+	}
+
+	// 部分成交后剩余挂单：both
+	got = submit(domain.NewLimitOrder("B2", "BTCUSDT", "buyer", domain.SideBuy, 50000, 10))
+	if want := (SubmitResult{Trades: 1, TakenQty: 3, RestedQty: 7, Role: RoleBoth}); got != want {
+		t.Errorf("partially matched order: got %+v, want %+v", got, want)
+	}
+
+	// 未成交的 IOC：既不吃单也不挂单
+	ioc := domain.NewLimitOrder("S2", "BTCUSDT", "seller", domain.SideSell, 50100, 1)
+	ioc.TimeInForce = domain.TimeInForceIOC
+	if got = submit(ioc); got != (SubmitResult{}) {
+		t.Errorf("unfilled IOC: got %+v, want zero result", got)
+	}
+}
+
+// TestCircuitBreaker 快速价格变动触发熔断：停止扫单、拒绝新单，冷却后自动恢复
+func TestCircuitBreaker(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)}
+	cfg := DefaultSymbolConfig()
+	cfg.Clock = clock
+	cfg.CircuitBreaker = CircuitBreakerConfig{MaxMoveBps: 500, Window: 3, Cooldown: time.Minute}
+
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	tripped := make(chan CircuitBreakerTripped, 1)
+	engine.SetCircuitBreakerHandler(func(event CircuitBreakerTripped) { tripped <- event })
+
+	submit := func(id string, side domain.Side, price, qty int64) error {
+		return engine.SubmitOrderSync(domain.NewLimitOrder(id, "BTCUSDT", id, side, price, qty))
+	}
+	for i, price := range []int64{50000, 50000, 51000, 53000, 54000} {
+		if err := submit(fmt.Sprintf("S%d", i), domain.SideSell, price, 1); err != nil {
+			t.Fatalf("ask %d: %v", price, err)
+		}
+	}
+	if err := submit("B0", domain.SideBuy, 50000, 1); err != nil {
+		t.Fatalf("first buy: %v", err)
+	}
+
+	// 扫单：50000 -> 51000 (2%) 未触发，-> 53000 (6%) 触发，54000 不再成交
+	var trades []int64
+	engine.OnTrade(func(trade *domain.Trade) { trades = append(trades, trade.Price) })
+	sweep := domain.NewLimitOrder("B1", "BTCUSDT", "B1", domain.SideBuy, 54000, 4)
+	if err := engine.SubmitOrderSync(sweep); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if !reflect.DeepEqual(trades, []int64{50000, 51000, 53000}) {
+		t.Errorf("sweep trades %v, expected to stop at the tripping trade", trades)
+	}
+	if sweep.Status != domain.OrderStatusCancelled || engine.GetOrderBook().GetBestBid() != 0 {
+		t.Errorf("remainder should be cancelled, status %d bid %d", sweep.Status, engine.GetOrderBook().GetBestBid())
+	}
+
+	select {
+	case event := <-tripped:
+		want := CircuitBreakerTripped{Symbol: "BTCUSDT", ReferencePrice: 50000, TripPrice: 53000,
+			HaltedAt: clock.Now(), ResumeAt: clock.Now().Add(time.Minute)}
+		if event != want {
+			t.Errorf("event %+v, want %+v", event, want)
+		}
+	default:
+		t.Fatal("circuit breaker did not trip")
+	}
+
+	// 冷却期内拒绝新单，撤单仍然有效
+	clock.Advance(time.Minute - time.Second)
+	if err := submit("B2", domain.SideBuy, 54000, 1); !errors.Is(err, ErrTradingHalted) {
+		t.Fatalf("expected ErrTradingHalted during cooldown, got %v", err)
+	}
+	if _, err := engine.CancelOrderSync("S4"); err != nil || engine.GetOrderBook().GetBestAsk() != 0 {
+		t.Fatalf("cancel during halt: err %v, best ask %d", err, engine.GetOrderBook().GetBestAsk())
+	}
+
+	// 冷却结束后自动恢复
+	clock.Advance(time.Second)
+	if err := submit("S5", domain.SideSell, 54000, 1); err != nil {
+		t.Fatalf("order after cooldown: %v", err)
+	}
+
+	// 手动暂停与恢复
+	engine.Halt()
+	if err := submit("B3", domain.SideBuy, 54000, 1); !errors.Is(err, ErrTradingHalted) {
+		t.Fatalf("expected ErrTradingHalted after Halt, got %v", err)
+	}
+	engine.Resume()
+	if err := submit("B4", domain.SideBuy, 54000, 1); err != nil {
+		t.Fatalf("order after Resume: %v", err)
+	}
+}
+
+// TestTradePublishBatch 批量发布：顺序不变；批次超过剩余空位时退化为逐个发布
+func TestTradePublishBatch(t *testing.T) {
+	rb := NewTradeRingBufferBatchSafe(8)
+	consumer := rb.NewTradeConsumerBatchSafe()
+
+	batch := func(from, n int) []*domain.Trade {
+		trades := make([]*domain.Trade, n)
+		for i := range trades {
+			trades[i] = &domain.Trade{ID: fmt.Sprintf("T%d", from+i)}
+		}
+		return trades
+	}
+
+	rb.PublishBatch(batch(0, 5))
+	if lag := consumer.Lag(); lag != 5 {
+		t.Fatalf("lag after batch = %d, want 5", lag)
+	}
+
+	// 只剩 3 个空位：后台消费者腾出空间后才能发布完
+	done := make(chan struct{})
+	go func() {
+		rb.PublishBatch(batch(5, 10))
+		close(done)
+	}()
+
+	var got []string
+	deadline := time.Now().Add(time.Second)
+	for len(got) < 15 && time.Now().Before(deadline) {
+		if trade, ok := consumer.TryConsume(); ok {
+			got = append(got, trade.ID)
+		}
+	}
+	<-done
+	for i, id := range got {
+		if id != fmt.Sprintf("T%d", i) {
+			t.Fatalf("trade %d out of order: %s (got %v)", i, id, got)
+		}
+	}
+	if len(got) != 15 {
+		t.Fatalf("consumed %d trades, want 15", len(got))
+	}
+}
+
+// TestBatchTradePublish 引擎开启批量发布后，多档扫单的成交全部按顺序到达
+func TestBatchTradePublish(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.BatchTradePublish = true
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	for i := 0; i < 5; i++ {
+		engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("S%d", i), "BTCUSDT", "seller", domain.SideSell, 50000+int64(i), 1))
+	}
+	engine.SubmitOrderSync(domain.NewLimitOrder("B", "BTCUSDT", "buyer", domain.SideBuy, 50004, 5))
+
+	consumer := engine.GetTradeBuffer().NewTradeConsumerBatchSafe()
+	trades := consumer.ConsumeBatch(10)
+	if len(trades) != 5 {
+		t.Fatalf("expected 5 trades, got %d", len(trades))
+	}
+	for i, trade := range trades {
+		if trade.Price != 50000+int64(i) {
+			t.Errorf("trade %d at %d, expected %d", i, trade.Price, 50000+i)
+		}
+	}
+}
+
+// TestOrderEvents 订单到达后的终态事件：完全成交 / 部分成交后挂单 / 部分成交后撤销
+func TestOrderEvents(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	var events []OrderEvent
+	engine.SetOrderEventHandler(func(event OrderEvent) { events = append(events, event) })
+
+	submit := func(order *domain.Order) {
+		t.Helper()
+		if err := engine.SubmitOrderSync(order); err != nil {
+			t.Fatalf("submit %s: %v", order.ID, err)
+		}
+	}
+	submit(domain.NewLimitOrder("S1", "BTCUSDT", "seller", domain.SideSell, 50000, 4))
+	submit(domain.NewLimitOrder("B1", "BTCUSDT", "buyer", domain.SideBuy, 50000, 1))
+	submit(domain.NewLimitOrder("B2", "BTCUSDT", "buyer", domain.SideBuy, 50000, 2))
+	ioc := domain.NewLimitOrder("B3", "BTCUSDT", "buyer", domain.SideBuy, 50000, 5)
+	ioc.TimeInForce = domain.TimeInForceIOC
+	submit(ioc)
+	submit(domain.NewLimitOrder("B4", "BTCUSDT", "buyer", domain.SideBuy, 49990, 3))
+
+	want := []OrderEvent{
+		{Type: OrderEventResting, OrderID: "S1", UserID: "seller", RemainingQuantity: 4},
+		{Type: OrderEventFilled, OrderID: "B1", UserID: "buyer", FilledQuantity: 1},
+		{Type: OrderEventFilled, OrderID: "B2", UserID: "buyer", FilledQuantity: 2},
+		{Type: OrderEventCancelled, OrderID: "B3", UserID: "buyer", FilledQuantity: 1, RemainingQuantity: 4},
+		{Type: OrderEventResting, OrderID: "B4", UserID: "buyer", RemainingQuantity: 3},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events:\n got %+v\nwant %+v", events, want)
+	}
+
+	// 部分成交后剩余挂单
+	events = nil
+	submit(domain.NewLimitOrder("S2", "BTCUSDT", "seller", domain.SideSell, 49990, 5))
+	if want := (OrderEvent{Type: OrderEventResting, OrderID: "S2", UserID: "seller", FilledQuantity: 3, RemainingQuantity: 2}); len(events) != 1 || events[0] != want {
+		t.Errorf("partial fill then rest: got %+v, want %+v", events, want)
+	}
+}
+
+// TestSweepEmptiedBestLevel 一个订单吃光最优档（多个订单）后继续吃更深一档：
+// 最优档被清空后必须从树中移除，否则撮合会在空档位处提前停止
+func TestSweepEmptiedBestLevel(t *testing.T) {
+	trees := []struct {
+		name       string
+		treeType   orderbook.PriceTreeType
+		bucketSize int64
+	}{
+		{"HashMapList", orderbook.HashMapListType, 0},
+		{"Sharded", orderbook.ShardedType, orderbook.DefaultBucketSize},
+		{"ShardedSmallBucket", orderbook.ShardedType, 16}, // 两档位于不同 bucket
+	}
+	for _, tree := range trees {
+		for _, side := range []domain.Side{domain.SideBuy, domain.SideSell} {
+			cfg := DefaultSymbolConfig()
+			cfg.TreeType, cfg.BucketSize = tree.treeType, tree.bucketSize
+			engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+			engine.Start()
+
+			// 挂单方向与吃单方向相反；best 档 3 个订单，深一档 2 个订单（相距 20 tick）
+			restSide, best, deeper := domain.SideSell, int64(50000), int64(50020)
+			if side == domain.SideSell {
+				restSide, best, deeper = domain.SideBuy, 50000, 49980
+			}
+			for i := 0; i < 3; i++ {
+				engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("best%d", i), "BTCUSDT", "m", restSide, best, 2))
+			}
+			for i := 0; i < 2; i++ {
+				engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("deep%d", i), "BTCUSDT", "m", restSide, deeper, 4))
+			}
+
+			var prices []int64
+			engine.OnTrade(func(trade *domain.Trade) { prices = append(prices, trade.Price) })
+			taker := domain.NewLimitOrder("T", "BTCUSDT", "t", side, deeper, 10) // 6 @ best + 4 @ deeper
+			engine.SubmitOrderSync(taker)
+
+			want := []int64{best, best, best, deeper}
+			if !reflect.DeepEqual(prices, want) || !taker.IsFilled() {
+				t.Errorf("%s side %d: trades at %v, want %v (filled %d)", tree.name, side, prices, want, taker.Filled)
+			}
+			bids, asks := engine.GetOrderBook().GetDepth(10)
+			rest := asks
+			if restSide == domain.SideBuy {
+				rest = bids
+			}
+			if len(rest) != 1 || rest[0].Price != deeper || rest[0].Quantity != 4 || rest[0].Orders != 1 {
+				t.Errorf("%s side %d: remaining levels %+v, want only %d x 4", tree.name, side, rest, deeper)
+			}
+			engine.Stop()
+		}
+	}
+}
+
+// TestMarketDataSeq 成交与深度快照共用每个 symbol 的单调序号：
+// 快照 Seq 之后的成交/增量才需要在快照上重放
+func TestMarketDataSeq(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	var trades []int64
+	engine.OnTrade(func(trade *domain.Trade) { trades = append(trades, trade.Seq) })
+
+	sub := engine.SubscribeDepth(5, 5*time.Millisecond)
+	defer sub.Close()
+	waitForSeq := func(seq int64) DepthSnapshot {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case snap := <-sub.C:
+				if snap.Seq == seq {
+					return snap
+				}
+			case <-deadline:
+				t.Fatalf("no snapshot with seq %d", seq)
+			}
+		}
+	}
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "seller", domain.SideSell, 50000, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "seller", domain.SideSell, 50010, 2))
+	before := waitForSeq(2)
+	if len(before.Asks) != 2 {
+		t.Fatalf("snapshot at seq 2: asks %+v", before.Asks)
+	}
+
+	// 吃单扫两档：每次成交推进一次序号，且都在快照之后
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "buyer", domain.SideBuy, 50010, 2))
+	if want := []int64{3, 4}; !reflect.DeepEqual(trades, want) {
+		t.Fatalf("trade seqs %v, want %v", trades, want)
+	}
+
+	after := waitForSeq(4)
+	_, asks := after.Diff(before)
+	want := []orderbook.DepthDelta{
+		{Action: orderbook.DepthRemove, Price: 50000, Seq: 4},
+		{Action: orderbook.DepthUpdate, Price: 50010, Quantity: 1, Orders: 1, Seq: 4},
+	}
+	if !reflect.DeepEqual(asks, want) {
+		t.Errorf("ask deltas:\n got %+v\nwant %+v", asks, want)
+	}
+}
+
+// TestStopTwice 重复/并发调用 Stop 不应 panic（defer Stop + 错误路径显式 Stop）
+func TestStopTwice(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	engine.Stop()
+	engine.Stop()
+
+	concurrent := NewMatchingEngine("BTCUSDT")
+	concurrent.Start()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			concurrent.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+// TestMatchLoopGuard 人为制造一个永远无法从档位移除的挂单（价格字段被改写），
+// 撮合循环应在达到上限后中止并上报，而不是卡死撮合线程
+func TestMatchLoopGuard(t *testing.T) {
+	if assertFills {
+		t.Skip("fill assertions stop the corrupted fills before the guard fires")
+	}
+	cfg := DefaultSymbolConfig()
+	cfg.TreeType = orderbook.HashMapListType
+	cfg.MaxMatchIterations = 100
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	var aborted []MatchLoopAborted
+	engine.SetMatchLoopAbortedHandler(func(event MatchLoopAborted) { aborted = append(aborted, event) })
+
+	stuck := domain.NewLimitOrder("S1", "BTCUSDT", "seller", domain.SideSell, 50000, 1)
+	engine.SubmitOrderSync(stuck)
+	// 改写价格后 Remove 找不到档位：成交完的订单留在 50000 档队首
+	engine.callOnMatchingThread(func() error { stuck.Price = 50001; return nil })
+
+	taker := domain.NewLimitOrder("B1", "BTCUSDT", "buyer", domain.SideBuy, 50000, 5)
+	done := make(chan error, 1)
+	go func() { done <- engine.SubmitOrderSync(taker) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("match loop did not terminate")
+	}
+
+	want := MatchLoopAborted{Symbol: "BTCUSDT", OrderID: "B1", Side: domain.SideBuy,
+		Iterations: 100, Trades: 100, RemainingQuantity: 4, BestPrice: 50000}
+	if len(aborted) != 1 || aborted[0] != want {
+		t.Fatalf("aborted events %+v, want %+v", aborted, want)
+	}
+	// 剩余部分撤销而不是挂在交叉的订单簿上
+	if taker.Status != domain.OrderStatusCancelled || engine.orderBook.GetOrder("B1") != nil {
+		t.Errorf("taker status %v, resting %v", taker.Status, engine.orderBook.GetOrder("B1") != nil)
+	}
+}
+
+// TestCancelPriorityUnderFlood 订单缓冲区被新订单塞满时，撤单与减量不排在新订单之后：
+// CancelOrder 不阻塞，撤单/减量在积压的新订单之前生效
+func TestCancelPriorityUnderFlood(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	var trades atomic.Int64
+	engine.OnTrade(func(trade *domain.Trade) { trades.Add(trade.Quantity) })
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "mm", domain.SideSell, 50000, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "mm", domain.SideSell, 50010, 5))
+
+	// 阻塞撮合线程，让新订单塞满缓冲区
+	// （等阻塞命令真正开始执行，否则它可能排在下面的撤单/减量之后）
+	release, blocked := make(chan struct{}), make(chan struct{})
+	engine.runOnMatchingThread(func() {
+		close(blocked)
+		<-release
+	})
+	<-blocked
+
+	const flood = 70000 // 超过缓冲区容量（64K）
+	flooded := make(chan struct{})
+	go func() {
+		defer close(flooded)
+		for i := 0; i < flood; i++ {
+			engine.SubmitOrder(domain.NewLimitOrder(fmt.Sprintf("B%d", i), "BTCUSDT", "taker", domain.SideBuy, 50010, 1))
+		}
+	}()
+	if !waitForCondition(func() bool { return atomic.LoadUint32(&engine.orderBuffer.emptySlots) == 0 }, 5*time.Second, time.Millisecond) {
+		t.Fatal("order buffer never filled")
+	}
+
+	cancelled := make(chan struct{})
+	go func() {
+		engine.CancelOrder("S1")
+		close(cancelled)
+	}()
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("CancelOrder blocked behind a full order buffer")
+	}
+
+	reduced := make(chan error, 1)
+	go func() { reduced <- engine.ReduceOrder("S2", 4) }()
+	if !waitForCondition(func() bool { return len(engine.amendChan) == 1 }, 2*time.Second, time.Millisecond) {
+		t.Fatal("reduce never queued")
+	}
+
+	close(release)
+	if err := <-reduced; err != nil {
+		t.Fatalf("ReduceOrder: %v", err)
+	}
+	<-flooded
+	engine.SubmitOrderSync(domain.NewLimitOrder("barrier", "BTCUSDT", "u", domain.SideBuy, 1, 1))
+
+	// 撤单与减量先于所有积压的买单生效：只剩 S2 的 1 手可成交
+	if got := trades.Load(); got != 1 {
+		t.Errorf("traded %d, want 1 (cancel and reduce applied before the flood)", got)
+	}
+}
+
+// TestTradeThroughProtection 受保护报价：拒绝模式下会以劣于保护价成交的订单整单拒绝，
+// 滑价模式下把吃单价格钳制到保护价
+func TestTradeThroughProtection(t *testing.T) {
+	marketBuy := func(id string, quantity int64) *domain.Order {
+		order := domain.NewLimitOrder(id, "BTCUSDT", "t", domain.SideBuy, 0, quantity)
+		order.Type = domain.OrderTypeMarket
+		return order
+	}
+	setup := func(policy TradeThroughPolicy) (*MatchingEngine, *[]int64) {
+		cfg := DefaultSymbolConfig()
+		cfg.TradeThrough = policy
+		engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+		engine.Start()
+		var prices []int64
+		engine.OnTrade(func(trade *domain.Trade) { prices = append(prices, trade.Price) })
+		engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "mm", domain.SideSell, 50000, 2))
+		engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "mm", domain.SideSell, 50010, 3))
+		engine.SetProtectedQuote(49990, 50005) // 外部市场卖一 50005
+		return engine, &prices
+	}
+
+	t.Run("Reject", func(t *testing.T) {
+		engine, prices := setup(TradeThroughReject)
+		defer engine.Stop()
+
+		// 吃完 50000 后会在 50010 成交，劣于保护价：整单拒绝，不产生成交
+		through := domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50010, 3)
+		if err := engine.SubmitOrderSync(through); !errors.Is(err, ErrTradeThrough) || len(*prices) != 0 {
+			t.Fatalf("trade-through order: err %v, trades %v", err, *prices)
+		}
+		// 在保护价以内即可成交完毕的市价单照常接受
+		if err := engine.SubmitOrderSync(marketBuy("B2", 1)); err != nil {
+			t.Fatalf("market order inside protected ask: %v", err)
+		}
+		// 限价不超过保护价：不会穿价，剩余部分挂单
+		if err := engine.SubmitOrderSync(domain.NewLimitOrder("B3", "BTCUSDT", "t", domain.SideBuy, 50003, 5)); err != nil {
+			t.Fatalf("limit at or inside protected ask: %v", err)
+		}
+		if want := []int64{50000, 50000}; !reflect.DeepEqual(*prices, want) {
+			t.Errorf("trades %v, want %v", *prices, want)
+		}
+
+		// 清除保护后恢复普通撮合
+		engine.SetProtectedQuote(0, 0)
+		if err := engine.SubmitOrderSync(domain.NewLimitOrder("B4", "BTCUSDT", "t", domain.SideBuy, 50010, 3)); err != nil {
+			t.Fatalf("after clearing protection: %v", err)
+		}
+		if n := len(*prices); n != 3 || (*prices)[2] != 50010 {
+			t.Errorf("trades after clearing protection %v", *prices)
+		}
+	})
+
+	t.Run("Slide", func(t *testing.T) {
+		engine, prices := setup(TradeThroughSlide)
+		defer engine.Stop()
+
+		// 限价钳制到 50005：只吃 50000，剩余挂在 50005
+		buy := domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50010, 3)
+		if err := engine.SubmitOrderSync(buy); err != nil {
+			t.Fatalf("slid order: %v", err)
+		}
+		if buy.Price != 50005 || buy.Filled != 2 || engine.GetOrderBook().GetBestBid() != 50005 {
+			t.Errorf("slid order price %d filled %d best bid %d", buy.Price, buy.Filled, engine.GetOrderBook().GetBestBid())
+		}
+
+		// 市价单变为保护价上的 IOC 限价单：没有保护价以内的流动性，直接撤销
+		market := marketBuy("B2", 5)
+		engine.SubmitOrderSync(market)
+		if market.Filled != 0 || market.Status != domain.OrderStatusCancelled {
+			t.Errorf("slid market order filled %d status %v", market.Filled, market.Status)
+		}
+		if want := []int64{50000}; !reflect.DeepEqual(*prices, want) {
+			t.Errorf("trades %v, want %v", *prices, want)
+		}
+	})
+}
+
+// TestExecInstructions 执行指令位组合：PostOnly+Hidden 挂单不显示但可被吃，
+// PostOnly 会成交时拒绝，AllOrNone 不能全部成交时不成交直接撤销
+func TestExecInstructions(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	var traded int64
+	engine.OnTrade(func(trade *domain.Trade) { traded += trade.Quantity })
+
+	order := func(id string, side domain.Side, price, qty int64, inst domain.ExecInst) *domain.Order {
+		o := domain.NewLimitOrder(id, "BTCUSDT", "u-"+id, side, price, qty)
+		o.ExecInst = inst
+		return o
+	}
+
+	// PostOnly+Hidden 买单：挂单成功，公开深度中看不到
+	hiddenBid := order("B1", domain.SideBuy, 50000, 4, domain.ExecPostOnly|domain.ExecHidden)
+	if err := engine.SubmitOrderSync(hiddenBid); err != nil {
+		t.Fatalf("post-only hidden bid: %v", err)
+	}
+	if bids, _ := engine.GetOrderBook().GetDepth(5); len(bids) != 0 {
+		t.Errorf("hidden bid displayed: %+v", bids)
+	}
+
+	// 会与隐藏买单成交的 PostOnly 卖单被拒绝
+	if err := engine.SubmitOrderSync(order("S1", domain.SideSell, 50000, 1, domain.ExecPostOnly|domain.ExecHidden)); !errors.Is(err, ErrPostOnlyWouldTrade) {
+		t.Errorf("crossing post-only: %v, want ErrPostOnlyWouldTrade", err)
+	}
+
+	// AllOrNone 卖 5 > 可成交量 4：不成交，直接撤销
+	aon := order("S2", domain.SideSell, 50000, 5, domain.ExecAllOrNone)
+	engine.SubmitOrderSync(aon)
+	if aon.Status != domain.OrderStatusCancelled || aon.Filled != 0 || traded != 0 {
+		t.Errorf("unfillable AON: status %v filled %d traded %d", aon.Status, aon.Filled, traded)
+	}
+
+	// AllOrNone 卖 4：全部成交（隐藏单照常参与撮合）
+	aon = order("S3", domain.SideSell, 50000, 4, domain.ExecAllOrNone)
+	engine.SubmitOrderSync(aon)
+	if !aon.IsFilled() || !hiddenBid.IsFilled() || traded != 4 {
+		t.Errorf("fillable AON: filled %d, hidden bid filled %d, traded %d", aon.Filled, hiddenBid.Filled, traded)
+	}
+}
+
+// TestAmendKeepsPriority 只改有效期/TIF 的改单原地修改，队列位置不变；
+// 改价或加量整单拒绝，不做任何修改
+func TestAmendKeepsPriority(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	cfg := DefaultSymbolConfig()
+	cfg.Clock = clock
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	for _, id := range []string{"B1", "B2", "B3"} {
+		engine.SubmitOrderSync(domain.NewLimitOrder(id, "BTCUSDT", "u", domain.SideBuy, 50000, 2))
+	}
+	position := func(id string) int {
+		t.Helper()
+		ahead, _, found := engine.QueuePosition(id)
+		if !found {
+			t.Fatalf("%s not resting", id)
+		}
+		return ahead
+	}
+
+	// TIF + 有效期（GTC -> GTD）
+	gtc := domain.TimeInForceGTC
+	expireAt := clock.Now().Add(time.Minute)
+	if err := engine.AmendOrder("B2", OrderAmend{TimeInForce: &gtc, ExpireAt: &expireAt}); err != nil {
+		t.Fatalf("TIF-only amend: %v", err)
+	}
+	if got := position("B2"); got != 1 {
+		t.Errorf("B2 has %d orders ahead after TIF amend, want 1", got)
+	}
+
+	// 改价：拒绝，且同一请求中的有效期也不生效
+	price, later := int64(50001), expireAt.Add(time.Hour)
+	if err := engine.AmendOrder("B2", OrderAmend{Price: &price, ExpireAt: &later}); !errors.Is(err, ErrAmendLosesPriority) {
+		t.Errorf("price amend: %v, want ErrAmendLosesPriority", err)
+	}
+	more := int64(3)
+	if err := engine.AmendOrder("B1", OrderAmend{Quantity: &more}); !errors.Is(err, ErrAmendLosesPriority) {
+		t.Errorf("quantity-up amend: %v, want ErrAmendLosesPriority", err)
+	}
+
+	// 减量保持位置
+	less := int64(1)
+	if err := engine.AmendOrder("B1", OrderAmend{Quantity: &less}); err != nil {
+		t.Fatalf("quantity-down amend: %v", err)
+	}
+	if _, qty, _ := engine.QueuePosition("B2"); qty != 1 || position("B3") != 2 {
+		t.Errorf("after reduce: B2 qty ahead %d, B3 position %d", qty, position("B3"))
+	}
+
+	// 新的有效期到期后订单过期（原地修改的有效期已被跟踪）
+	clock.Advance(2 * time.Minute)
+	if !waitForCondition(func() bool {
+		_, _, found := engine.QueuePosition("B2")
+		return !found
+	}, 2*time.Second, time.Millisecond) {
+		t.Error("amended GTD order did not expire")
+	}
+	if got := position("B3"); got != 1 {
+		t.Errorf("B3 has %d orders ahead after B2 expired, want 1", got)
+	}
+}
+
+// TestPendingStopInvisible 未触发的止损单不出现在深度/BBO 中，触发后才影响订单簿
+func TestPendingStopInvisible(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m", domain.SideSell, 50000, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "m", domain.SideSell, 50100, 5))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B0", "BTCUSDT", "m", domain.SideBuy, 49900, 1))
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50000, 1)) // 最新成交价 50000
+
+	view := func() string {
+		var out string
+		engine.WithFrozenView(func(book orderbook.ReadOnlyBook) {
+			bids, asks := book.GetDepth(10)
+			out = fmt.Sprintf("bids %v asks %v bbo %d/%d", bids, asks, book.GetBestBid(), book.GetBestAsk())
+		})
+		return out
+	}
+	before := view()
+
+	stop := domain.NewLimitOrder("STOP", "BTCUSDT", "c", domain.SideBuy, 0, 2)
+	stop.Type = domain.OrderTypeStop
+	stop.TriggerPrice = 50050
+	engine.SubmitOrderSync(stop)
+
+	if after := view(); after != before {
+		t.Fatalf("pending stop changed the visible book:\nbefore %s\nafter  %s", before, after)
+	}
+	if n := engine.PendingStopCount(); n != 1 {
+		t.Fatalf("PendingStopCount = %d, want 1", n)
+	}
+
+	// 成交价升到 50100 触发止损单：从 S2 买入 2
+	engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "t", domain.SideBuy, 50100, 1))
+	if !stop.IsFilled() {
+		t.Fatalf("stop not triggered, status %v", stop.Status)
+	}
+	if n := engine.PendingStopCount(); n != 0 {
+		t.Errorf("PendingStopCount after trigger = %d, want 0", n)
+	}
+	_, asks := engine.GetOrderBook().GetDepth(10)
+	if len(asks) != 1 || asks[0].Price != 50100 || asks[0].Quantity != 2 {
+		t.Errorf("asks after trigger %v, want [50100 x 2]", asks)
+	}
+
+	// 撤销未触发的止损单同样更新计数
+	stop2 := domain.NewLimitOrder("STOP2", "BTCUSDT", "c", domain.SideSell, 0, 1)
+	stop2.Type = domain.OrderTypeStop
+	stop2.TriggerPrice = 49000
+	engine.SubmitOrderSync(stop2)
+	engine.CancelOrderSync("STOP2")
+	if n := engine.PendingStopCount(); n != 0 {
+		t.Errorf("PendingStopCount after cancel = %d, want 0", n)
+	}
+}
+
+// TestSimulationVirtualTime 仿真模式下虚拟时间随订单时间戳推进，GTD 过期按历史时间确定性发生
+func TestSimulationVirtualTime(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.Simulation = true
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	start := time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)
+	at := func(order *domain.Order, offset time.Duration) *domain.Order {
+		order.Timestamp = start.Add(offset) // 回放的历史时间戳
+		return order
+	}
+	var trades []*domain.Trade
+	engine.OnTrade(func(trade *domain.Trade) { trades = append(trades, trade) })
+
+	// 两个 GTD 卖单：S1 在 +1m 过期，S2 在 +10m 过期
+	s1 := at(domain.NewLimitOrder("S1", "BTCUSDT", "m", domain.SideSell, 50000, 1), 0)
+	s1.ExpireAt = start.Add(time.Minute)
+	engine.SubmitOrderSync(s1)
+	s2 := at(domain.NewLimitOrder("S2", "BTCUSDT", "m", domain.SideSell, 50100, 1), time.Second)
+	s2.ExpireAt = start.Add(10 * time.Minute)
+	engine.SubmitOrderSync(s2)
+	if !s2.Timestamp.Equal(start.Add(time.Second)) {
+		t.Errorf("S2 accepted at %v, want its historical timestamp", s2.Timestamp)
+	}
+
+	// 全速回放：墙钟几乎不动，但 +2m 的买单到达前 S1 已按虚拟时间过期
+	engine.SubmitOrderSync(at(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50100, 1), 2*time.Minute))
+	if len(trades) != 1 || trades[0].SellOrderID != "S2" || !trades[0].Timestamp.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("want one trade against S2 at +2m, got %+v", trades)
+	}
+	if s1.Status != domain.OrderStatusExpired {
+		t.Errorf("S1 status %v, want expired", s1.Status)
+	}
+
+	// 虚拟时间不倒退：更早的时间戳按当前虚拟时间处理
+	late := at(domain.NewLimitOrder("B2", "BTCUSDT", "t", domain.SideBuy, 49000, 1), time.Minute)
+	late.ExpireAt = start.Add(5 * time.Minute)
+	engine.SubmitOrderSync(late)
+	if !late.Timestamp.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("out-of-order order accepted at %v, want %v", late.Timestamp, start.Add(2*time.Minute))
+	}
+
+	// 没有订单时用 AdvanceTime 推进到收盘，剩余 GTD 过期
+	if err := engine.AdvanceTime(start.Add(time.Hour)); err != nil {
+		t.Fatalf("AdvanceTime: %v", err)
+	}
+	if bid := engine.GetOrderBook().GetBestBid(); bid != 0 {
+		t.Errorf("best bid %d after advancing past expiry, want empty", bid)
+	}
+
+	if err := NewMatchingEngine("ETHUSDT").AdvanceTime(start); !errors.Is(err, ErrNotSimulation) {
+		t.Errorf("AdvanceTime on a live engine: %v, want ErrNotSimulation", err)
+	}
+}
+
+// TestAdvanceTimeKeepsFIFO AdvanceTime 与订单保持 FIFO：先排队的订单按自己的时间戳撮合，不被后来的推进抢先
+func TestAdvanceTimeKeepsFIFO(t *testing.T) {
+	cfg := DefaultSymbolConfig()
+	cfg.Simulation = true
+	engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+	engine.Start()
+	defer engine.Stop()
+
+	t1 := time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)
+	t2, t3 := t1.Add(time.Minute), t1.Add(3*time.Minute)
+
+	// O1 @t1：GTD 卖单，在 t2 与 t3 之间过期
+	o1 := domain.NewLimitOrder("O1", "BTCUSDT", "m", domain.SideSell, 50000, 1)
+	o1.Timestamp, o1.ExpireAt = t1, t2.Add(time.Minute)
+	engine.SubmitOrderSync(o1)
+
+	// 撮合线程暂停时先排队 O2 @t2，再排队 AdvanceTime(t3)
+	o2 := domain.NewLimitOrder("O2", "BTCUSDT", "t", domain.SideBuy, 50000, 1)
+	o2.Timestamp = t2
+	advanced := make(chan error, 1)
+	engine.WithFrozenView(func(orderbook.ReadOnlyBook) {
+		engine.SubmitOrder(o2)
+		go func() { advanced <- engine.AdvanceTime(t3) }()
+		time.Sleep(20 * time.Millisecond)
+	})
+	if err := <-advanced; err != nil {
+		t.Fatalf("AdvanceTime: %v", err)
+	}
+
+	// O2 在 t2 成交，O1 尚未过期
+	if o2.Status != domain.OrderStatusFilled || !o2.Timestamp.Equal(t2) {
+		t.Errorf("O2 status %v at %v, want filled at %v", o2.Status, o2.Timestamp, t2)
+	}
+	if o1.Status != domain.OrderStatusFilled {
+		t.Errorf("O1 status %v, want filled before its expiry", o1.Status)
+	}
+	if now := engine.now(); !now.Equal(t3) {
+		t.Errorf("virtual time %v after AdvanceTime, want %v", now, t3)
+	}
+}
+
+// TestEnginePanicRecovery 撮合线程 panic 被隔离：引擎报告不健康并暂停交易，而不是卡死
+func TestEnginePanicRecovery(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	events := make(chan EnginePanic, 2)
+	engine.SetEnginePanicHandler(func(event EnginePanic) { events <- event })
+	engine.OnTrade(func(trade *domain.Trade) {
+		if trade.BuyOrderID == "BAD" {
+			panic("injected")
+		}
+	})
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m", domain.SideSell, 50000, 5))
+	if h := engine.Health(); !h.Healthy || h.Panics != 0 {
+		t.Fatalf("fresh engine health %+v", h)
+	}
+
+	// 同步提交者拿到 ErrEnginePanic 而不是永远阻塞
+	result := make(chan error, 1)
+	go func() {
+		result <- engine.SubmitOrderSync(domain.NewLimitOrder("BAD", "BTCUSDT", "t", domain.SideBuy, 50000, 1))
+	}()
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrEnginePanic) {
+			t.Fatalf("SubmitOrderSync: %v, want ErrEnginePanic", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("engine wedged after a panic")
+	}
+
+	select {
+	case event := <-events:
+		if event.Symbol != "BTCUSDT" || event.OrderID != "BAD" || event.Value != "injected" || len(event.Stack) == 0 {
+			t.Errorf("unexpected panic event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no EnginePanic event")
+	}
+	if h := engine.Health(); h.Healthy || h.Panics != 1 || h.LastPanic.OrderID != "BAD" {
+		t.Errorf("health after panic %+v", h)
+	}
+
+	// 循环已重启：新订单被拒绝（暂停交易），撤单仍然可用
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("B2", "BTCUSDT", "t", domain.SideBuy, 50000, 1)); !errors.Is(err, ErrTradingHalted) {
+		t.Errorf("order after panic: %v, want ErrTradingHalted", err)
+	}
+	if _, err := engine.CancelOrderSync("S1"); err != nil {
+		t.Errorf("cancel after panic: %v", err)
+	}
+
+	// 同步命令 panic 同样返回错误
+	if err := engine.WithFrozenView(func(orderbook.ReadOnlyBook) { panic("in view") }); !errors.Is(err, ErrEnginePanic) {
+		t.Errorf("panicking command: %v, want ErrEnginePanic", err)
+	}
+	<-events
+
+	// Resume 后恢复交易，健康记录保留
+	engine.Resume()
+	engine.SubmitOrderSync(domain.NewLimitOrder("S3", "BTCUSDT", "m", domain.SideSell, 50000, 1))
+	if err := engine.SubmitOrderSync(domain.NewLimitOrder("B3", "BTCUSDT", "t", domain.SideBuy, 50000, 1)); err != nil {
+		t.Errorf("order after Resume: %v", err)
+	}
+	if h := engine.Health(); h.Healthy || h.Panics != 2 {
+		t.Errorf("health after Resume %+v, want 2 panics on record", h)
+	}
+}
+
+// TestIcebergRandomizedSlices 冰山单每次补单的显示数量在配置区间内随机（种子可复现），
+// 所有显示切片之和等于原始数量
+func TestIcebergRandomizedSlices(t *testing.T) {
+	slices := func(seed int64) []int64 {
+		cfg := DefaultSymbolConfig()
+		cfg.Rand = rand.New(rand.NewSource(seed))
+		engine := NewMatchingEngineWithConfig("BTCUSDT", cfg)
+		engine.Start()
+		defer engine.Stop()
+
+		iceberg := domain.NewLimitOrder("ICE", "BTCUSDT", "whale", domain.SideSell, 50000, 100)
+		iceberg.DisplayQty, iceberg.DisplayQtyMax = 5, 15
+		if err := engine.SubmitOrderSync(iceberg); err != nil {
+			t.Fatalf("iceberg rejected: %v", err)
+		}
+
+		// 每次吃掉当前显示的切片，触发下一次补单
+		var shown []int64
+		for i := 0; !iceberg.IsFilled(); i++ {
+			_, asks := engine.GetOrderBook().GetDepth(1)
+			if len(asks) != 1 || asks[0].Orders != 1 {
+				t.Fatalf("slice %d: depth %v", i, asks)
+			}
+			shown = append(shown, asks[0].Quantity)
+			engine.SubmitOrderSync(domain.NewLimitOrder(fmt.Sprintf("B%d", i), "BTCUSDT", "t", domain.SideBuy, 50000, asks[0].Quantity))
+		}
+		return shown
+	}
+
+	shown := slices(7)
+	var sum int64
+	distinct := map[int64]bool{}
+	for i, qty := range shown {
+		sum += qty
+		distinct[qty] = true
+		if i < len(shown)-1 && (qty < 5 || qty > 15) {
+			t.Errorf("slice %d = %d, outside [5, 15]", i, qty)
+		}
+	}
+	if sum != 100 {
+		t.Errorf("slices %v sum to %d, want 100", shown, sum)
+	}
+	if len(distinct) < 2 {
+		t.Errorf("slices %v not randomized", shown)
+	}
+	if again := slices(7); fmt.Sprint(again) != fmt.Sprint(shown) {
+		t.Errorf("same seed gave %v, then %v", shown, again)
+	}
+}
+
+// TestIcebergRefillLosesPriority 冰山单只显示切片；切片吃完后补单排到同价位队尾
+func TestIcebergRefillLosesPriority(t *testing.T) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	var fills []string
+	engine.OnTrade(func(trade *domain.Trade) {
+		fills = append(fills, fmt.Sprintf("%s:%d", trade.SellOrderID, trade.Quantity))
+	})
+
+	iceberg := domain.NewLimitOrder("ICE", "BTCUSDT", "m", domain.SideSell, 50000, 6)
+	iceberg.DisplayQty = 2
+	engine.SubmitOrderSync(iceberg)
+	engine.SubmitOrderSync(domain.NewLimitOrder("S2", "BTCUSDT", "m", domain.SideSell, 50000, 3))
+
+	// 深度只显示切片：2 + 3
+	_, asks := engine.GetOrderBook().GetDepth(1)
+	if len(asks) != 1 || asks[0].Quantity != 5 || asks[0].Orders != 2 {
+		t.Fatalf("depth %v, want [50000 x 5, 2 orders]", asks)
+	}
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50000, 6))
+	if got := fmt.Sprint(fills); got != "[ICE:2 S2:3 ICE:1]" {
+		t.Errorf("fills %s, want [ICE:2 S2:3 ICE:1]", got)
+	}
+	_, asks = engine.GetOrderBook().GetDepth(1)
+	if len(asks) != 1 || asks[0].Quantity != 1 || iceberg.RemainingQuantity() != 3 {
+		t.Errorf("after sweep: depth %v, iceberg remaining %d", asks, iceberg.RemainingQuantity())
+	}
+
+	bad := domain.NewLimitOrder("BAD", "BTCUSDT", "m", domain.SideSell, 50000, 6)
+	bad.DisplayQty, bad.DisplayQtyMax = 4, 2
+	if err := engine.SubmitOrderSync(bad); !errors.Is(err, ErrInvalidIceberg) {
+		t.Errorf("inverted display range: %v, want ErrInvalidIceberg", err)
+	}
+}
+
+// TestFillAssertion 篡改订单 Filled 后断言能发现记账错误
+// 默认构建下断言被编译掉，只校验断言本身；用 -tags matchassert 运行时走完整撮合路径
+func TestFillAssertion(t *testing.T) {
+	if !assertFills {
+		corrupt := domain.NewLimitOrder("S1", "BTCUSDT", "m", domain.SideSell, 50000, 5)
+		corrupt.Filled = 6
+		defer func() {
+			if err, ok := recover().(error); !ok || !errors.Is(err, ErrFillInvariant) {
+				t.Errorf("recovered %v, want ErrFillInvariant", err)
+			}
+		}()
+		assertFill(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50000, 1), corrupt, 1)
+		t.Fatal("corrupted order passed the fill assertion")
+	}
+
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.Start()
+	defer engine.Stop()
+
+	engine.SubmitOrderSync(domain.NewLimitOrder("S1", "BTCUSDT", "m", domain.SideSell, 50000, 5))
+	engine.callOnMatchingThread(func() error {
+		engine.orderBook.GetOrder("S1").Filled = 6 // 模拟记账错误
+		return nil
+	})
+
+	err := engine.SubmitOrderSync(domain.NewLimitOrder("B1", "BTCUSDT", "t", domain.SideBuy, 50000, 1))
+	if !errors.Is(err, ErrEnginePanic) {
+		t.Fatalf("SubmitOrderSync: %v, want ErrEnginePanic", err)
+	}
+	if h := engine.Health(); h.Healthy || !strings.Contains(h.LastPanic.Value, ErrFillInvariant.Error()) {
+		t.Errorf("health %+v, want a fill invariant panic", h)
+	}
+}
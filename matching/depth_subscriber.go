@@ -0,0 +1,119 @@
+package matching
+
+import (
+	"lightning-exchange/orderbook"
+	"sync"
+	"time"
+)
+
+// DepthSnapshot is a consistent top-N view of the book taken on the matching thread
+//
+// Seq is the book sequence (orderbook.OrderBook.Seq) the snapshot reflects: every trade
+// with Trade.Seq <= Seq is already included. Trades and deltas share that one per-symbol
+// clock, so a consumer resyncing after a gap takes a snapshot, then applies only the
+// trades and DepthDeltas with a Seq greater than the snapshot's.
+type DepthSnapshot struct {
+	Symbol    string
+	Seq       int64
+	Bids      []orderbook.PriceLevel
+	Asks      []orderbook.PriceLevel
+	Timestamp time.Time
+}
+
+// Diff returns the level changes that turn prev into s, each stamped with s.Seq
+// Deltas from consecutive snapshots of one subscriber form an incremental depth feed.
+func (s DepthSnapshot) Diff(prev DepthSnapshot) (bids, asks []orderbook.DepthDelta) {
+	bids = orderbook.DiffDepth(prev.Bids, s.Bids)
+	asks = orderbook.DiffDepth(prev.Asks, s.Asks)
+	for i := range bids {
+		bids[i].Seq = s.Seq
+	}
+	for i := range asks {
+		asks[i].Seq = s.Seq
+	}
+	return bids, asks
+}
+
+// DepthSubscriber delivers coalesced depth snapshots at a fixed interval
+// Decouples a consumer's refresh rate from the matching rate:
+//   - One snapshot is taken per tick, however many book changes happened in between
+//   - C holds at most one snapshot; a slow reader only ever sees the latest one
+//     (older undelivered snapshots are replaced, never queued)
+//
+// Snapshots are stamped on the engine clock; the interval itself is wall-clock time.
+// Multiple subscribers with different intervals and depths may coexist on one engine.
+type DepthSubscriber struct {
+	C <-chan DepthSnapshot
+
+	updates   chan DepthSnapshot
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// SubscribeDepth starts a subscriber emitting the top `levels` levels every `interval`
+// Call Close when done to stop the background ticker.
+func (me *MatchingEngine) SubscribeDepth(levels int, interval time.Duration) *DepthSubscriber {
+	updates := make(chan DepthSnapshot, 1)
+	sub := &DepthSubscriber{
+		C:       updates,
+		updates: updates,
+		done:    make(chan struct{}),
+	}
+
+	go sub.run(me, levels, interval)
+	return sub
+}
+
+// Close stops the subscriber; C receives no further snapshots
+// Safe to call more than once; calls after the first are no-ops.
+func (s *DepthSubscriber) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// run requests a snapshot from the matching thread on every tick
+func (s *DepthSubscriber) run(me *MatchingEngine, levels int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Snapshot is built on the matching thread so it never observes a half-applied order
+	snapshot := func() {
+		bids, asks := me.orderBook.GetDepth(levels)
+		s.publish(DepthSnapshot{
+			Symbol:    me.symbol,
+			Seq:       me.orderBook.Seq(),
+			Bids:      bids,
+			Asks:      asks,
+			Timestamp: me.now(),
+		})
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		case <-me.stopChan:
+			return
+		}
+
+		select {
+		case me.controlChan <- snapshot:
+			me.wake()
+		case <-s.done:
+			return
+		case <-me.stopChan:
+			return
+		}
+	}
+}
+
+// publish replaces any undelivered snapshot with the latest one (matching thread only)
+func (s *DepthSubscriber) publish(snapshot DepthSnapshot) {
+	select {
+	case <-s.updates:
+	default:
+	}
+	s.updates <- snapshot
+}
@@ -2,7 +2,9 @@ package matching
 
 import (
 	"lightning-exchange/domain"
+	"runtime"
 	"sync/atomic"
+	"time"
 	_ "unsafe" // for go:linkname
 )
 
@@ -22,13 +24,29 @@ func semreleaseSafe(s *uint32, handoff bool, skipframes int)
 // 1. 先 semacquire(full) 获取第 1 个（阻塞，保证不空）
 // 2. 再循环调用 semacquire(full) 获取更多（最多 127 个）
 // 3. 所有操作都通过 semaphore，不使用 CAS
+//
+// 内存序（多生产者）：
+// semaphore 只保证"数量"，不绑定"槽位"。两个生产者领取相邻序号 s、s+1 后，
+// 可能 s+1 先写完并释放 fullSlots，此时消费者拿到令牌、领取读序号 s，
+// 而 s 号槽位尚未写入——读到的是上一圈的旧值或 nil（nil 会被当成唤醒令牌，订单丢失）。
+// 因此每个槽位另有一个发布序号 published：
+//   - 生产者写完 buffer 后 Store(seq+1)，消费者 Load 到 seq+1 才读取（release/acquire）
+//   - 消费者读完后 Store(-(seq+1))，下一圈的生产者 Load 到该值才覆盖
+//
+// emptySlots/fullSlots 仍负责阻塞与计数，published 只确认"自己的槽位"已就绪，
+// 正常情况下第一次 Load 即通过；等待时间上限是另一个生产者领取序号到写完之间的几条指令。
 type RingBufferSemaphoreBatchSafe struct {
 	buffer     []*domain.Order
+	published  []atomic.Int64 // 每个槽位的发布序号：seq+1 已写入，-(seq+1) 已读走，0 从未使用
 	mask       int64
 	writeSeq   atomic.Int64
 	readSeq    atomic.Int64
 	emptySlots uint32
 	fullSlots  uint32
+
+	// 满时丢弃最旧元素（可选，默认关闭 = 满时阻塞生产者）
+	dropOldest bool
+	onDrop     func(order *domain.Order)
 }
 
 // ConsumerBatchSafe 消费者批量读取缓存
@@ -47,6 +65,7 @@ func NewRingBufferSemaphoreBatchSafe(size int) *RingBufferSemaphoreBatchSafe {
 
 	rb := &RingBufferSemaphoreBatchSafe{
 		buffer:     make([]*domain.Order, size),
+		published:  make([]atomic.Int64, size),
 		mask:       int64(size - 1),
 		emptySlots: 0,
 		fullSlots:  0,
@@ -69,15 +88,108 @@ func (rb *RingBufferSemaphoreBatchSafe) NewConsumerBatchSafe() *ConsumerBatchSaf
 	}
 }
 
+// SetDropOldest 切换为满时丢弃最旧元素模式（必须在使用前调用）
+//
+// 默认模式下缓冲区满时 Publish 阻塞，保证每个元素恰好被消费一次。
+// 丢弃模式下生产者不再阻塞：缓冲区满时抢占最旧的未消费元素并覆盖其槽位，
+// 被丢弃的元素交给 onDrop（在生产者 goroutine 上调用，不含 nil 唤醒令牌）。
+// 代价：放弃 exactly-once 保证，以新鲜度换完整性。仅适用于能容忍丢单的场景。
+func (rb *RingBufferSemaphoreBatchSafe) SetDropOldest(onDrop func(order *domain.Order)) {
+	rb.dropOldest = true
+	rb.onDrop = onDrop
+}
+
+// trySemacquire 非阻塞获取 semaphore，与 runtime 快速路径（cansemacquire）相同的 CAS 语义
+func trySemacquire(s *uint32) bool {
+	for {
+		v := atomic.LoadUint32(s)
+		if v == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(s, v, v-1) {
+			return true
+		}
+	}
+}
+
+// writeSlot 写入已领取的写序号 seq
+// 先等上一圈的元素被读走（emptySlots 已保证数量，这里确认是本槽位），写完再发布序号
+func (rb *RingBufferSemaphoreBatchSafe) writeSlot(seq int64, order *domain.Order) {
+	index := seq & rb.mask
+	var prev int64
+	if size := int64(len(rb.buffer)); seq >= size {
+		prev = -(seq - size + 1)
+	}
+	for rb.published[index].Load() != prev {
+		runtime.Gosched()
+	}
+	rb.buffer[index] = order
+	rb.published[index].Store(seq + 1)
+}
+
+// readSlot 读取已领取的读序号 seq
+// 拿到 fullSlots 令牌不代表本序号已写完（可能是更晚的序号先发布），需等待本槽位的发布序号
+func (rb *RingBufferSemaphoreBatchSafe) readSlot(seq int64) *domain.Order {
+	index := seq & rb.mask
+	for rb.published[index].Load() != seq+1 {
+		runtime.Gosched()
+	}
+	order := rb.buffer[index]
+	rb.buffer[index] = nil
+	rb.published[index].Store(-(seq + 1))
+	return order
+}
+
 // Publish 发布单个元素（生产者使用）
 func (rb *RingBufferSemaphoreBatchSafe) Publish(order *domain.Order) {
+	if rb.dropOldest {
+		rb.publishDropOldest(order)
+		return
+	}
+
 	semacquireSafe(&rb.emptySlots)
 
-	seq := rb.writeSeq.Add(1) - 1
-	index := seq & rb.mask
-	rb.buffer[index] = order
+	rb.writeSlot(rb.writeSeq.Add(1)-1, order)
+
+	semreleaseSafe(&rb.fullSlots, false, 0)
+}
+
+// TryPublish 非阻塞发布：缓冲区满时不写入并返回 false（丢弃模式下也不会抢占旧元素）
+// 用于发布 nil 唤醒令牌：缓冲区满说明消费者有活可干，不需要再唤醒
+func (rb *RingBufferSemaphoreBatchSafe) TryPublish(order *domain.Order) bool {
+	if !trySemacquire(&rb.emptySlots) {
+		return false
+	}
+
+	rb.writeSlot(rb.writeSeq.Add(1)-1, order)
 
 	semreleaseSafe(&rb.fullSlots, false, 0)
+	return true
+}
+
+// publishDropOldest 丢弃模式的发布
+// 序号管理：抢占方与消费者一样先取得 fullSlots 令牌再推进 readSeq，
+// 因此每个读序号仍只被领取一次；被抢占的槽位直接转为本次写入的空位，
+// 不经过 emptySlots（满时 writeSeq - readSeq == size，新写入正好落在该槽位）。
+func (rb *RingBufferSemaphoreBatchSafe) publishDropOldest(order *domain.Order) {
+	var dropped *domain.Order
+	for !trySemacquire(&rb.emptySlots) {
+		// 缓冲区满：抢占最旧的未消费元素
+		if trySemacquire(&rb.fullSlots) {
+			dropped = rb.readSlot(rb.readSeq.Add(1) - 1)
+			break
+		}
+		// 消费者正在读取，空位即将释放
+		runtime.Gosched()
+	}
+
+	rb.writeSlot(rb.writeSeq.Add(1)-1, order)
+
+	semreleaseSafe(&rb.fullSlots, false, 0)
+
+	if dropped != nil && rb.onDrop != nil {
+		rb.onDrop(dropped)
+	}
 }
 
 // Consume 批量读取优化的阻塞消费
@@ -98,6 +210,34 @@ func (cb *ConsumerBatchSafe) Consume() *domain.Order {
 	return order
 }
 
+// ConsumeTimeout 带超时的消费：d 内没有元素到达时返回 (nil, false)
+// 供空闲时也需要定期做维护工作（过期扫描、心跳）的循环使用，避免 default 分支忙等。
+//
+// 实现：缓冲区为空时挂一个定时器，到期后发布 nil 唤醒令牌，阻塞中的 semaphore 等待随之返回。
+// 令牌用非阻塞发布（见 wakeConsumer）：超时绝不阻塞定时器 goroutine，也不会在丢弃模式下挤掉真实元素。
+// 若元素与定时器同时到达，残留的 nil 令牌会让之后的某次消费返回 (nil, false)，
+// 即允许虚假超时（与条件变量的虚假唤醒类似），调用方按超时处理即可。
+// 注意：nil 本身即唤醒令牌，因此 Publish(nil) 也会表现为一次超时。
+func (cb *ConsumerBatchSafe) ConsumeTimeout(d time.Duration) (*domain.Order, bool) {
+	if cb.cacheStart < cb.cacheEnd || atomic.LoadUint32(&cb.rb.fullSlots) > 0 {
+		order := cb.Consume()
+		return order, order != nil
+	}
+
+	// 缓冲区为空：定时器到期时发布唤醒令牌
+	timer := time.AfterFunc(d, cb.rb.wakeConsumer)
+	order := cb.Consume()
+	timer.Stop()
+	return order, order != nil
+}
+
+// wakeConsumer 非阻塞地发布 nil 唤醒令牌（ConsumeTimeout 的定时器回调）
+// 缓冲区满时放弃：消费者此时一定有元素可取，不会阻塞，不需要令牌；
+// 用 Publish 会让定时器 goroutine 阻塞，丢弃模式下还会为令牌丢掉一个真实订单。
+func (rb *RingBufferSemaphoreBatchSafe) wakeConsumer() {
+	rb.TryPublish(nil)
+}
+
 // fillCacheSafe 批量填充（纯 semaphore 语义）
 // 关键改进：不使用 CAS，每个元素都通过 semacquire
 func (cb *ConsumerBatchSafe) fillCacheSafe() {
@@ -107,9 +247,7 @@ func (cb *ConsumerBatchSafe) fillCacheSafe() {
 	semacquireSafe(&rb.fullSlots)
 
 	// 读取第 1 个元素
-	seq := rb.readSeq.Add(1) - 1
-	index := seq & rb.mask
-	cb.localCache[0] = rb.buffer[index]
+	cb.localCache[0] = rb.readSlot(rb.readSeq.Add(1) - 1)
 
 	// 释放对应的空位
 	semreleaseSafe(&rb.emptySlots, false, 0)
@@ -131,12 +269,17 @@ func (cb *ConsumerBatchSafe) fillCacheSafe() {
 	// 批量获取（每次都调用 semacquire，但我们知道有数据所以不会阻塞）
 	for i := 0; i < available; i++ {
 		// 纯 semaphore 操作：获取 token
-		semacquireSafe(&rb.fullSlots)
+		// 丢弃模式下生产者可能抢走令牌，改为非阻塞获取，取不到就结束本批
+		if rb.dropOldest {
+			if !trySemacquire(&rb.fullSlots) {
+				break
+			}
+		} else {
+			semacquireSafe(&rb.fullSlots)
+		}
 
 		// 读取数据
-		seq := rb.readSeq.Add(1) - 1
-		index := seq & rb.mask
-		cb.localCache[acquired] = rb.buffer[index]
+		cb.localCache[acquired] = rb.readSlot(rb.readSeq.Add(1) - 1)
 
 		// 释放空位
 		semreleaseSafe(&rb.emptySlots, false, 0)
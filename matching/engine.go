@@ -1,13 +1,19 @@
 package matching
 
 import (
+	"errors"
 	"lightning-exchange/domain"
 	"lightning-exchange/orderbook"
+	"math/rand"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// ErrEngineStopped is returned by synchronous calls when the engine stops before completing them
+var ErrEngineStopped = errors.New("matching engine stopped")
+
 // IMatchingEngine defines the interface for a matching engine
 type IMatchingEngine interface {
 	// SubmitOrder submits an order to the matching engine (non-blocking)
@@ -33,24 +39,174 @@ type MatchingEngine struct {
 	symbol      string                        // Trading pair this engine handles
 	orderBook   *orderbook.OrderBook          // Order book for this symbol
 	orderBuffer *RingBufferSemaphoreBatchSafe // Incoming order queue (batch + safe semaphore)
-	cancelChan  chan string                   // Cancel order requests (by order ID)
+	cancelChan  chan cancelRequest            // Cancel order requests (by order ID)
 	tradeBuffer *TradeRingBufferBatchSafe     // Outgoing trade queue (batch + safe semaphore)
-	tradeIDGen  *IDGenerator                  // Trade ID generator
+	tradeIDGen  IDProvider                    // Trade ID source (SymbolConfig.TradeIDs or an IDGenerator)
+	amendChan   chan func()                   // Risk-reducing amends (ReduceOrder), serviced after cancels
+	controlChan chan func()                   // Administrative commands run on the matching thread (rare)
 	stopChan    chan struct{}                 // Signal to stop the engine
+	stopOnce    sync.Once                     // Makes Stop idempotent (closes stopChan once)
+
+	statsMu sync.Mutex   // Guards stats; held only briefly by the matching thread and GetTicker
+	stats   sessionStats // Session high/low/volume/VWAP accumulators
+
+	// Optional maker veto for LastLook orders (nil = accept); matching thread only
+	lastLook func(aggressor, resting *domain.Order) bool
+
+	stpMode     SelfTradePrevention // Self-trade prevention mode; matching thread only
+	onSelfMatch func(SelfMatch)     // Optional private notification of self-matches
+	onAggTrade  func(AggTrade)      // Optional per-taker aggregated trade stream
+	onTrade     func(*domain.Trade) // Optional inline per-trade callback
+	logger      Logger              // Optional structured logger for matching decisions (nil = off)
+
+	onOrderEvent func(OrderEvent) // Optional per-order outcome stream (filled / resting / cancelled)
+
+	events   chan EngineEvent // Optional unified order + trade feed (nil = off)
+	eventSeq int64            // Last EngineEvent.Seq assigned; matching thread only
+
+	onFill        func(FillEvent) // Optional aggressor fill stream
+	fillReporting FillReporting   // Per-fill or per-order FillEvents (SymbolConfig.FillReporting)
+
+	syncWaiters atomic.Int32 // Number of SubmitOrderSync calls in flight (gates the syncDone lookup)
+	syncDone    sync.Map     // *domain.Order -> chan syncOutcome, receives the order's outcome once processed
+
+	tickSize   int64                                // Minimum price increment (0 = unchecked)
+	tickPolicy TickPolicy                           // Reject or snap off-tick limit prices
+	midpoint   MidpointRounding                     // Rounding of off-tick midpoint executions
+	onReject   func(order *domain.Order, err error) // Optional rejection notification
+
+	maxOpenOrders int // Per-user resting order cap (0 = unlimited)
+
+	expiryBatch int          // Max GTD orders expired per loop iteration (<= 0 = unbounded)
+	nextExpiry  atomic.Int64 // Earliest pending GTD expiry (UnixNano, 0 = none); published by the matching thread
+	armedExpiry int64        // Expiry the timer is armed for (0 = stopped); matching thread only
+	expiryTimer *time.Timer  // Wakes an idle loop at the next GTD expiry (nil = not started / simulation)
+
+	clock Clock         // Injected time source (nil = wall clock); immutable after construction
+	sim   *VirtualClock // Virtual time in simulation mode (nil = real time); also set as clock
+	rng   *rand.Rand    // Iceberg slice sizes; matching thread only
+
+	timeMarkers sync.Map // *domain.Order -> chan error, AdvanceTime markers queued on the order buffer
+
+	current  *domain.Order     // Order being processed (matching thread only); nil between orders
+	onPanic  func(EnginePanic) // Optional panic notification
+	healthMu sync.Mutex        // Guards health
+	health   EngineHealth      // Panic record, read by Health
+
+	loopStats loopStats // Start time, loop iterations and last processed order, see Health and Metrics
+
+	measureCancels bool             // Stamp cancels and record tick-to-cancel latency
+	cancelLatency  latencyHistogram // Tick-to-cancel latency, see Metrics()
+	fillQuality    fillStats        // Fill-quality counters, see Metrics()
+
+	minRestTime    time.Duration                   // Minimum quote life before a cancel is accepted (0 = off)
+	onCancelReject func(orderID string, err error) // Optional rejected-cancel notification
+	unknownCancel  UnknownCancelPolicy             // Ignore or reject cancels of orders that are not open
+
+	onDropped func(order *domain.Order) // OverflowDropOldest notification (submitting goroutine)
+	onPruned  func(order *domain.Order) // MaxBookDepth pruning notification (matching thread)
+
+	triggers       *triggerBook // Pending stop / MIT orders (matching thread only)
+	fills          *fillLedger  // Optional per-order fill history (nil = off)
+	lastTradePrice int64        // Price of the most recent trade (matching thread only)
+
+	batchPublish bool // Publish each order's trades with one PublishBatch
+
+	halted           bool                        // Trading halted (matching thread only)
+	resumeAt         time.Time                   // End of a timed halt (zero = until Resume)
+	breaker          *circuitBreaker             // Rapid-move auto-halt (nil = off)
+	onCircuitBreaker func(CircuitBreakerTripped) // Optional circuit-breaker notification
+
+	priceBand           PriceBandConfig // Limit price band around the reference (MaxDeviationBps 0 = off)
+	marketProtectionBps int64           // Market orders become IOC limits this far past the last trade price (0 = off)
+	referencePrice      int64           // Seeded reference price (SetReferencePrice); matching thread only
+
+	tradeThrough TradeThroughPolicy // Reject or slide orders that would trade through the protected quote
+	protectedBid int64              // Externally protected best bid (0 = unprotected); matching thread only
+	protectedAsk int64              // Externally protected best ask (0 = unprotected); matching thread only
+
+	maxMatchIterations int                    // Match-loop guard per incoming order (<= 0 = unbounded)
+	matchAborted       bool                   // The current order's match loop hit the guard
+	sweepBound         int64                  // The current market order's slippage bound (0 = none)
+	onMatchLoopAborted func(MatchLoopAborted) // Optional guard notification
+
+	priorityAudit       bool                    // Cross-check every match against price-time priority (debug)
+	onPriorityViolation func(PriorityViolation) // Optional audit notification
 }
 
 // NewMatchingEngine creates a new matching engine for a specific symbol
 // Performance: Uses batch + safe semaphore RingBuffer (fast + safe)
 func NewMatchingEngine(symbol string) *MatchingEngine {
-	return &MatchingEngine{
+	return NewMatchingEngineWithConfig(symbol, DefaultSymbolConfig())
+}
+
+// NewMatchingEngineWithConfig creates a new matching engine with per-symbol settings
+func NewMatchingEngineWithConfig(symbol string, cfg SymbolConfig) *MatchingEngine {
+	orderSlots, tradeSlots := cfg.bufferSizes()
+	me := &MatchingEngine{
 		symbol:      symbol,
-		orderBook:   orderbook.NewOrderBook(symbol),
-		orderBuffer: NewRingBufferSemaphoreBatchSafe(65536), // Order queue (64K buffer)
-		cancelChan:  make(chan string, 1000),                // Cancel requests (low frequency)
-		tradeBuffer: NewTradeRingBufferBatchSafe(65536),     // Trade queue (64K buffer)
-		tradeIDGen:  NewIDGenerator("T"),
+		orderBook:   orderbook.NewOrderBookWithOrdering(symbol, cfg.TreeType, cfg.bucketSize(), cfg.PriceOrdering),
+		orderBuffer: NewRingBufferSemaphoreBatchSafe(orderSlots), // Order queue (64K by default)
+		cancelChan:  make(chan cancelRequest, 1000),              // Cancel requests (low frequency)
+		tradeBuffer: NewTradeRingBufferBatchSafe(tradeSlots),     // Trade queue (64K by default)
+		tradeIDGen:  cfg.tradeIDs(),
+		amendChan:   make(chan func(), 256),
+		controlChan: make(chan func(), 16),
 		stopChan:    make(chan struct{}),
+		expiryBatch: cfg.ExpirySweepBatch,
+		tickSize:    cfg.TickSize,
+		tickPolicy:  cfg.TickPolicy,
+		midpoint:    cfg.MidpointRounding,
+		clock:       cfg.Clock,
+
+		maxOpenOrders: cfg.MaxOpenOrdersPerUser,
+		fillReporting: cfg.FillReporting,
+
+		measureCancels: cfg.MeasureCancelLatency,
+		minRestTime:    cfg.MinRestTime,
+		unknownCancel:  cfg.UnknownCancel,
+		onDropped:      cfg.OnOrderDropped,
+		onPruned:       cfg.OnOrderPruned,
+		triggers:       newTriggerBook(),
+		breaker:        newCircuitBreaker(cfg.CircuitBreaker),
+		priceBand:      cfg.PriceBand,
+		batchPublish:   cfg.BatchTradePublish,
+
+		maxMatchIterations: cfg.MaxMatchIterations,
+		priorityAudit:      cfg.PriorityAudit,
+		tradeThrough:       cfg.TradeThrough,
+
+		marketProtectionBps: cfg.MarketProtectionBps,
+	}
+	if cfg.EventBufferSize > 0 {
+		me.events = make(chan EngineEvent, cfg.EventBufferSize)
+	}
+	me.rng = cfg.Rand
+	if me.rng == nil {
+		me.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if cfg.Simulation {
+		me.sim = &VirtualClock{}
+		me.clock = me.sim
+	}
+	me.orderBook.SetPruneHandler(me.orderPruned)
+	me.orderBook.SetMaxDepth(cfg.MaxBookDepth)
+	if cfg.FillHistoryOrders > 0 {
+		me.fills = newFillLedger(cfg.FillHistoryOrders)
+	}
+	if cfg.OrderOverflow == OverflowDropOldest {
+		me.orderBuffer.SetDropOldest(me.orderDropped)
 	}
+	me.stats = sessionStats{sessionStart: me.now()}
+	return me
+}
+
+// now returns the current time from the injected clock, or the wall clock if none
+func (me *MatchingEngine) now() time.Time {
+	if me.clock != nil {
+		return me.clock.Now()
+	}
+	return time.Now()
 }
 
 // ExchangeEngine manages multiple MatchingEngines (one per symbol)
@@ -65,13 +221,16 @@ func NewMatchingEngine(symbol string) *MatchingEngine {
 //   - atomic.Value.Load(): ~5ns (1 atomic op)
 //   - 2x faster on read-heavy workload (99.99% reads)
 type ExchangeEngine struct {
-	engines atomic.Value // Stores map[string]*MatchingEngine (immutable, copy-on-write)
-	mu      sync.Mutex   // Only used during writes (creating new engines)
+	engines atomic.Value            // Stores map[string]*MatchingEngine (immutable, copy-on-write)
+	mu      sync.Mutex              // Only used during writes (creating new engines)
+	configs map[string]SymbolConfig // Per-symbol overrides, guarded by mu
 }
 
 // NewExchangeEngine creates a new exchange engine
 func NewExchangeEngine() *ExchangeEngine {
-	e := &ExchangeEngine{}
+	e := &ExchangeEngine{
+		configs: make(map[string]SymbolConfig),
+	}
 	// Initialize with empty map
 	e.engines.Store(make(map[string]*MatchingEngine))
 	return e
@@ -96,8 +255,12 @@ func (e *ExchangeEngine) GetEngine(symbol string) *MatchingEngine {
 		return engine
 	}
 
-	// Create new engine
-	engine := NewMatchingEngine(symbol)
+	// Create new engine (with per-symbol overrides if configured)
+	cfg, ok := e.configs[symbol]
+	if !ok {
+		cfg = DefaultSymbolConfig()
+	}
+	engine := NewMatchingEngineWithConfig(symbol, cfg)
 	engine.Start()
 
 	// Copy-on-write: create new map with all existing engines + new one
@@ -114,20 +277,60 @@ func (e *ExchangeEngine) GetEngine(symbol string) *MatchingEngine {
 	return engine
 }
 
+// GetExistingEngine returns the matching engine for a symbol without creating one
+// Lock-free: a single atomic load of the engine map
+func (e *ExchangeEngine) GetExistingEngine(symbol string) (*MatchingEngine, bool) {
+	engines := e.engines.Load().(map[string]*MatchingEngine)
+	engine, ok := engines[symbol]
+	return engine, ok
+}
+
+// SetSymbolConfig registers per-symbol settings used when the symbol's engine is created
+// Has no effect on an engine that already exists; configure symbols before first use
+func (e *ExchangeEngine) SetSymbolConfig(symbol string, cfg SymbolConfig) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.configs[symbol] = cfg
+}
+
 // SubmitOrder submits an order to the appropriate matching engine
 func (e *ExchangeEngine) SubmitOrder(order *domain.Order) {
 	engine := e.GetEngine(order.Symbol)
 	engine.SubmitOrder(order)
 }
 
+// SubmitOrderSync submits an order and waits until it has been processed (read-your-writes)
+func (e *ExchangeEngine) SubmitOrderSync(order *domain.Order) error {
+	engine := e.GetEngine(order.Symbol)
+	return engine.SubmitOrderSync(order)
+}
+
+// SubmitOrderWithResult is SubmitOrderSync that also reports the order's maker/taker outcome
+func (e *ExchangeEngine) SubmitOrderWithResult(order *domain.Order) (SubmitResult, error) {
+	engine := e.GetEngine(order.Symbol)
+	return engine.SubmitOrderWithResult(order)
+}
+
 // CancelOrder submits a cancel request to the appropriate matching engine
 func (e *ExchangeEngine) CancelOrder(symbol, orderID string) {
-	engine := e.GetEngine(symbol)
+	// An unknown symbol has no resting orders: don't spin up an engine just to cancel
+	engine, ok := e.GetExistingEngine(symbol)
+	if !ok {
+		return
+	}
 	engine.CancelOrder(orderID)
 }
 
 // Start starts the matching loop in a dedicated goroutine
 func (me *MatchingEngine) Start() {
+	me.loopStats.start(me.now())
+
+	// Wake the loop when a pending GTD expiry is due (armed by sweepExpired)
+	// (in simulation mode expiries follow virtual time instead; see simulation.go)
+	if me.sim == nil {
+		me.expiryTimer = time.AfterFunc(time.Hour, me.expiryDue)
+		me.expiryTimer.Stop()
+	}
 	go func() {
 		// Lock this goroutine to an OS thread to reduce context switches
 		// This improves CPU cache locality and reduces scheduling overhead
@@ -138,29 +341,123 @@ func (me *MatchingEngine) Start() {
 		orderConsumer := me.orderBuffer.NewConsumerBatchSafe()
 
 		// Main matching loop - single-threaded with batch + safe semaphore
-		for {
-			// Check for cancel/stop signals first (non-blocking)
-			select {
-			case orderID := <-me.cancelChan:
-				me.orderBook.CancelOrder(orderID)
-				continue
-			case <-me.stopChan:
-				return
-			default:
+		// A panic ends one run; the loop is restarted on the same book (see recoverPanic)
+		for me.run(orderConsumer) {
+		}
+	}()
+}
+
+// run is the matching loop; it returns false on Stop and true after a recovered panic
+func (me *MatchingEngine) run(orderConsumer *ConsumerBatchSafe) (restart bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			me.recoverPanic(r)
+			restart = true
+		}
+	}()
+
+	for {
+		me.loopStats.iterations.Add(1)
+
+		// Expire at most expiryBatch GTD orders per iteration
+		me.sweepExpired()
+
+		// Service the command lanes before the next new order, in strict priority:
+		// cancels, then risk-reducing amends, then control commands (see CancelOrder)
+		select {
+		case req := <-me.cancelChan:
+			if _, err := me.applyCancel(req.orderID); err != nil && me.onCancelReject != nil {
+				me.onCancelReject(req.orderID, err)
+			}
+			if !req.submitted.IsZero() {
+				me.cancelLatency.record(time.Since(req.submitted))
 			}
+			continue
+		default:
+		}
+		select {
+		case cmd := <-me.amendChan:
+			cmd()
+			continue
+		default:
+		}
+		select {
+		case cmd := <-me.controlChan:
+			cmd()
+			continue
+		case <-me.stopChan:
+			return false
+		default:
+		}
 
-			// Consume order from batch RingBuffer (blocking wait)
-			order := orderConsumer.Consume()
+		// Consume order from batch RingBuffer (blocking wait)
+		order := orderConsumer.Consume()
 
-			// Process order and generate trades
-			trades := me.processOrder(order)
+		// nil is a wake-up token published alongside cancels and control commands
+		// so they are serviced even when no orders are arriving
+		if order == nil {
+			continue
+		}
 
-			// Publish trades to batch RingBuffer
+		// Simulation: an AdvanceTime marker keeps its FIFO place among the orders
+		if me.sim != nil && me.applyTimeMarker(order) {
+			continue
+		}
+
+		// Process order and generate trades
+		trades, outcome := me.handleOrder(order, me.syncWaiters.Load() > 0)
+
+		// Publish trades to batch RingBuffer
+		if me.batchPublish {
+			me.tradeBuffer.PublishBatch(trades)
+		} else {
 			for _, trade := range trades {
 				me.tradeBuffer.Publish(trade)
 			}
 		}
-	}()
+
+		me.loopStats.orderDone(me.now())
+
+		// Release a SubmitOrderSync caller waiting on this order (rare; gated by a counter)
+		if me.syncWaiters.Load() > 0 {
+			if done, ok := me.syncDone.LoadAndDelete(order); ok {
+				done.(chan syncOutcome) <- outcome
+			}
+		}
+		me.current = nil
+	}
+}
+
+// handleOrder runs one order through the matching pipeline (matching thread only)
+// It matches the order, fires the stop orders its trades trigger and records the trades,
+// leaving their delivery to the caller: the matching loop publishes them, SyncEngine
+// returns them. summarize requests the order's SubmitResult and MatchReport in the
+// outcome; its err is always set. me.current stays set to the order for panic recovery;
+// the caller clears it.
+func (me *MatchingEngine) handleOrder(order *domain.Order, summarize bool) ([]*domain.Trade, syncOutcome) {
+	// Simulation: the order's historical timestamp drives virtual time
+	if me.sim != nil {
+		me.advanceVirtualTime(order.Timestamp)
+	}
+
+	me.current = order
+	trades, err := me.processOrder(order)
+	outcome := syncOutcome{err: err}
+
+	// Summarize before triggered orders can trade against the order if it rested
+	if summarize {
+		outcome.result = newSubmitResult(order, len(trades))
+	}
+
+	trades = me.fireTriggers(trades)
+	me.recordTrades(trades)
+
+	// The report covers the whole pass, triggered stops included, and copies the trades
+	// before they are published and may be recycled
+	if summarize {
+		outcome.report = me.newMatchReport(order, trades)
+	}
+	return trades, outcome
 }
 
 // SubmitOrder submits an order to the matching engine (non-blocking)
@@ -168,15 +465,283 @@ func (me *MatchingEngine) SubmitOrder(order *domain.Order) {
 	me.orderBuffer.Publish(order)
 }
 
+// SubmitOrderSync submits an order and blocks until the matching thread has processed it
+// Provides read-your-writes: on return the order has been matched and, if it rests,
+// is visible in the book, and its trades have been published to the trade buffer.
+// The order keeps its FIFO position relative to orders submitted asynchronously.
+//
+// Latency: the caller pays the queueing delay of every order ahead of it plus a goroutine
+// wake-up (typically several microseconds), versus ~100ns for the async SubmitOrder.
+// Use only where read-your-writes is required; SubmitOrder remains the fast path.
+// Returns the rejection reason if the order was rejected, or ErrEngineStopped if the
+// engine stops before the order is processed.
+func (me *MatchingEngine) SubmitOrderSync(order *domain.Order) error {
+	_, err := me.SubmitOrderWithResult(order)
+	return err
+}
+
+// SubmitOrderWithResult is SubmitOrderSync that also reports how the order met the book:
+// how much it took on arrival, how much rested, and hence whether it was maker, taker or
+// both — so a fee-sensitive client learns its role without waiting for execution reports.
+func (me *MatchingEngine) SubmitOrderWithResult(order *domain.Order) (SubmitResult, error) {
+	outcome := me.submitSync(order)
+	return outcome.result, outcome.err
+}
+
+// submitSync publishes order and waits for the matching thread's outcome
+func (me *MatchingEngine) submitSync(order *domain.Order) syncOutcome {
+	done := make(chan syncOutcome, 1)
+	me.syncDone.Store(order, done)
+	me.syncWaiters.Add(1)
+	defer me.syncWaiters.Add(-1)
+
+	me.orderBuffer.Publish(order)
+
+	select {
+	case outcome := <-done:
+		return outcome
+	case <-me.stopChan:
+		me.syncDone.Delete(order)
+		return syncOutcome{err: ErrEngineStopped}
+	}
+}
+
 // CancelOrder submits a cancel request to the matching engine (non-blocking)
 // The cancel is processed in the matching thread to ensure thread safety
+// A nil wake-up token is published to the order buffer so a matching loop blocked
+// in Consume() picks the cancel up immediately instead of waiting for the next order
+//
+// Priority: cancels travel in their own lane, serviced ahead of everything else, so
+// users can always pull risk while the engine is congested. Before each new order the
+// loop drains pending cancels, then ReduceOrder amends, then control commands; only then
+// does it take the next order. Neither CancelOrder nor ReduceOrder queues behind a full
+// order buffer. Fairness implications:
+//   - A cancel can overtake orders submitted before it, including the order it targets:
+//     cancelling an order the engine hasn't processed yet is a no-op and the order rests
+//   - A sustained cancel/amend stream delays new orders (and control commands) for as
+//     long as it lasts; cancels are cheap, so in practice this bounds how far they lag
+//   - Orders themselves stay strictly FIFO among each other
 func (me *MatchingEngine) CancelOrder(orderID string) {
-	me.cancelChan <- orderID
+	req := cancelRequest{orderID: orderID}
+	if me.measureCancels {
+		req.submitted = time.Now() // wall clock (monotonic), independent of an injected Clock
+	}
+	me.cancelChan <- req
+	me.wake()
+}
+
+// CancelOrderSync cancels an order and blocks until the matching thread has applied it
+// Reports true if this call cancelled the order, false if it was not open (unknown, already
+// filled, cancelled or expired, e.g. a duplicate cancel); such a cancel is a no-op that
+// returns nil, or ErrOrderNotFound under UnknownCancelReject.
+// Returns ErrMinRestTimeNotMet if the order is younger than the symbol's MinRestTime.
+func (me *MatchingEngine) CancelOrderSync(orderID string) (bool, error) {
+	var cancelled bool
+	err := me.callOnMatchingThread(func() error {
+		var err error
+		cancelled, err = me.applyCancel(orderID)
+		return err
+	})
+	return cancelled, err
+}
+
+// SetCancelRejectHandler installs a callback notified of every cancel rejected by CancelOrder
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetCancelRejectHandler(handler func(orderID string, err error)) {
+	me.runOnMatchingThread(func() {
+		me.onCancelReject = handler
+	})
+}
+
+// applyCancel cancels a pending conditional order or a resting order (matching thread only)
+// Reports whether the order was cancelled; an order that is not open is left alone.
+// Conditional orders are not yet quoting, so the minimum rest time doesn't apply to them.
+func (me *MatchingEngine) applyCancel(orderID string) (bool, error) {
+	if me.triggers.cancel(orderID) {
+		return true, nil
+	}
+	order := me.orderBook.GetOrder(orderID)
+	if order == nil {
+		if me.unknownCancel == UnknownCancelReject {
+			return false, ErrOrderNotFound
+		}
+		return false, nil
+	}
+	if !me.minRestTimeMet(order) {
+		return false, ErrMinRestTimeNotMet
+	}
+	me.orderBook.CancelOrder(orderID)
+	return true, nil
+}
+
+// minRestTimeMet reports whether order has rested long enough to be pulled (matching thread only)
+// Applies to every user request that removes a resting order: cancels, and amends or
+// reduces that leave nothing to rest.
+func (me *MatchingEngine) minRestTimeMet(order *domain.Order) bool {
+	return me.minRestTime <= 0 || me.now().Sub(order.Timestamp) >= me.minRestTime
+}
+
+// CancelSession cancels all resting orders tagged with sessionID (cancel-on-disconnect)
+// Called by a gateway when a client connection drops. Like CancelOrder it is asynchronous;
+// session orders already submitted but not yet processed may still rest afterwards, so a
+// gateway should stop forwarding the session's orders before calling it.
+func (me *MatchingEngine) CancelSession(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	me.runOnMatchingThread(func() {
+		me.orderBook.CancelSession(sessionID)
+	})
+}
+
+// CancelOlderThan cancels every resting order accepted before cutoff and returns their IDs
+// Stale-order cleanup, e.g. after a mass disconnect left orders whose owners are gone.
+// Like session cancels it is not subject to MinRestTime; pending stop / MIT orders are
+// not resting and are left alone. Blocks until applied, or returns ErrEngineStopped.
+func (me *MatchingEngine) CancelOlderThan(cutoff time.Time) ([]string, error) {
+	var cancelled []string
+	err := me.callOnMatchingThread(func() error {
+		cancelled = me.orderBook.CancelOlderThan(cutoff)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+// SetL3Handler enables the order-by-order (L3) feed; nil turns it off (the default)
+// Every add, cancel/expiry/modify-down and execution of a resting order is delivered in
+// exact causal order with a gap-free sequence number, enough to reconstruct the full book.
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetL3Handler(handler func(orderbook.L3Event)) {
+	me.runOnMatchingThread(func() {
+		me.orderBook.SetL3Handler(handler)
+	})
+}
+
+// WithFrozenView runs fn on the matching thread with a read-only view of the order book
+// Matching is paused while fn runs, so all queries inside it (BBO, depth, individual levels)
+// reflect the same instant. Keep fn short: it stalls order processing.
+// Blocks until fn has returned, or returns ErrEngineStopped.
+func (me *MatchingEngine) WithFrozenView(fn func(orderbook.ReadOnlyBook)) error {
+	return me.callOnMatchingThread(func() error {
+		me.orderBook.WithFrozenView(fn)
+		return nil
+	})
+}
+
+// runOnMatchingThread queues a command to be executed by the matching goroutine
+// Used for rare administrative operations that must not race with matching
+func (me *MatchingEngine) runOnMatchingThread(cmd func()) {
+	me.controlChan <- cmd
+	me.wake()
+}
+
+// wake publishes a nil wake-up token so a loop blocked in Consume() services the command lanes
+// Non-blocking: when the order buffer is full the loop is busy and checks the lanes before
+// its next order anyway, so a command never waits behind a flood of new orders.
+func (me *MatchingEngine) wake() {
+	me.orderBuffer.TryPublish(nil)
+}
+
+// callOnMatchingThread runs cmd on the matching goroutine and waits for its result
+// Returns ErrEngineStopped if the engine stops before the command completes
+func (me *MatchingEngine) callOnMatchingThread(cmd func() error) error {
+	return me.callOnLane(me.controlChan, cmd)
+}
+
+// callOnLane runs cmd from the given command lane and waits for its result
+func (me *MatchingEngine) callOnLane(lane chan func(), cmd func() error) error {
+	done := make(chan error, 1)
+	lane <- func() {
+		err := ErrEnginePanic // reported if cmd panics (the loop recovers and restarts)
+		defer func() { done <- err }()
+		err = cmd()
+	}
+	me.wake()
+
+	select {
+	case err := <-done:
+		return err
+	case <-me.stopChan:
+		return ErrEngineStopped
+	}
+}
+
+// QueuePosition reports the orders and quantity ahead of a resting order at its price
+// Safe to call from any goroutine: the lookup runs on the matching thread, so the
+// answer is exact as of the moment it runs. found is false if the order isn't resting.
+func (me *MatchingEngine) QueuePosition(orderID string) (ordersAhead int, qtyAhead int64, found bool) {
+	me.callOnMatchingThread(func() error {
+		ordersAhead, qtyAhead, found = me.orderBook.QueuePosition(orderID)
+		return nil
+	})
+	return ordersAhead, qtyAhead, found
+}
+
+// PeekMatch previews the first match an incoming order would get, without executing it
+// Safe to call from any goroutine. On top of orderbook.OrderBook.PeekMatch it applies
+// what the match loop does to the first match: resting orders vetoed by the last-look
+// handler (which is consulted, as for a real match) are skipped, and a midpoint resting
+// order is priced at the midpoint. Self-trade prevention is not applied. The answer is
+// a snapshot: orders queued ahead of the real submission may change it.
+func (me *MatchingEngine) PeekMatch(incoming *domain.Order) (willMatch bool, matchPrice domain.Price, matchQty int64) {
+	me.callOnMatchingThread(func() error {
+		willMatch, matchPrice, matchQty = me.peekMatch(incoming)
+		return nil
+	})
+	return willMatch, matchPrice, matchQty
+}
+
+// peekMatch is PeekMatch on the matching thread
+func (me *MatchingEngine) peekMatch(incoming *domain.Order) (bool, domain.Price, int64) {
+	willMatch, price, _ := me.orderBook.PeekMatch(incoming)
+	if !willMatch {
+		return false, 0, 0
+	}
+	level := me.orderBook.GetBestSellLevel()
+	if incoming.Side == domain.SideSell {
+		level = me.orderBook.GetBestBuyLevel()
+	}
+	resting := me.firstMatchable(level, incoming)
+	if resting == nil {
+		return false, 0, 0
+	}
+	if resting.IsMidpoint() {
+		price = me.midpointPrice(incoming, resting, price)
+	}
+	return true, price, min(incoming.RemainingQuantity(), resting.MatchableQuantity())
+}
+
+// MigrateTree switches the order book to a different price tree implementation
+// The book is rebuilt on the matching thread between orders, preserving FIFO priority
+// and best prices, so it can be done on a live engine. Blocks until applied.
+func (me *MatchingEngine) MigrateTree(newType orderbook.PriceTreeType) error {
+	return me.callOnMatchingThread(func() error {
+		me.orderBook.MigrateTree(newType)
+		return nil
+	})
+}
+
+// Compact rebuilds the order book's trees and indexes to reclaim memory after mass cancels
+// Runs on the matching thread between orders; see orderbook.OrderBook.Compact. Blocks until applied.
+func (me *MatchingEngine) Compact() error {
+	return me.callOnMatchingThread(func() error {
+		me.orderBook.Compact()
+		return nil
+	})
 }
 
 // Stop stops the matching engine gracefully
+// Safe to call more than once and from several goroutines; calls after the first are no-ops.
 func (me *MatchingEngine) Stop() {
-	close(me.stopChan)
+	me.stopOnce.Do(func() {
+		close(me.stopChan)
+		if me.expiryTimer != nil {
+			me.expiryTimer.Stop()
+		}
+	})
 }
 
 // GetOrderBook returns the order book
@@ -190,9 +755,68 @@ func (me *MatchingEngine) GetTradeBuffer() *TradeRingBufferBatchSafe {
 }
 
 // processOrder processes an incoming order (internal, runs in matching goroutine)
-func (me *MatchingEngine) processOrder(order *domain.Order) []*domain.Trade {
+// A rejected order is marked OrderStatusRejected and the reason returned; it never matches
+func (me *MatchingEngine) processOrder(order *domain.Order) ([]*domain.Trade, error) {
+	if err := me.checkOrder(order); err != nil {
+		me.rejectOrder(order, err)
+		return nil, err
+	}
+	// Acceptance time defines time priority (and maker/taker) from here on
+	order.Timestamp = me.now()
+
+	// Stop / MIT orders wait off-book until the last trade price reaches their trigger
+	if isConditional(order) {
+		if !isTriggered(order, me.lastTradePrice) {
+			me.triggers.add(order)
+			return nil, nil
+		}
+		order.Type = domain.OrderTypeMarket
+	}
+
+	// Trade-through protection against an external protected quote (off until one is set)
+	if me.protectedBid > 0 || me.protectedAsk > 0 {
+		if err := me.protectTradeThrough(order); err != nil {
+			me.rejectOrder(order, err)
+			return nil, err
+		}
+	}
+
+	me.emitOrderAccepted(order)
+
+	// All-or-none: trade only if the whole order fills now, otherwise cancel it untraded
+	if order.IsAllOrNone() && !me.fillableNow(order) {
+		order.Cancel()
+		me.emitOrderOutcome(order)
+		return nil, nil
+	}
+
+	// Top-level-only market order: all or none against the best level alone. Matching is
+	// then bounded to that level by turning it into an IOC limit at the level's price, so
+	// a remainder left by last-look vetoes is cancelled rather than sweeping deeper.
+	if order.IsTopLevelOnly() {
+		fillable, top := me.fillableAtTop(order)
+		if !fillable {
+			order.Cancel()
+			me.emitOrderOutcome(order)
+			return nil, nil
+		}
+		order.Type, order.TimeInForce, order.Price = domain.OrderTypeLimit, domain.TimeInForceIOC, top
+	}
+
+	var oldBid, oldAsk int64
+	if me.logger != nil {
+		me.logOrderAccepted(order)
+		oldBid, oldAsk = me.orderBook.GetBestBid(), me.orderBook.GetBestAsk()
+	}
+
 	var trades []*domain.Trade
 
+	// Slippage protection: fix the market order's worst price before it moves the book
+	me.sweepBound = me.slippageBound(order)
+	if me.marketProtectionBps > 0 && order.Type == domain.OrderTypeMarket {
+		me.protectMarketOrder(order)
+	}
+
 	// Try to match the order against existing orders
 	if order.Side == domain.SideBuy {
 		trades = me.matchBuyOrder(order)
@@ -201,41 +825,101 @@ func (me *MatchingEngine) processOrder(order *domain.Order) []*domain.Trade {
 	}
 
 	// If order is not fully filled, add remaining to order book
+	// (an IOC limit order cancels its remainder instead of resting, as does an order
+	// cut short by the circuit breaker or the match-loop guard: it may still cross the book;
+	// an all-or-none order never rests: a remainder means a maker vetoed a match;
+	// nor does the remainder of a user at the resting-order cap)
 	if !order.IsFilled() && order.Type == domain.OrderTypeLimit {
-		me.orderBook.AddOrder(order)
+		if order.TimeInForce == domain.TimeInForceIOC || me.halted || me.matchAborted || order.IsAllOrNone() ||
+			me.atOpenOrderCap(order.UserID) {
+			order.Cancel()
+		} else {
+			if me.logger != nil && me.orderBook.GetLevel(order.Side, order.Price) == nil {
+				me.logLevel("price level created", order.Side, order.Price)
+			}
+			if order.IsIceberg() {
+				order.ShownQty = min(me.nextSlice(order), order.RemainingQuantity())
+			}
+			me.orderBook.AddOrder(order)
+		}
+	}
+	me.matchAborted = false
+	// A market order stopped by its slippage bound cancels the remainder
+	if me.sweepBound != 0 {
+		if !order.IsFilled() {
+			order.Cancel()
+		}
+		me.sweepBound = 0
 	}
 
-	return trades
+	if me.logger != nil {
+		me.logBestPrice(oldBid, oldAsk, me.orderBook.GetBestBid(), me.orderBook.GetBestAsk())
+	}
+
+	// One fill event for the whole arrival, now that the remainder has rested or been cancelled
+	if me.onFill != nil && me.fillReporting == FillPerOrder && len(trades) > 0 {
+		me.onFill(newFillEvent(order, trades))
+	}
+
+	// Summarize the taker's fills across all makers and levels
+	if me.onAggTrade != nil && len(trades) > 0 {
+		me.onAggTrade(newAggTrade(order, trades))
+	}
+
+	me.emitOrderOutcome(order)
+
+	return trades, nil
 }
 
 // matchBuyOrder matches a buy order against sell orders
 func (me *MatchingEngine) matchBuyOrder(buyOrder *domain.Order) []*domain.Trade {
 	var trades []*domain.Trade
 
-	for !buyOrder.IsFilled() {
+	for iterations := 0; !buyOrder.IsFilled() && !me.halted; iterations++ {
+		if me.matchLoopExhausted(buyOrder, iterations, len(trades)) {
+			break
+		}
 		bestAsk := me.orderBook.GetBestAsk()
 
 		// No matching sell orders
-		if bestAsk == 0 || (buyOrder.Type == domain.OrderTypeLimit && buyOrder.Price < bestAsk) {
+		if bestAsk == 0 || (buyOrder.Type == domain.OrderTypeLimit && !me.orderBook.Crosses(buyOrder.Price, bestAsk)) {
+			break
+		}
+		// A market order with a slippage cap stops at the first price past its bound
+		if me.sweepBound != 0 && !me.orderBook.Crosses(me.sweepBound, bestAsk) {
 			break
 		}
 
 		// Get best sell price level (O(1) - no allocation)
 		bestLevel := me.orderBook.GetBestSellLevel()
-		if bestLevel == nil || bestLevel.Orders.Len() == 0 {
+		if bestLevel == nil {
 			break
 		}
+		// An empty best level means the tree failed to drop it: repair it and look one
+		// level deeper rather than stranding the liquidity behind it
+		if bestLevel.Orders.Len() == 0 {
+			if !me.orderBook.RemoveEmptyLevel(domain.SideSell, bestLevel.Price) {
+				break
+			}
+			continue
+		}
 
-		// Get first sell order (FIFO) - O(1)
-		sellOrder := bestLevel.Orders.Front().Value.(*domain.Order)
-		trade := me.executeTrade(buyOrder, sellOrder, bestAsk)
-		trades = append(trades, trade)
+		// Get first sell order (FIFO) that accepts the match - O(1) unless last look vetoes
+		sellOrder := me.firstMatchable(bestLevel, buyOrder)
+		if sellOrder == nil {
+			break
+		}
 
-		// Remove fully filled sell order
-		if sellOrder.IsFilled() {
-			me.orderBook.CancelOrder(sellOrder.ID)
+		// Self-trade prevention: decrement both sides without printing a trade
+		if me.stpMode == STPDecrementBoth && sellOrder.UserID == buyOrder.UserID {
+			me.decrementBoth(buyOrder, sellOrder, bestAsk)
+			continue
 		}
+
+		trade := me.executeTrade(buyOrder, sellOrder, bestAsk)
+		trades = append(trades, trade)
 	}
+	me.fillQuality.record(buyOrder, trades)
 
 	return trades
 }
@@ -244,46 +928,152 @@ func (me *MatchingEngine) matchBuyOrder(buyOrder *domain.Order) []*domain.Trade
 func (me *MatchingEngine) matchSellOrder(sellOrder *domain.Order) []*domain.Trade {
 	var trades []*domain.Trade
 
-	for !sellOrder.IsFilled() {
+	for iterations := 0; !sellOrder.IsFilled() && !me.halted; iterations++ {
+		if me.matchLoopExhausted(sellOrder, iterations, len(trades)) {
+			break
+		}
 		bestBid := me.orderBook.GetBestBid()
 
 		// No matching buy orders
-		if bestBid == 0 || (sellOrder.Type == domain.OrderTypeLimit && sellOrder.Price > bestBid) {
+		if bestBid == 0 || (sellOrder.Type == domain.OrderTypeLimit && !me.orderBook.Crosses(bestBid, sellOrder.Price)) {
+			break
+		}
+		// A market order with a slippage cap stops at the first price past its bound
+		if me.sweepBound != 0 && !me.orderBook.Crosses(bestBid, me.sweepBound) {
 			break
 		}
 
 		// Get best buy price level (O(1) - no allocation)
 		bestLevel := me.orderBook.GetBestBuyLevel()
-		if bestLevel == nil || bestLevel.Orders.Len() == 0 {
+		if bestLevel == nil {
 			break
 		}
+		// An empty best level means the tree failed to drop it: repair it and look one
+		// level deeper rather than stranding the liquidity behind it
+		if bestLevel.Orders.Len() == 0 {
+			if !me.orderBook.RemoveEmptyLevel(domain.SideBuy, bestLevel.Price) {
+				break
+			}
+			continue
+		}
 
-		// Get first buy order (FIFO) - O(1)
-		buyOrder := bestLevel.Orders.Front().Value.(*domain.Order)
-		trade := me.executeTrade(buyOrder, sellOrder, bestBid)
-		trades = append(trades, trade)
+		// Get first buy order (FIFO) that accepts the match - O(1) unless last look vetoes
+		buyOrder := me.firstMatchable(bestLevel, sellOrder)
+		if buyOrder == nil {
+			break
+		}
 
-		// Remove fully filled buy order
-		if buyOrder.IsFilled() {
-			me.orderBook.CancelOrder(buyOrder.ID)
+		// Self-trade prevention: decrement both sides without printing a trade
+		if me.stpMode == STPDecrementBoth && buyOrder.UserID == sellOrder.UserID {
+			me.decrementBoth(sellOrder, buyOrder, bestBid)
+			continue
 		}
+
+		trade := me.executeTrade(sellOrder, buyOrder, bestBid)
+		trades = append(trades, trade)
 	}
+	me.fillQuality.record(sellOrder, trades)
 
 	return trades
 }
 
-// executeTrade executes a trade between two orders
-func (me *MatchingEngine) executeTrade(buyOrder, sellOrder *domain.Order, price int64) *domain.Trade {
+// firstMatchable returns the first resting order at the level willing to trade with the aggressor
+// Orders flagged LastLook are offered to the last-look handler and skipped if it rejects.
+// Returns nil if every order at the level rejected; matching then stops for this aggressor
+// rather than trading through to worse price levels.
+func (me *MatchingEngine) firstMatchable(level *orderbook.PriceLevel_, aggressor *domain.Order) *domain.Order {
+	for e := level.Orders.Front(); e != nil; e = e.Next() {
+		resting := e.Value.(*domain.Order)
+		if !resting.IsLastLook() || me.lastLook == nil || me.lastLook(aggressor, resting) {
+			return resting
+		}
+	}
+	return nil
+}
+
+// SetLastLookHandler installs a hook that lets makers flagged LastLook veto a match
+// The handler runs ON THE MATCHING THREAD for every proposed match against a LastLook order,
+// so it must be fast and must not block: the whole symbol stalls while it runs.
+// It may be consulted more than once for the same resting order while one aggressor is matched.
+// Returning false rejects the match; nil (the default) accepts every match.
+func (me *MatchingEngine) SetLastLookHandler(handler func(aggressor, resting *domain.Order) bool) {
+	me.runOnMatchingThread(func() {
+		me.lastLook = handler
+	})
+}
+
+// OnTrade installs a callback invoked synchronously for every trade (nil disables)
+// The callback runs ON THE MATCHING THREAD right after the trade is created and before
+// it is published to the trade buffer, so it adds directly to matching latency:
+//   - it must not block (no I/O, no locks that other goroutines hold for long)
+//   - it must not retain the *domain.Trade after returning: trades come from a pool and
+//     are recycled once the downstream consumer calls Destroy(); copy any fields needed later
+func (me *MatchingEngine) OnTrade(callback func(*domain.Trade)) {
+	me.runOnMatchingThread(func() {
+		me.onTrade = callback
+	})
+}
+
+// executeTrade executes a trade between an incoming order and a resting order
+// The resting order's fill goes through the order book so its level volume stays in sync;
+// a fully filled resting order is removed from the book
+func (me *MatchingEngine) executeTrade(aggressor, resting *domain.Order, price int64) *domain.Trade {
 	// Calculate trade quantity (minimum of remaining quantities)
-	quantity := min(buyOrder.RemainingQuantity(), sellOrder.RemainingQuantity())
+	quantity := min(aggressor.RemainingQuantity(), resting.MatchableQuantity())
+	if assertFills {
+		assertFill(aggressor, resting, quantity)
+	}
+	if me.priorityAudit {
+		me.auditPriority(aggressor, resting, price)
+	}
+	// A midpoint (dark) order trades at the public midpoint, priced before this fill moves it
+	if resting.IsMidpoint() {
+		price = me.midpointPrice(aggressor, resting, price)
+	}
 
 	// Update orders
-	buyOrder.Fill(quantity)
-	sellOrder.Fill(quantity)
+	aggressor.Fill(quantity)
+	me.orderBook.FillOrder(resting, quantity)
+	if assertFills {
+		assertNotOverfilled(aggressor)
+		assertNotOverfilled(resting)
+	}
+	if resting.IsIceberg() && resting.ShownQty == 0 && !resting.IsFilled() {
+		me.orderBook.RefillIceberg(resting, me.nextSlice(resting))
+	}
+
+	buyOrder, sellOrder := aggressor, resting
+	if aggressor.Side == domain.SideSell {
+		buyOrder, sellOrder = resting, aggressor
+	}
 
 	// Create trade
 	tradeID := me.tradeIDGen.Next()
-	trade := domain.NewTrade(tradeID, buyOrder.Symbol, price, quantity, buyOrder, sellOrder)
+	trade := domain.NewTradeAt(tradeID, buyOrder.Symbol, price, quantity, buyOrder, sellOrder, me.now())
+	trade.Seq = me.orderBook.Seq()
+	me.lastTradePrice = price
+	if me.breaker != nil {
+		me.checkCircuitBreaker(price)
+	}
+	if me.fills != nil {
+		me.fills.recordTrade(trade)
+	}
+
+	if me.logger != nil {
+		me.logMatch(trade, aggressor, resting)
+		if resting.IsFilled() && me.orderBook.GetLevel(resting.Side, resting.Price) == nil {
+			me.logLevel("price level removed", resting.Side, resting.Price)
+		}
+	}
+
+	// Inline side effects run before the trade is published to tradeBuffer
+	if me.onTrade != nil {
+		me.onTrade(trade)
+	}
+	if me.onFill != nil && me.fillReporting == FillPerFill {
+		me.onFill(newFillEvent(aggressor, []*domain.Trade{trade}))
+	}
+	me.emitTradeEvent(trade)
 
 	return trade
 }
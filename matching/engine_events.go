@@ -0,0 +1,87 @@
+package matching
+
+import "lightning-exchange/domain"
+
+// EngineEventKind tells which payload an EngineEvent carries
+type EngineEventKind uint8
+
+const (
+	// EngineEventOrder: Order is set (an incoming order accepted, or its outcome)
+	EngineEventOrder EngineEventKind = iota + 1
+
+	// EngineEventTrade: Trade is set
+	EngineEventTrade
+)
+
+// EngineEvent is one entry of the unified order + trade feed (SymbolConfig.EventBufferSize)
+//
+// Order events and trades share a single per-engine sequence, assigned on the matching
+// thread in the exact order things happen: an incoming order's OrderEventAccepted, then
+// each of its trades, then its outcome (filled / resting / cancelled). Seq starts at 1
+// and has no gaps, so a consumer (e.g. reconciliation) can replay causes and effects
+// in order and detect a missed event.
+type EngineEvent struct {
+	Seq   int64
+	Kind  EngineEventKind
+	Order OrderEvent   // EngineEventOrder only
+	Trade domain.Trade // EngineEventTrade only: a copy, independent of the pooled trade on the trade buffer
+}
+
+// Events returns the unified order + trade feed, or nil if SymbolConfig.EventBufferSize is 0
+//
+// Back-pressure: the feed is lossless, so the matching thread blocks when the buffer is
+// full, like the trade buffer. A stalled consumer stalls matching, cancels and commands
+// for the symbol; size the buffer for bursts and keep reading. Stop still takes effect:
+// the blocked send gives up and events from then on are discarded (the feed ends with a
+// gap rather than wedging shutdown). A SyncEngine caller must drain it between calls.
+func (me *MatchingEngine) Events() <-chan EngineEvent {
+	return me.events
+}
+
+// emitOrderOutcome reports how an incoming order ended its arrival to the order event
+// handler and the unified feed (matching thread only)
+func (me *MatchingEngine) emitOrderOutcome(order *domain.Order) {
+	if me.onOrderEvent == nil && me.events == nil {
+		return
+	}
+	event := newOrderEvent(order)
+	if me.onOrderEvent != nil {
+		me.onOrderEvent(event)
+	}
+	me.emitOrderEvent(event)
+}
+
+// emitOrderAccepted opens an incoming order's entries on the unified feed (matching thread only)
+// The order event handler only receives outcomes, so acceptance goes to the feed alone.
+func (me *MatchingEngine) emitOrderAccepted(order *domain.Order) {
+	if me.events == nil {
+		return
+	}
+	event := newOrderEvent(order)
+	event.Type = OrderEventAccepted
+	me.emitOrderEvent(event)
+}
+
+// emitOrderEvent appends an order event to the unified feed, if enabled (matching thread only)
+func (me *MatchingEngine) emitOrderEvent(event OrderEvent) {
+	if me.events != nil {
+		me.eventSeq++
+		me.publishEvent(EngineEvent{Seq: me.eventSeq, Kind: EngineEventOrder, Order: event})
+	}
+}
+
+// emitTradeEvent appends a trade to the unified feed (matching thread only)
+func (me *MatchingEngine) emitTradeEvent(trade *domain.Trade) {
+	if me.events != nil {
+		me.eventSeq++
+		me.publishEvent(EngineEvent{Seq: me.eventSeq, Kind: EngineEventTrade, Trade: *trade})
+	}
+}
+
+// publishEvent blocks until the feed has room, or discards event once the engine is stopping
+func (me *MatchingEngine) publishEvent(event EngineEvent) {
+	select {
+	case me.events <- event:
+	case <-me.stopChan:
+	}
+}
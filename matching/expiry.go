@@ -0,0 +1,74 @@
+package matching
+
+import "time"
+
+// expiryCheckInterval bounds the expiry timer under an injected Clock, which may jump ahead
+// of wall time: pending expiries are then re-checked at this interval instead of waited for
+const expiryCheckInterval = time.Millisecond
+
+// ExpirySweepBatch returns the configured maximum number of GTD orders expired per loop iteration
+func (me *MatchingEngine) ExpirySweepBatch() int {
+	return me.expiryBatch
+}
+
+// sweepExpired expires due GTD orders, bounded by expiryBatch (runs in matching goroutine)
+// Remaining expired orders are picked up on the following iterations.
+func (me *MatchingEngine) sweepExpired() {
+	if !me.orderBook.HasPendingExpiries() {
+		if me.armedExpiry != 0 {
+			me.armExpiryTimer(0)
+		}
+		return
+	}
+
+	now := me.now()
+	me.orderBook.ExpireOrders(now, me.expiryBatch)
+
+	next := int64(0)
+	if me.orderBook.HasPendingExpiries() {
+		next = me.orderBook.NextExpiry().UnixNano()
+	}
+	me.nextExpiry.Store(next)
+	// Re-arm when the earliest expiry changed, or immediately while a due backlog remains
+	if next != me.armedExpiry || (next != 0 && next <= now.UnixNano()) {
+		me.armExpiryTimer(next)
+	}
+}
+
+// armExpiryTimer points the expiry timer at next (UnixNano; 0 = stop it) (matching thread only)
+// Without it, an idle loop blocked in Consume() would never sweep expiries. A single timer
+// is armed for the earliest pending expiry; nothing runs while no GTD order is pending.
+func (me *MatchingEngine) armExpiryTimer(next int64) {
+	me.armedExpiry = next
+	if me.expiryTimer == nil {
+		return // Not started, or simulation mode (expiries follow virtual time; see simulation.go)
+	}
+	if next == 0 {
+		me.expiryTimer.Stop()
+		return
+	}
+	me.expiryTimer.Reset(me.expiryDelay(next))
+}
+
+// expiryDelay returns how long the expiry timer waits for an expiry at next (UnixNano)
+func (me *MatchingEngine) expiryDelay(next int64) time.Duration {
+	delay := max(time.Duration(next-me.now().UnixNano()), 0)
+	if me.clock != nil {
+		delay = min(delay, expiryCheckInterval)
+	}
+	return delay
+}
+
+// expiryDue runs on the timer goroutine: wakes the loop once the earliest expiry is due
+// Under an injected Clock that hasn't reached it yet, the timer is re-armed instead.
+func (me *MatchingEngine) expiryDue() {
+	next := me.nextExpiry.Load()
+	if next == 0 {
+		return
+	}
+	if next <= me.now().UnixNano() {
+		me.wake() // the loop sweeps and re-arms
+		return
+	}
+	me.expiryTimer.Reset(me.expiryDelay(next))
+}
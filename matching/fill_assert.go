@@ -0,0 +1,42 @@
+package matching
+
+import (
+	"errors"
+	"fmt"
+	"lightning-exchange/domain"
+)
+
+// Fill assertions verify trade accounting inside executeTrade: every fill is positive and
+// fits both orders' remaining quantity, and no order ends up with Filled > Quantity.
+// They are compiled in only with the matchassert build tag:
+//
+//	go test -tags matchassert ./...
+//
+// Without the tag assertFills is a false constant and the checks are eliminated, so
+// production builds pay nothing. A violation panics with ErrFillInvariant on the
+// matching thread, which the engine recovers as an EnginePanic (halting the symbol).
+
+// ErrFillInvariant is the panic value (wrapped) of a failed fill assertion
+var ErrFillInvariant = errors.New("fill invariant violated")
+
+// assertFill checks a fill of quantity between aggressor and resting before it is applied
+func assertFill(aggressor, resting *domain.Order, quantity int64) {
+	for _, order := range []*domain.Order{aggressor, resting} {
+		if order.Filled < 0 || order.Filled >= order.Quantity {
+			panic(fmt.Errorf("%w: order %s has filled %d of %d before the fill", ErrFillInvariant, order.ID, order.Filled, order.Quantity))
+		}
+		if quantity > order.RemainingQuantity() {
+			panic(fmt.Errorf("%w: fill %d exceeds order %s remaining %d", ErrFillInvariant, quantity, order.ID, order.RemainingQuantity()))
+		}
+	}
+	if quantity <= 0 {
+		panic(fmt.Errorf("%w: non-positive fill %d between %s and %s", ErrFillInvariant, quantity, aggressor.ID, resting.ID))
+	}
+}
+
+// assertNotOverfilled checks an order after a fill was applied
+func assertNotOverfilled(order *domain.Order) {
+	if order.Filled > order.Quantity {
+		panic(fmt.Errorf("%w: order %s overfilled, %d of %d", ErrFillInvariant, order.ID, order.Filled, order.Quantity))
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !matchassert
+
+package matching
+
+// assertFills disables the fill assertions (see fill_assert.go); the checks compile out
+const assertFills = false
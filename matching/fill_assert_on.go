@@ -0,0 +1,6 @@
+//go:build matchassert
+
+package matching
+
+// assertFills enables the fill assertions (see fill_assert.go)
+const assertFills = true
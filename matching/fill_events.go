@@ -0,0 +1,70 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"time"
+)
+
+// FillReporting selects how often the fill handler is notified of an aggressor's fills
+type FillReporting int
+
+const (
+	// FillPerFill emits one FillEvent per trade, as it executes (default)
+	// Mirrors the trade stream: a sweep across N makers produces N events.
+	FillPerFill FillReporting = iota
+
+	// FillPerOrder accumulates an aggressor's fills and emits a single FillEvent once
+	// matching on arrival is done, cutting event volume on multi-level sweeps
+	FillPerOrder
+)
+
+// FillEvent reports fills of an incoming (aggressor) order
+// In FillPerFill mode it covers exactly one trade; in FillPerOrder mode it covers every
+// trade of the order's arrival and LeavesQty is the remainder that rested or was cancelled.
+// Later fills of a resting order as a maker are not reported here (see the trade stream).
+type FillEvent struct {
+	OrderID     string
+	UserID      string
+	Side        domain.Side
+	Quantity    int64  // Quantity filled by the trades this event covers
+	Notional    int64  // Sum of price * quantity across those trades (exact)
+	AvgPrice    int64  // Notional / Quantity (truncated); the trade price in FillPerFill mode
+	FillCount   int    // Number of trades covered: always 1 in FillPerFill mode
+	CumQty      int64  // Order's total filled quantity after this event
+	LeavesQty   int64  // Order's remaining quantity after this event
+	LastTradeID string // ID of the last trade covered
+	Timestamp   time.Time
+}
+
+// SetFillHandler installs a callback notified of aggressor fills (nil disables)
+// Granularity is SymbolConfig.FillReporting.
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetFillHandler(handler func(FillEvent)) {
+	me.runOnMatchingThread(func() {
+		me.onFill = handler
+	})
+}
+
+// newFillEvent summarizes an aggressor's trades (matching thread only)
+// trades must be non-empty and all involve aggressor.
+func newFillEvent(aggressor *domain.Order, trades []*domain.Trade) FillEvent {
+	last := trades[len(trades)-1]
+	event := FillEvent{
+		OrderID:     aggressor.ID,
+		UserID:      aggressor.UserID,
+		Side:        aggressor.Side,
+		FillCount:   len(trades),
+		CumQty:      aggressor.Filled,
+		LeavesQty:   aggressor.RemainingQuantity(),
+		LastTradeID: last.ID,
+		Timestamp:   last.Timestamp,
+	}
+	for _, trade := range trades {
+		event.Quantity += trade.Quantity
+		event.Notional += trade.Price * trade.Quantity
+	}
+	if event.Quantity > 0 {
+		event.AvgPrice = event.Notional / event.Quantity
+	}
+	return event
+}
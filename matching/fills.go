@@ -0,0 +1,80 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"time"
+)
+
+// Fill is one execution of an order, as seen from that order's side
+type Fill struct {
+	TradeID             string
+	Price               int64
+	Quantity            int64
+	CounterpartyOrderID string
+	Timestamp           time.Time
+}
+
+// fillLedger keeps per-order fill history for a bounded number of orders (matching thread only)
+// When full, the order whose first fill is oldest is evicted (FIFO), so memory stays at
+// roughly capacity orders' worth of fills regardless of uptime.
+type fillLedger struct {
+	fills map[string][]Fill
+	ring  []string // order IDs in first-fill order, for eviction
+	next  int
+}
+
+func newFillLedger(capacity int) *fillLedger {
+	return &fillLedger{
+		fills: make(map[string][]Fill, capacity),
+		ring:  make([]string, capacity),
+	}
+}
+
+// record appends a fill to orderID's history, evicting the oldest order if needed
+func (l *fillLedger) record(orderID string, fill Fill) {
+	history, ok := l.fills[orderID]
+	if !ok {
+		if evict := l.ring[l.next]; evict != "" {
+			delete(l.fills, evict)
+		}
+		l.ring[l.next] = orderID
+		l.next = (l.next + 1) % len(l.ring)
+	}
+	l.fills[orderID] = append(history, fill)
+}
+
+// recordTrade records a trade on both orders' histories
+func (l *fillLedger) recordTrade(trade *domain.Trade) {
+	l.record(trade.BuyOrderID, Fill{
+		TradeID:             trade.ID,
+		Price:               trade.Price,
+		Quantity:            trade.Quantity,
+		CounterpartyOrderID: trade.SellOrderID,
+		Timestamp:           trade.Timestamp,
+	})
+	l.record(trade.SellOrderID, Fill{
+		TradeID:             trade.ID,
+		Price:               trade.Price,
+		Quantity:            trade.Quantity,
+		CounterpartyOrderID: trade.BuyOrderID,
+		Timestamp:           trade.Timestamp,
+	})
+}
+
+// GetFills returns the fills of an order in execution order, including after it completed
+// Requires SymbolConfig.FillHistoryOrders > 0; returns nil if fill history is off, the order
+// has no fills, or its history was evicted. Safe to call from any goroutine: the lookup
+// runs on the matching thread and the result is a copy.
+func (me *MatchingEngine) GetFills(orderID string) []Fill {
+	if me.fills == nil {
+		return nil
+	}
+	var fills []Fill
+	me.callOnMatchingThread(func() error {
+		if history := me.fills.fills[orderID]; len(history) > 0 {
+			fills = append([]Fill(nil), history...)
+		}
+		return nil
+	})
+	return fills
+}
@@ -0,0 +1,39 @@
+package matching
+
+import "time"
+
+// Halt stops matching: new orders are rejected with ErrTradingHalted until Resume
+// Resting orders stay in the book and can still be cancelled; pending stop / MIT
+// orders are not triggered while halted. Takes effect on the matching thread before
+// the next order: control commands are serviced ahead of the order buffer (see
+// CancelOrder), so orders submitted before Halt but not yet processed are rejected too.
+func (me *MatchingEngine) Halt() {
+	me.runOnMatchingThread(func() {
+		me.halt(time.Time{})
+	})
+}
+
+// Resume lifts a manual halt or ends a circuit-breaker cooldown early
+// Also lifts the halt that follows a recovered panic (see EnginePanic).
+func (me *MatchingEngine) Resume() {
+	me.runOnMatchingThread(func() {
+		me.halted = false
+		me.resumeAt = time.Time{}
+	})
+}
+
+// halt halts the engine until resumeAt (zero = until Resume); matching thread only
+func (me *MatchingEngine) halt(resumeAt time.Time) {
+	me.halted = true
+	me.resumeAt = resumeAt
+}
+
+// isHalted reports whether trading is halted, lifting a timed halt whose cooldown has passed
+// The cooldown is checked lazily, against the engine clock, when the next order arrives.
+func (me *MatchingEngine) isHalted() bool {
+	if me.halted && !me.resumeAt.IsZero() && !me.now().Before(me.resumeAt) {
+		me.halted = false
+		me.resumeAt = time.Time{}
+	}
+	return me.halted
+}
@@ -0,0 +1,27 @@
+package matching
+
+import "lightning-exchange/domain"
+
+// Icebergs (domain.Order.DisplayQty > 0) rest with only a slice of their quantity on
+// display. The engine sizes each slice: DisplayQty, or with DisplayQtyMax > DisplayQty a
+// size drawn uniformly from [DisplayQty, DisplayQtyMax] using SymbolConfig.Rand, so the
+// refills don't leave a fixed, recognizable footprint. The order book keeps the reserve
+// out of public depth and moves a refilled iceberg to the back of its level's queue.
+
+// validIceberg reports whether an order's display settings are usable
+// Icebergs must be limit orders with a positive display range; hidden icebergs are
+// rejected since a hidden order displays nothing to slice.
+func validIceberg(order *domain.Order) bool {
+	return order.DisplayQty > 0 &&
+		(order.DisplayQtyMax == 0 || order.DisplayQtyMax >= order.DisplayQty) &&
+		order.Type == domain.OrderTypeLimit && !order.IsHidden()
+}
+
+// nextSlice draws the size of an iceberg's next displayed slice (matching thread only)
+// The book caps it at the order's remaining quantity.
+func (me *MatchingEngine) nextSlice(order *domain.Order) int64 {
+	if order.DisplayQtyMax <= order.DisplayQty {
+		return order.DisplayQty
+	}
+	return order.DisplayQty + me.rng.Int63n(order.DisplayQtyMax-order.DisplayQty+1)
+}
@@ -7,6 +7,18 @@ import (
 	"sync/atomic"
 )
 
+// IDProvider supplies trade IDs (e.g. a central sequencer, Snowflake, a DB sequence)
+// Next is called ON THE MATCHING THREAD once per trade, inside executeTrade: its latency
+// adds directly to every fill, so it must be fast and must not block (no network or DB
+// round-trip per call; pre-fetch ID ranges instead). IDs must be unique per engine.
+// IDGenerator, the default, is one.
+type IDProvider interface {
+	Next() string
+}
+
+// Ensure IDGenerator implements IDProvider
+var _ IDProvider = (*IDGenerator)(nil)
+
 // IDGenerator generates unique IDs for trades and orders
 // Performance optimization:
 //   - Uses strings.Builder + sync.Pool to avoid allocations (16x faster than fmt.Sprintf)
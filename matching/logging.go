@@ -0,0 +1,124 @@
+package matching
+
+import (
+	"context"
+	"lightning-exchange/domain"
+	"log/slog"
+)
+
+// Logger is a leveled, structured logger for matching decisions
+// Implementations must be safe to call from the matching thread and should return
+// quickly from Enabled, which is checked before any attributes are built.
+type Logger interface {
+	Enabled(level slog.Level) bool
+	LogAttrs(level slog.Level, msg string, attrs ...slog.Attr)
+}
+
+// slogLogger adapts *slog.Logger to Logger
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger wraps a *slog.Logger for use with SetLogger
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (s slogLogger) Enabled(level slog.Level) bool {
+	return s.l.Enabled(context.Background(), level)
+}
+
+func (s slogLogger) LogAttrs(level slog.Level, msg string, attrs ...slog.Attr) {
+	s.l.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// SetLogger injects a logger for matching decisions (nil, the default, disables logging)
+// Logged events (level):
+//   - order accepted (Debug) / rejected (Info)
+//   - match executed (Debug)
+//   - price level created / removed (Debug)
+//   - best bid/ask changed (Debug)
+//
+// Every call site is guarded by a nil check and Enabled, so a nil or disabled logger
+// costs a branch on the hot path and never allocates.
+func (me *MatchingEngine) SetLogger(logger Logger) {
+	me.runOnMatchingThread(func() {
+		me.logger = logger
+	})
+}
+
+// logEnabled reports whether a log at level would be emitted
+func (me *MatchingEngine) logEnabled(level slog.Level) bool {
+	return me.logger != nil && me.logger.Enabled(level)
+}
+
+func (me *MatchingEngine) logOrderAccepted(order *domain.Order) {
+	if !me.logEnabled(slog.LevelDebug) {
+		return
+	}
+	me.logger.LogAttrs(slog.LevelDebug, "order accepted",
+		slog.String("symbol", me.symbol),
+		slog.String("order_id", order.ID),
+		slog.Int("side", int(order.Side)),
+		slog.Int("type", int(order.Type)),
+		slog.Int64("price", order.Price),
+		slog.Int64("quantity", order.Quantity))
+}
+
+func (me *MatchingEngine) logOrderRejected(order *domain.Order, err error) {
+	if !me.logEnabled(slog.LevelInfo) {
+		return
+	}
+	me.logger.LogAttrs(slog.LevelInfo, "order rejected",
+		slog.String("symbol", me.symbol),
+		slog.String("order_id", order.ID),
+		slog.Int64("price", order.Price),
+		slog.String("reason", err.Error()))
+}
+
+func (me *MatchingEngine) logOrderPruned(order *domain.Order) {
+	if !me.logEnabled(slog.LevelInfo) {
+		return
+	}
+	me.logger.LogAttrs(slog.LevelInfo, "order pruned beyond book depth",
+		slog.String("symbol", me.symbol),
+		slog.String("order_id", order.ID),
+		slog.String("user_id", order.UserID),
+		slog.Int64("price", order.Price),
+		slog.Int64("remaining", order.RemainingQuantity()))
+}
+
+func (me *MatchingEngine) logMatch(trade *domain.Trade, aggressor, resting *domain.Order) {
+	if !me.logEnabled(slog.LevelDebug) {
+		return
+	}
+	me.logger.LogAttrs(slog.LevelDebug, "match executed",
+		slog.String("symbol", me.symbol),
+		slog.String("trade_id", trade.ID),
+		slog.String("aggressor_id", aggressor.ID),
+		slog.String("resting_id", resting.ID),
+		slog.Int64("price", trade.Price),
+		slog.Int64("quantity", trade.Quantity))
+}
+
+func (me *MatchingEngine) logLevel(msg string, side domain.Side, price int64) {
+	if !me.logEnabled(slog.LevelDebug) {
+		return
+	}
+	me.logger.LogAttrs(slog.LevelDebug, msg,
+		slog.String("symbol", me.symbol),
+		slog.Int("side", int(side)),
+		slog.Int64("price", price))
+}
+
+func (me *MatchingEngine) logBestPrice(oldBid, oldAsk, newBid, newAsk int64) {
+	if (oldBid == newBid && oldAsk == newAsk) || !me.logEnabled(slog.LevelDebug) {
+		return
+	}
+	me.logger.LogAttrs(slog.LevelDebug, "best price changed",
+		slog.String("symbol", me.symbol),
+		slog.Int64("bid", newBid),
+		slog.Int64("ask", newAsk),
+		slog.Int64("prev_bid", oldBid),
+		slog.Int64("prev_ask", oldAsk))
+}
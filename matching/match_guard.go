@@ -0,0 +1,63 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"log/slog"
+)
+
+// MatchLoopAborted is emitted when an aggressor's match loop hits SymbolConfig.MaxMatchIterations
+// It indicates a book inconsistency (e.g. a resting order that is never removed) and
+// should never occur in correct operation. The aggressor's unfilled remainder is
+// cancelled rather than rested, since the book may still cross it.
+type MatchLoopAborted struct {
+	Symbol            string
+	OrderID           string
+	Side              domain.Side
+	Iterations        int   // Loop iterations run before the guard fired
+	Trades            int   // Trades printed for the aggressor before the abort
+	RemainingQuantity int64 // Aggressor quantity left unmatched (cancelled)
+	BestPrice         int64 // Opposite best price the loop was stuck on
+}
+
+// SetMatchLoopAbortedHandler installs a callback notified each time the match-loop guard fires
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetMatchLoopAbortedHandler(handler func(MatchLoopAborted)) {
+	me.runOnMatchingThread(func() {
+		me.onMatchLoopAborted = handler
+	})
+}
+
+// matchLoopExhausted reports whether the match loop has run its maximum iterations
+// On the first exhausted check it aborts the aggressor and emits MatchLoopAborted.
+func (me *MatchingEngine) matchLoopExhausted(aggressor *domain.Order, iterations, trades int) bool {
+	if me.maxMatchIterations <= 0 || iterations < me.maxMatchIterations {
+		return false
+	}
+	me.matchAborted = true
+
+	event := MatchLoopAborted{
+		Symbol:            me.symbol,
+		OrderID:           aggressor.ID,
+		Side:              aggressor.Side,
+		Iterations:        iterations,
+		Trades:            trades,
+		RemainingQuantity: aggressor.RemainingQuantity(),
+	}
+	if aggressor.Side == domain.SideBuy {
+		event.BestPrice = me.orderBook.GetBestAsk()
+	} else {
+		event.BestPrice = me.orderBook.GetBestBid()
+	}
+
+	if me.logger != nil {
+		me.logger.LogAttrs(slog.LevelError, "match loop aborted",
+			slog.String("symbol", me.symbol),
+			slog.String("order_id", event.OrderID),
+			slog.Int("iterations", iterations),
+			slog.Int64("best_price", event.BestPrice))
+	}
+	if me.onMatchLoopAborted != nil {
+		me.onMatchLoopAborted(event)
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"time"
+)
+
+// MatchReport summarizes everything that happened to one order while it was processed
+// Returned by SubmitOrderWithReport: one value instead of correlating the trade stream,
+// order events and the book. Unlike SubmitResult it covers the whole matching pass,
+// including fills the order received as a maker from stop orders its trades triggered.
+type MatchReport struct {
+	OrderID   string
+	Trades    []TradeView        // The order's trades in execution order (copies; nil if none)
+	RestedQty int64              // Quantity resting in the book after the pass (0 if not resting)
+	Status    domain.OrderStatus // Order status after the pass
+}
+
+// TradeView is a copy of one trade from the reporting order's point of view
+// Pooled *domain.Trade values are recycled once consumed, so a report never holds them.
+type TradeView struct {
+	ID                  string
+	Price               int64
+	Quantity            int64
+	Maker               bool   // The reporting order was the resting side
+	CounterpartyOrderID string // The other order
+	Timestamp           time.Time
+}
+
+// SubmitOrderWithReport is SubmitOrderSync that returns a MatchReport of the order's processing
+// Same latency and ordering as SubmitOrderSync. On error (rejected order, stopped engine)
+// the report is as far as processing got: empty for a stopped engine.
+func (me *MatchingEngine) SubmitOrderWithReport(order *domain.Order) (MatchReport, error) {
+	outcome := me.submitSync(order)
+	return outcome.report, outcome.err
+}
+
+// newMatchReport builds order's report from the trades of its matching pass (matching thread only)
+func (me *MatchingEngine) newMatchReport(order *domain.Order, trades []*domain.Trade) MatchReport {
+	report := MatchReport{OrderID: order.ID, Status: order.Status}
+	if me.orderBook.GetOrder(order.ID) == order {
+		report.RestedQty = order.RemainingQuantity()
+	}
+	for _, trade := range trades {
+		view := TradeView{ID: trade.ID, Price: trade.Price, Quantity: trade.Quantity, Timestamp: trade.Timestamp}
+		switch order.ID {
+		case trade.BuyOrderID:
+			view.Maker, view.CounterpartyOrderID = trade.IsBuyerMaker, trade.SellOrderID
+		case trade.SellOrderID:
+			view.Maker, view.CounterpartyOrderID = !trade.IsBuyerMaker, trade.BuyOrderID
+		default:
+			continue // between orders it triggered
+		}
+		report.Trades = append(report.Trades, view)
+	}
+	return report
+}
@@ -0,0 +1,179 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// EngineMetrics is a point-in-time view of engine latency, throughput and fill-quality metrics
+type EngineMetrics struct {
+	// LoopIterations counts matching-loop iterations (orders, cancels, commands and wake-ups);
+	// OrdersProcessed counts the orders among them, rejected ones included. Both only ever
+	// grow while the loop is running: a frozen counter under load means a stalled engine.
+	LoopIterations  int64
+	OrdersProcessed int64
+
+	// CancelsProcessed is the number of cancel requests whose latency was recorded
+	CancelsProcessed int64
+
+	// Tick-to-cancel: time from CancelOrder() until the matching loop applies the cancel.
+	// High values mean cancels are waiting behind order processing (cancel starvation).
+	// Percentiles are bucket upper bounds, accurate to within 25%.
+	CancelLatencyP50 time.Duration
+	CancelLatencyP99 time.Duration
+	CancelLatencyMax time.Duration
+
+	// Fill quality, over aggressive orders: incoming orders that traded on arrival
+	AggressiveOrders int64
+	// AvgLevelsSwept is the mean number of price levels an aggressive order traded at
+	AvgLevelsSwept float64
+	// PriceImprovedOrders counts limit orders that traded at least partly better than their limit;
+	// AvgPriceImprovement is their improvement per unit filled, weighted by quantity
+	PriceImprovedOrders int64
+	AvgPriceImprovement float64
+	// PartialFillRate is the fraction of aggressive orders left with a remainder
+	// (rested, cancelled as IOC, or cut short) after matching
+	PartialFillRate float64
+}
+
+// Metrics returns a snapshot of the engine's latency metrics
+// Safe to call from any goroutine. Latencies are only recorded when
+// SymbolConfig.MeasureCancelLatency is set; fill-quality stats are always on.
+func (me *MatchingEngine) Metrics() EngineMetrics {
+	m := EngineMetrics{
+		LoopIterations:   me.loopStats.iterations.Load(),
+		OrdersProcessed:  me.loopStats.orders.Load(),
+		CancelsProcessed: me.cancelLatency.count.Load(),
+		CancelLatencyP50: me.cancelLatency.quantile(0.50),
+		CancelLatencyP99: me.cancelLatency.quantile(0.99),
+		CancelLatencyMax: time.Duration(me.cancelLatency.max.Load()),
+	}
+	if n := me.fillQuality.orders.Load(); n > 0 {
+		m.AggressiveOrders = n
+		m.AvgLevelsSwept = float64(me.fillQuality.levels.Load()) / float64(n)
+		m.PartialFillRate = float64(me.fillQuality.partial.Load()) / float64(n)
+	}
+	if qty := me.fillQuality.improvedQty.Load(); qty > 0 {
+		m.PriceImprovedOrders = me.fillQuality.improvedOrders.Load()
+		m.AvgPriceImprovement = float64(me.fillQuality.improvement.Load()) / float64(qty)
+	}
+	return m
+}
+
+// fillStats aggregates fill quality with atomic counters, cheap enough to stay on in production
+// Written by the matching thread, read from any goroutine; a snapshot may mix counters
+// from either side of one order.
+type fillStats struct {
+	orders         atomic.Int64 // Aggressive orders (traded on arrival)
+	levels         atomic.Int64 // Price levels swept, summed over aggressive orders
+	partial        atomic.Int64 // Aggressive orders not fully filled
+	improvedOrders atomic.Int64 // Limit orders with at least one fill better than the limit
+	improvedQty    atomic.Int64 // Quantity of those orders' fills (all of them, improved or not)
+	improvement    atomic.Int64 // Sum of (better price - limit) * qty over those fills
+}
+
+// record accounts one aggressive order's trades, which are in sweep (price) order
+func (f *fillStats) record(order *domain.Order, trades []*domain.Trade) {
+	if len(trades) == 0 {
+		return
+	}
+	var levels, filled, improvement int64
+	for i, trade := range trades {
+		if i == 0 || trade.Price != trades[i-1].Price {
+			levels++
+		}
+		filled += trade.Quantity
+		// A limit order never trades through its limit, so this is never negative
+		if order.Type == domain.OrderTypeLimit {
+			if order.Side == domain.SideBuy {
+				improvement += (order.Price - trade.Price) * trade.Quantity
+			} else {
+				improvement += (trade.Price - order.Price) * trade.Quantity
+			}
+		}
+	}
+
+	f.orders.Add(1)
+	f.levels.Add(levels)
+	if !order.IsFilled() {
+		f.partial.Add(1)
+	}
+	if improvement > 0 {
+		f.improvedOrders.Add(1)
+		f.improvedQty.Add(filled)
+		f.improvement.Add(improvement)
+	}
+}
+
+// cancelRequest is a queued cancel, stamped with its submit time when latency is measured
+type cancelRequest struct {
+	orderID   string
+	submitted time.Time // zero = not measured
+}
+
+// Latency histogram layout: 4 sub-buckets per power of two (log-linear, like HDR histograms)
+// Bucket i covers a range at most 25% wide, which bounds the percentile error.
+const (
+	latencySubBucketBits = 2
+	latencySubBuckets    = 1 << latencySubBucketBits
+	latencyBuckets       = (64 - latencySubBucketBits) * latencySubBuckets
+)
+
+// latencyHistogram records durations with lock-free atomic counters
+// Written by the matching thread, read from any goroutine.
+type latencyHistogram struct {
+	counts [latencyBuckets]atomic.Int64
+	count  atomic.Int64
+	max    atomic.Int64
+}
+
+// record adds one observation
+func (h *latencyHistogram) record(d time.Duration) {
+	ns := max(int64(d), 0)
+	h.counts[latencyBucket(ns)].Add(1)
+	h.count.Add(1)
+	if ns > h.max.Load() {
+		h.max.Store(ns) // single writer
+	}
+}
+
+// quantile returns the upper bound of the bucket holding the q-th observation (0 if empty)
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	total := h.count.Load()
+	if total == 0 {
+		return 0
+	}
+	rank := max(int64(q*float64(total)+0.5), 1)
+
+	var seen int64
+	for i := range h.counts {
+		if seen += h.counts[i].Load(); seen >= rank {
+			return time.Duration(min(latencyBucketUpper(i), h.max.Load()))
+		}
+	}
+	return time.Duration(h.max.Load())
+}
+
+// latencyBucket maps a non-negative nanosecond value to its bucket index
+// Values below latencySubBuckets get exact buckets; above that, the bucket is the
+// power of two plus the next latencySubBucketBits bits of the value.
+func latencyBucket(ns int64) int {
+	if ns < latencySubBuckets {
+		return int(ns)
+	}
+	exp := bits.Len64(uint64(ns)) - 1
+	sub := int(ns>>(exp-latencySubBucketBits)) & (latencySubBuckets - 1)
+	return (exp-latencySubBucketBits+1)*latencySubBuckets + sub
+}
+
+// latencyBucketUpper returns the largest value that maps to bucket i
+func latencyBucketUpper(i int) int64 {
+	if i < latencySubBuckets {
+		return int64(i)
+	}
+	exp := i/latencySubBuckets + latencySubBucketBits - 1
+	sub := int64(i % latencySubBuckets)
+	return (latencySubBuckets+sub+1)<<(exp-latencySubBucketBits) - 1
+}
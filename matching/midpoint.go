@@ -0,0 +1,51 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"lightning-exchange/orderbook"
+)
+
+// midpointPrice returns the execution price of a match against a resting midpoint order
+// The midpoint of the displayed BBO, rounded to a tick per the symbol's MidpointRounding,
+// then kept within both orders' limits: a midpoint worse than the resting order's own price
+// (or the aggressor's limit) gives way to it, so a midpoint order never trades worse than
+// it would without the flag. With no displayed bid or ask there is no midpoint and
+// restingPrice stands.
+func (me *MatchingEngine) midpointPrice(aggressor, resting *domain.Order, restingPrice int64) int64 {
+	bid, ask := me.orderBook.DisplayedBBO()
+	if bid == 0 || ask == 0 {
+		return restingPrice
+	}
+
+	// The midpoint is (bid+ask)/2; below and above are the ticks around it (equal when on tick)
+	tick := max(me.tickSize, 1)
+	below := (bid + ask) / (2 * tick) * tick
+	above := below
+	if below*2 != bid+ask {
+		above += tick
+	}
+
+	favored := resting.Side
+	if me.midpoint == MidpointFavorAggressor {
+		favored = aggressor.Side
+	}
+	// A buyer is favored by the lower price, or the higher one on an inverted book
+	price := below
+	if (favored == domain.SideSell) != (me.orderBook.PriceOrdering() == orderbook.PriceOrderingInverted) {
+		price = above
+	}
+
+	// The resting price already satisfies the aggressor's limit, so clamp to it last
+	if aggressor.Type == domain.OrderTypeLimit {
+		price = me.limitPrice(price, aggressor)
+	}
+	return me.limitPrice(price, resting)
+}
+
+// limitPrice clamps price to what order's limit allows, in the book's price ordering
+func (me *MatchingEngine) limitPrice(price int64, order *domain.Order) int64 {
+	if me.reaches(order, price) {
+		return price
+	}
+	return order.Price
+}
@@ -0,0 +1,69 @@
+package matching
+
+import "lightning-exchange/domain"
+
+// OrderEventType is the outcome of an incoming order once matching on arrival is done
+type OrderEventType uint8
+
+const (
+	// OrderEventFilled: the order matched in full
+	OrderEventFilled OrderEventType = iota + 1
+
+	// OrderEventResting: the order rests in the book, possibly after partial fills
+	OrderEventResting
+
+	// OrderEventCancelled: the unfilled remainder was cancelled (IOC, a market order that
+	// ran out of liquidity, self-trade prevention, or a circuit-breaker halt), possibly
+	// after partial fills
+	OrderEventCancelled
+
+	// OrderEventAccepted: the order passed validation and is about to match. Emitted on
+	// the unified EngineEvent feed only, ahead of the order's trades and outcome.
+	OrderEventAccepted
+)
+
+// OrderEvent reports how an incoming order ended its arrival at the book
+// Emitted once per accepted order after its trades, so a client order state machine
+// doesn't have to infer the outcome from the trade stream. FilledQuantity > 0 tells a
+// partial fill from an untouched order. Later fills as a maker are not reported here.
+type OrderEvent struct {
+	Type              OrderEventType
+	OrderID           string
+	UserID            string
+	FilledQuantity    int64
+	RemainingQuantity int64
+}
+
+// SetOrderEventHandler installs a callback notified of each accepted order's outcome
+// Rejected orders go to the reject handler instead; stop / MIT orders are reported
+// when they trigger, not when they are parked.
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetOrderEventHandler(handler func(OrderEvent)) {
+	me.runOnMatchingThread(func() {
+		me.onOrderEvent = handler
+	})
+}
+
+// newOrderEvent summarizes a just-processed order (matching thread only)
+func newOrderEvent(order *domain.Order) OrderEvent {
+	event := OrderEvent{
+		Type:              OrderEventCancelled,
+		OrderID:           order.ID,
+		UserID:            order.UserID,
+		FilledQuantity:    order.Filled,
+		RemainingQuantity: order.RemainingQuantity(),
+	}
+	switch {
+	case order.Status == domain.OrderStatusFilled:
+		event.Type = OrderEventFilled
+	case restsAfterArrival(order):
+		event.Type = OrderEventResting
+	}
+	return event
+}
+
+// restsAfterArrival reports whether a just-processed order was left resting in the book
+func restsAfterArrival(order *domain.Order) bool {
+	return order.Type == domain.OrderTypeLimit && !order.IsFilled() &&
+		(order.Status == domain.OrderStatusPending || order.Status == domain.OrderStatusPartialFilled)
+}
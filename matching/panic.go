@@ -0,0 +1,98 @@
+package matching
+
+import (
+	"errors"
+	"fmt"
+	"lightning-exchange/domain"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// ErrEnginePanic is returned to a SubmitOrderSync (or synchronous command) caller whose
+// order or command panicked on the matching thread
+var ErrEnginePanic = errors.New("matching engine panicked")
+
+// EnginePanic is emitted when the matching loop recovers from a panic
+// The panic may have left the book half-updated (e.g. an order filled on one side only),
+// so after a panic the engine halts trading and reports itself unhealthy: new orders are
+// rejected with ErrTradingHalted while cancels keep working. Inspect the book, then call
+// Resume to trade again; Health keeps the panic on record either way.
+type EnginePanic struct {
+	Symbol  string
+	OrderID string    // Order being processed when it panicked ("" = a command or the loop itself)
+	Value   string    // The recovered panic value
+	Stack   []byte    // Stack trace of the panicking goroutine
+	Time    time.Time // Engine clock time of the panic
+}
+
+// EngineHealth reports whether the matching loop has ever panicked, and whether it is still matching
+// Times are on the engine clock. LastProcessedAt that stops advancing while orders are
+// being submitted means the loop is stalled, even though Health itself still responds.
+// In simulation mode virtual time starts with the first timestamped order, so StartedAt
+// is that order's time and stays zero until it arrives.
+type EngineHealth struct {
+	Healthy   bool        // false once any panic has been recovered
+	Panics    int64       // Number of panics recovered
+	LastPanic EnginePanic // Most recent panic (zero if none)
+
+	StartedAt       time.Time     // When Start was called (zero if not started)
+	Uptime          time.Duration // Time since StartedAt
+	LastProcessedAt time.Time     // When the matching loop last finished an order (zero if none yet)
+}
+
+// SetEnginePanicHandler installs a callback notified each time the matching loop recovers a panic
+// The handler runs ON THE MATCHING THREAD, before the loop restarts, and must not block or panic.
+func (me *MatchingEngine) SetEnginePanicHandler(handler func(EnginePanic)) {
+	me.runOnMatchingThread(func() {
+		me.onPanic = handler
+	})
+}
+
+// Health returns the engine's panic record and liveness; safe to call from any goroutine
+func (me *MatchingEngine) Health() EngineHealth {
+	me.healthMu.Lock()
+	health := me.health
+	me.healthMu.Unlock()
+	health.Healthy = health.Panics == 0
+	me.loopStats.fillHealth(&health, me.now())
+	return health
+}
+
+// recoverPanic isolates a panic raised on the matching thread (called from run's recover)
+// The order being processed is rejected and its SubmitOrderSync caller released, trading
+// is halted, and the panic is recorded, logged and emitted. Its trades, if any were
+// printed before the panic, are not published.
+func (me *MatchingEngine) recoverPanic(r any) {
+	event := EnginePanic{
+		Symbol: me.symbol,
+		Value:  fmt.Sprint(r),
+		Stack:  debug.Stack(),
+		Time:   me.now(),
+	}
+
+	if order := me.current; order != nil {
+		me.current = nil
+		event.OrderID = order.ID
+		order.Status = domain.OrderStatusRejected
+		if done, ok := me.syncDone.LoadAndDelete(order); ok {
+			done.(chan syncOutcome) <- syncOutcome{err: ErrEnginePanic}
+		}
+	}
+	me.halt(time.Time{})
+
+	me.healthMu.Lock()
+	me.health.Panics++
+	me.health.LastPanic = event
+	me.healthMu.Unlock()
+
+	if me.logger != nil {
+		me.logger.LogAttrs(slog.LevelError, "matching loop panicked",
+			slog.String("symbol", me.symbol),
+			slog.String("order_id", event.OrderID),
+			slog.String("panic", event.Value))
+	}
+	if me.onPanic != nil {
+		me.onPanic(event)
+	}
+}
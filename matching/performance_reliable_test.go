@@ -2,7 +2,9 @@ package matching
 
 import (
 	"fmt"
+	"io"
 	"lightning-exchange/domain"
+	"log/slog"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -351,3 +353,202 @@ func TestMatchingEngineConcurrentReliableQPS(t *testing.T) {
 	t.Logf("成交 TPS:      %.0f trades/sec (%.1f 万/秒)", tps, tps/10000)
 	t.Logf("平均延迟:      %.2f μs/order", float64(elapsed.Microseconds())/float64(ordersProcessed))
 }
+
+// benchmarkProcessOrder 直接在当前 goroutine 调用 processOrder（挂单 + 吃单）
+func benchmarkProcessOrder(b *testing.B, logger Logger) {
+	engine := NewMatchingEngine("BTCUSDT")
+	engine.logger = logger
+	sells := make([]*domain.Order, b.N)
+	buys := make([]*domain.Order, b.N)
+	for i := 0; i < b.N; i++ {
+		sells[i] = &domain.Order{ID: "S", Symbol: "BTCUSDT", Side: domain.SideSell, Price: 50000, Quantity: 1}
+		buys[i] = &domain.Order{ID: "B", Symbol: "BTCUSDT", Side: domain.SideBuy, Price: 50000, Quantity: 1}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		engine.processOrder(sells[i])
+		trades, _ := engine.processOrder(buys[i])
+		for _, trade := range trades {
+			trade.Destroy()
+		}
+	}
+}
+
+// BenchmarkProcessOrder_NilLogger 默认不注入日志
+func BenchmarkProcessOrder_NilLogger(b *testing.B) {
+	benchmarkProcessOrder(b, nil)
+}
+
+// BenchmarkProcessOrder_DisabledLogger 注入了日志但级别不满足，应与 nil 无明显差异且不增加分配
+func BenchmarkProcessOrder_DisabledLogger(b *testing.B) {
+	handler := slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError})
+	benchmarkProcessOrder(b, NewSlogLogger(slog.New(handler)))
+}
+
+// benchmarkSweepPublish 一个买单扫过 10 档，对比逐笔发布与批量发布成交
+func benchmarkSweepPublish(b *testing.B, batch bool) {
+	const levels = 10
+	engine := NewMatchingEngine("BTCUSDT")
+	consumer := engine.tradeBuffer.NewTradeConsumerBatchSafe()
+	sells := make([]*domain.Order, b.N*levels)
+	buys := make([]*domain.Order, b.N)
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < levels; j++ {
+			sells[i*levels+j] = &domain.Order{ID: "S", Symbol: "BTCUSDT", Side: domain.SideSell, Price: 50000 + int64(j), Quantity: 1}
+		}
+		buys[i] = &domain.Order{ID: "B", Symbol: "BTCUSDT", Side: domain.SideBuy, Price: 50000 + levels, Quantity: levels}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < levels; j++ {
+			engine.processOrder(sells[i*levels+j])
+		}
+		trades, _ := engine.processOrder(buys[i])
+		if batch {
+			engine.tradeBuffer.PublishBatch(trades)
+		} else {
+			for _, trade := range trades {
+				engine.tradeBuffer.Publish(trade)
+			}
+		}
+		for _, trade := range consumer.ConsumeBatch(levels) {
+			trade.Destroy()
+		}
+	}
+}
+
+// BenchmarkSweepPublish_PerTrade 每笔成交一次 Publish
+func BenchmarkSweepPublish_PerTrade(b *testing.B) {
+	benchmarkSweepPublish(b, false)
+}
+
+// BenchmarkSweepPublish_Batch 每个订单一次 PublishBatch
+func BenchmarkSweepPublish_Batch(b *testing.B) {
+	benchmarkSweepPublish(b, true)
+}
+
+// 消费路径基准：生产者 goroutine 持续发布（缓冲区保持饱和），只测量消费端吞吐
+// 同一个对象反复发布，避免把对象分配计入 allocs/op
+
+// BenchmarkOrderConsume_Blocking 逐个调用 Consume（每个元素一次函数调用，每 128 个一次批量填充）
+func BenchmarkOrderConsume_Blocking(b *testing.B) {
+	rb := NewRingBufferSemaphoreBatchSafe(65536)
+	consumer := rb.NewConsumerBatchSafe()
+	order := &domain.Order{ID: "O", Symbol: "BTCUSDT"}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			rb.Publish(order)
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		consumer.Consume()
+	}
+}
+
+// BenchmarkOrderConsume_Batched 假想的批量接口：一次取走整个本地缓存（最多 128 个）
+// 与 Blocking 的差值即逐元素调用的开销；semaphore 次数两者相同
+func BenchmarkOrderConsume_Batched(b *testing.B) {
+	rb := NewRingBufferSemaphoreBatchSafe(65536)
+	consumer := rb.NewConsumerBatchSafe()
+	order := &domain.Order{ID: "O", Symbol: "BTCUSDT"}
+	var batch [128]*domain.Order
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			rb.Publish(order)
+		}
+	}()
+	for consumed := 0; consumed < b.N; {
+		consumed += consumeOrderBatch(consumer, batch[:])
+	}
+}
+
+// consumeOrderBatch 阻塞直到至少有一个元素，然后把本地缓存整体拷出
+func consumeOrderBatch(cb *ConsumerBatchSafe, dst []*domain.Order) int {
+	if cb.cacheStart >= cb.cacheEnd {
+		cb.fillCacheSafe()
+	}
+	n := copy(dst, cb.localCache[cb.cacheStart:cb.cacheEnd])
+	cb.cacheStart += n
+	return n
+}
+
+// BenchmarkTradeConsume_TryConsume 逐个非阻塞 TryConsume
+func BenchmarkTradeConsume_TryConsume(b *testing.B) {
+	rb := NewTradeRingBufferBatchSafe(65536)
+	consumer := rb.NewTradeConsumerBatchSafe()
+	trade := &domain.Trade{ID: "T", Symbol: "BTCUSDT"}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			rb.Publish(trade)
+		}
+	}()
+	for consumed := 0; consumed < b.N; {
+		if _, ok := consumer.TryConsume(); ok {
+			consumed++
+		}
+	}
+}
+
+// BenchmarkTradeConsume_Batch 每次 ConsumeBatch(128) 取一批（返回新切片，会计入分配）
+func BenchmarkTradeConsume_Batch(b *testing.B) {
+	rb := NewTradeRingBufferBatchSafe(65536)
+	consumer := rb.NewTradeConsumerBatchSafe()
+	trade := &domain.Trade{ID: "T", Symbol: "BTCUSDT"}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			rb.Publish(trade)
+		}
+	}()
+	for consumed := 0; consumed < b.N; {
+		consumed += len(consumer.ConsumeBatch(128))
+	}
+}
+
+// TestBenchmarkThroughput 标准化吞吐自检：CI 中断言 QPS 不低于基线
+func TestBenchmarkThroughput(t *testing.T) {
+	result := BenchmarkThroughput(BenchConfig{
+		Duration:        300 * time.Millisecond,
+		Producers:       2,
+		OrderBufferSize: 4096,
+		SampleEvery:     64,
+	})
+
+	t.Logf("订单: %d | 成交: %d | 耗时: %v | QPS: %.0f | TPS: %.0f",
+		result.Orders, result.Trades, result.Elapsed, result.QPS, result.TPS)
+	t.Logf("延迟: P50 %v | P99 %v | P99.9 %v | Max %v (%d 个采样)",
+		result.LatencyP50, result.LatencyP99, result.LatencyP999, result.LatencyMax, result.LatencySamples)
+
+	// 基线取得很宽松（"合格性能"档），只为拦住数量级的回退
+	const minQPS = 10000
+	if result.QPS < minQPS {
+		t.Errorf("QPS %.0f 低于基线 %d", result.QPS, minQPS)
+	}
+	if result.Trades == 0 {
+		t.Error("默认订单流应产生成交")
+	}
+	if result.LatencySamples == 0 {
+		t.Fatal("应有延迟采样")
+	}
+	if result.LatencyP50 <= 0 || result.LatencyP50 > result.LatencyP99 || result.LatencyP99 > result.LatencyP999 {
+		t.Errorf("分位数不单调: P50 %v, P99 %v, P99.9 %v", result.LatencyP50, result.LatencyP99, result.LatencyP999)
+	}
+	if len(result.Bids) == 0 || len(result.Asks) == 0 {
+		t.Errorf("结束时双边都应有挂单: bids %d, asks %d", len(result.Bids), len(result.Asks))
+	}
+}
@@ -0,0 +1,61 @@
+package matching
+
+// PriceBandConfig rejects limit orders priced too far from a reference price
+// Complements the circuit breaker: the breaker halts after a price move has printed,
+// the band stops a fat-finger order before it can trade or rest.
+type PriceBandConfig struct {
+	MaxDeviationBps int64              // Largest allowed distance from the reference, in basis points (0 = off)
+	Reference       PriceBandReference // Which price the band is centred on
+}
+
+// PriceBandReference selects the price a PriceBandConfig band is centred on
+type PriceBandReference int
+
+const (
+	// BandFromLastTrade centres the band on the price set with SetReferencePrice until the
+	// first trade, then on the last trade price (default)
+	BandFromLastTrade PriceBandReference = iota
+
+	// BandFromReferencePrice keeps the band on the price set with SetReferencePrice for the
+	// whole session, e.g. a static daily limit around the previous close
+	BandFromReferencePrice
+)
+
+// SetReferencePrice seeds the reference price used before the engine has traded
+// Typically the previous session's close, set at startup so price band checks apply from
+// the first order. Also primes the circuit breaker window, so the first trade is measured
+// against it, unless the engine has already traded. A zero price clears it.
+// Runs on the matching thread ahead of any order submitted after it returns.
+func (me *MatchingEngine) SetReferencePrice(price int64) {
+	me.runOnMatchingThread(func() {
+		me.referencePrice = price
+		if me.breaker != nil && me.lastTradePrice == 0 {
+			me.breaker.reset()
+			if price > 0 {
+				me.breaker.observe(price)
+			}
+		}
+	})
+}
+
+// bandReference returns the price the band is currently centred on (0 = none yet)
+func (me *MatchingEngine) bandReference() int64 {
+	if me.priceBand.Reference == BandFromLastTrade && me.lastTradePrice > 0 {
+		return me.lastTradePrice
+	}
+	return me.referencePrice
+}
+
+// outsidePriceBand reports whether a limit price deviates from the reference by more than the band
+// Market orders carry no price and are not checked; with no reference yet every price passes.
+func (me *MatchingEngine) outsidePriceBand(price int64) bool {
+	reference := me.bandReference()
+	if reference <= 0 {
+		return false
+	}
+	move := price - reference
+	if move < 0 {
+		move = -move
+	}
+	return move*10000 > me.priceBand.MaxDeviationBps*reference
+}
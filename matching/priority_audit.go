@@ -0,0 +1,91 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"lightning-exchange/orderbook"
+	"log/slog"
+)
+
+// PriorityViolation is emitted when the priority audit finds a match that broke price-time priority
+// It should never occur in correct operation: it points at a bug in the match loop or in
+// the book (a stale best price, a skipped queue entry, a refill that jumped the queue).
+type PriorityViolation struct {
+	Symbol           string
+	AggressorOrderID string
+	RestingOrderID   string // Order the engine matched
+	ExpectedOrderID  string // Highest-priority eligible order per the book ("" if none)
+	Price            int64  // Price the engine was about to trade at
+	ExpectedPrice    int64  // Best opposite price per the book (0 if none)
+	Reason           string
+}
+
+// SetPriorityViolationHandler installs a callback notified of each priority violation
+// Only called when SymbolConfig.PriorityAudit is on.
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetPriorityViolationHandler(handler func(PriorityViolation)) {
+	me.runOnMatchingThread(func() {
+		me.onPriorityViolation = handler
+	})
+}
+
+// auditPriority cross-checks the counterparty executeTrade is about to fill against the book
+// The best level is found by walking the price tree rather than through the cached best
+// price the match loop used, and every order queued ahead of resting at that level must
+// be one a maker may veto (last look); anything else should have traded first.
+// Runs before the fill, so the book is still as the match loop saw it.
+func (me *MatchingEngine) auditPriority(aggressor, resting *domain.Order, price int64) {
+	violation := PriorityViolation{
+		Symbol:           me.symbol,
+		AggressorOrderID: aggressor.ID,
+		RestingOrderID:   resting.ID,
+		Price:            price,
+	}
+
+	var best *orderbook.PriceLevel_
+	for level := range me.orderBook.Levels(resting.Side) {
+		if level.Orders.Len() > 0 {
+			best = level
+			break
+		}
+	}
+	if best != nil {
+		violation.ExpectedPrice = best.Price
+		violation.ExpectedOrderID = best.Orders.Front().Value.(*domain.Order).ID
+	}
+
+	switch {
+	case me.orderBook.GetOrder(resting.ID) != resting:
+		violation.Reason = "matched order is not resting in the book"
+	case best == nil || best.Price != resting.Price:
+		violation.Reason = "a better price level was available"
+	case price != resting.Price:
+		violation.Reason = "trade price differs from the resting order's price"
+	default:
+		for e := best.Orders.Front(); ; e = e.Next() {
+			if e == nil {
+				violation.Reason = "matched order is missing from its price level"
+				break
+			}
+			ahead := e.Value.(*domain.Order)
+			if ahead == resting {
+				return
+			}
+			if !ahead.IsLastLook() {
+				violation.ExpectedOrderID = ahead.ID
+				violation.Reason = "an order ahead in the queue was skipped"
+				break
+			}
+		}
+	}
+
+	if me.logger != nil {
+		me.logger.LogAttrs(slog.LevelError, "priority violation",
+			slog.String("symbol", me.symbol),
+			slog.String("order_id", resting.ID),
+			slog.String("expected_order_id", violation.ExpectedOrderID),
+			slog.String("reason", violation.Reason))
+	}
+	if me.onPriorityViolation != nil {
+		me.onPriorityViolation(violation)
+	}
+}
@@ -0,0 +1,44 @@
+package matching
+
+import "errors"
+
+var (
+	// ErrOrderNotFound is returned when the order is not resting in the book
+	ErrOrderNotFound = errors.New("order not found")
+
+	// ErrInvalidQuantity is returned for a non-positive quantity
+	ErrInvalidQuantity = errors.New("quantity must be positive")
+
+	// ErrReduceExceedsRemaining is returned when reducing by more than the remaining quantity
+	ErrReduceExceedsRemaining = errors.New("reduce quantity exceeds remaining quantity")
+)
+
+// ReduceOrder lowers a resting order's remaining quantity without losing time priority
+// The order keeps its position in the level's FIFO queue ("modify down"); the level volume
+// is adjusted. Reducing by exactly the remaining quantity removes the order (cancelled),
+// which like a cancel is rejected with ErrMinRestTimeNotMet before MinRestTime.
+// Executed on the matching thread, so it is strictly ordered with respect to matching:
+// an aggressor processed before the reduce fills against the original quantity, one
+// processed after sees the reduced quantity. Blocks until applied.
+// Being risk-reducing, it is serviced right after cancels, ahead of queued new orders.
+func (me *MatchingEngine) ReduceOrder(orderID string, reduceBy int64) error {
+	if reduceBy <= 0 {
+		return ErrInvalidQuantity
+	}
+
+	return me.callOnLane(me.amendChan, func() error {
+		order := me.orderBook.GetOrder(orderID)
+		if order == nil {
+			return ErrOrderNotFound
+		}
+		if reduceBy > order.RemainingQuantity() {
+			return ErrReduceExceedsRemaining
+		}
+		if reduceBy == order.RemainingQuantity() && !me.minRestTimeMet(order) {
+			return ErrMinRestTimeNotMet
+		}
+
+		me.orderBook.ReduceOrder(order, reduceBy)
+		return nil
+	})
+}
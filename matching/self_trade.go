@@ -0,0 +1,70 @@
+package matching
+
+import "lightning-exchange/domain"
+
+// SelfTradePrevention selects how the engine handles an aggressor matching
+// a resting order from the same UserID
+type SelfTradePrevention int
+
+const (
+	// STPNone lets self-matches trade normally (default)
+	// Such trades carry domain.VisibilitySelfMatch, keeping them off the public tape.
+	STPNone SelfTradePrevention = iota
+
+	// STPDecrementBoth reduces both orders by the overlapping quantity without printing a trade
+	// The "wash" never reaches the public tape; a private SelfMatch event is emitted instead
+	// so the user's own quantities stay consistent with their net position.
+	STPDecrementBoth
+)
+
+// SelfMatch is a private event describing quantity removed by self-trade prevention
+// It is not a trade: no trade ID is assigned and it is not published to the trade buffer.
+type SelfMatch struct {
+	Symbol           string
+	UserID           string
+	AggressorOrderID string
+	RestingOrderID   string
+	Price            int64 // Resting order's price
+	Quantity         int64 // Quantity decremented from both orders
+}
+
+// SetSelfTradePrevention sets the self-trade prevention mode
+// Applied on the matching thread; takes effect for orders processed after the change.
+func (me *MatchingEngine) SetSelfTradePrevention(mode SelfTradePrevention) {
+	me.runOnMatchingThread(func() {
+		me.stpMode = mode
+	})
+}
+
+// SetSelfMatchHandler installs a callback for private SelfMatch events
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetSelfMatchHandler(handler func(SelfMatch)) {
+	me.runOnMatchingThread(func() {
+		me.onSelfMatch = handler
+	})
+}
+
+// decrementBoth cancels the overlapping quantity of a self-match (STPDecrementBoth)
+// The resting order is removed from the book if fully decremented; a fully decremented
+// aggressor is marked cancelled so it is not added to the book.
+func (me *MatchingEngine) decrementBoth(aggressor, resting *domain.Order, price int64) {
+	quantity := min(aggressor.RemainingQuantity(), resting.RemainingQuantity())
+
+	me.orderBook.ReduceOrder(resting, quantity)
+
+	aggressor.Quantity -= quantity
+	if aggressor.RemainingQuantity() == 0 {
+		aggressor.Cancel()
+	}
+
+	if me.onSelfMatch != nil {
+		me.onSelfMatch(SelfMatch{
+			Symbol:           me.symbol,
+			UserID:           aggressor.UserID,
+			AggressorOrderID: aggressor.ID,
+			RestingOrderID:   resting.ID,
+			Price:            price,
+			Quantity:         quantity,
+		})
+	}
+}
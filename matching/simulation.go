@@ -0,0 +1,114 @@
+package matching
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"lightning-exchange/domain"
+)
+
+// Simulation mode (SymbolConfig.Simulation) runs the engine on virtual time for
+// backtests: historical order flow is replayed as fast as the engine goes, while
+// time-dependent features (GTD expiry, minimum rest time, circuit-breaker windows and
+// cooldowns, session statistics) behave as they did at the original timestamps.
+//
+// Virtual time advances with order arrival, not with the wall clock:
+//   - Each order taken off the order buffer carries its historical time in
+//     Order.Timestamp. Before the order is processed, virtual time moves forward to
+//     that timestamp, and every GTD order expiring at or before it is expired, so an
+//     order never matches against liquidity that had already expired.
+//   - Virtual time never moves backward: an order stamped earlier than the current
+//     virtual time is processed at the current virtual time. Orders with a zero
+//     Timestamp don't move it. Note that domain.NewLimitOrder stamps the wall clock,
+//     so replayed orders must have their Timestamp overwritten with the historical one.
+//   - Cancels, amends and control commands carry no timestamp and apply at the
+//     current virtual time. AdvanceTime moves time without an order (e.g. to the end
+//     of a session, to expire the remaining GTD orders); it travels the order buffer
+//     as a timestamped marker, so it stays in FIFO order with the orders around it.
+//
+// The engine stamps accepted orders and trades with virtual time, and the background
+// expiry timer is not armed: expiries happen only as virtual time advances. Stop and
+// MIT orders trigger on trade prices, not time, so they fire exactly as in live mode.
+// Replay from a single goroutine in historical order for a deterministic result.
+
+// ErrNotSimulation is returned by AdvanceTime on an engine running on real time
+var ErrNotSimulation = errors.New("engine is not in simulation mode")
+
+// VirtualClock is the Clock of an engine in simulation mode
+// Only the matching thread advances it; Now is safe to call from any goroutine.
+// Before the first timestamped order it reports the zero time.
+type VirtualClock struct {
+	now atomic.Int64 // Unix nanoseconds; 0 = not started
+}
+
+// Now returns the current virtual time
+func (c *VirtualClock) Now() time.Time {
+	nanos := c.now.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+// advance moves the clock forward to t; earlier and zero times are ignored
+func (c *VirtualClock) advance(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if nanos := t.UnixNano(); nanos > c.now.Load() {
+		c.now.Store(nanos)
+	}
+}
+
+// IsSimulation reports whether the engine runs on virtual time
+func (me *MatchingEngine) IsSimulation() bool {
+	return me.sim != nil
+}
+
+// AdvanceTime moves virtual time forward to t and expires the GTD orders now due
+// The advance is queued on the order buffer as a marker stamped t, so it applies after
+// every order submitted before it and before every order submitted after it. Times not
+// after the current virtual time are a no-op. Blocks until applied; returns
+// ErrNotSimulation outside simulation mode, ErrOrderDropped if OverflowDropOldest
+// discards the marker, or ErrEngineStopped.
+func (me *MatchingEngine) AdvanceTime(t time.Time) error {
+	if me.sim == nil {
+		return ErrNotSimulation
+	}
+	marker := &domain.Order{Timestamp: t}
+	done := make(chan error, 1)
+	me.timeMarkers.Store(marker, done)
+
+	me.orderBuffer.Publish(marker)
+
+	select {
+	case err := <-done:
+		return err
+	case <-me.stopChan:
+		me.timeMarkers.Delete(marker)
+		return ErrEngineStopped
+	}
+}
+
+// applyTimeMarker advances virtual time if order is an AdvanceTime marker (matching thread only)
+// Reports whether it was one; a marker is not an order and must not be processed.
+func (me *MatchingEngine) applyTimeMarker(order *domain.Order) bool {
+	done, ok := me.timeMarkers.LoadAndDelete(order)
+	if !ok {
+		return false
+	}
+	me.advanceVirtualTime(order.Timestamp)
+	done.(chan error) <- nil
+	return true
+}
+
+// advanceVirtualTime moves virtual time to t and expires every GTD order due by then
+// Unlike sweepExpired it ignores ExpirySweepBatch: no order may see a book still
+// holding liquidity that expired before it arrived.
+func (me *MatchingEngine) advanceVirtualTime(t time.Time) {
+	me.sim.advance(t)
+	if me.orderBook.HasPendingExpiries() {
+		me.orderBook.ExpireOrders(me.now(), 0)
+	}
+}
@@ -0,0 +1,53 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"lightning-exchange/orderbook"
+)
+
+// slippageBound returns the worst price a market order may trade at under its MaxSlippageBps
+// The reference is the best opposite price when the order arrives; the bound lies
+// MaxSlippageBps away from it in the direction that is worse for the order (truncated
+// toward the reference). Returns 0 (unbounded) for limit orders, orders without a cap
+// and an empty opposite side.
+func (me *MatchingEngine) slippageBound(order *domain.Order) int64 {
+	if order.Type != domain.OrderTypeMarket || order.MaxSlippageBps <= 0 {
+		return 0
+	}
+	reference := me.orderBook.GetBestAsk()
+	if order.Side == domain.SideSell {
+		reference = me.orderBook.GetBestBid()
+	}
+	if reference == 0 {
+		return 0
+	}
+	return me.worsePrice(order.Side, reference, order.MaxSlippageBps)
+}
+
+// protectMarketOrder applies SymbolConfig.MarketProtectionBps to a market order (matching thread only)
+// The order becomes an IOC limit at the last trade price moved MarketProtectionBps in its
+// disfavor, so it cannot execute past that band and its remainder is cancelled. Before
+// the first trade the price set with SetReferencePrice stands in; with neither the order
+// stays a plain market order.
+func (me *MatchingEngine) protectMarketOrder(order *domain.Order) {
+	reference := me.lastTradePrice
+	if reference == 0 {
+		reference = me.referencePrice
+	}
+	if reference <= 0 {
+		return
+	}
+	order.Type, order.TimeInForce = domain.OrderTypeLimit, domain.TimeInForceIOC
+	order.Price = me.worsePrice(order.Side, reference, me.marketProtectionBps)
+}
+
+// worsePrice returns reference moved bps basis points in the direction that is worse for side
+// (higher for a buyer, lower for a seller, flipped under inverted price ordering); the move
+// is truncated toward reference
+func (me *MatchingEngine) worsePrice(side domain.Side, reference, bps int64) int64 {
+	band := reference * bps / 10000
+	if (side == domain.SideBuy) != (me.orderBook.PriceOrdering() == orderbook.PriceOrderingInverted) {
+		return reference + band
+	}
+	return reference - band
+}
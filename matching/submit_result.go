@@ -0,0 +1,48 @@
+package matching
+
+import "lightning-exchange/domain"
+
+// MakerTaker describes how an order interacted with the book on arrival
+type MakerTaker int
+
+const (
+	RoleNone  MakerTaker = iota // neither traded nor rested (rejected, unfilled IOC, parked stop)
+	RoleTaker                   // matched on arrival, nothing rested
+	RoleMaker                   // rested without matching
+	RoleBoth                    // partially matched on arrival, remainder rested
+)
+
+// SubmitResult is the outcome of an order as returned by SubmitOrderWithResult
+// It describes the order's arrival only; fills it receives later as a maker are not included.
+type SubmitResult struct {
+	Trades    int   // Trades executed with this order as the aggressor
+	TakenQty  int64 // Quantity matched on arrival (liquidity taken)
+	RestedQty int64 // Quantity left resting in the book (liquidity added)
+	Role      MakerTaker
+}
+
+// syncOutcome is delivered to a SubmitOrderSync / SubmitOrderWithResult / SubmitOrderWithReport caller
+type syncOutcome struct {
+	result SubmitResult
+	report MatchReport
+	err    error
+}
+
+// newSubmitResult summarizes a just-processed order (matching thread only)
+// Must be called before anything else can trade against the order once it rests.
+func newSubmitResult(order *domain.Order, trades int) SubmitResult {
+	result := SubmitResult{Trades: trades, TakenQty: order.Filled}
+	if restsAfterArrival(order) {
+		result.RestedQty = order.RemainingQuantity()
+	}
+
+	switch {
+	case result.TakenQty > 0 && result.RestedQty > 0:
+		result.Role = RoleBoth
+	case result.TakenQty > 0:
+		result.Role = RoleTaker
+	case result.RestedQty > 0:
+		result.Role = RoleMaker
+	}
+	return result
+}
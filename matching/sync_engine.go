@@ -0,0 +1,55 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"lightning-exchange/orderbook"
+)
+
+// SyncEngine is a deterministic, single-goroutine matching engine for tests
+// Every call runs the order or cancel to completion in the caller's goroutine and returns
+// its outcome directly: no ring buffer, no matching thread, so assertions need no polling.
+// It wraps a MatchingEngine that is never started and drives the same matching pipeline
+// (handleOrder), so results are identical to the asynchronous engine fed the same sequence.
+//
+// Not safe for concurrent use. Trades are returned instead of published to the trade
+// buffer; the caller owns them. Handlers that MatchingEngine installs through the
+// matching thread (OnTrade, SetL3Handler, SetRejectHandler, ...) are not available:
+// read trades and rejections from the return values and the book from GetOrderBook.
+// Only the callbacks carried by SymbolConfig (OnOrderPruned) are called.
+type SyncEngine struct {
+	engine *MatchingEngine
+}
+
+// NewSyncEngine creates a synchronous engine for symbol with the default configuration
+func NewSyncEngine(symbol string) *SyncEngine {
+	return NewSyncEngineWithConfig(symbol, DefaultSymbolConfig())
+}
+
+// NewSyncEngineWithConfig creates a synchronous engine for symbol with cfg
+func NewSyncEngineWithConfig(symbol string, cfg SymbolConfig) *SyncEngine {
+	// The buffers are never used: keep them at the minimum size
+	cfg.OrderBufferSize, cfg.TradeBufferSize = 1, 1
+	return &SyncEngine{engine: NewMatchingEngineWithConfig(symbol, cfg)}
+}
+
+// SubmitOrder matches order and returns its trades, including those of stop orders it triggered
+// Returns the rejection reason if the order was rejected.
+func (se *SyncEngine) SubmitOrder(order *domain.Order) ([]*domain.Trade, error) {
+	me := se.engine
+	me.sweepExpired()
+	trades, outcome := me.handleOrder(order, false)
+	me.current = nil
+	return trades, outcome.err
+}
+
+// CancelOrder cancels a resting or pending conditional order
+// Reports whether the order was cancelled, with the same results as MatchingEngine.CancelOrderSync.
+func (se *SyncEngine) CancelOrder(orderID string) (bool, error) {
+	se.engine.sweepExpired()
+	return se.engine.applyCancel(orderID)
+}
+
+// GetOrderBook returns the order book
+func (se *SyncEngine) GetOrderBook() orderbook.IOrderBook {
+	return se.engine.orderBook
+}
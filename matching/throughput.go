@@ -0,0 +1,197 @@
+package matching
+
+import (
+	"fmt"
+	"lightning-exchange/domain"
+	"lightning-exchange/orderbook"
+	"lightning-exchange/orderflow"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BenchConfig configures a BenchmarkThroughput run; zero fields take the listed defaults
+type BenchConfig struct {
+	Duration  time.Duration // How long producers submit (default 5s)
+	Producers int           // Submitting goroutines (default NumCPU-2, at least 1)
+
+	OrderBufferSize int // Order ring buffer slots, power of 2 (default DefaultBufferSize)
+	TradeBufferSize int // Trade ring buffer slots, power of 2 (default DefaultBufferSize)
+
+	// Flow is the order flow; producer i uses seed Flow.Seed+i, so equal configs replay
+	// the same orders (default orderflow.DefaultConfig())
+	Flow orderflow.Config
+
+	// SampleEvery submits one order in SampleEvery from producer 0 synchronously to
+	// measure submit-to-matched latency, queueing included (default 1024). The first
+	// order is always sampled, so a producer starved on a full lane still reports one
+	SampleEvery int
+
+	// Progress, if set, is called about once per second with the running totals
+	Progress func(elapsed time.Duration, orders, trades int64)
+}
+
+// BenchResult is the outcome of a BenchmarkThroughput run
+type BenchResult struct {
+	Elapsed time.Duration // From the first submit until every submitted order was processed
+	Orders  int64         // Orders and cancels submitted
+	Trades  int64         // Trades consumed from the trade buffer
+	QPS     float64       // Orders per second
+	TPS     float64       // Trades per second
+
+	// Latency of the sampled orders; percentiles are bucket upper bounds, accurate to within 25%
+	LatencySamples int64
+	LatencyP50     time.Duration
+	LatencyP99     time.Duration
+	LatencyP999    time.Duration
+	LatencyMax     time.Duration
+
+	Bids, Asks []orderbook.PriceLevel // Top 5 levels of the book at the end of the run
+}
+
+// BenchmarkThroughput runs a standardized throughput test on a fresh engine for Flow.Symbol
+// Producers submit the configured order flow as fast as the engine accepts it while a
+// consumer drains the trade buffer; after Duration the run waits until every submitted
+// order has been matched. Use it to compare builds on the same config, or to assert in CI
+// that QPS stays above a baseline. It saturates the machine for the whole Duration.
+func BenchmarkThroughput(cfg BenchConfig) BenchResult {
+	cfg = cfg.withDefaults()
+
+	symbolCfg := DefaultSymbolConfig()
+	symbolCfg.OrderBufferSize = cfg.OrderBufferSize
+	symbolCfg.TradeBufferSize = cfg.TradeBufferSize
+	engine := NewMatchingEngineWithConfig(cfg.Flow.Symbol, symbolCfg)
+	engine.Start()
+	defer engine.Stop()
+
+	var (
+		orders  atomic.Int64
+		trades  atomic.Int64
+		latency latencyHistogram // written by producer 0 only
+	)
+
+	consumerDone := make(chan struct{})
+	stopConsumer := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		consumer := engine.GetTradeBuffer().NewTradeConsumerBatchSafe()
+		for {
+			if trade, ok := consumer.TryConsume(); ok {
+				trade.Destroy()
+				trades.Add(1)
+				continue
+			}
+			select {
+			case <-stopConsumer:
+				// Every trade is published once the barrier returned; take what's left
+				for trade, ok := consumer.TryConsume(); ok; trade, ok = consumer.TryConsume() {
+					trade.Destroy()
+					trades.Add(1)
+				}
+				return
+			default:
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	start := time.Now()
+	stop := make(chan struct{})
+	var producers sync.WaitGroup
+	for w := 0; w < cfg.Producers; w++ {
+		flow := cfg.Flow
+		flow.Seed += int64(w)
+		flow.IDPrefix = fmt.Sprintf("%sw%d-", cfg.Flow.IDPrefix, w)
+		gen := orderflow.NewGenerator(flow)
+		sample := w == 0
+
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			// Stop is checked after each action, so every producer submits at least one
+			// even if it is first scheduled after Duration has run out
+			for n := 1; ; n++ {
+				action := gen.Next()
+				switch {
+				case action.Type == orderflow.ActionCancel:
+					engine.CancelOrder(action.CancelID)
+				case sample && (n-1)%cfg.SampleEvery == 0:
+					submitted := time.Now()
+					engine.SubmitOrderSync(action.Order)
+					latency.record(time.Since(submitted))
+				default:
+					engine.SubmitOrder(action.Order)
+				}
+				orders.Add(1)
+
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+		}()
+	}
+
+	if cfg.Progress != nil {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					cfg.Progress(time.Since(start), orders.Load(), trades.Load())
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(cfg.Duration)
+	close(stop)
+	producers.Wait()
+
+	// Barrier: a non-marketable order queued behind everything submitted so far
+	engine.SubmitOrderSync(domain.NewLimitOrder("bench-barrier", cfg.Flow.Symbol, "bench", domain.SideBuy, 1, 1))
+	engine.CancelOrderSync("bench-barrier")
+	elapsed := time.Since(start)
+
+	close(stopConsumer)
+	<-consumerDone
+
+	result := BenchResult{
+		Elapsed:        elapsed,
+		Orders:         orders.Load(),
+		Trades:         trades.Load(),
+		LatencySamples: latency.count.Load(),
+		LatencyP50:     latency.quantile(0.50),
+		LatencyP99:     latency.quantile(0.99),
+		LatencyP999:    latency.quantile(0.999),
+		LatencyMax:     time.Duration(latency.max.Load()),
+	}
+	result.QPS = float64(result.Orders) / elapsed.Seconds()
+	result.TPS = float64(result.Trades) / elapsed.Seconds()
+	engine.WithFrozenView(func(book orderbook.ReadOnlyBook) {
+		result.Bids, result.Asks = book.GetDepth(5)
+	})
+	return result
+}
+
+// withDefaults fills in the zero fields of a BenchConfig
+func (cfg BenchConfig) withDefaults() BenchConfig {
+	if cfg.Duration <= 0 {
+		cfg.Duration = 5 * time.Second
+	}
+	if cfg.Producers <= 0 {
+		cfg.Producers = max(runtime.NumCPU()-2, 1) // 1 for the matching thread, 1 for the system/GC
+	}
+	if cfg.Flow == (orderflow.Config{}) {
+		cfg.Flow = orderflow.DefaultConfig()
+	}
+	if cfg.SampleEvery <= 0 {
+		cfg.SampleEvery = 1024
+	}
+	return cfg
+}
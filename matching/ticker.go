@@ -0,0 +1,92 @@
+package matching
+
+import (
+	"lightning-exchange/domain"
+	"time"
+)
+
+// Ticker is a point-in-time view of a symbol's session statistics
+type Ticker struct {
+	Symbol       string
+	SessionStart time.Time // When the current session's stats started accumulating
+	LastPrice    int64
+	High         int64
+	Low          int64
+	Volume       int64 // Base quantity traded this session
+	QuoteVolume  int64 // Sum of price * quantity this session
+	VWAP         int64 // QuoteVolume / Volume (0 if no trades)
+	TradeCount   int64
+}
+
+// sessionStats accumulates per-session trade statistics
+// Written only by the matching thread; guarded by MatchingEngine.statsMu for readers
+type sessionStats struct {
+	sessionStart time.Time
+	lastPrice    int64
+	high         int64
+	low          int64
+	volume       int64
+	quoteVolume  int64
+	tradeCount   int64
+}
+
+// recordTrades folds a batch of trades into the session stats
+// Runs in the matching goroutine; the lock is taken once per batch, not per trade
+func (me *MatchingEngine) recordTrades(trades []*domain.Trade) {
+	if len(trades) == 0 {
+		return
+	}
+
+	me.statsMu.Lock()
+	s := &me.stats
+	for _, trade := range trades {
+		if s.tradeCount == 0 || trade.Price > s.high {
+			s.high = trade.Price
+		}
+		if s.tradeCount == 0 || trade.Price < s.low {
+			s.low = trade.Price
+		}
+		s.lastPrice = trade.Price
+		s.volume += trade.Quantity
+		s.quoteVolume += trade.Price * trade.Quantity
+		s.tradeCount++
+	}
+	me.statsMu.Unlock()
+}
+
+// ResetSessionStats zeroes the session high/low/volume/VWAP accumulators at a session rollover
+// The order book is left untouched: resting orders survive the rollover.
+// The reset is executed on the matching thread so it never splits a batch of trades.
+// It takes effect asynchronously but before the next order: control commands are
+// serviced ahead of the order buffer (see CancelOrder), so trades of orders submitted
+// before the call but not yet processed count towards the new session.
+func (me *MatchingEngine) ResetSessionStats() {
+	me.runOnMatchingThread(func() {
+		me.statsMu.Lock()
+		me.stats = sessionStats{sessionStart: me.now()}
+		me.statsMu.Unlock()
+	})
+}
+
+// GetTicker returns a snapshot of the current session statistics
+// Safe to call from any goroutine
+func (me *MatchingEngine) GetTicker() Ticker {
+	me.statsMu.Lock()
+	s := me.stats
+	me.statsMu.Unlock()
+
+	ticker := Ticker{
+		Symbol:       me.symbol,
+		SessionStart: s.sessionStart,
+		LastPrice:    s.lastPrice,
+		High:         s.high,
+		Low:          s.low,
+		Volume:       s.volume,
+		QuoteVolume:  s.quoteVolume,
+		TradeCount:   s.tradeCount,
+	}
+	if s.volume > 0 {
+		ticker.VWAP = s.quoteVolume / s.volume
+	}
+	return ticker
+}
@@ -2,6 +2,7 @@ package matching
 
 import (
 	"lightning-exchange/domain"
+	"runtime"
 	"sync/atomic"
 	_ "unsafe" // for go:linkname
 )
@@ -13,8 +14,12 @@ func semacquireTradeSafe(s *uint32)
 func semreleaseTradeSafe(s *uint32, handoff bool, skipframes int)
 
 // TradeRingBufferBatchSafe 批量读取 + 纯 semaphore 语义的 Trade RingBuffer
+// 与订单 RingBuffer 相同，每个槽位另有发布序号 published 绑定读写（见 RingBufferSemaphoreBatchSafe）：
+// fullSlots 只保证数量，且 runtime semaphore 对 race detector 不可见，
+// published 的 release/acquire 让槽位的写入与读取之间有可检查的 happens-before。
 type TradeRingBufferBatchSafe struct {
 	buffer     []*domain.Trade
+	published  []atomic.Int64 // 每个槽位的发布序号：seq+1 已写入，-(seq+1) 已读走，0 从未使用
 	mask       int64
 	writeSeq   atomic.Int64
 	readSeq    atomic.Int64
@@ -28,6 +33,7 @@ type TradeConsumerBatchSafe struct {
 	localCache [128]*domain.Trade
 	cacheStart int
 	cacheEnd   int
+	cached     atomic.Int64 // cacheEnd - cacheStart，供其他 goroutine 无锁读取（Lag）
 }
 
 // NewTradeRingBufferBatchSafe 创建 Trade RingBuffer
@@ -38,6 +44,7 @@ func NewTradeRingBufferBatchSafe(size int) *TradeRingBufferBatchSafe {
 
 	rb := &TradeRingBufferBatchSafe{
 		buffer:     make([]*domain.Trade, size),
+		published:  make([]atomic.Int64, size),
 		mask:       int64(size - 1),
 		emptySlots: 0,
 		fullSlots:  0,
@@ -59,23 +66,88 @@ func (rb *TradeRingBufferBatchSafe) NewTradeConsumerBatchSafe() *TradeConsumerBa
 	}
 }
 
+// writeSlot 写入已领取的写序号 seq：等上一圈的 Trade 被读走，写完再发布序号
+func (rb *TradeRingBufferBatchSafe) writeSlot(seq int64, trade *domain.Trade) {
+	index := seq & rb.mask
+	var prev int64
+	if size := int64(len(rb.buffer)); seq >= size {
+		prev = -(seq - size + 1)
+	}
+	for rb.published[index].Load() != prev {
+		runtime.Gosched()
+	}
+	rb.buffer[index] = trade
+	rb.published[index].Store(seq + 1)
+}
+
+// readSlot 读取已领取的读序号 seq：等本槽位的发布序号，读完标记为已读走
+func (rb *TradeRingBufferBatchSafe) readSlot(seq int64) *domain.Trade {
+	index := seq & rb.mask
+	for rb.published[index].Load() != seq+1 {
+		runtime.Gosched()
+	}
+	trade := rb.buffer[index]
+	rb.buffer[index] = nil
+	rb.published[index].Store(-(seq + 1))
+	return trade
+}
+
 // Publish 发布 Trade
 func (rb *TradeRingBufferBatchSafe) Publish(trade *domain.Trade) {
 	semacquireTradeSafe(&rb.emptySlots)
 
-	seq := rb.writeSeq.Add(1) - 1
-	index := seq & rb.mask
-	rb.buffer[index] = trade
+	rb.writeSlot(rb.writeSeq.Add(1)-1, trade)
+
+	semreleaseTradeSafe(&rb.fullSlots, false, 0)
+}
+
+// PublishBatch 批量发布一组 Trade（一次扫过多个档位产生的成交）
+// 空位足够时用一次 CAS 取得全部 emptySlots，并一次性推进 writeSeq、释放 fullSlots，
+// 把每笔成交两次 semaphore 操作降为每批一次；空位不足时退化为逐个 semacquire（阻塞）。
+// 仅支持单生产者（撮合线程），与 Publish 不能并发调用。
+func (rb *TradeRingBufferBatchSafe) PublishBatch(trades []*domain.Trade) {
+	n := len(trades)
+	if n == 0 {
+		return
+	}
+	if n == 1 || !tryAcquireN(&rb.emptySlots, uint32(n)) {
+		for _, trade := range trades {
+			rb.Publish(trade)
+		}
+		return
+	}
 
+	seq := rb.writeSeq.Add(int64(n)) - int64(n)
+	for i, trade := range trades {
+		rb.writeSlot(seq+int64(i), trade)
+	}
+
+	// 消费者只用 CAS 读取 fullSlots，不会在其上休眠：直接加 n-1，
+	// 最后一个仍走 semrelease，保留唤醒语义
+	atomic.AddUint32(&rb.fullSlots, uint32(n-1))
 	semreleaseTradeSafe(&rb.fullSlots, false, 0)
 }
 
+// tryAcquireN 非阻塞地一次获取 n 个 semaphore 令牌（不足 n 个时不获取任何令牌）
+func tryAcquireN(s *uint32, n uint32) bool {
+	for {
+		v := atomic.LoadUint32(s)
+		if v < n {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(s, v, v-n) {
+			return true
+		}
+	}
+}
+
 // TryConsume 非阻塞消费（用于测试中的 trade consumer）
 func (cb *TradeConsumerBatchSafe) TryConsume() (*domain.Trade, bool) {
 	// 如果本地缓存还有数据，直接返回
 	if cb.cacheStart < cb.cacheEnd {
 		trade := cb.localCache[cb.cacheStart]
 		cb.cacheStart++
+		cb.cached.Store(int64(cb.cacheEnd - cb.cacheStart))
 		return trade, true
 	}
 
@@ -86,9 +158,49 @@ func (cb *TradeConsumerBatchSafe) TryConsume() (*domain.Trade, bool) {
 
 	trade := cb.localCache[cb.cacheStart]
 	cb.cacheStart++
+	cb.cached.Store(int64(cb.cacheEnd - cb.cacheStart))
 	return trade, true
 }
 
+// ConsumeBatch 非阻塞批量消费，最多返回 max 个 Trade（用于网关按批次组帧推送）
+// 优先返回本地缓存中的数据；缓存为空时尝试一次非阻塞填充，不会等待凑满批次
+// 没有可用数据时返回 nil
+//
+// 所有权：返回的 Trade 来自 tradePool，调用方取得所有权，
+// 使用完毕（例如写入网络后）必须逐个调用 Destroy() 归还对象池，
+// 归还后不得再持有或访问。返回的切片本身是新分配的，可以安全保留
+func (cb *TradeConsumerBatchSafe) ConsumeBatch(max int) []*domain.Trade {
+	if max <= 0 {
+		return nil
+	}
+
+	// 本地缓存耗尽，尝试批量读取（非阻塞）
+	if cb.cacheStart >= cb.cacheEnd && !cb.tryFillCache() {
+		return nil
+	}
+
+	n := cb.cacheEnd - cb.cacheStart
+	if n > max {
+		n = max
+	}
+
+	trades := make([]*domain.Trade, n)
+	copy(trades, cb.localCache[cb.cacheStart:cb.cacheStart+n])
+	cb.cacheStart += n
+	cb.cached.Store(int64(cb.cacheEnd - cb.cacheStart))
+	return trades
+}
+
+// Lag 返回已发布但尚未被该消费者取走的 Trade 数量（非阻塞，可在任意 goroutine 调用）
+// = 环形缓冲区中未读取的数量（writeSeq - readSeq）+ 该消费者本地缓存中尚未返回的数量
+// 用于监控慢消费者：Lag 持续接近缓冲区容量时，撮合线程的 Publish 即将阻塞。
+// 多个消费者共享同一个缓冲区时，未读取部分会计入每个消费者。
+// 各计数分别原子读取，并发消费时结果是近似值。
+func (cb *TradeConsumerBatchSafe) Lag() int64 {
+	rb := cb.rb
+	return rb.writeSeq.Load() - rb.readSeq.Load() + cb.cached.Load()
+}
+
 // tryFillCache 非阻塞批量填充
 func (cb *TradeConsumerBatchSafe) tryFillCache() bool {
 	rb := cb.rb
@@ -123,9 +235,7 @@ func (cb *TradeConsumerBatchSafe) tryFillCache() bool {
 		}
 
 		// 读取数据
-		seq := rb.readSeq.Add(1) - 1
-		index := seq & rb.mask
-		cb.localCache[acquired] = rb.buffer[index]
+		cb.localCache[acquired] = rb.readSlot(rb.readSeq.Add(1) - 1)
 
 		// 释放空位
 		semreleaseTradeSafe(&rb.emptySlots, false, 0)
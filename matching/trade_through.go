@@ -0,0 +1,93 @@
+package matching
+
+import "lightning-exchange/domain"
+
+// TradeThroughPolicy selects how an aggressor that would trade through the protected quote is handled
+type TradeThroughPolicy int
+
+const (
+	// TradeThroughReject rejects the whole order with ErrTradeThrough (default)
+	// Nothing executes: the sender is expected to route to the better-priced venue first.
+	// Only orders that would actually print through the protected price are rejected; a
+	// marketable order fully filled at or inside it is accepted as usual.
+	TradeThroughReject TradeThroughPolicy = iota
+
+	// TradeThroughSlide reprices the aggressor to the protected price and lets it match
+	// A limit order's price is clamped to the protected ask (buys) or bid (sells) and any
+	// remainder rests there, locking the away market; a market order becomes an IOC limit
+	// at the protected price, so its remainder is cancelled. Prefer reject where locked
+	// markets are not allowed.
+	TradeThroughSlide
+)
+
+// SetProtectedQuote sets the externally supplied protected best bid and offer (e.g. the NBBO)
+// Aggressors are then not allowed to execute at a price worse than the protected quote:
+// buys above ask, sells below bid. A zero price disables protection on that side, so
+// SetProtectedQuote(0, 0) turns it off (the default). What happens to an order that would
+// trade through is set by SymbolConfig.TradeThrough. Runs on the matching thread ahead of
+// any order submitted after it returns.
+func (me *MatchingEngine) SetProtectedQuote(bid, ask int64) {
+	me.runOnMatchingThread(func() {
+		me.protectedBid, me.protectedAsk = bid, ask
+	})
+}
+
+// protectTradeThrough applies the trade-through policy to an aggressor (matching thread only)
+// Returns ErrTradeThrough if the order is rejected; under TradeThroughSlide it may reprice it.
+func (me *MatchingEngine) protectTradeThrough(order *domain.Order) error {
+	protected, opposite := me.protectedAsk, domain.SideSell
+	if order.Side == domain.SideSell {
+		protected, opposite = me.protectedBid, domain.SideBuy
+	}
+	if protected <= 0 {
+		return nil
+	}
+	isMarket := order.Type == domain.OrderTypeMarket
+	if !isMarket && !me.throughProtected(order.Side, order.Price, protected) {
+		return nil
+	}
+
+	if me.tradeThrough == TradeThroughSlide {
+		if isMarket {
+			order.Type = domain.OrderTypeLimit
+			order.TimeInForce = domain.TimeInForceIOC
+		}
+		order.Price = protected
+		return nil
+	}
+
+	// Walk the levels the order would consume; it trades through if it reaches one
+	// priced worse than the protected quote before it is filled
+	remaining := order.RemainingQuantity()
+	for level := range me.orderBook.Levels(opposite) {
+		if !isMarket && !me.reaches(order, level.Price) {
+			break
+		}
+		if me.throughProtected(order.Side, level.Price, protected) {
+			return ErrTradeThrough
+		}
+		if remaining -= level.Volume; remaining <= 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// throughProtected reports whether executing at price is worse for side than the protected price
+func (me *MatchingEngine) throughProtected(side domain.Side, price, protected int64) bool {
+	if price == protected {
+		return false
+	}
+	if side == domain.SideBuy {
+		return me.orderBook.Crosses(price, protected)
+	}
+	return me.orderBook.Crosses(protected, price)
+}
+
+// reaches reports whether a limit order's price is marketable against an opposite level price
+func (me *MatchingEngine) reaches(order *domain.Order, price int64) bool {
+	if order.Side == domain.SideBuy {
+		return me.orderBook.Crosses(order.Price, price)
+	}
+	return me.orderBook.Crosses(price, order.Price)
+}
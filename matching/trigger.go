@@ -0,0 +1,168 @@
+package matching
+
+import (
+	"container/heap"
+	"lightning-exchange/domain"
+	"sync/atomic"
+)
+
+// Conditional orders (stop and market-if-touched) rest off-book until the last trade
+// price reaches their TriggerPrice, then enter matching as market orders.
+// Pending orders are invisible to market data: they never appear in depth, BBO or the
+// L3 feed, and show up only as the trades (and book changes) they cause once triggered.
+//
+// The two types differ only in trigger direction:
+//
+//	            Buy                      Sell
+//	Stop        last >= trigger (rises)  last <= trigger (falls)
+//	MIT         last <= trigger (falls)  last >= trigger (rises)
+//
+// so a pending order waits either for the price to rise to its trigger or to fall to it.
+
+// triggerEntry is a pending conditional order; trigger and seq are copied so a
+// recycled (pooled) order can't corrupt heap ordering
+type triggerEntry struct {
+	order   *domain.Order
+	trigger int64
+	seq     int64 // arrival order, breaks ties between equal triggers (FIFO)
+}
+
+// triggerHeap orders pending orders by how soon the price reaches them
+// rising: lowest trigger first; falling: highest trigger first
+type triggerHeap struct {
+	entries []triggerEntry
+	rising  bool
+}
+
+func (h *triggerHeap) Len() int { return len(h.entries) }
+func (h *triggerHeap) Less(i, j int) bool {
+	a, b := h.entries[i], h.entries[j]
+	if a.trigger != b.trigger {
+		return (a.trigger < b.trigger) == h.rising
+	}
+	return a.seq < b.seq
+}
+func (h *triggerHeap) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *triggerHeap) Push(x any)    { h.entries = append(h.entries, x.(triggerEntry)) }
+func (h *triggerHeap) Pop() any {
+	n := len(h.entries)
+	entry := h.entries[n-1]
+	h.entries[n-1] = triggerEntry{}
+	h.entries = h.entries[:n-1]
+	return entry
+}
+
+// triggerBook holds pending conditional orders (matching thread only)
+// Cancelled orders are dropped from pending and skipped lazily when popped.
+type triggerBook struct {
+	rising  triggerHeap              // fire when last >= trigger: buy stops, sell MITs
+	falling triggerHeap              // fire when last <= trigger: sell stops, buy MITs
+	pending map[string]*domain.Order // order ID -> pending order
+	seq     int64
+	size    atomic.Int64 // len(pending), readable from any goroutine
+}
+
+func newTriggerBook() *triggerBook {
+	return &triggerBook{
+		rising:  triggerHeap{rising: true},
+		falling: triggerHeap{rising: false},
+		pending: make(map[string]*domain.Order),
+	}
+}
+
+// isConditional reports whether an order waits for a trigger before matching
+func isConditional(order *domain.Order) bool {
+	return order.Type == domain.OrderTypeStop || order.Type == domain.OrderTypeMIT
+}
+
+// firesOnRise reports whether an order triggers when the price rises to its trigger
+func firesOnRise(order *domain.Order) bool {
+	return (order.Type == domain.OrderTypeStop) == (order.Side == domain.SideBuy)
+}
+
+// isTriggered reports whether lastPrice satisfies the order's trigger condition
+// No trade yet (lastPrice 0) never triggers.
+func isTriggered(order *domain.Order, lastPrice int64) bool {
+	if lastPrice == 0 {
+		return false
+	}
+	if firesOnRise(order) {
+		return lastPrice >= order.TriggerPrice
+	}
+	return lastPrice <= order.TriggerPrice
+}
+
+// add parks a conditional order until triggered
+func (tb *triggerBook) add(order *domain.Order) {
+	tb.seq++
+	entry := triggerEntry{order: order, trigger: order.TriggerPrice, seq: tb.seq}
+	if firesOnRise(order) {
+		heap.Push(&tb.rising, entry)
+	} else {
+		heap.Push(&tb.falling, entry)
+	}
+	tb.pending[order.ID] = order
+	tb.size.Store(int64(len(tb.pending)))
+}
+
+// cancel removes a pending conditional order; returns false if orderID isn't pending
+func (tb *triggerBook) cancel(orderID string) bool {
+	order, ok := tb.pending[orderID]
+	if !ok {
+		return false
+	}
+	delete(tb.pending, orderID)
+	tb.size.Store(int64(len(tb.pending)))
+	order.Cancel()
+	return true
+}
+
+// next pops the next order triggered by lastPrice (nil if none)
+// Orders whose trigger is reached first by the price move fire first; ties in arrival order.
+func (tb *triggerBook) next(lastPrice int64) *domain.Order {
+	if lastPrice == 0 || len(tb.pending) == 0 {
+		return nil
+	}
+	for _, h := range []*triggerHeap{&tb.rising, &tb.falling} {
+		for h.Len() > 0 {
+			top := h.entries[0]
+			if tb.pending[top.order.ID] != top.order || top.order.TriggerPrice != top.trigger {
+				heap.Pop(h) // cancelled (or recycled) since it was parked
+				continue
+			}
+			if (h.rising && lastPrice < top.trigger) || (!h.rising && lastPrice > top.trigger) {
+				break
+			}
+			heap.Pop(h)
+			delete(tb.pending, top.order.ID)
+			tb.size.Store(int64(len(tb.pending)))
+			return top.order
+		}
+	}
+	return nil
+}
+
+// PendingStopCount returns how many stop and MIT orders are waiting for their trigger
+// Lock-free and safe to call from any goroutine (for monitoring); the count is exact as
+// of the last order the matching thread processed.
+func (me *MatchingEngine) PendingStopCount() int {
+	return int(me.triggers.size.Load())
+}
+
+// fireTriggers feeds conditional orders triggered by the latest trades into matching
+// Runs right after the order that moved the price, before the next queued order, so
+// triggered orders execute in causal order. Trades from triggered orders can move the
+// price further and trigger more orders (cascade); all resulting trades are appended.
+func (me *MatchingEngine) fireTriggers(trades []*domain.Trade) []*domain.Trade {
+	for !me.halted {
+		order := me.triggers.next(me.lastTradePrice)
+		if order == nil {
+			return trades
+		}
+		order.Type = domain.OrderTypeMarket
+		triggered, _ := me.processOrder(order)
+		trades = append(trades, triggered...)
+	}
+	// Halted (e.g. by the circuit breaker): the rest stay pending until trading resumes
+	return trades
+}
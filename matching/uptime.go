@@ -0,0 +1,49 @@
+package matching
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// loopStats tracks matching-loop liveness for SLA reporting (see Health and Metrics)
+// Written by the matching thread, read from any goroutine. Times are UnixNano on the
+// engine clock, 0 = not yet. A stalled loop freezes lastOrderAt and iterations while
+// Health, which doesn't go through the matching thread, keeps answering.
+// In simulation mode the clock reads the zero time until the first timestamped order;
+// nothing is recorded until then, and the start time is that of the first order.
+type loopStats struct {
+	startedAt   atomic.Int64 // When Start was called (or the first order, see above)
+	lastOrderAt atomic.Int64 // When the matching loop last finished an order
+	iterations  atomic.Int64 // Matching-loop iterations: orders, cancels, commands and wake-ups
+	orders      atomic.Int64 // Orders processed by the matching loop, rejected ones included
+}
+
+// start records the start time, unless the clock has not started yet
+func (ls *loopStats) start(now time.Time) {
+	if !now.IsZero() {
+		ls.startedAt.Store(now.UnixNano())
+	}
+}
+
+// orderDone records an order the matching loop finished processing
+func (ls *loopStats) orderDone(now time.Time) {
+	ls.orders.Add(1)
+	if now.IsZero() {
+		return
+	}
+	ls.lastOrderAt.Store(now.UnixNano())
+	if ls.startedAt.Load() == 0 {
+		ls.startedAt.Store(now.UnixNano())
+	}
+}
+
+// fillHealth adds the liveness fields to a Health snapshot
+func (ls *loopStats) fillHealth(health *EngineHealth, now time.Time) {
+	if started := ls.startedAt.Load(); started != 0 {
+		health.StartedAt = time.Unix(0, started)
+		health.Uptime = now.Sub(health.StartedAt)
+	}
+	if last := ls.lastOrderAt.Load(); last != 0 {
+		health.LastProcessedAt = time.Unix(0, last)
+	}
+}
@@ -0,0 +1,208 @@
+package matching
+
+import (
+	"errors"
+	"lightning-exchange/domain"
+)
+
+var (
+	// ErrOffTick is returned for a limit price that is not a multiple of the symbol's tick size
+	ErrOffTick = errors.New("price is not a multiple of the tick size")
+
+	// ErrTooManyOpenOrders is returned for a non-marketable limit order that would exceed the
+	// user's resting-order cap
+	ErrTooManyOpenOrders = errors.New("too many open orders")
+
+	// ErrWrongSymbol is returned for an order whose Symbol doesn't match the engine's symbol
+	ErrWrongSymbol = errors.New("order symbol does not match engine")
+
+	// ErrOrderDropped is reported for an order discarded by OverflowDropOldest before matching
+	ErrOrderDropped = errors.New("order dropped: order buffer full")
+
+	// ErrBeyondBookDepth is returned for a limit order that would rest past the book's depth limit
+	ErrBeyondBookDepth = errors.New("price beyond book depth")
+
+	// ErrMinRestTimeNotMet is returned for a cancel of an order younger than the symbol's MinRestTime
+	ErrMinRestTimeNotMet = errors.New("order has not rested for the minimum time")
+
+	// ErrTradingHalted is returned for an order submitted while the engine is halted
+	ErrTradingHalted = errors.New("trading halted")
+
+	// ErrPostOnlyWouldTrade is returned for a post-only order that would take liquidity on arrival
+	ErrPostOnlyWouldTrade = errors.New("post-only order would trade")
+
+	// ErrTradeThrough is returned for an order that would execute worse than the protected quote
+	ErrTradeThrough = errors.New("order would trade through the protected quote")
+
+	// ErrInvalidIceberg is returned for an iceberg with a bad display range or incompatible instructions
+	ErrInvalidIceberg = errors.New("invalid iceberg display quantity")
+
+	// ErrOutsidePriceBand is returned for a limit price too far from the price band's reference
+	ErrOutsidePriceBand = errors.New("price outside the price band")
+
+	// ErrDuplicateOrderID is returned for an order whose ID is already resting or pending as a
+	// stop / MIT order; accepting it would orphan the first order. IDs of finished orders may be reused.
+	ErrDuplicateOrderID = errors.New("duplicate order ID")
+
+	// ErrTopLevelOnlyLimit is returned for a limit order carrying ExecTopLevelOnly (market orders only)
+	ErrTopLevelOnlyLimit = errors.New("top-level-only applies to market orders")
+)
+
+// SetRejectHandler installs a callback notified of every rejected order
+// The handler runs ON THE MATCHING THREAD and must not block.
+func (me *MatchingEngine) SetRejectHandler(handler func(order *domain.Order, err error)) {
+	me.runOnMatchingThread(func() {
+		me.onReject = handler
+	})
+}
+
+// checkOrder validates (and, where configured, normalizes) an incoming order
+// Runs in the matching goroutine before the order can match
+func (me *MatchingEngine) checkOrder(order *domain.Order) error {
+	// Safety net for direct MatchingEngine users: never match a misrouted order
+	if order.Symbol != me.symbol {
+		return ErrWrongSymbol
+	}
+	if me.orderBook.GetOrder(order.ID) != nil || me.triggers.pending[order.ID] != nil {
+		return ErrDuplicateOrderID
+	}
+	if me.halted && me.isHalted() {
+		return ErrTradingHalted
+	}
+	if order.IsPostOnly() && (order.Type == domain.OrderTypeMarket || me.isMarketable(order)) {
+		return ErrPostOnlyWouldTrade
+	}
+	if order.IsTopLevelOnly() && order.Type == domain.OrderTypeLimit {
+		return ErrTopLevelOnlyLimit
+	}
+	if (order.DisplayQty != 0 || order.DisplayQtyMax != 0) && !validIceberg(order) {
+		return ErrInvalidIceberg
+	}
+	if me.tickSize > 0 && order.Type == domain.OrderTypeLimit && order.Price%me.tickSize != 0 {
+		if me.tickPolicy != TickSnap {
+			return ErrOffTick
+		}
+		order.Price = snapToTick(order.Price, me.tickSize, order.Side)
+		if order.Price <= 0 {
+			return ErrOffTick
+		}
+	}
+	if me.priceBand.MaxDeviationBps > 0 && order.Type == domain.OrderTypeLimit && me.outsidePriceBand(order.Price) {
+		return ErrOutsidePriceBand
+	}
+	// A non-marketable order that would open a level past the kept depth is rejected
+	if order.Type == domain.OrderTypeLimit && me.orderBook.MaxDepth() > 0 &&
+		!me.isMarketable(order) && me.orderBook.BeyondDepth(order.Side, order.Price) {
+		return ErrBeyondBookDepth
+	}
+	// The cap limits resting orders: an order that can only rest is rejected up front, one
+	// that may trade is let through and its remainder cancelled instead of resting (processOrder)
+	if order.Type == domain.OrderTypeLimit && order.TimeInForce != domain.TimeInForceIOC &&
+		!me.isMarketable(order) && me.atOpenOrderCap(order.UserID) {
+		return ErrTooManyOpenOrders
+	}
+	return nil
+}
+
+// atOpenOrderCap reports whether userID already holds MaxOpenOrdersPerUser resting orders
+func (me *MatchingEngine) atOpenOrderCap(userID string) bool {
+	return me.maxOpenOrders > 0 && me.orderBook.OpenOrderCount(userID) >= me.maxOpenOrders
+}
+
+// isMarketable reports whether a limit order would trade on arrival
+func (me *MatchingEngine) isMarketable(order *domain.Order) bool {
+	if order.Side == domain.SideBuy {
+		bestAsk := me.orderBook.GetBestAsk()
+		return bestAsk != 0 && me.orderBook.Crosses(order.Price, bestAsk)
+	}
+	bestBid := me.orderBook.GetBestBid()
+	return bestBid != 0 && me.orderBook.Crosses(bestBid, order.Price)
+}
+
+// fillableNow reports whether the book holds enough marketable liquidity to fill the order completely
+// Counts all resting volume the order's price reaches, hidden orders included; last-look
+// vetoes and self-trade prevention can still leave a remainder.
+func (me *MatchingEngine) fillableNow(order *domain.Order) bool {
+	opposite := domain.SideSell
+	if order.Side == domain.SideSell {
+		opposite = domain.SideBuy
+	}
+	remaining := order.RemainingQuantity()
+	for level := range me.orderBook.Levels(opposite) {
+		if order.Type == domain.OrderTypeLimit && !me.reaches(order, level.Price) {
+			break
+		}
+		if remaining -= level.Volume; remaining <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fillableAtTop reports whether the best opposite level alone can fill the order completely
+// Returns the level's price as well, 0 if that side is empty.
+func (me *MatchingEngine) fillableAtTop(order *domain.Order) (bool, int64) {
+	best := me.orderBook.GetBestSellLevel()
+	if order.Side == domain.SideSell {
+		best = me.orderBook.GetBestBuyLevel()
+	}
+	if best == nil {
+		return false, 0
+	}
+	return best.Volume >= order.RemainingQuantity(), best.Price
+}
+
+// snapToTick rounds price to a multiple of tick toward the less aggressive side
+// Buys round down (never bid more than entered), sells round up (never offer for less)
+func snapToTick(price, tick int64, side domain.Side) int64 {
+	floor := price - price%tick
+	if price%tick < 0 {
+		floor -= tick
+	}
+	if side == domain.SideBuy || floor == price {
+		return floor
+	}
+	return floor + tick
+}
+
+// orderDropped handles an order discarded from a full buffer (runs on the submitting goroutine)
+// The order never reached the matching thread, so it is safe to update here.
+func (me *MatchingEngine) orderDropped(order *domain.Order) {
+	if me.sim != nil {
+		if done, ok := me.timeMarkers.LoadAndDelete(order); ok {
+			done.(chan error) <- ErrOrderDropped
+			return
+		}
+	}
+	order.Status = domain.OrderStatusRejected
+	if me.syncWaiters.Load() > 0 {
+		if done, ok := me.syncDone.LoadAndDelete(order); ok {
+			done.(chan syncOutcome) <- syncOutcome{err: ErrOrderDropped}
+		}
+	}
+	if me.onDropped != nil {
+		me.onDropped(order)
+	}
+}
+
+// orderPruned handles a resting order cancelled by MaxBookDepth pruning (matching thread only)
+// The owner had the order accepted, so the cancel is logged and reported rather than silent.
+func (me *MatchingEngine) orderPruned(order *domain.Order) {
+	if me.logger != nil {
+		me.logOrderPruned(order)
+	}
+	if me.onPruned != nil {
+		me.onPruned(order)
+	}
+}
+
+// rejectOrder marks an order rejected and notifies the reject handler
+func (me *MatchingEngine) rejectOrder(order *domain.Order, err error) {
+	order.Status = domain.OrderStatusRejected
+	if me.logger != nil {
+		me.logOrderRejected(order, err)
+	}
+	if me.onReject != nil {
+		me.onReject(order, err)
+	}
+}
@@ -0,0 +1,162 @@
+package orderbook
+
+// AuctionTieBreak is one rule for choosing among candidate auction clearing prices
+// that all maximize executable volume
+type AuctionTieBreak int
+
+const (
+	// TieBreakMinImbalance prefers the price leaving the smallest |buy - sell| surplus
+	TieBreakMinImbalance AuctionTieBreak = iota
+
+	// TieBreakNearestReference prefers the price closest to the reference (e.g. last) price
+	TieBreakNearestReference
+
+	// TieBreakLowerPrice prefers the lowest price
+	TieBreakLowerPrice
+
+	// TieBreakHigherPrice prefers the highest price
+	TieBreakHigherPrice
+)
+
+// AuctionPolicy lists the tie-break rules applied in order after volume maximization
+// Rules are applied until a single price remains; if several still tie, the lowest wins
+// so the result is always deterministic.
+type AuctionPolicy struct {
+	TieBreaks []AuctionTieBreak
+}
+
+// DefaultAuctionPolicy: maximize volume, then minimize imbalance,
+// then nearest to the reference price, then the lower price
+func DefaultAuctionPolicy() AuctionPolicy {
+	return AuctionPolicy{
+		TieBreaks: []AuctionTieBreak{TieBreakMinImbalance, TieBreakNearestReference, TieBreakLowerPrice},
+	}
+}
+
+// AuctionResult is the outcome of an auction price calculation
+type AuctionResult struct {
+	Price         int64 // Clearing price (0 if the book does not cross)
+	MatchedVolume int64 // Volume executable at Price
+	Imbalance     int64 // Buy volume - sell volume at Price (positive = buy surplus)
+	Candidates    int   // Prices that maximized volume before tie-breaking
+}
+
+// auctionCandidate is the executable volume at one candidate price
+type auctionCandidate struct {
+	price     int64
+	matched   int64
+	imbalance int64
+}
+
+// ComputeAuctionPrice finds the uncrossing price of the book for an opening/closing auction
+// The clearing price maximizes executable volume; remaining ties are broken by policy,
+// using referencePrice (typically the last or previous close price) for TieBreakNearestReference.
+// Candidate prices are every price level present on either side.
+// Performance: O(n) in the number of price levels; not a hot path
+func (ob *OrderBook) ComputeAuctionPrice(policy AuctionPolicy, referencePrice int64) AuctionResult {
+	bids := ob.bids.GetDepth(ob.bids.Size()) // best (highest) first
+	asks := ob.asks.GetDepth(ob.asks.Size()) // best (lowest) first
+	if len(bids) == 0 || len(asks) == 0 || bids[0].Price < asks[0].Price {
+		return AuctionResult{}
+	}
+
+	// Only prices inside the crossed range [best ask, best bid] can execute volume
+	prices := make([]int64, 0, len(bids)+len(asks))
+	for _, level := range bids {
+		if level.Price >= asks[0].Price {
+			prices = append(prices, level.Price)
+		}
+	}
+	for _, level := range asks {
+		if level.Price <= bids[0].Price {
+			prices = append(prices, level.Price)
+		}
+	}
+
+	var candidates []auctionCandidate
+	for _, price := range prices {
+		var buyVolume, sellVolume int64
+		for _, level := range bids {
+			if level.Price < price {
+				break
+			}
+			buyVolume += level.Volume
+		}
+		for _, level := range asks {
+			if level.Price > price {
+				break
+			}
+			sellVolume += level.Volume
+		}
+
+		c := auctionCandidate{price: price, matched: min(buyVolume, sellVolume), imbalance: buyVolume - sellVolume}
+		if len(candidates) > 0 && c.matched < candidates[0].matched {
+			continue
+		}
+		if len(candidates) > 0 && c.matched > candidates[0].matched {
+			candidates = candidates[:0]
+		}
+		if !containsPrice(candidates, price) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	result := AuctionResult{Candidates: len(candidates)}
+	for _, rule := range policy.TieBreaks {
+		if len(candidates) == 1 {
+			break
+		}
+		candidates = applyTieBreak(candidates, rule, referencePrice)
+	}
+	candidates = applyTieBreak(candidates, TieBreakLowerPrice, referencePrice)
+
+	best := candidates[0]
+	result.Price = best.price
+	result.MatchedVolume = best.matched
+	result.Imbalance = best.imbalance
+	return result
+}
+
+// applyTieBreak keeps only the candidates that score best under rule
+func applyTieBreak(candidates []auctionCandidate, rule AuctionTieBreak, referencePrice int64) []auctionCandidate {
+	score := func(c auctionCandidate) int64 {
+		switch rule {
+		case TieBreakMinImbalance:
+			return abs64(c.imbalance)
+		case TieBreakNearestReference:
+			return abs64(c.price - referencePrice)
+		case TieBreakHigherPrice:
+			return -c.price
+		default: // TieBreakLowerPrice
+			return c.price
+		}
+	}
+
+	kept := candidates[:0:0]
+	for _, c := range candidates {
+		if len(kept) > 0 && score(c) > score(kept[0]) {
+			continue
+		}
+		if len(kept) > 0 && score(c) < score(kept[0]) {
+			kept = kept[:0]
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+func containsPrice(candidates []auctionCandidate, price int64) bool {
+	for _, c := range candidates {
+		if c.price == price {
+			return true
+		}
+	}
+	return false
+}
+
+func abs64(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
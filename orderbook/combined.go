@@ -0,0 +1,44 @@
+package orderbook
+
+import "lightning-exchange/domain"
+
+// CombinedBBO returns the best bid and ask across books and the book holding each
+// A read-only routing view (e.g. the same symbol on several engines): it reports where
+// the best displayed liquidity is and never matches across books. Quantities are the
+// displayed size of the winning book's level only. On a price tie the earlier book in
+// the argument list wins, so list preferred venues first. A side empty in every book
+// returns zero price and quantity and a nil book. nil books are skipped.
+// All books must share one PriceOrdering. Each book is read directly, so call it from
+// a goroutine that owns them all (stopped engines, or one test/replay thread).
+func CombinedBBO(books ...*OrderBook) (bidPrice, bidQty, askPrice, askQty int64, bidBook, askBook *OrderBook) {
+	for _, ob := range books {
+		if ob == nil {
+			continue
+		}
+		if bid, ok := ob.bestDisplayed(domain.SideBuy); ok && (bidBook == nil || ob.improves(domain.SideBuy, bid.Price, bidPrice)) {
+			bidPrice, bidQty, bidBook = bid.Price, bid.Quantity, ob
+		}
+		if ask, ok := ob.bestDisplayed(domain.SideSell); ok && (askBook == nil || ob.improves(domain.SideSell, ask.Price, askPrice)) {
+			askPrice, askQty, askBook = ask.Price, ask.Quantity, ob
+		}
+	}
+	return bidPrice, bidQty, askPrice, askQty, bidBook, askBook
+}
+
+// bestDisplayed returns the best level of side with displayed orders, skipping fully hidden ones
+func (ob *OrderBook) bestDisplayed(side domain.Side) (PriceLevel, bool) {
+	for level := range ob.Levels(side) {
+		if shown := ob.displayed(side, level); shown.Orders > 0 {
+			return shown, true
+		}
+	}
+	return PriceLevel{}, false
+}
+
+// improves reports whether price is strictly better than than on side
+func (ob *OrderBook) improves(side domain.Side, price, than int64) bool {
+	if ob.descending(side) {
+		return price > than
+	}
+	return price < than
+}
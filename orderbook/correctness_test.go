@@ -1,8 +1,15 @@
 package orderbook
 
 import (
+	"container/list"
+	"errors"
+	"fmt"
 	"lightning-exchange/domain"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestAddOrder 测试添加订单
@@ -245,3 +252,1240 @@ func TestAsksDepth(t *testing.T) {
 		}
 	}
 }
+
+// TestSeedFromDepth 测试从 L2 快照初始化订单簿
+func TestSeedFromDepth(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+
+	ob.SeedFromDepth(
+		[]PriceLevel{{Price: 49900, Quantity: 300}, {Price: 49800, Quantity: 500}},
+		[]PriceLevel{{Price: 50100, Quantity: 200}, {Price: 50200, Quantity: 0}},
+	)
+
+	bids, asks := ob.GetDepth(10)
+	if len(bids) != 2 || bids[0].Price != 49900 || bids[0].Quantity != 300 || bids[0].Orders != 1 {
+		t.Fatalf("unexpected seeded bids: %+v", bids)
+	}
+	if len(asks) != 1 || asks[0].Price != 50100 || asks[0].Quantity != 200 {
+		t.Fatalf("unexpected seeded asks (zero-quantity level should be skipped): %+v", asks)
+	}
+
+	// 真实订单不应被清除
+	ob.AddOrder(domain.NewLimitOrder("real1", "BTCUSDT", "user1", domain.SideBuy, 49900, 100))
+
+	if removed := ob.ClearSyntheticOrders(); removed != 3 {
+		t.Errorf("expected 3 synthetic orders removed, got %d", removed)
+	}
+
+	bids, asks = ob.GetDepth(10)
+	if len(bids) != 1 || bids[0].Quantity != 100 {
+		t.Errorf("expected only the real bid to remain, got %+v", bids)
+	}
+	if len(asks) != 0 {
+		t.Errorf("expected asks to be empty, got %+v", asks)
+	}
+
+	// 同一价格重复出现的档位合并为一个订单，清除后不留孤儿
+	ob.SeedFromDepth(
+		[]PriceLevel{{Price: 49900, Quantity: 300}, {Price: 49800, Quantity: 500}, {Price: 49900, Quantity: 200}},
+		[]PriceLevel{{Price: 50200, Quantity: 100}, {Price: 50100, Quantity: 200}},
+	)
+	bids, _ = ob.GetDepth(10)
+	if len(bids) != 2 || bids[0].Quantity != 600 || bids[0].Orders != 2 {
+		t.Fatalf("expected the repeated price merged into one order, got %+v", bids)
+	}
+
+	// 撤单事件按价格顺序：买方从高到低，再卖方从低到高
+	var cancelled []string
+	ob.SetL3Handler(func(event L3Event) {
+		if event.Type == L3Cancel {
+			cancelled = append(cancelled, event.OrderID)
+		}
+	})
+	if removed := ob.ClearSyntheticOrders(); removed != 4 {
+		t.Errorf("expected 4 synthetic orders removed, got %d", removed)
+	}
+	if got := strings.Join(cancelled, ","); got != "SEED-B-49900,SEED-B-49800,SEED-S-50100,SEED-S-50200" {
+		t.Errorf("cancel order %s", got)
+	}
+	bids, asks = ob.GetDepth(10)
+	if len(bids) != 1 || bids[0].Quantity != 100 || len(asks) != 0 {
+		t.Errorf("expected only the real bid to remain, got %+v / %+v", bids, asks)
+	}
+}
+
+// TestUncrossRepair 测试修复交叉订单簿（bid >= ask）
+func TestUncrossRepair(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+
+	if trades := ob.UncrossRepair(); trades != nil {
+		t.Fatalf("expected no trades on empty book, got %d", len(trades))
+	}
+
+	// 通过快照加载构造一个交叉的订单簿
+	ob.SeedFromDepth(
+		[]PriceLevel{{Price: 50200, Quantity: 100}, {Price: 50000, Quantity: 300}, {Price: 49800, Quantity: 100}},
+		[]PriceLevel{{Price: 49900, Quantity: 250}, {Price: 50100, Quantity: 50}, {Price: 50300, Quantity: 100}},
+	)
+	if ob.GetBestBid() < ob.GetBestAsk() {
+		t.Fatal("expected crossed book before repair")
+	}
+
+	trades := ob.UncrossRepair()
+	if len(trades) == 0 {
+		t.Fatal("expected repair to generate trades")
+	}
+
+	var total int64
+	for _, trade := range trades {
+		if trade.Quantity <= 0 {
+			t.Errorf("trade %s has non-positive quantity %d", trade.ID, trade.Quantity)
+		}
+		if trade.Price < 49900 || trade.Price > 50200 {
+			t.Errorf("trade %s price %d outside crossed range", trade.ID, trade.Price)
+		}
+		total += trade.Quantity
+	}
+
+	// 50200x100 吃 49900x100，50000x300 吃 49900 剩余的 150，之后 50000 < 50100 不再交叉
+	if total != 250 {
+		t.Errorf("expected total repaired quantity 250, got %d", total)
+	}
+
+	if bid, ask := ob.GetBestBid(), ob.GetBestAsk(); bid >= ask {
+		t.Errorf("book still crossed after repair: bid %d, ask %d", bid, ask)
+	}
+
+	bids, asks := ob.GetDepth(10)
+	if len(bids) != 2 || bids[0].Price != 50000 || bids[0].Quantity != 150 {
+		t.Errorf("unexpected bids after repair: %+v", bids)
+	}
+	if len(asks) != 2 || asks[0].Price != 50100 || asks[0].Quantity != 50 {
+		t.Errorf("unexpected asks after repair: %+v", asks)
+	}
+
+	if trades := ob.UncrossRepair(); trades != nil {
+		t.Errorf("expected no trades on valid book, got %d", len(trades))
+	}
+}
+
+// TestMemoryEstimate 内存估算随订单增长，且稀疏档位下分片树固定开销更高
+func TestMemoryEstimate(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	empty := ob.MemoryEstimate()
+	if empty <= 0 {
+		t.Fatalf("expected positive estimate for empty book, got %d", empty)
+	}
+
+	ob.AddOrder(domain.NewLimitOrder("sell1", "BTCUSDT", "user1", domain.SideSell, 50000, 100))
+	one := ob.MemoryEstimate()
+	if one <= empty {
+		t.Errorf("expected estimate to grow after adding an order: %d -> %d", empty, one)
+	}
+
+	ob.CancelOrder("sell1")
+	if got := ob.MemoryEstimate(); got != empty {
+		t.Errorf("expected estimate to return to %d after cancel, got %d", empty, got)
+	}
+
+	// 稀疏价格（每个档位一个 bucket）：分片树需要为每个 bucket 支付固定数组开销
+	sharded := NewPriceTreeWithType(ShardedType, false)
+	hashList := NewPriceTreeWithType(HashMapListType, false)
+	for i := int64(0); i < 10; i++ {
+		price := 50000 + i*1000
+		sharded.Insert(domain.NewLimitOrder("s", "BTCUSDT", "u", domain.SideSell, price, 1))
+		hashList.Insert(domain.NewLimitOrder("h", "BTCUSDT", "u", domain.SideSell, price, 1))
+	}
+	if sharded.MemoryEstimate() <= hashList.MemoryEstimate() {
+		t.Errorf("expected sharded tree to cost more for sparse levels: sharded %d, hashmap %d",
+			sharded.MemoryEstimate(), hashList.MemoryEstimate())
+	}
+}
+
+// TestBucketSizeForSpread 测试根据价格跨度选择 bucket 大小
+func TestBucketSizeForSpread(t *testing.T) {
+	cases := []struct {
+		spread int64
+		want   int64
+	}{
+		{0, DefaultBucketSize},
+		{50, MinBucketSize},
+		{1000, 128},
+		{1 << 30, MaxBucketSize},
+	}
+	for _, c := range cases {
+		if got := BucketSizeForSpread(c.spread); got != c.want {
+			t.Errorf("BucketSizeForSpread(%d) = %d, want %d", c.spread, got, c.want)
+		}
+	}
+
+	// 非默认 bucket 大小下订单簿行为不变
+	ob := NewOrderBookWithTree("BTCUSDT", ShardedType, 16)
+	for i := int64(0); i < 100; i++ {
+		ob.AddOrder(domain.NewLimitOrder("s", "BTCUSDT", "u", domain.SideSell, 50000+i*7, 1))
+	}
+	_, asks := ob.GetDepth(3)
+	if len(asks) != 3 || asks[0].Price != 50000 || asks[1].Price != 50007 || asks[2].Price != 50014 {
+		t.Errorf("unexpected asks with bucket size 16: %+v", asks)
+	}
+	if ob.asks.Size() != 100 {
+		t.Errorf("expected 100 levels, got %d", ob.asks.Size())
+	}
+}
+
+// TestAuctionTieBreak 集合竞价多个候选价格成交量相同时的决胜规则
+func TestAuctionTieBreak(t *testing.T) {
+	// 100@102 买 / 100@100 卖：100 与 102 两个候选价成交量和不平衡量都相同
+	symmetric := func() *OrderBook {
+		ob := NewOrderBook("BTCUSDT")
+		ob.AddOrder(domain.NewLimitOrder("b1", "BTCUSDT", "u1", domain.SideBuy, 102, 100))
+		ob.AddOrder(domain.NewLimitOrder("s1", "BTCUSDT", "u2", domain.SideSell, 100, 100))
+		return ob
+	}
+
+	// 不平衡量：额外的 50@100 买单让 100 处不平衡量为 50，102 处为 0
+	ob := symmetric()
+	ob.AddOrder(domain.NewLimitOrder("b2", "BTCUSDT", "u3", domain.SideBuy, 100, 50))
+	res := ob.ComputeAuctionPrice(DefaultAuctionPolicy(), 0)
+	if res.Price != 102 || res.MatchedVolume != 100 || res.Imbalance != 0 || res.Candidates != 2 {
+		t.Errorf("min imbalance: unexpected result %+v", res)
+	}
+	// 同一订单簿，仅按低价规则则选 100
+	res = ob.ComputeAuctionPrice(AuctionPolicy{TieBreaks: []AuctionTieBreak{TieBreakLowerPrice}}, 0)
+	if res.Price != 100 || res.Imbalance != 50 {
+		t.Errorf("lower price only: unexpected result %+v", res)
+	}
+
+	// 参考价：不平衡量相同，选离参考价最近的价格
+	if res := symmetric().ComputeAuctionPrice(DefaultAuctionPolicy(), 103); res.Price != 102 {
+		t.Errorf("nearest reference 103: expected 102, got %+v", res)
+	}
+	if res := symmetric().ComputeAuctionPrice(DefaultAuctionPolicy(), 99); res.Price != 100 {
+		t.Errorf("nearest reference 99: expected 100, got %+v", res)
+	}
+
+	// 低价：与参考价等距时选低价；配置高价规则则选高价
+	if res := symmetric().ComputeAuctionPrice(DefaultAuctionPolicy(), 101); res.Price != 100 {
+		t.Errorf("lower price: expected 100, got %+v", res)
+	}
+	higher := AuctionPolicy{TieBreaks: []AuctionTieBreak{TieBreakMinImbalance, TieBreakHigherPrice}}
+	if res := symmetric().ComputeAuctionPrice(higher, 101); res.Price != 102 {
+		t.Errorf("higher price: expected 102, got %+v", res)
+	}
+
+	// 成交量最大化优先于所有决胜规则
+	ob = NewOrderBook("BTCUSDT")
+	ob.AddOrder(domain.NewLimitOrder("b1", "BTCUSDT", "u1", domain.SideBuy, 105, 100))
+	ob.AddOrder(domain.NewLimitOrder("s1", "BTCUSDT", "u2", domain.SideSell, 100, 40))
+	ob.AddOrder(domain.NewLimitOrder("s2", "BTCUSDT", "u2", domain.SideSell, 104, 60))
+	if res := ob.ComputeAuctionPrice(DefaultAuctionPolicy(), 100); res.Price != 104 || res.MatchedVolume != 100 {
+		t.Errorf("volume maximization: expected 104 x 100, got %+v", res)
+	}
+
+	// 未交叉的订单簿没有成交价
+	ob = NewOrderBook("BTCUSDT")
+	ob.AddOrder(domain.NewLimitOrder("b1", "BTCUSDT", "u1", domain.SideBuy, 99, 100))
+	ob.AddOrder(domain.NewLimitOrder("s1", "BTCUSDT", "u2", domain.SideSell, 100, 100))
+	if res := ob.ComputeAuctionPrice(DefaultAuctionPolicy(), 100); res.Price != 0 || res.MatchedVolume != 0 {
+		t.Errorf("uncrossed book: expected no clearing price, got %+v", res)
+	}
+}
+
+// TestSnapshotRoundTrip 快照序列化后恢复，保持价格时间优先级
+func TestSnapshotRoundTrip(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	ob.AddOrder(domain.NewLimitOrder("b1", "BTCUSDT", "u1", domain.SideBuy, 49900, 100))
+	ob.AddOrder(domain.NewLimitOrder("b2", "BTCUSDT", "u2", domain.SideBuy, 49900, 200))
+	ob.AddOrder(domain.NewLimitOrder("b3", "BTCUSDT", "u3", domain.SideBuy, 49800, 300))
+	tagged := domain.NewLimitOrder("s1", "BTCUSDT", "u4", domain.SideSell, 50100, 400)
+	tagged.Tag = "strategy-7"
+	ob.AddOrder(tagged)
+
+	data, err := ob.MarshalSnapshot()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	restored := NewOrderBook("BTCUSDT")
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	bids, asks := restored.GetDepth(10)
+	if len(bids) != 2 || bids[0].Quantity != 300 || bids[0].Orders != 2 || bids[1].Price != 49800 {
+		t.Errorf("unexpected restored bids: %+v", bids)
+	}
+	if len(asks) != 1 || asks[0].Quantity != 400 {
+		t.Errorf("unexpected restored asks: %+v", asks)
+	}
+	if front := restored.GetBestBuyOrders(); front[0].ID != "b1" || front[1].ID != "b2" {
+		t.Errorf("FIFO order not preserved: %s, %s", front[0].ID, front[1].ID)
+	}
+	if tag := restored.GetOrder("s1").Tag; tag != "strategy-7" {
+		t.Errorf("order tag not restored: %q", tag)
+	}
+	if equal, diff := ob.Equal(restored); !equal {
+		t.Errorf("restored book differs: %s", diff)
+	}
+
+	if err := restored.LoadSnapshot(data); !errors.Is(err, ErrBookNotEmpty) {
+		t.Errorf("expected ErrBookNotEmpty, got %v", err)
+	}
+	if err := NewOrderBook("ETHUSDT").LoadSnapshot(data); !errors.Is(err, ErrSnapshotSymbol) {
+		t.Errorf("expected ErrSnapshotSymbol, got %v", err)
+	}
+}
+
+// TestSnapshotVersion 拒绝未知的未来版本
+func TestSnapshotVersion(t *testing.T) {
+	future := []byte(`{"version": 99, "symbol": "BTCUSDT", "orders": []}`)
+	if err := NewOrderBook("BTCUSDT").LoadSnapshot(future); !errors.Is(err, ErrSnapshotVersion) {
+		t.Errorf("expected ErrSnapshotVersion for future version, got %v", err)
+	}
+
+	unversioned := []byte(`{"symbol": "BTCUSDT", "orders": []}`)
+	if err := NewOrderBook("BTCUSDT").LoadSnapshot(unversioned); !errors.Is(err, ErrSnapshotVersion) {
+		t.Errorf("expected ErrSnapshotVersion for missing version, got %v", err)
+	}
+
+	current := []byte(`{"version": 1, "symbol": "BTCUSDT", "orders": [
+		{"id": "s1", "user_id": "u1", "side": 1, "price": 50000, "quantity": 10, "filled": 4}]}`)
+	ob := NewOrderBook("BTCUSDT")
+	if err := ob.LoadSnapshot(current); err != nil {
+		t.Fatalf("load v1: %v", err)
+	}
+	if _, asks := ob.GetDepth(1); len(asks) != 1 || asks[0].Quantity != 6 {
+		t.Errorf("expected 6 remaining at 50000, got %+v", asks)
+	}
+}
+
+// TestSnapshotExecInst v1 的 last_look 迁移为 v2 的 exec_inst；隐藏单经快照往返后仍不显示
+func TestSnapshotExecInst(t *testing.T) {
+	v1 := []byte(`{"version": 1, "symbol": "BTCUSDT", "orders": [
+		{"id": "s1", "user_id": "u1", "side": 1, "price": 50000, "quantity": 10, "last_look": true},
+		{"id": "s2", "user_id": "u1", "side": 1, "price": 50000, "quantity": 5}]}`)
+	ob := NewOrderBook("BTCUSDT")
+	if err := ob.LoadSnapshot(v1); err != nil {
+		t.Fatalf("load v1: %v", err)
+	}
+	if inst := ob.GetOrder("s1").ExecInst; inst != domain.ExecLastLook {
+		t.Errorf("s1 exec inst %b, want last look", inst)
+	}
+	if inst := ob.GetOrder("s2").ExecInst; inst != 0 {
+		t.Errorf("s2 exec inst %b, want none", inst)
+	}
+
+	hidden := domain.NewLimitOrder("b1", "BTCUSDT", "u2", domain.SideBuy, 49990, 7)
+	hidden.ExecInst = domain.ExecHidden | domain.ExecPostOnly
+	ob.AddOrder(hidden)
+	data, err := ob.MarshalSnapshot()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	restored := NewOrderBook("BTCUSDT")
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("load v2: %v", err)
+	}
+	if inst := restored.GetOrder("b1").ExecInst; inst != domain.ExecHidden|domain.ExecPostOnly {
+		t.Errorf("b1 exec inst %b after round trip", inst)
+	}
+	if bids, _ := restored.GetDepth(5); len(bids) != 0 {
+		t.Errorf("hidden bid displayed after round trip: %+v", bids)
+	}
+}
+
+// TestMigrateTree 迁移价格树实现后深度、BBO 和 FIFO 顺序保持不变
+func TestMigrateTree(t *testing.T) {
+	ob := NewOrderBookWithTree("BTCUSDT", HashMapListType, 0)
+	for i := 0; i < 200; i++ {
+		side := domain.SideBuy
+		price := int64(50000 - i%40*7)
+		if i%2 == 1 {
+			side = domain.SideSell
+			price = int64(50100 + i%50*3)
+		}
+		ob.AddOrder(domain.NewLimitOrder(fmt.Sprintf("o%d", i), "BTCUSDT", "u", side, price, int64(1+i%9)))
+	}
+	ob.FillOrder(ob.GetBestSellOrders()[0], 1)
+
+	wantBids, wantAsks := ob.GetDepth(1000)
+	wantBuyQueue := orderIDs(ob.GetBestBuyOrders())
+	wantSellQueue := orderIDs(ob.GetBestSellOrders())
+
+	for _, treeType := range []PriceTreeType{ShardedType, HashMapListType} {
+		ob.MigrateTree(treeType)
+
+		bids, asks := ob.GetDepth(1000)
+		if !reflect.DeepEqual(bids, wantBids) || !reflect.DeepEqual(asks, wantAsks) {
+			t.Fatalf("depth changed after migrating to %v", treeType)
+		}
+		if ob.GetBestBid() != wantBids[0].Price || ob.GetBestAsk() != wantAsks[0].Price {
+			t.Errorf("BBO changed after migrating to %v: %d/%d", treeType, ob.GetBestBid(), ob.GetBestAsk())
+		}
+		if !reflect.DeepEqual(orderIDs(ob.GetBestBuyOrders()), wantBuyQueue) ||
+			!reflect.DeepEqual(orderIDs(ob.GetBestSellOrders()), wantSellQueue) {
+			t.Errorf("FIFO order changed after migrating to %v", treeType)
+		}
+	}
+
+	// 迁移后的簿仍可正常撤单
+	ob.CancelOrder(wantBuyQueue[0])
+	if bids, _ := ob.GetDepth(1); bids[0].Orders != wantBids[0].Orders-1 {
+		t.Errorf("cancel after migration not applied: %+v", bids[0])
+	}
+}
+
+// TestCompact 大量撤单后压缩：深度、BBO、FIFO 和索引保持不变
+func TestCompact(t *testing.T) {
+	for _, treeType := range []PriceTreeType{HashMapListType, ShardedType} {
+		ob := NewOrderBookWithTree("BTCUSDT", treeType, 16)
+		for i := 0; i < 2000; i++ {
+			side, price := domain.SideBuy, int64(50000-i%400)
+			if i%2 == 1 {
+				side, price = domain.SideSell, int64(50001+i%400)
+			}
+			order := domain.NewLimitOrder(fmt.Sprintf("o%d", i), "BTCUSDT", fmt.Sprintf("u%d", i%7), side, price, 1)
+			order.SessionID = fmt.Sprintf("s%d", i%3)
+			ob.AddOrder(order)
+		}
+		// 撤掉 95% 的订单
+		for i := 0; i < 2000; i++ {
+			if i%20 != 0 && i%20 != 1 {
+				ob.CancelOrder(fmt.Sprintf("o%d", i))
+			}
+		}
+
+		wantBids, wantAsks := ob.GetDepth(1000)
+		wantBuyQueue := orderIDs(ob.GetBestBuyOrders())
+		wantOpen := ob.OpenOrderCount("u0")
+
+		ob.Compact()
+
+		bids, asks := ob.GetDepth(1000)
+		if !reflect.DeepEqual(bids, wantBids) || !reflect.DeepEqual(asks, wantAsks) {
+			t.Fatalf("%v: depth changed after compaction", treeType)
+		}
+		if ob.GetBestBid() != wantBids[0].Price || ob.GetBestAsk() != wantAsks[0].Price {
+			t.Errorf("%v: BBO changed after compaction", treeType)
+		}
+		if !reflect.DeepEqual(orderIDs(ob.GetBestBuyOrders()), wantBuyQueue) {
+			t.Errorf("%v: FIFO order changed after compaction", treeType)
+		}
+		if sharded, ok := ob.bids.(*ShardedPriceTreeAdapter); ok && sharded.tree.bucketSize != 16 {
+			t.Errorf("bucket size not preserved: %d", sharded.tree.bucketSize)
+		}
+		if ob.OpenOrderCount("u0") != wantOpen {
+			t.Errorf("%v: user order count changed: %d, want %d", treeType, ob.OpenOrderCount("u0"), wantOpen)
+		}
+
+		// 压缩后的索引仍然可用
+		if n := ob.CancelSession("s0"); n == 0 {
+			t.Errorf("%v: session index lost after compaction", treeType)
+		}
+		for _, order := range ob.orders {
+			ob.CancelOrder(order.ID)
+		}
+		if ob.GetBestBid() != 0 || ob.GetBestAsk() != 0 || len(ob.userOrders) != 0 {
+			t.Errorf("%v: book not empty after cancelling everything", treeType)
+		}
+	}
+}
+
+// TestQueuePosition 排队位置：前方订单数和剩余数量，撤单/成交后前移
+func TestQueuePosition(t *testing.T) {
+	for _, treeType := range []PriceTreeType{HashMapListType, ShardedType} {
+		ob := NewOrderBookWithTree("BTCUSDT", treeType, 0)
+		for i, qty := range []int64{5, 3, 7, 2} {
+			ob.AddOrder(domain.NewLimitOrder(fmt.Sprintf("b%d", i), "BTCUSDT", "u", domain.SideBuy, 50000, qty))
+		}
+		ob.AddOrder(domain.NewLimitOrder("other", "BTCUSDT", "u", domain.SideBuy, 49990, 100))
+
+		check := func(id string, wantOrders int, wantQty int64) {
+			t.Helper()
+			orders, qty, found := ob.QueuePosition(id)
+			if !found || orders != wantOrders || qty != wantQty {
+				t.Errorf("%v %s: got (%d, %d, %v), want (%d, %d, true)", treeType, id, orders, qty, found, wantOrders, wantQty)
+			}
+		}
+		check("b0", 0, 0)
+		check("b3", 3, 15)
+		check("other", 0, 0) // 其他档位的订单不计入
+
+		ob.FillOrder(ob.GetOrder("b0"), 4)
+		check("b3", 3, 11)
+		ob.CancelOrder("b1")
+		check("b3", 2, 8)
+
+		if _, _, found := ob.QueuePosition("b1"); found {
+			t.Errorf("%v: cancelled order still reported as resting", treeType)
+		}
+		if _, _, found := ob.QueuePosition("missing"); found {
+			t.Errorf("%v: unknown order reported as resting", treeType)
+		}
+	}
+}
+
+// TestPeekMatch 预览首笔撮合：与实际撮合结果一致且不修改订单簿
+func TestPeekMatch(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	ob.AddOrder(domain.NewLimitOrder("S1", "BTCUSDT", "u", domain.SideSell, 50010, 3))
+	ob.AddOrder(domain.NewLimitOrder("S2", "BTCUSDT", "u", domain.SideSell, 50010, 9))
+	ob.AddOrder(domain.NewLimitOrder("S3", "BTCUSDT", "u", domain.SideSell, 50020, 5))
+	ob.AddOrder(domain.NewLimitOrder("B1", "BTCUSDT", "u", domain.SideBuy, 49990, 4))
+
+	market := domain.NewLimitOrder("M", "BTCUSDT", "u", domain.SideSell, 0, 10)
+	market.Type = domain.OrderTypeMarket
+
+	cases := []struct {
+		name      string
+		order     *domain.Order
+		willMatch bool
+		price     int64
+		qty       int64
+	}{
+		{"buy below ask", domain.NewLimitOrder("x", "BTCUSDT", "u", domain.SideBuy, 50000, 2), false, 0, 0},
+		{"buy at ask, smaller than first order", domain.NewLimitOrder("x", "BTCUSDT", "u", domain.SideBuy, 50010, 2), true, 50010, 2},
+		{"buy through two levels: first order only", domain.NewLimitOrder("x", "BTCUSDT", "u", domain.SideBuy, 50020, 10), true, 50010, 3},
+		{"sell above bid", domain.NewLimitOrder("x", "BTCUSDT", "u", domain.SideSell, 49995, 1), false, 0, 0},
+		{"market sell", market, true, 49990, 4},
+	}
+	for _, tc := range cases {
+		willMatch, price, qty := ob.PeekMatch(tc.order)
+		if willMatch != tc.willMatch || price != tc.price || qty != tc.qty {
+			t.Errorf("%s: got (%v, %d, %d), want (%v, %d, %d)", tc.name, willMatch, price, qty, tc.willMatch, tc.price, tc.qty)
+		}
+	}
+
+	bids, asks := ob.GetDepth(10)
+	if len(bids) != 1 || bids[0].Quantity != 4 || len(asks) != 2 || asks[0].Quantity != 12 {
+		t.Errorf("PeekMatch mutated the book: bids %+v asks %+v", bids, asks)
+	}
+
+	empty := NewOrderBook("BTCUSDT")
+	if willMatch, _, _ := empty.PeekMatch(market); willMatch {
+		t.Error("empty book should not match")
+	}
+}
+
+// TestRemoveEmptyLevel 人为制造"空档位仍是最优档"的状态，修复后最优价前移到下一档
+func TestRemoveEmptyLevel(t *testing.T) {
+	for _, tt := range integrityTreeTypes {
+		ob := NewOrderBookWithTree("BTCUSDT", tt.treeType, tt.bucketSize)
+		stale := domain.NewLimitOrder("S1", "BTCUSDT", "u", domain.SideSell, 50000, 1)
+		ob.AddOrder(stale)
+		ob.AddOrder(domain.NewLimitOrder("S2", "BTCUSDT", "u", domain.SideSell, 50020, 1))
+
+		if ob.RemoveEmptyLevel(domain.SideSell, 50000) {
+			t.Fatalf("%s: removed a non-empty level", tt.name)
+		}
+
+		// 只从链表摘掉订单，不经过树：留下一个空的最优档
+		level := ob.GetBestSellLevel()
+		level.Orders.Remove(stale.ListElement.(*list.Element))
+		stale.ListElement = nil
+
+		if !ob.RemoveEmptyLevel(domain.SideSell, 50000) {
+			t.Fatalf("%s: empty level not removed", tt.name)
+		}
+		if ob.GetBestAsk() != 50020 || ob.asks.Size() != 1 {
+			t.Errorf("%s: best ask %d, levels %d after repair", tt.name, ob.GetBestAsk(), ob.asks.Size())
+		}
+		if ob.RemoveEmptyLevel(domain.SideSell, 50000) {
+			t.Errorf("%s: removed a missing level", tt.name)
+		}
+	}
+}
+
+func orderIDs(orders []*domain.Order) []string {
+	ids := make([]string, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+	return ids
+}
+
+// TestVolumeInRange 区间成交量统计（两种价格树实现）
+func TestVolumeInRange(t *testing.T) {
+	for _, treeType := range []PriceTreeType{HashMapListType, ShardedType} {
+		ob := NewOrderBookWithTree("BTCUSDT", treeType, 16)
+		for i, price := range []int64{49900, 49950, 49950, 50000} {
+			ob.AddOrder(domain.NewLimitOrder(fmt.Sprintf("b%d", i), "BTCUSDT", "u", domain.SideBuy, price, 10*int64(i+1)))
+		}
+		for i, price := range []int64{50010, 50020, 50500} {
+			ob.AddOrder(domain.NewLimitOrder(fmt.Sprintf("s%d", i), "BTCUSDT", "u", domain.SideSell, price, 100*int64(i+1)))
+		}
+
+		cases := []struct {
+			side     domain.Side
+			from, to int64
+			want     int64
+		}{
+			{domain.SideBuy, 49950, 50000, 20 + 30 + 40},
+			{domain.SideBuy, 50000, 49950, 20 + 30 + 40}, // 边界顺序无关
+			{domain.SideBuy, 49000, 49949, 10},
+			{domain.SideBuy, 50001, 60000, 0},
+			{domain.SideSell, 50000, 50020, 100 + 200},
+			{domain.SideSell, 50020, 50020, 200},
+			{domain.SideSell, 50021, 50499, 0},
+			{domain.SideSell, 0, 1 << 40, 600},
+		}
+		for _, c := range cases {
+			if got := ob.VolumeInRange(c.side, c.from, c.to); got != c.want {
+				t.Errorf("type %v: VolumeInRange(%v, %d, %d) = %d, want %d", treeType, c.side, c.from, c.to, got, c.want)
+			}
+		}
+	}
+}
+
+// TestDiffDepth 计算深度快照之间的最小增量，并验证应用增量后与新快照一致
+func TestDiffDepth(t *testing.T) {
+	old := []PriceLevel{{50000, 10, 1}, {49990, 20, 2}, {49980, 30, 3}, {49970, 5, 1}}
+	new := []PriceLevel{{50005, 7, 1}, {50000, 10, 1}, {49990, 25, 2}, {49970, 5, 2}}
+
+	deltas := DiffDepth(old, new)
+	want := []DepthDelta{
+		{Action: DepthRemove, Price: 49980},
+		{Action: DepthAdd, Price: 50005, Quantity: 7, Orders: 1},
+		{Action: DepthUpdate, Price: 49990, Quantity: 25, Orders: 2},
+		{Action: DepthUpdate, Price: 49970, Quantity: 5, Orders: 2},
+	}
+	if !reflect.DeepEqual(deltas, want) {
+		t.Fatalf("unexpected deltas:\n got %+v\nwant %+v", deltas, want)
+	}
+
+	// 应用增量
+	levels := make(map[int64]PriceLevel)
+	for _, level := range old {
+		levels[level.Price] = level
+	}
+	for _, d := range deltas {
+		if d.Action == DepthRemove {
+			delete(levels, d.Price)
+		} else {
+			levels[d.Price] = PriceLevel{d.Price, d.Quantity, d.Orders}
+		}
+	}
+	if len(levels) != len(new) {
+		t.Fatalf("applied result has %d levels, want %d", len(levels), len(new))
+	}
+	for _, level := range new {
+		if levels[level.Price] != level {
+			t.Errorf("level %d: got %+v, want %+v", level.Price, levels[level.Price], level)
+		}
+	}
+
+	if d := DiffDepth(new, new); d != nil {
+		t.Errorf("identical snapshots should produce no deltas, got %+v", d)
+	}
+	if d := DiffDepth(nil, old[:1]); len(d) != 1 || d[0].Action != DepthAdd {
+		t.Errorf("diff from empty: %+v", d)
+	}
+	if d := DiffDepth(old[:1], nil); len(d) != 1 || d[0].Action != DepthRemove {
+		t.Errorf("diff to empty: %+v", d)
+	}
+}
+
+// TestDump 调试输出：每个区块最优价位在最上方
+func TestDump(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	ob.AddOrder(domain.NewLimitOrder("s1", "BTCUSDT", "u", domain.SideSell, 50010, 20))
+	ob.AddOrder(domain.NewLimitOrder("s2", "BTCUSDT", "u", domain.SideSell, 50000, 10))
+	ob.AddOrder(domain.NewLimitOrder("s3", "BTCUSDT", "u", domain.SideSell, 50010, 5))
+	ob.AddOrder(domain.NewLimitOrder("s4", "BTCUSDT", "u", domain.SideSell, 50020, 1)) // 超出 2 档
+	ob.AddOrder(domain.NewLimitOrder("b1", "BTCUSDT", "u", domain.SideBuy, 49990, 5))
+
+	want := "BTCUSDT top 2 levels\n" +
+		"ASKS          price       volume  orders\n" +
+		"              50000           10       1\n" +
+		"              50010           25       2\n" +
+		"BIDS          price       volume  orders\n" +
+		"              49990            5       1\n"
+	if got := ob.Dump(2); got != want {
+		t.Errorf("unexpected dump:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := NewOrderBook("ETHUSDT").Dump(5); !strings.Contains(got, "(empty)") {
+		t.Errorf("empty book should be marked empty:\n%s", got)
+	}
+}
+
+// TestApplyL3 L3 重放：按 Remaining 还原数量，序号缺口和不一致事件报错
+func TestApplyL3(t *testing.T) {
+	source := NewOrderBook("BTCUSDT")
+	var events []L3Event
+	source.SetL3Handler(func(event L3Event) { events = append(events, event) })
+
+	a := domain.NewLimitOrder("A", "BTCUSDT", "u1", domain.SideBuy, 100, 10)
+	b := domain.NewLimitOrder("B", "BTCUSDT", "u2", domain.SideBuy, 100, 5)
+	c := domain.NewLimitOrder("C", "BTCUSDT", "u3", domain.SideSell, 110, 7)
+	source.AddOrder(a)
+	source.AddOrder(b)
+	source.AddOrder(c)
+	source.FillOrder(a, 4)
+	source.ReduceOrder(c, 2)
+	source.CancelOrder("B")
+	if last := events[len(events)-1]; last.Remaining != 0 || events[3].Remaining != 6 {
+		t.Fatalf("remaining not carried: %+v", events)
+	}
+
+	replica := NewOrderBook("BTCUSDT")
+	if err := replica.ApplyL3(events); err != nil {
+		t.Fatalf("ApplyL3: %v", err)
+	}
+	bids, asks := replica.GetDepth(5)
+	if len(bids) != 1 || bids[0].Quantity != 6 || bids[0].Orders != 1 || len(asks) != 1 || asks[0].Quantity != 5 {
+		t.Errorf("replayed depth bids %+v asks %+v", bids, asks)
+	}
+	if replica.Seq() != source.Seq() {
+		t.Errorf("replica seq %d, source seq %d", replica.Seq(), source.Seq())
+	}
+	if equal, diff := source.Equal(replica); !equal {
+		t.Errorf("replayed book differs: %s", diff)
+	}
+
+	// 重复应用：序号不连续
+	if err := replica.ApplyL3(events[:1]); !errors.Is(err, ErrL3SeqGap) {
+		t.Errorf("replay of old event: %v, want ErrL3SeqGap", err)
+	}
+	// 未知订单
+	unknown := L3Event{Seq: replica.Seq() + 1, Type: L3Execute, OrderID: "X", Quantity: 1}
+	if err := replica.ApplyL3([]L3Event{unknown}); !errors.Is(err, ErrL3Inconsistent) {
+		t.Errorf("execute for unknown order: %v, want ErrL3Inconsistent", err)
+	}
+	// Quantity 与 Remaining 不符
+	bad := L3Event{Seq: replica.Seq() + 1, Type: L3Execute, OrderID: "A", Side: domain.SideBuy, Price: 100, Quantity: 1, Remaining: 1}
+	if err := replica.ApplyL3([]L3Event{bad}); !errors.Is(err, ErrL3Inconsistent) {
+		t.Errorf("mismatched remaining: %v, want ErrL3Inconsistent", err)
+	}
+}
+
+// TestMicroprice 按数量加权的中间价（手算示例：买盘量大，价格偏向卖价）
+func TestMicroprice(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	if got := ob.Microprice(); got != 0 {
+		t.Errorf("empty book: %d, want 0", got)
+	}
+
+	ob.AddOrder(domain.NewLimitOrder("B1", "BTCUSDT", "u", domain.SideBuy, 100, 3))
+	if got := ob.Microprice(); got != 0 {
+		t.Errorf("one-sided book: %d, want 0", got)
+	}
+
+	ob.AddOrder(domain.NewLimitOrder("A1", "BTCUSDT", "u", domain.SideSell, 110, 1))
+	// (110*3 + 100*1) / (3+1) = 430/4 = 107
+	if got := ob.Microprice(); got != 107 {
+		t.Errorf("microprice %d, want 107", got)
+	}
+
+	// 只看最优档：更深的档位不影响结果
+	ob.AddOrder(domain.NewLimitOrder("B2", "BTCUSDT", "u", domain.SideBuy, 100, 5))
+	ob.AddOrder(domain.NewLimitOrder("A2", "BTCUSDT", "u", domain.SideSell, 120, 50))
+	// (110*8 + 100*1) / 9 = 980/9 = 108
+	if got := ob.Microprice(); got != 108 {
+		t.Errorf("microprice %d, want 108", got)
+	}
+}
+
+// TestLevelsIterator 两种价格树的 Levels 都按优先级顺序产出档位，并支持提前终止
+func TestLevelsIterator(t *testing.T) {
+	for _, treeType := range []PriceTreeType{HashMapListType, ShardedType} {
+		for _, descending := range []bool{true, false} {
+			tree := NewPriceTreeWithType(treeType, descending)
+			for i, price := range []int64{100, 300, 200, 5000, 50} {
+				tree.Insert(domain.NewLimitOrder(fmt.Sprintf("o%d", i), "BTCUSDT", "u", domain.SideBuy, price, int64(i+1)))
+			}
+
+			var prices []int64
+			for level := range tree.Levels() {
+				prices = append(prices, level.Price)
+			}
+			want := []int64{50, 100, 200, 300, 5000}
+			if descending {
+				want = []int64{5000, 300, 200, 100, 50}
+			}
+			if !reflect.DeepEqual(prices, want) {
+				t.Errorf("type %v descending %v: levels %v, want %v", treeType, descending, prices, want)
+			}
+
+			// break 后不再产出
+			visited := 0
+			for range tree.Levels() {
+				if visited++; visited == 2 {
+					break
+				}
+			}
+			if visited != 2 {
+				t.Errorf("type %v descending %v: visited %d levels after break, want 2", treeType, descending, visited)
+			}
+		}
+	}
+}
+
+// ExamplePriceTreeInterface_Levels 用迭代器累计整侧挂单量，无需先分配深度切片
+func ExamplePriceTreeInterface_Levels() {
+	asks := NewPriceTreeWithType(ShardedType, false)
+	asks.Insert(domain.NewLimitOrder("a1", "BTCUSDT", "u", domain.SideSell, 50010, 3))
+	asks.Insert(domain.NewLimitOrder("a2", "BTCUSDT", "u", domain.SideSell, 50000, 2))
+	asks.Insert(domain.NewLimitOrder("a3", "BTCUSDT", "u", domain.SideSell, 50020, 5))
+
+	var total int64
+	for level := range asks.Levels() {
+		total += level.Volume
+		fmt.Printf("%d: %d\n", level.Price, level.Volume)
+	}
+	fmt.Println("total:", total)
+	// Output:
+	// 50000: 2
+	// 50010: 3
+	// 50020: 5
+	// total: 10
+}
+
+// TestHiddenDepth 隐藏单不计入公开深度，但仍占用档位并随成交/减量/撤单同步
+func TestHiddenDepth(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	shown := domain.NewLimitOrder("A1", "BTCUSDT", "u", domain.SideSell, 50000, 3)
+	hidden := domain.NewLimitOrder("A2", "BTCUSDT", "u", domain.SideSell, 50000, 5)
+	hidden.ExecInst = domain.ExecHidden
+	onlyHidden := domain.NewLimitOrder("A3", "BTCUSDT", "u", domain.SideSell, 50010, 4)
+	onlyHidden.ExecInst = domain.ExecHidden
+	deeper := domain.NewLimitOrder("A4", "BTCUSDT", "u", domain.SideSell, 50020, 1)
+	for _, order := range []*domain.Order{shown, hidden, onlyHidden, deeper} {
+		ob.AddOrder(order)
+	}
+
+	// 全隐藏的 50010 档被跳过，仍返回两档可见深度
+	_, asks := ob.GetDepth(2)
+	want := []PriceLevel{{Price: 50000, Quantity: 3, Orders: 1}, {Price: 50020, Quantity: 1, Orders: 1}}
+	if !reflect.DeepEqual(asks, want) {
+		t.Errorf("displayed asks %+v, want %+v", asks, want)
+	}
+	if level := ob.LevelAt(domain.SideSell, 50000); level.Quantity != 3 || level.Orders != 1 {
+		t.Errorf("LevelAt %+v, want 3 / 1 order", level)
+	}
+	if ob.GetBestAsk() != 50000 || ob.GetLevel(domain.SideSell, 50000).Volume != 8 {
+		t.Errorf("matching view must include hidden volume")
+	}
+
+	ob.FillOrder(shown, 3)
+	ob.FillOrder(hidden, 2)
+	ob.ReduceOrder(hidden, 1)
+	if _, asks := ob.GetDepth(5); len(asks) != 1 || asks[0].Price != 50020 {
+		t.Errorf("after fills, displayed asks %+v", asks)
+	}
+	ob.CancelOrder("A2")
+	ob.CancelOrder("A3")
+	if len(ob.hidden) != 0 {
+		t.Errorf("hidden aggregates leaked: %+v", ob.hidden)
+	}
+}
+
+// TestCombinedBBO 跨簿最优价：取各簿最好的一档并报告所在簿，同价取靠前的簿
+func TestCombinedBBO(t *testing.T) {
+	a := NewOrderBook("BTCUSDT")
+	b := NewOrderBookWithTree("BTCUSDT", ShardedType, 0)
+
+	bidPrice, bidQty, askPrice, askQty, bidBook, askBook := CombinedBBO(a, b, nil)
+	if bidPrice != 0 || bidQty != 0 || askPrice != 0 || askQty != 0 || bidBook != nil || askBook != nil {
+		t.Fatalf("empty books: %d/%d %d/%d %p %p", bidPrice, bidQty, askPrice, askQty, bidBook, askBook)
+	}
+
+	a.AddOrder(domain.NewLimitOrder("a-b1", "BTCUSDT", "u", domain.SideBuy, 100, 3))
+	a.AddOrder(domain.NewLimitOrder("a-s1", "BTCUSDT", "u", domain.SideSell, 110, 4))
+	b.AddOrder(domain.NewLimitOrder("b-b1", "BTCUSDT", "u", domain.SideBuy, 101, 2))
+	b.AddOrder(domain.NewLimitOrder("b-s1", "BTCUSDT", "u", domain.SideSell, 112, 9))
+
+	bidPrice, bidQty, askPrice, askQty, bidBook, askBook = CombinedBBO(a, b)
+	if bidPrice != 101 || bidQty != 2 || bidBook != b {
+		t.Errorf("bid %d x %d in %p, want 101 x 2 in b", bidPrice, bidQty, bidBook)
+	}
+	if askPrice != 110 || askQty != 4 || askBook != a {
+		t.Errorf("ask %d x %d in %p, want 110 x 4 in a", askPrice, askQty, askBook)
+	}
+
+	// 同价：数量只取胜出簿本身，靠前的簿胜出
+	a.AddOrder(domain.NewLimitOrder("a-b2", "BTCUSDT", "u", domain.SideBuy, 101, 7))
+	if bidPrice, bidQty, _, _, bidBook, _ = CombinedBBO(a, b); bidPrice != 101 || bidQty != 7 || bidBook != a {
+		t.Errorf("tie (a, b): %d x %d in %p, want 101 x 7 in a", bidPrice, bidQty, bidBook)
+	}
+	if bidPrice, bidQty, _, _, bidBook, _ = CombinedBBO(b, a); bidPrice != 101 || bidQty != 2 || bidBook != b {
+		t.Errorf("tie (b, a): %d x %d in %p, want 101 x 2 in b", bidPrice, bidQty, bidBook)
+	}
+
+	// 纯隐藏档位不参与比较
+	hidden := domain.NewLimitOrder("b-s2", "BTCUSDT", "u", domain.SideSell, 105, 50)
+	hidden.ExecInst = domain.ExecHidden
+	b.AddOrder(hidden)
+	if _, _, askPrice, askQty, _, askBook = CombinedBBO(a, b); askPrice != 110 || askQty != 4 || askBook != a {
+		t.Errorf("hidden ask: %d x %d in %p, want 110 x 4 in a", askPrice, askQty, askBook)
+	}
+
+	// 反向报价：越低的买价越好
+	inv1 := NewOrderBookWithOrdering("BTCUSD", HashMapListType, 0, PriceOrderingInverted)
+	inv2 := NewOrderBookWithOrdering("BTCUSD", HashMapListType, 0, PriceOrderingInverted)
+	inv1.AddOrder(domain.NewLimitOrder("i1", "BTCUSD", "u", domain.SideBuy, 200, 1))
+	inv2.AddOrder(domain.NewLimitOrder("i2", "BTCUSD", "u", domain.SideBuy, 190, 1))
+	if bidPrice, _, _, _, bidBook, _ = CombinedBBO(inv1, inv2); bidPrice != 190 || bidBook != inv2 {
+		t.Errorf("inverted bid %d in %p, want 190 in inv2", bidPrice, bidBook)
+	}
+}
+
+// TestIcebergReserve 冰山单储备量不进入公开深度；减量先扣储备；快照保留当前切片
+func TestIcebergReserve(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	var events []L3Event
+	ob.SetL3Handler(func(event L3Event) {
+		if event.OrderID == "ice" {
+			events = append(events, event)
+		}
+	})
+	iceberg := domain.NewLimitOrder("ice", "BTCUSDT", "u", domain.SideSell, 50000, 10)
+	iceberg.DisplayQty = 3
+	ob.AddOrder(iceberg)
+	ob.AddOrder(domain.NewLimitOrder("s2", "BTCUSDT", "u", domain.SideSell, 50000, 1))
+
+	depth := func(book *OrderBook) PriceLevel {
+		_, asks := book.GetDepth(1)
+		if len(asks) != 1 {
+			t.Fatalf("asks %v", asks)
+		}
+		return asks[0]
+	}
+	if level := depth(ob); level.Quantity != 4 || level.Orders != 2 {
+		t.Fatalf("depth %+v, want 4 displayed across 2 orders", level)
+	}
+
+	// 减量 5：全部来自储备（7 → 2），显示切片不变
+	ob.ReduceOrder(iceberg, 5)
+	if iceberg.ShownQty != 3 || depth(ob).Quantity != 4 {
+		t.Errorf("after reduce: shown %d, depth %+v", iceberg.ShownQty, depth(ob))
+	}
+
+	// 切片吃完前不补单；补单后排到 s2 之后
+	ob.FillOrder(iceberg, 3)
+	if depth(ob).Quantity != 1 {
+		t.Errorf("consumed slice still displayed: %+v", depth(ob))
+	}
+	if !ob.RefillIceberg(iceberg, 3) || iceberg.ShownQty != 2 {
+		t.Fatalf("refill: shown %d, want 2 (capped at remaining)", iceberg.ShownQty)
+	}
+	if front := ob.GetBestSellLevel().Orders.Front().Value.(*domain.Order); front.ID != "s2" {
+		t.Errorf("refilled iceberg kept priority, front is %s", front.ID)
+	}
+	if ob.RefillIceberg(iceberg, 3) {
+		t.Error("refill of a non-empty slice should be a no-op")
+	}
+
+	data, err := ob.MarshalSnapshot()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	restored := NewOrderBook("BTCUSDT")
+	if err := restored.LoadSnapshot(data); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := restored.GetOrder("ice"); got.DisplayQty != 3 || got.ShownQty != 2 || depth(restored).Quantity != 3 {
+		t.Errorf("after round trip: %+v, depth %+v", got, depth(restored))
+	}
+
+	ob.CancelOrder("ice")
+	if len(ob.hidden) != 0 {
+		t.Errorf("reserve aggregate left behind: %+v", ob.hidden)
+	}
+
+	// L3 只发布切片：数量从不超过切片大小，储备量不可见
+	// 挂单 3、减量只动储备（不发布）、成交 3、补单 2、撤单 2
+	var got []string
+	for _, event := range events {
+		if event.Quantity > iceberg.DisplayQty || event.Remaining > iceberg.DisplayQty {
+			t.Errorf("L3 event reveals the reserve: %+v", event)
+		}
+		got = append(got, fmt.Sprintf("%d:%d/%d", event.Type, event.Quantity, event.Remaining))
+	}
+	want := []string{
+		fmt.Sprintf("%d:3/3", L3Add), fmt.Sprintf("%d:3/0", L3Execute),
+		fmt.Sprintf("%d:2/2", L3Add), fmt.Sprintf("%d:2/0", L3Cancel),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("iceberg L3 events %v, want %v", got, want)
+	}
+}
+
+// TestGetTopOrders 最佳档位有数千个订单时只取队首，顺序与时间优先一致
+func TestGetTopOrders(t *testing.T) {
+	for _, treeType := range []PriceTreeType{HashMapListType, ShardedType} {
+		ob := NewOrderBookWithTree("BTCUSDT", treeType, 16)
+		for i := 0; i < 5000; i++ {
+			ob.AddOrder(domain.NewLimitOrder(fmt.Sprintf("a%d", i), "BTCUSDT", "u", domain.SideSell, 50001, 1))
+		}
+		ob.AddOrder(domain.NewLimitOrder("a-far", "BTCUSDT", "u", domain.SideSell, 50002, 1))
+
+		top := ob.GetTopOrders(domain.SideSell, 10)
+		if len(top) != 10 || cap(top) != 10 {
+			t.Fatalf("%v: expected 10 orders in a slice of cap 10, got len %d cap %d", treeType, len(top), cap(top))
+		}
+		for i, order := range top {
+			if want := fmt.Sprintf("a%d", i); order.ID != want {
+				t.Errorf("%v: position %d is %s, want %s", treeType, i, order.ID, want)
+			}
+		}
+
+		// 上限超过档位订单数时返回整档，且不越过到下一档
+		ob.CancelOrder("a0")
+		if got := ob.GetTopOrders(domain.SideSell, 10000); len(got) != 4999 || got[0].ID != "a1" {
+			t.Errorf("%v: expected the whole best level (4999 from a1), got %d", treeType, len(got))
+		}
+		if got := ob.GetTopOrders(domain.SideSell, 0); got != nil {
+			t.Errorf("%v: maxOrders 0 should return nil, got %d", treeType, len(got))
+		}
+		if got := ob.GetTopOrders(domain.SideBuy, 10); got != nil {
+			t.Errorf("%v: empty side should return nil, got %d", treeType, len(got))
+		}
+	}
+}
+
+// TestIsOneSided 空簿、单边（买/卖）和双边四种组合，两种价格树结果一致
+func TestIsOneSided(t *testing.T) {
+	for _, treeType := range []PriceTreeType{HashMapListType, ShardedType} {
+		ob := NewOrderBookWithTree("BTCUSDT", treeType, 16)
+		check := func(state string, wantBidsEmpty, wantAsksEmpty bool) {
+			t.Helper()
+			bidsEmpty, asksEmpty := ob.IsOneSided()
+			if bidsEmpty != wantBidsEmpty || asksEmpty != wantAsksEmpty || ob.IsEmpty() != (wantBidsEmpty && wantAsksEmpty) {
+				t.Errorf("%v %s: IsOneSided (%v, %v), IsEmpty %v", treeType, state, bidsEmpty, asksEmpty, ob.IsEmpty())
+			}
+		}
+
+		check("empty", true, true)
+		ob.AddOrder(domain.NewLimitOrder("b1", "BTCUSDT", "u", domain.SideBuy, 49999, 1))
+		check("bids only", false, true)
+		ob.AddOrder(domain.NewLimitOrder("a1", "BTCUSDT", "u", domain.SideSell, 50001, 1))
+		check("two-sided", false, false)
+		ob.CancelOrder("b1")
+		check("asks only", true, false)
+		ob.CancelOrder("a1")
+		check("emptied", true, true)
+	}
+}
+
+// TestBestPriceAfterLevelDelete 删除最佳档位后最佳价回落到下一档，不残留旧指针
+// 覆盖同一 bucket 内、跨 bucket（bucket 清空）以及买卖两侧
+func TestBestPriceAfterLevelDelete(t *testing.T) {
+	for _, treeType := range []PriceTreeType{HashMapListType, ShardedType} {
+		for _, prices := range [][]int64{{50001, 50002, 50003}, {50001, 50017, 50033}} {
+			ob := NewOrderBookWithTree("BTCUSDT", treeType, 16)
+			for i, price := range prices {
+				ob.AddOrder(domain.NewLimitOrder(fmt.Sprintf("a%d", i), "BTCUSDT", "u", domain.SideSell, price, 1))
+				ob.AddOrder(domain.NewLimitOrder(fmt.Sprintf("b%d", i), "BTCUSDT", "u", domain.SideBuy, 100000-price, 1))
+			}
+			// 最佳档位有两个订单：撤掉一个不应改变最佳价
+			ob.AddOrder(domain.NewLimitOrder("a0-2", "BTCUSDT", "u", domain.SideSell, prices[0], 1))
+			ob.CancelOrder("a0")
+			if got := ob.GetBestAsk(); got != prices[0] {
+				t.Fatalf("%v %v: best ask %d after a partial level cancel, want %d", treeType, prices, got, prices[0])
+			}
+
+			ob.CancelOrder("a0-2")
+			ob.CancelOrder("b0")
+			if got := ob.GetBestAsk(); got != prices[1] {
+				t.Errorf("%v %v: best ask %d after deleting the best level, want %d", treeType, prices, got, prices[1])
+			}
+			if got := ob.GetBestBid(); got != 100000-prices[1] {
+				t.Errorf("%v %v: best bid %d after deleting the best level, want %d", treeType, prices, got, 100000-prices[1])
+			}
+			if level := ob.GetBestSellLevel(); level == nil || level.Orders.Len() != 1 {
+				t.Errorf("%v %v: best ask level stale or empty: %+v", treeType, prices, level)
+			}
+
+			ob.CancelOrder("a1")
+			ob.CancelOrder("a2")
+			if got := ob.GetBestAsk(); got != 0 || ob.GetBestSellLevel() != nil {
+				t.Errorf("%v %v: emptied ask side still reports best %d", treeType, prices, got)
+			}
+		}
+	}
+}
+
+// TestTotalNotional 多档位手算名义金额；成交、减量、撤单后增量维护与逐档遍历一致；溢出时饱和
+func TestTotalNotional(t *testing.T) {
+	for _, treeType := range []PriceTreeType{HashMapListType, ShardedType} {
+		ob := NewOrderBookWithTree("BTCUSDT", treeType, 16)
+		ob.AddOrder(domain.NewLimitOrder("b1", "BTCUSDT", "u", domain.SideBuy, 100, 3))
+		ob.AddOrder(domain.NewLimitOrder("b2", "BTCUSDT", "u", domain.SideBuy, 100, 2))
+		ob.AddOrder(domain.NewLimitOrder("b3", "BTCUSDT", "u", domain.SideBuy, 98, 10))
+		hidden := domain.NewLimitOrder("b4", "BTCUSDT", "u", domain.SideBuy, 95, 4)
+		hidden.ExecInst = domain.ExecHidden
+		ob.AddOrder(hidden)
+		ob.AddOrder(domain.NewLimitOrder("a1", "BTCUSDT", "u", domain.SideSell, 101, 7))
+
+		// 100*5 + 98*10 + 95*4 = 1860
+		if got := ob.TotalNotional(domain.SideBuy); got != 1860 {
+			t.Errorf("%v: bid notional %d, want 1860", treeType, got)
+		}
+		if got := ob.TotalNotional(domain.SideSell); got != 707 {
+			t.Errorf("%v: ask notional %d, want 707", treeType, got)
+		}
+
+		ob.FillOrder(ob.GetOrder("b1"), 1)   // -100
+		ob.ReduceOrder(ob.GetOrder("b3"), 4) // -392
+		ob.CancelOrder("b4")                 // -380
+		ob.FillOrder(ob.GetOrder("a1"), 7)   // 卖方清空
+		if got := ob.TotalNotional(domain.SideBuy); got != 988 {
+			t.Errorf("%v: bid notional %d after fill/reduce/cancel, want 988", treeType, got)
+		}
+		var walked int64
+		for level := range ob.Levels(domain.SideBuy) {
+			walked += level.Price * level.Volume
+		}
+		if walked != 988 || ob.TotalNotional(domain.SideSell) != 0 {
+			t.Errorf("%v: traversal %d, ask notional %d", treeType, walked, ob.TotalNotional(domain.SideSell))
+		}
+
+		// 超出 int64 时饱和；撤掉后恢复精确值
+		ob.AddOrder(domain.NewLimitOrder("huge", "BTCUSDT", "u", domain.SideBuy, math.MaxInt64/2, 4))
+		if got := ob.TotalNotional(domain.SideBuy); got != math.MaxInt64 {
+			t.Errorf("%v: expected saturation, got %d", treeType, got)
+		}
+		ob.CancelOrder("huge")
+		if got := ob.TotalNotional(domain.SideBuy); got != 988 {
+			t.Errorf("%v: after removing the huge order %d, want 988", treeType, got)
+		}
+	}
+}
+
+// TestEqual 逐价位、逐订单比较两个订单簿，队列顺序不同也算不同
+func TestEqual(t *testing.T) {
+	build := func(ids ...string) *OrderBook {
+		ob := NewOrderBook("BTCUSDT")
+		for _, id := range ids {
+			ob.AddOrder(domain.NewLimitOrder(id, "BTCUSDT", "u1", domain.SideBuy, 49900, 10))
+		}
+		ob.AddOrder(domain.NewLimitOrder("s1", "BTCUSDT", "u2", domain.SideSell, 50100, 5))
+		return ob
+	}
+
+	a := build("b1", "b2")
+	if equal, diff := a.Equal(build("b1", "b2")); !equal || diff != "" {
+		t.Errorf("identical books reported different: %s", diff)
+	}
+
+	// 总量和订单数相同，仅 FIFO 顺序不同
+	if equal, diff := a.Equal(build("b2", "b1")); equal || !strings.Contains(diff, "position 0") {
+		t.Errorf("FIFO difference not detected: %v %q", equal, diff)
+	}
+
+	b := build("b1", "b2")
+	b.FillOrder(b.GetOrder("b2"), 3)
+	if equal, diff := a.Equal(b); equal || !strings.Contains(diff, "volume") {
+		t.Errorf("volume difference not detected: %v %q", equal, diff)
+	}
+
+	c := build("b1", "b2")
+	c.AddOrder(domain.NewLimitOrder("s2", "BTCUSDT", "u2", domain.SideSell, 50200, 5))
+	if equal, diff := a.Equal(c); equal || !strings.Contains(diff, "asks: 1 levels != 2") {
+		t.Errorf("extra level not detected: %v %q", equal, diff)
+	}
+
+	if equal, _ := a.Equal(NewOrderBook("ETHUSDT")); equal {
+		t.Error("books of different symbols reported equal")
+	}
+}
+
+// TestCancelOlderThan 撤销截止时间之前受理的挂单，新单保留，每笔撤单发出 L3Cancel
+func TestCancelOlderThan(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	var events []L3Event
+	ob.SetL3Handler(func(event L3Event) { events = append(events, event) })
+
+	cutoff := time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)
+	add := func(id string, side domain.Side, price int64, age time.Duration) {
+		order := domain.NewLimitOrder(id, "BTCUSDT", "u1", side, price, 10)
+		order.Timestamp = cutoff.Add(-age)
+		ob.AddOrder(order)
+	}
+	add("old-b1", domain.SideBuy, 49900, time.Hour)
+	add("new-b2", domain.SideBuy, 49900, -time.Minute)
+	add("old-b3", domain.SideBuy, 49800, time.Second)
+	add("new-s1", domain.SideSell, 50100, 0) // 恰好等于截止时间：不算过旧
+	add("old-s2", domain.SideSell, 50200, time.Minute)
+	events = events[:0]
+
+	cancelled := ob.CancelOlderThan(cutoff)
+	if want := []string{"old-b1", "old-b3", "old-s2"}; !reflect.DeepEqual(cancelled, want) {
+		t.Errorf("cancelled %v, want %v", cancelled, want)
+	}
+	if len(events) != 3 || events[0].Type != L3Cancel || events[0].OrderID != "old-b1" || events[0].Remaining != 0 {
+		t.Errorf("expected one L3Cancel per order, got %+v", events)
+	}
+
+	bids, asks := ob.GetDepth(5)
+	if len(bids) != 1 || bids[0].Orders != 1 || ob.GetOrder("new-b2") == nil {
+		t.Errorf("unexpected bids after cleanup: %+v", bids)
+	}
+	if len(asks) != 1 || asks[0].Price != 50100 {
+		t.Errorf("unexpected asks after cleanup: %+v", asks)
+	}
+
+	if again := ob.CancelOlderThan(cutoff); len(again) != 0 {
+		t.Errorf("second sweep cancelled %v", again)
+	}
+}
+
+// TestHiddenOrderL3 隐藏单的挂单、成交、减量、撤单都不出现在 L3 流中，也不推进序号
+func TestHiddenOrderL3(t *testing.T) {
+	ob := NewOrderBook("BTCUSDT")
+	var events []L3Event
+	ob.SetL3Handler(func(event L3Event) { events = append(events, event) })
+
+	hidden := domain.NewLimitOrder("H1", "BTCUSDT", "u1", domain.SideSell, 50000, 10)
+	hidden.ExecInst = domain.ExecHidden
+	ob.AddOrder(hidden)
+	ob.FillOrder(hidden, 3)
+	ob.ReduceOrder(hidden, 2)
+	ob.CancelOrder("H1")
+	if len(events) != 0 || ob.Seq() != 0 {
+		t.Fatalf("hidden order published on L3: seq %d events %+v", ob.Seq(), events)
+	}
+
+	// 公开挂单照常发布，序号连续
+	ob.AddOrder(domain.NewLimitOrder("S1", "BTCUSDT", "u2", domain.SideSell, 50010, 4))
+	if len(events) != 1 || events[0].OrderID != "S1" || events[0].Seq != 1 {
+		t.Errorf("displayed add not published as seq 1: %+v", events)
+	}
+}
+
+// TestUncrossRepairEmptyLevelAndIceberg 修复交叉时跳过空的最优档，冰山单按展示量成交并补充
+func TestUncrossRepairEmptyLevelAndIceberg(t *testing.T) {
+	for _, tt := range integrityTreeTypes {
+		ob := NewOrderBookWithTree("BTCUSDT", tt.treeType, tt.bucketSize)
+
+		// 空的最优卖档：只从链表摘掉订单，不经过树
+		stale := domain.NewLimitOrder("S0", "BTCUSDT", "u", domain.SideSell, 50000, 1)
+		ob.AddOrder(stale)
+		ob.GetBestSellLevel().Orders.Remove(stale.ListElement.(*list.Element))
+		stale.ListElement = nil
+
+		iceberg := domain.NewLimitOrder("ICE", "BTCUSDT", "u", domain.SideSell, 50050, 6)
+		iceberg.DisplayQty = 2
+		ob.AddOrder(iceberg)
+		ob.AddOrder(domain.NewLimitOrder("B1", "BTCUSDT", "v", domain.SideBuy, 50100, 5))
+
+		trades := ob.UncrossRepair()
+		var total int64
+		for _, trade := range trades {
+			if trade.Quantity > iceberg.DisplayQty {
+				t.Errorf("%s: trade of %d exceeds the iceberg slice", tt.name, trade.Quantity)
+			}
+			total += trade.Quantity
+		}
+		if total != 5 {
+			t.Errorf("%s: repaired %d, want 5", tt.name, total)
+		}
+		if iceberg.RemainingQuantity() != 1 || iceberg.ShownQty != 1 {
+			t.Errorf("%s: iceberg remaining %d shown %d, want 1 and 1", tt.name, iceberg.RemainingQuantity(), iceberg.ShownQty)
+		}
+		if bid, ask := ob.GetBestBid(), ob.GetBestAsk(); bid != 0 || ask != 50050 {
+			t.Errorf("%s: best bid %d / ask %d after repair", tt.name, bid, ask)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package orderbook
 
 import (
 	"container/list"
+	"lightning-exchange/domain"
+	"math"
 	"math/rand"
 	"testing"
 
@@ -512,3 +514,178 @@ func BenchmarkShardedTree_Remove(b *testing.B) {
 		}
 	}
 }
+
+// ============ 分片树 bucket 大小调优 Benchmark ============
+// 集中分布：1000 个档位落在连续 1000 tick 内
+// 分散分布：1000 个档位每隔 97 tick 一个（跨度约 10 万 tick）
+
+func generateSpreadPrices(n int, step int64) []int64 {
+	prices := make([]int64, n)
+	for i := 0; i < n; i++ {
+		prices[i] = 50000 + int64(i)*step
+	}
+	rand.Shuffle(n, func(i, j int) {
+		prices[i], prices[j] = prices[j], prices[i]
+	})
+	return prices
+}
+
+func benchmarkBucketSize(b *testing.B, bucketSize int64, prices []int64) {
+	orders := make([]*domain.Order, len(prices))
+	for i, price := range prices {
+		orders[i] = &domain.Order{Price: price, Quantity: 1, Side: domain.SideSell}
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree := NewPriceTreeWithBucketSize(ShardedType, false, bucketSize)
+		for _, order := range orders {
+			tree.Insert(order)
+		}
+		for _, order := range orders {
+			tree.Remove(order)
+		}
+	}
+}
+
+func BenchmarkBucketSize_Clustered_32(b *testing.B) {
+	benchmarkBucketSize(b, 32, generateSpreadPrices(1000, 1))
+}
+
+func BenchmarkBucketSize_Clustered_128(b *testing.B) {
+	benchmarkBucketSize(b, 128, generateSpreadPrices(1000, 1))
+}
+
+func BenchmarkBucketSize_Clustered_1024(b *testing.B) {
+	benchmarkBucketSize(b, 1024, generateSpreadPrices(1000, 1))
+}
+
+func BenchmarkBucketSize_Spread_32(b *testing.B) {
+	benchmarkBucketSize(b, 32, generateSpreadPrices(1000, 97))
+}
+
+func BenchmarkBucketSize_Spread_128(b *testing.B) {
+	benchmarkBucketSize(b, 128, generateSpreadPrices(1000, 97))
+}
+
+func BenchmarkBucketSize_Spread_1024(b *testing.B) {
+	benchmarkBucketSize(b, 1024, generateSpreadPrices(1000, 97))
+}
+
+// ============ 真实价格分布 Benchmark：围绕中间价聚集 + 少量远端挂单 ============
+// 顺序价格无法体现真实订单簿：大部分订单挤在中间价附近少数档位（高斯分布），
+// 偶尔有远离盘口的挂单（远端离群值）。前者考验 bucket 内链表的 O(n) 插入，
+// 后者让分片树的 bucket 分布变得稀疏。
+// 每轮：逐个插入（每次插入后查询最佳价格，模拟撮合读盘口），再按随机顺序撤单。
+
+// clusteredTree 三种实现在该场景下共同的操作
+type clusteredTree interface {
+	Insert(order *domain.Order)
+	Remove(order *domain.Order)
+	GetBestPrice() domain.Price
+}
+
+// generateClusteredOrders 生成 n 个卖单：价格 ~ N(mid, sigma)，outlierRate 比例的订单
+// 落在中间价之外 5000~50000 tick 处；同一价格可有多个订单
+func generateClusteredOrders(n int, sigma float64, outlierRate float64) []*domain.Order {
+	const mid = 50000
+	rng := rand.New(rand.NewSource(42))
+	orders := make([]*domain.Order, n)
+	for i := range orders {
+		price := mid + int64(math.Round(rng.NormFloat64()*sigma))
+		if rng.Float64() < outlierRate {
+			price = mid + 5000 + rng.Int63n(45000)
+		}
+		orders[i] = &domain.Order{Price: max(price, 1), Quantity: 1, Side: domain.SideSell}
+	}
+	return orders
+}
+
+// rbOrderTree 按订单维护档位的红黑树（gods），与正式价格树的 Insert/Remove 语义一致
+type rbOrderTree struct {
+	tree *rbt.Tree[int64, *PriceLevel_]
+}
+
+func newRBOrderTree() *rbOrderTree {
+	return &rbOrderTree{tree: rbt.New[int64, *PriceLevel_]()} // 卖方：价格从低到高
+}
+
+func (r *rbOrderTree) Insert(order *domain.Order) {
+	level, found := r.tree.Get(order.Price)
+	if !found {
+		level = &PriceLevel_{Price: order.Price, Orders: list.New()}
+		r.tree.Put(order.Price, level)
+	}
+	order.ListElement = level.Orders.PushBack(order)
+	level.Volume += order.RemainingQuantity()
+}
+
+func (r *rbOrderTree) Remove(order *domain.Order) {
+	level, found := r.tree.Get(order.Price)
+	if !found || order.ListElement == nil {
+		return
+	}
+	level.Orders.Remove(order.ListElement.(*list.Element))
+	order.ListElement = nil
+	level.Volume -= order.RemainingQuantity()
+	if level.Orders.Len() == 0 {
+		r.tree.Remove(order.Price)
+	}
+}
+
+func (r *rbOrderTree) GetBestPrice() domain.Price {
+	if node := r.tree.Left(); node != nil {
+		return node.Key
+	}
+	return 0
+}
+
+func benchmarkClustered(b *testing.B, newTree func() clusteredTree, orders []*domain.Order) {
+	cancels := make([]*domain.Order, len(orders))
+	copy(cancels, orders)
+	rand.New(rand.NewSource(7)).Shuffle(len(cancels), func(i, j int) {
+		cancels[i], cancels[j] = cancels[j], cancels[i]
+	})
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree := newTree()
+		for _, order := range orders {
+			tree.Insert(order)
+			_ = tree.GetBestPrice()
+		}
+		for _, order := range cancels {
+			tree.Remove(order)
+		}
+	}
+}
+
+// clusteredScenarios: 紧密聚集（sigma 20 tick）与较宽聚集（sigma 200 tick），均带 2% 远端挂单
+var clusteredScenarios = []struct {
+	name  string
+	sigma float64
+}{
+	{"Tight", 20},
+	{"Wide", 200},
+}
+
+func BenchmarkClustered(b *testing.B) {
+	trees := []struct {
+		name    string
+		newTree func() clusteredTree
+	}{
+		{"HashMapList", func() clusteredTree { return NewPriceTreeWithType(HashMapListType, false) }},
+		{"Sharded_32", func() clusteredTree { return NewPriceTreeWithBucketSize(ShardedType, false, 32) }},
+		{"Sharded_128", func() clusteredTree { return NewPriceTreeWithBucketSize(ShardedType, false, 128) }},
+		{"Sharded_1024", func() clusteredTree { return NewPriceTreeWithBucketSize(ShardedType, false, 1024) }},
+		{"RedBlackTree", func() clusteredTree { return newRBOrderTree() }},
+	}
+	for _, scenario := range clusteredScenarios {
+		orders := generateClusteredOrders(5000, scenario.sigma, 0.02)
+		for _, tree := range trees {
+			b.Run(scenario.name+"/"+tree.name, func(b *testing.B) {
+				benchmarkClustered(b, tree.newTree, orders)
+			})
+		}
+	}
+}
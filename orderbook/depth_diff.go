@@ -0,0 +1,53 @@
+package orderbook
+
+// DepthAction is the kind of change a DepthDelta applies to a price level
+type DepthAction uint8
+
+const (
+	DepthAdd    DepthAction = iota + 1 // level not present before
+	DepthUpdate                        // level present, quantity or order count changed
+	DepthRemove                        // level no longer present
+)
+
+// DepthDelta is one level change needed to bring a depth snapshot up to date
+// For DepthRemove only Price is meaningful.
+type DepthDelta struct {
+	Action   DepthAction
+	Price    int64
+	Quantity int64
+	Orders   int
+	Seq      int64 // book Seq the change brings the level up to (0 if the producer doesn't track it)
+}
+
+// DiffDepth returns the minimal set of deltas that transforms old into new
+// Both slices are one side of the book (as returned by GetDepth); levels are matched
+// by price, so their order doesn't matter. Unchanged levels produce no delta.
+// Removals come first (in old's order), then additions and updates (in new's order).
+// Returns nil if the two are identical.
+func DiffDepth(old, new []PriceLevel) []DepthDelta {
+	oldLevels := make(map[int64]PriceLevel, len(old))
+	for _, level := range old {
+		oldLevels[level.Price] = level
+	}
+	newPrices := make(map[int64]struct{}, len(new))
+	for _, level := range new {
+		newPrices[level.Price] = struct{}{}
+	}
+
+	var deltas []DepthDelta
+	for _, level := range old {
+		if _, ok := newPrices[level.Price]; !ok {
+			deltas = append(deltas, DepthDelta{Action: DepthRemove, Price: level.Price})
+		}
+	}
+	for _, level := range new {
+		prev, ok := oldLevels[level.Price]
+		switch {
+		case !ok:
+			deltas = append(deltas, DepthDelta{Action: DepthAdd, Price: level.Price, Quantity: level.Quantity, Orders: level.Orders})
+		case prev != level:
+			deltas = append(deltas, DepthDelta{Action: DepthUpdate, Price: level.Price, Quantity: level.Quantity, Orders: level.Orders})
+		}
+	}
+	return deltas
+}
@@ -0,0 +1,89 @@
+package orderbook
+
+import "lightning-exchange/domain"
+
+// SetMaxDepth limits each side of the book to its best levels price levels (<= 0 = unlimited)
+// Bounds memory for symbols that accumulate stale far orders. Enforced in two ways:
+//   - BeyondDepth lets the caller reject a new order that would open a level worse than
+//     the last kept level
+//   - when a new level opens inside the kept depth on a full side, the worst level is
+//     pruned: its orders, although previously accepted, are cancelled and reported to
+//     the prune handler (SetPruneHandler)
+//
+// Lock-free: Only called by the matching thread (or before the engine is started)
+func (ob *OrderBook) SetMaxDepth(levels int) {
+	ob.maxDepth = max(levels, 0)
+	if ob.maxDepth > 0 {
+		ob.pruneBeyondDepth(domain.SideBuy)
+		ob.pruneBeyondDepth(domain.SideSell)
+	}
+}
+
+// SetPruneHandler installs a callback notified of each order cancelled by depth pruning
+// The order is already out of the book (status cancelled) when the handler runs.
+// Lock-free: Only called by the matching thread (or before the engine is started)
+func (ob *OrderBook) SetPruneHandler(handler func(order *domain.Order)) {
+	ob.onPrune = handler
+}
+
+// MaxDepth returns the per-side level limit (0 = unlimited)
+func (ob *OrderBook) MaxDepth() int {
+	return ob.maxDepth
+}
+
+// BeyondDepth reports whether a resting order at price would open a level outside the
+// kept depth on side (the side is full and price is worse than its last kept level)
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) BeyondDepth(side domain.Side, price int64) bool {
+	tree := ob.treeFor(side)
+	if ob.maxDepth == 0 || tree.Size() < ob.maxDepth || tree.GetLevel(price) != nil {
+		return false
+	}
+
+	var last int64
+	n := 0
+	tree.Walk(func(level *PriceLevel_) bool {
+		last = level.Price
+		n++
+		return n < ob.maxDepth
+	})
+	if ob.descending(side) {
+		return price < last
+	}
+	return price > last
+}
+
+// pruneBeyondDepth cancels all orders on levels past maxDepth on side
+// Each cancelled order is reported to the prune handler. Returns the number cancelled.
+func (ob *OrderBook) pruneBeyondDepth(side domain.Side) int {
+	tree := ob.treeFor(side)
+	if ob.maxDepth == 0 || tree.Size() <= ob.maxDepth {
+		return 0
+	}
+
+	var evict []*domain.Order
+	n := 0
+	tree.Walk(func(level *PriceLevel_) bool {
+		if n++; n > ob.maxDepth {
+			for e := level.Orders.Front(); e != nil; e = e.Next() {
+				evict = append(evict, e.Value.(*domain.Order))
+			}
+		}
+		return true
+	})
+	for _, order := range evict {
+		ob.CancelOrder(order.ID)
+		if ob.onPrune != nil {
+			ob.onPrune(order)
+		}
+	}
+	return len(evict)
+}
+
+// treeFor returns the price tree holding side's orders
+func (ob *OrderBook) treeFor(side domain.Side) PriceTreeInterface {
+	if side == domain.SideBuy {
+		return ob.bids
+	}
+	return ob.asks
+}
@@ -0,0 +1,39 @@
+package orderbook
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dump renders the top maxLevels bids and asks as an aligned text table for debugging
+// Each section lists its best level first:
+//
+//	BTCUSDT top 2 levels
+//	ASKS          price       volume  orders
+//	              50000           10       1
+//	              50010           25       3
+//	BIDS          price       volume  orders
+//	              49990            5       1
+//
+// Read-only. Lock-free: Only called by the matching thread
+func (ob *OrderBook) Dump(maxLevels int) string {
+	bids, asks := ob.GetDepth(maxLevels)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s top %d levels\n", ob.symbol, maxLevels)
+	dumpSide(&b, "ASKS", asks)
+	dumpSide(&b, "BIDS", bids)
+	return b.String()
+}
+
+// dumpSide writes one section of Dump
+func dumpSide(b *strings.Builder, title string, levels []PriceLevel) {
+	fmt.Fprintf(b, "%-4s %14s %12s %7s\n", title, "price", "volume", "orders")
+	if len(levels) == 0 {
+		fmt.Fprintf(b, "%19s\n", "(empty)")
+		return
+	}
+	for _, level := range levels {
+		fmt.Fprintf(b, "%-4s %14d %12d %7d\n", "", level.Price, level.Quantity, level.Orders)
+	}
+}
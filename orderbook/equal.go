@@ -0,0 +1,60 @@
+package orderbook
+
+import (
+	"fmt"
+	"lightning-exchange/domain"
+)
+
+// Equal compares two books level by level and order by order
+// Returns true and "" when they hold the same resting state; otherwise false and a
+// human-readable description of the first difference found (bids before asks, best level first).
+// Each level's queue is compared in FIFO order, so two books with the same depth but a
+// different time priority are not equal. Per order it compares ID, price and remaining
+// quantity, what every restore path preserves (an L3 replay carries no UserID or timestamps).
+// For validating Snapshot/LoadSnapshot round trips and ApplyL3 replays.
+// Lock-free: Only called by the matching thread (of both books)
+func (ob *OrderBook) Equal(other *OrderBook) (bool, string) {
+	if ob.symbol != other.symbol {
+		return false, fmt.Sprintf("symbol %s != %s", ob.symbol, other.symbol)
+	}
+	if diff := diffSide("bids", ob.bids, other.bids); diff != "" {
+		return false, diff
+	}
+	if diff := diffSide("asks", ob.asks, other.asks); diff != "" {
+		return false, diff
+	}
+	return true, ""
+}
+
+// diffSide describes the first difference between two trees of the same side ("" if none)
+func diffSide(side string, a, b PriceTreeInterface) string {
+	levelsA, levelsB := a.GetDepth(a.Size()), b.GetDepth(b.Size())
+	for i := 0; i < min(len(levelsA), len(levelsB)); i++ {
+		la, lb := levelsA[i], levelsB[i]
+		if la.Price != lb.Price {
+			return fmt.Sprintf("%s: best+%d level price %d != %d", side, i, la.Price, lb.Price)
+		}
+		if la.Volume != lb.Volume {
+			return fmt.Sprintf("%s level %d: volume %d != %d", side, la.Price, la.Volume, lb.Volume)
+		}
+		if la.Orders.Len() != lb.Orders.Len() {
+			return fmt.Sprintf("%s level %d: %d orders != %d", side, la.Price, la.Orders.Len(), lb.Orders.Len())
+		}
+		pos := 0
+		for ea, eb := la.Orders.Front(), lb.Orders.Front(); ea != nil; ea, eb = ea.Next(), eb.Next() {
+			x, y := ea.Value.(*domain.Order), eb.Value.(*domain.Order)
+			if x.ID != y.ID {
+				return fmt.Sprintf("%s level %d position %d: order %s != %s", side, la.Price, pos, x.ID, y.ID)
+			}
+			if x.RemainingQuantity() != y.RemainingQuantity() {
+				return fmt.Sprintf("%s level %d order %s: remaining %d != %d",
+					side, la.Price, x.ID, x.RemainingQuantity(), y.RemainingQuantity())
+			}
+			pos++
+		}
+	}
+	if len(levelsA) != len(levelsB) {
+		return fmt.Sprintf("%s: %d levels != %d", side, len(levelsA), len(levelsB))
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package orderbook
+
+import (
+	"container/heap"
+	"lightning-exchange/domain"
+	"time"
+)
+
+// expiryEntry records a GTD order in the expiry heap
+// expireAt is copied so a recycled (pooled) order can't corrupt heap ordering
+type expiryEntry struct {
+	order    *domain.Order
+	expireAt time.Time
+}
+
+// expiryHeap is a min-heap of GTD orders keyed by expiry time
+// Cancelled/filled orders are not removed eagerly; they are skipped when popped
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expireAt.Before(h[j].expireAt) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = expiryEntry{}
+	*h = old[:n-1]
+	return entry
+}
+
+// trackExpiry registers a GTD order for expiry sweeping
+func (ob *OrderBook) trackExpiry(order *domain.Order) {
+	if order.ExpireAt.IsZero() {
+		return
+	}
+	heap.Push(&ob.expiries, expiryEntry{order: order, expireAt: order.ExpireAt})
+}
+
+// SetExpiry changes a resting order's GTD expiry in place, keeping its queue position
+// A zero expireAt makes the order good-till-cancel. The superseded heap entry no longer
+// matches the order's ExpireAt and is discarded when it reaches the top.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) SetExpiry(order *domain.Order, expireAt time.Time) {
+	order.ExpireAt = expireAt
+	ob.trackExpiry(order)
+}
+
+// HasPendingExpiries reports whether any GTD order is waiting to expire
+// Stale entries for already removed orders may make this true until they are swept
+func (ob *OrderBook) HasPendingExpiries() bool {
+	return len(ob.expiries) > 0
+}
+
+// NextExpiry returns the earliest tracked GTD expiry time (zero if none)
+// May belong to an order already removed; such entries are discarded by ExpireOrders
+func (ob *OrderBook) NextExpiry() time.Time {
+	if len(ob.expiries) == 0 {
+		return time.Time{}
+	}
+	return ob.expiries[0].expireAt
+}
+
+// ExpireOrders removes resting GTD orders whose expiry is at or before now
+// At most max orders are expired per call (max <= 0 means unbounded), so a burst of
+// simultaneous expiries can be spread across several calls instead of one long stall.
+// Returns the number of orders expired.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) ExpireOrders(now time.Time, max int) int {
+	expired := 0
+	for len(ob.expiries) > 0 && (max <= 0 || expired < max) {
+		entry := ob.expiries[0]
+		if entry.expireAt.After(now) {
+			break
+		}
+		heap.Pop(&ob.expiries)
+
+		// Skip orders that were cancelled/filled (or recycled) since they were tracked
+		order := entry.order
+		if ob.orders[order.ID] != order || !order.ExpireAt.Equal(entry.expireAt) {
+			continue
+		}
+
+		ob.emitL3(L3Cancel, order, publicQty(order), 0)
+		ob.removeOrder(order)
+		order.Expire()
+		expired++
+	}
+	return expired
+}
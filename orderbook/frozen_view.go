@@ -0,0 +1,42 @@
+package orderbook
+
+import "lightning-exchange/domain"
+
+// ReadOnlyBook is the query surface of an order book inside WithFrozenView
+// All methods return copies; none of them mutate the book.
+type ReadOnlyBook interface {
+	GetBestBid() int64
+	GetBestAsk() int64
+	GetDepth(levels int) (bids, asks []PriceLevel)
+
+	// Seq returns the sequence number of the last book change the view reflects
+	Seq() int64
+
+	// LevelAt returns the aggregate for one price level (zero PriceLevel if none)
+	LevelAt(side domain.Side, price int64) PriceLevel
+
+	VolumeInRange(side domain.Side, fromPrice, toPrice int64) int64
+	EstimateCostToFill(side domain.Side, targetQty int64) (totalCost int64, avgPrice int64, fullyFilled bool)
+}
+
+// Ensure OrderBook implements ReadOnlyBook
+var _ ReadOnlyBook = (*OrderBook)(nil)
+
+// WithFrozenView runs fn with a read-only view of the book
+// Every query made inside fn observes the same book state, so several reads
+// (BBO, depth, a specific level) are mutually consistent. fn must not retain the view.
+// Lock-free: Only called by the matching thread (see MatchingEngine.WithFrozenView)
+func (ob *OrderBook) WithFrozenView(fn func(ReadOnlyBook)) {
+	fn(ob)
+}
+
+// LevelAt returns the aggregate for one price level (zero PriceLevel if none)
+// Like GetDepth it is the displayed aggregate: hidden orders are not counted.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) LevelAt(side domain.Side, price int64) PriceLevel {
+	level := ob.GetLevel(side, price)
+	if level == nil {
+		return PriceLevel{}
+	}
+	return ob.displayed(side, level)
+}
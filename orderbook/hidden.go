@@ -0,0 +1,119 @@
+package orderbook
+
+import (
+	"container/list"
+	"lightning-exchange/domain"
+)
+
+// levelKey identifies a price level on one side of the book
+type levelKey struct {
+	side  domain.Side
+	price domain.Price
+}
+
+// hiddenLevel is the part of a level's aggregate not on display: hidden orders
+// (volume and count) and iceberg reserves (volume only; the iceberg itself is displayed)
+type hiddenLevel struct {
+	volume int64
+	orders int
+}
+
+// trackHidden adjusts the hidden aggregate of a hidden order's or iceberg's level
+// Only called for orders flagged domain.ExecHidden and for icebergs; entries are dropped
+// once nothing hidden is left at the level.
+func (ob *OrderBook) trackHidden(order *domain.Order, volume int64, orders int) {
+	if ob.hidden == nil {
+		ob.hidden = make(map[levelKey]hiddenLevel)
+	}
+	key := levelKey{order.Side, order.Price}
+	h := ob.hidden[key]
+	h.volume += volume
+	h.orders += orders
+	if h.orders <= 0 && h.volume <= 0 {
+		delete(ob.hidden, key)
+		return
+	}
+	ob.hidden[key] = h
+}
+
+// displayed returns the public aggregate of a level, excluding hidden orders
+// Hidden orders keep their normal price-time priority; only what is shown changes.
+func (ob *OrderBook) displayed(side domain.Side, level *PriceLevel_) PriceLevel {
+	h := ob.hidden[levelKey{side, level.Price}]
+	return PriceLevel{
+		Price:    level.Price,
+		Quantity: level.Volume - h.volume,
+		Orders:   level.Orders.Len() - h.orders,
+	}
+}
+
+// trackReserve adjusts the hidden aggregate by an iceberg's reserve change (no-op if 0)
+func (ob *OrderBook) trackReserve(order *domain.Order, volume int64) {
+	if volume != 0 {
+		ob.trackHidden(order, volume, 0)
+	}
+}
+
+// publicQty is an order's resting quantity as published on L3: an iceberg's current
+// slice (its reserve stays off the feed), otherwise its remaining quantity
+func publicQty(order *domain.Order) int64 {
+	if order.IsIceberg() {
+		return order.ShownQty
+	}
+	return order.RemainingQuantity()
+}
+
+// reserve returns the part of an iceberg's remaining quantity outside the current slice
+func reserve(order *domain.Order) int64 {
+	return order.RemainingQuantity() - order.ShownQty
+}
+
+// RefillIceberg shows the next slice of an iceberg whose current slice has been consumed
+// The slice is min(slice, remaining) and the order moves to the back of its level's queue:
+// a refill is new displayed liquidity and takes no time priority from the orders it joins.
+// L3 consumers only ever see slices: the consumed slice already left the feed with
+// Remaining 0, so a refill is a re-add of the order with the new slice. Returns false (and does nothing)
+// unless order is a resting iceberg with an empty slice and quantity left.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) RefillIceberg(order *domain.Order, slice int64) bool {
+	level := ob.levelOf(order)
+	if !order.IsIceberg() || order.ShownQty > 0 || order.IsFilled() || level == nil || ob.orders[order.ID] != order {
+		return false
+	}
+	order.ShownQty = max(min(slice, order.RemainingQuantity()), 1)
+	ob.trackReserve(order, -order.ShownQty)
+
+	if elem, ok := order.ListElement.(*list.Element); ok {
+		level.Orders.MoveToBack(elem)
+	}
+	ob.emitL3(L3Add, order, order.ShownQty, order.ShownQty)
+	return true
+}
+
+// DisplayedBBO returns the best bid and ask prices with displayed orders (0 for an empty side)
+// Unlike GetBestBid/GetBestAsk it skips levels holding only hidden orders, so it is the
+// public quote; midpoint (dark) orders are priced off it.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) DisplayedBBO() (bid, ask int64) {
+	if level, ok := ob.bestDisplayed(domain.SideBuy); ok {
+		bid = level.Price
+	}
+	if level, ok := ob.bestDisplayed(domain.SideSell); ok {
+		ask = level.Price
+	}
+	return bid, ask
+}
+
+// displayedDepth returns up to levels displayed levels of side, skipping fully hidden ones
+func (ob *OrderBook) displayedDepth(side domain.Side, levels int) []PriceLevel {
+	var depth []PriceLevel
+	for level := range ob.Levels(side) {
+		if len(depth) >= levels {
+			break
+		}
+		if shown := ob.displayed(side, level); shown.Orders > 0 {
+			depth = append(depth, shown)
+		}
+	}
+	return depth
+}
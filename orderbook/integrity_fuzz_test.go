@@ -0,0 +1,200 @@
+package orderbook
+
+import (
+	"fmt"
+	"lightning-exchange/domain"
+	"math/rand"
+	"testing"
+)
+
+// 订单簿完整性模糊测试
+// 随机执行 AddOrder / CancelOrder / 撮合（UncrossRepair）/ 减量（ReduceOrder），
+// 每一步之后校验不变量：
+//   1. 最佳价格等于实际存在订单的极值价格
+//   2. 每个档位的 Volume 等于其订单剩余数量之和
+//   3. 不存在空档位，Size() 与实际档位数一致
+//   4. 双边都有订单时 best bid < best ask
+//   5. 增量维护的名义金额等于逐单 price * 剩余数量之和
+
+// integrityTreeTypes 需要覆盖的价格树实现
+var integrityTreeTypes = []struct {
+	name       string
+	treeType   PriceTreeType
+	bucketSize int64
+}{
+	{"HashMapList", HashMapListType, 0},
+	{"Sharded", ShardedType, DefaultBucketSize},
+	{"ShardedSmallBucket", ShardedType, 16}, // 小 bucket：更容易触发 bucket 创建/删除
+}
+
+// integrityOp 根据两个随机字节对订单簿执行一个操作
+func integrityOp(ob *OrderBook, live map[string]*domain.Order, seq *int, op, arg byte) {
+	switch op % 4 {
+	case 0, 1: // 挂单（价格集中在 49900-50100，偶尔跨 bucket）
+		*seq++
+		side := domain.SideBuy
+		if arg&1 == 1 {
+			side = domain.SideSell
+		}
+		price := 50000 + int64(arg%200) - 100
+		order := domain.NewLimitOrder(fmt.Sprintf("o%d", *seq), "BTCUSDT", "u", side, price, int64(arg%7)+1)
+		ob.AddOrder(order)
+		live[order.ID] = order
+	case 2: // 撤单
+		for id := range live {
+			ob.CancelOrder(id)
+			delete(live, id)
+			break
+		}
+	case 3: // 撮合：消除交叉、按撮合引擎方式部分成交最优档首单、或对任意订单减量
+		switch arg % 3 {
+		case 0:
+			ob.UncrossRepair()
+		case 1:
+			level := ob.GetBestSellLevel()
+			if arg&4 == 0 {
+				level = ob.GetBestBuyLevel()
+			}
+			if level != nil {
+				order := level.Orders.Front().Value.(*domain.Order)
+				ob.FillOrder(order, min(int64(arg%5)+1, order.RemainingQuantity()))
+			}
+		case 2:
+			for _, order := range live {
+				ob.ReduceOrder(order, int64(arg%3)+1)
+				break
+			}
+		}
+		for id, order := range live {
+			if _, ok := ob.orders[id]; !ok || order.RemainingQuantity() == 0 {
+				delete(live, id)
+			}
+		}
+	}
+}
+
+// checkTreeIntegrity 校验单侧价格树的不变量
+func checkTreeIntegrity(t *testing.T, tree PriceTreeInterface, live map[string]*domain.Order, side domain.Side) {
+	t.Helper()
+
+	var extreme int64
+	expectedLevels := make(map[int64]int64)
+	for _, order := range live {
+		if order.Side != side {
+			continue
+		}
+		expectedLevels[order.Price] += order.RemainingQuantity()
+		if extreme == 0 || (side == domain.SideBuy && order.Price > extreme) ||
+			(side == domain.SideSell && order.Price < extreme) {
+			extreme = order.Price
+		}
+	}
+
+	if best := tree.GetBestPrice(); best != extreme {
+		t.Fatalf("side %d: best price %d, actual extreme %d", side, best, extreme)
+	}
+
+	depth := tree.GetDepth(1000) // 价格范围只有 200 个 tick
+	if len(depth) != len(expectedLevels) || tree.Size() != len(expectedLevels) {
+		t.Fatalf("side %d: depth has %d levels, Size() %d, expected %d",
+			side, len(depth), tree.Size(), len(expectedLevels))
+	}
+	for i, level := range depth {
+		if level.Orders.Len() == 0 {
+			t.Fatalf("side %d: empty level lingers at %d", side, level.Price)
+		}
+		var sum int64
+		for e := level.Orders.Front(); e != nil; e = e.Next() {
+			sum += e.Value.(*domain.Order).RemainingQuantity()
+		}
+		if level.Volume != sum || sum != expectedLevels[level.Price] {
+			t.Fatalf("side %d: level %d volume %d, orders sum %d, expected %d",
+				side, level.Price, level.Volume, sum, expectedLevels[level.Price])
+		}
+		if i > 0 && ((side == domain.SideBuy && level.Price >= depth[i-1].Price) ||
+			(side == domain.SideSell && level.Price <= depth[i-1].Price)) {
+			t.Fatalf("side %d: depth out of order at %d", side, level.Price)
+		}
+	}
+}
+
+// checkBookIntegrity 校验订单簿整体不变量
+func checkBookIntegrity(t *testing.T, ob *OrderBook, live map[string]*domain.Order, crossedAllowed bool) {
+	t.Helper()
+
+	if len(ob.orders) != len(live) {
+		t.Fatalf("order index has %d orders, expected %d", len(ob.orders), len(live))
+	}
+	checkTreeIntegrity(t, ob.bids, live, domain.SideBuy)
+	checkTreeIntegrity(t, ob.asks, live, domain.SideSell)
+
+	// 每用户挂单计数与订单索引一致
+	counted := 0
+	for _, n := range ob.userOrders {
+		counted += n
+	}
+	if counted != len(ob.orders) {
+		t.Fatalf("user order counts sum to %d, book holds %d orders", counted, len(ob.orders))
+	}
+
+	var notional [2]int64
+	for _, order := range live {
+		notional[order.Side] += order.Price * order.RemainingQuantity()
+	}
+	for _, side := range []domain.Side{domain.SideBuy, domain.SideSell} {
+		if got := ob.TotalNotional(side); got != notional[side] {
+			t.Fatalf("side %v notional %d, orders sum to %d", side, got, notional[side])
+		}
+	}
+
+	bid, ask := ob.GetBestBid(), ob.GetBestAsk()
+	if !crossedAllowed && bid != 0 && ask != 0 && bid >= ask {
+		t.Fatalf("book crossed: bid %d >= ask %d", bid, ask)
+	}
+}
+
+// runIntegrity 执行一串操作并在每一步后校验
+// AddOrder 本身不撮合，所以每次挂单后都执行 UncrossRepair，模拟撮合引擎的行为
+func runIntegrity(t *testing.T, treeType PriceTreeType, bucketSize int64, ops []byte) {
+	ob := NewOrderBookWithTree("BTCUSDT", treeType, bucketSize)
+	live := make(map[string]*domain.Order)
+	seq := 0
+
+	for i := 0; i+1 < len(ops); i += 2 {
+		integrityOp(ob, live, &seq, ops[i], ops[i+1])
+		checkBookIntegrity(t, ob, live, true)
+
+		ob.UncrossRepair()
+		for id, order := range live {
+			if order.IsFilled() {
+				delete(live, id)
+			}
+		}
+		checkBookIntegrity(t, ob, live, false)
+	}
+}
+
+// TestOrderBookIntegrityRandom 固定种子的随机操作序列
+func TestOrderBookIntegrityRandom(t *testing.T) {
+	for _, tt := range integrityTreeTypes {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(1); seed <= 20; seed++ {
+				r := rand.New(rand.NewSource(seed))
+				ops := make([]byte, 2000)
+				r.Read(ops)
+				runIntegrity(t, tt.treeType, tt.bucketSize, ops)
+			}
+		})
+	}
+}
+
+// FuzzOrderBookIntegrity go test -fuzz=FuzzOrderBookIntegrity ./orderbook
+func FuzzOrderBookIntegrity(f *testing.F) {
+	f.Add([]byte{0, 10, 1, 11, 2, 0, 3, 0})
+	f.Add([]byte{0, 100, 0, 101, 0, 99, 3, 1, 2, 0, 3, 0})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		for _, tt := range integrityTreeTypes {
+			runIntegrity(t, tt.treeType, tt.bucketSize, ops)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+	"lightning-exchange/domain"
+)
+
+var (
+	// ErrL3SeqGap is returned by ApplyL3 for an event that doesn't follow the book's Seq
+	ErrL3SeqGap = errors.New("L3 event sequence gap")
+
+	// ErrL3Inconsistent is returned by ApplyL3 for an event that doesn't fit the rebuilt book
+	// (unknown or duplicate order, or a Quantity that disagrees with Remaining)
+	ErrL3Inconsistent = errors.New("L3 event inconsistent with book")
+)
+
+// L3EventType identifies an order-by-order book change
+type L3EventType uint8
+
+const (
+	// L3Add: an order started resting (Quantity = its resting quantity)
+	L3Add L3EventType = iota + 1
+
+	// L3Cancel: resting quantity was removed without trading (Quantity = amount removed).
+	// Covers cancels, expiries and modify-down; the order leaves the book once nothing remains.
+	L3Cancel
+
+	// L3Execute: a resting order traded (Quantity = amount filled, Price = its resting price)
+	L3Execute
+)
+
+// L3Event is one entry of the order-by-order (ITCH-style) feed
+// Applying events in Seq order to an empty book reproduces every resting order,
+// its queue position and remaining quantity (see ApplyL3). Aggressors that trade
+// without resting never appear; their fills show up as L3Execute on the resting side.
+//
+// Quantity is the change; Remaining is the order's resting quantity after it, so a
+// consumer never has to carry per-order state to know what is left (0 = order left the book).
+// An iceberg is published by its displayed slice only: a consumed slice leaves the feed
+// and each refill is a new L3Add, so the reserve never shows.
+type L3Event struct {
+	Seq       int64 // Book Seq() after this change; gap-free from the first change
+	Type      L3EventType
+	OrderID   string
+	Side      domain.Side
+	Price     int64
+	Quantity  int64
+	Remaining int64
+}
+
+// SetL3Handler installs the L3 event handler (nil disables the feed)
+// The handler is called synchronously on every book change, in causal order.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) SetL3Handler(handler func(L3Event)) {
+	ob.onL3 = handler
+}
+
+// Seq returns the sequence number of the last book change (0 for an untouched book)
+// Advanced once per L3 event whether or not the L3 feed is enabled, so it is the
+// per-symbol market-data clock: trades and depth snapshots are stamped with it.
+// Changes to hidden orders are not published and don't advance it (see emitL3).
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) Seq() int64 {
+	return ob.seq
+}
+
+// emitL3 advances the book sequence and publishes an L3 event if the feed is enabled
+// remaining is the order's resting quantity once the change is applied.
+// Hidden (ExecHidden) orders are kept off the feed: an order-by-order stream would let
+// any subscriber rebuild them. They don't advance the sequence either, so the public
+// feed stays gap-free and Seq remains the clock of the displayed book.
+func (ob *OrderBook) emitL3(eventType L3EventType, order *domain.Order, quantity, remaining int64) {
+	if order.IsHidden() {
+		return
+	}
+	ob.seq++
+	if ob.onL3 == nil {
+		return
+	}
+	ob.onL3(L3Event{
+		Seq:       ob.seq,
+		Type:      eventType,
+		OrderID:   order.ID,
+		Side:      order.Side,
+		Price:     order.Price,
+		Quantity:  quantity,
+		Remaining: remaining,
+	})
+}
+
+// emitL3Change publishes a reduction of order's published quantity from shown
+// Nothing is published when only an iceberg's reserve changed: the feed never saw it.
+func (ob *OrderBook) emitL3Change(eventType L3EventType, order *domain.Order, shown int64) {
+	if remaining := publicQty(order); remaining < shown {
+		ob.emitL3(eventType, order, shown-remaining, remaining)
+	}
+}
+
+// ApplyL3 rebuilds book state from an L3 event stream, e.g. a recorded public feed
+// Events must continue the book's sequence: an empty book starts at Seq 1, and each
+// event's Seq must be Seq()+1 (ErrL3SeqGap otherwise). Adds append to the level's queue,
+// so replaying in order restores time priority; cancels and executes are applied through
+// Remaining, the authoritative quantity left. Reconstructed orders carry no UserID.
+// On error, events before the offending one stay applied.
+// Lock-free: Only called by the matching thread (or before the engine is started)
+func (ob *OrderBook) ApplyL3(events []L3Event) error {
+	for _, event := range events {
+		if event.Seq != ob.seq+1 {
+			return fmt.Errorf("%w: event seq %d, book seq %d", ErrL3SeqGap, event.Seq, ob.seq)
+		}
+
+		order, exists := ob.orders[event.OrderID]
+		if event.Type == L3Add {
+			if exists || event.Remaining != event.Quantity {
+				return fmt.Errorf("%w: add %q at seq %d", ErrL3Inconsistent, event.OrderID, event.Seq)
+			}
+			ob.AddOrder(domain.NewLimitOrder(event.OrderID, ob.symbol, "", event.Side, event.Price, event.Quantity))
+			continue
+		}
+
+		if !exists || order.RemainingQuantity()-event.Remaining != event.Quantity || event.Remaining < 0 {
+			return fmt.Errorf("%w: event %d for %q at seq %d", ErrL3Inconsistent, event.Type, event.OrderID, event.Seq)
+		}
+		switch {
+		case event.Type == L3Execute:
+			ob.FillOrder(order, event.Quantity)
+		case event.Remaining == 0:
+			ob.CancelOrder(order.ID)
+		default:
+			ob.ReduceOrder(order, event.Quantity)
+		}
+	}
+	return nil
+}
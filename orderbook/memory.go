@@ -0,0 +1,51 @@
+package orderbook
+
+import (
+	"container/list"
+	"lightning-exchange/domain"
+	"unsafe"
+)
+
+// Memory model used by MemoryEstimate
+// The numbers are approximations for capacity planning, not exact heap accounting:
+//   - Go map entries cost roughly key + value + ~8 bytes of bucket/tophash overhead
+//     (load factor slack is ignored)
+//   - Red-black tree nodes (gods) hold key, value, 3 pointers and a color flag
+//   - Order ID / UserID string bytes are counted; Symbol is shared and not counted
+//   - Orders are pooled, so freed orders still occupy memory in the pool (not counted)
+const (
+	mapEntryOverhead = 8
+	rbtNodeBytes     = 8 + 8 + 3*8 + 8 // key + value + left/right/parent + color (padded)
+)
+
+var (
+	orderBytes           = int64(unsafe.Sizeof(domain.Order{}))
+	listElementBytes     = int64(unsafe.Sizeof(list.Element{}))
+	listBytes            = int64(unsafe.Sizeof(list.List{}))
+	priceLevelBytes      = int64(unsafe.Sizeof(PriceLevel_{})) + listBytes
+	bucketBytes          = int64(unsafe.Sizeof(Bucket{})) // excludes the bucketSize-long levels array
+	orderIndexEntryBytes = int64(16+8) + mapEntryOverhead // string header key + *Order value
+	levelIndexEntryBytes = int64(8+8) + mapEntryOverhead  // int64 key + *PriceLevel_ value
+	orderBookBytes       = int64(unsafe.Sizeof(OrderBook{}))
+)
+
+// levelMemory returns the estimated bytes of a price level and its resting orders
+func levelMemory(level *PriceLevel_) int64 {
+	total := priceLevelBytes
+	for e := level.Orders.Front(); e != nil; e = e.Next() {
+		order := e.Value.(*domain.Order)
+		total += orderBytes + listElementBytes + int64(len(order.ID)+len(order.UserID))
+	}
+	return total
+}
+
+// MemoryEstimate approximates the bytes used by the book
+// Includes the order index, both price trees (levels, list elements, orders,
+// and for ShardedType the per-bucket fixed arrays and tree nodes). See the memory model above.
+// O(n) in the number of resting orders; intended for capacity planning, not the hot path.
+func (ob *OrderBook) MemoryEstimate() int64 {
+	return orderBookBytes +
+		int64(len(ob.orders))*orderIndexEntryBytes +
+		ob.bids.MemoryEstimate() +
+		ob.asks.MemoryEstimate()
+}
@@ -0,0 +1,75 @@
+package orderbook
+
+import "lightning-exchange/domain"
+
+// MigrateTree rebuilds both sides of the book into a new price tree implementation
+// Levels are replayed best-first and orders within a level in queue order, so FIFO
+// priority, level volumes and best prices are preserved. ShardedType uses DefaultBucketSize.
+// Cost is O(orders); intended for an occasional switch (e.g. a symbol outgrowing
+// HashMapListType), not the hot path.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) MigrateTree(newType PriceTreeType) {
+	ob.bids = rebuildTree(ob.bids, NewPriceTreeWithType(newType, ob.descending(domain.SideBuy)))
+	ob.asks = rebuildTree(ob.asks, NewPriceTreeWithType(newType, ob.descending(domain.SideSell)))
+}
+
+// rebuildTree inserts every order of src into dst, preserving price-time priority
+func rebuildTree(src, dst PriceTreeInterface) PriceTreeInterface {
+	for _, level := range src.GetDepth(src.Size()) {
+		for e := level.Orders.Front(); e != nil; e = e.Next() {
+			dst.Insert(e.Value.(*domain.Order))
+		}
+	}
+	return dst
+}
+
+// Compact rebuilds the price trees and the order indexes to reclaim memory
+// Go maps never shrink: after a mass cancel or heavy churn the orders, per-user and
+// per-session indexes (and the HashMapListType level map) keep the capacity of their peak.
+// Compact copies everything into right-sized structures, keeping the tree type, bucket
+// size and FIFO priority. The sharded tree already frees empty buckets as they empty;
+// rebuilding it drops the slack of the remaining ones. Cost is O(orders); run it during
+// quiet periods, not after every cancel.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) Compact() {
+	ob.bids = rebuildTree(ob.bids, emptyTreeLike(ob.bids, ob.descending(domain.SideBuy)))
+	ob.asks = rebuildTree(ob.asks, emptyTreeLike(ob.asks, ob.descending(domain.SideSell)))
+
+	orders := make(map[string]*domain.Order, len(ob.orders))
+	for id, order := range ob.orders {
+		orders[id] = order
+	}
+	ob.orders = orders
+
+	userOrders := make(map[string]int, len(ob.userOrders))
+	for userID, n := range ob.userOrders {
+		userOrders[userID] = n
+	}
+	ob.userOrders = userOrders
+
+	sessions := make(map[string]map[string]*domain.Order, len(ob.sessions))
+	for sessionID, session := range ob.sessions {
+		compacted := make(map[string]*domain.Order, len(session))
+		for id, order := range session {
+			compacted[id] = order
+		}
+		sessions[sessionID] = compacted
+	}
+	ob.sessions = sessions
+
+	if ob.hidden != nil {
+		hidden := make(map[levelKey]hiddenLevel, len(ob.hidden))
+		for key, h := range ob.hidden {
+			hidden[key] = h
+		}
+		ob.hidden = hidden
+	}
+}
+
+// emptyTreeLike returns an empty tree of the same implementation (and bucket size) as tree
+func emptyTreeLike(tree PriceTreeInterface, descending bool) PriceTreeInterface {
+	if sharded, ok := tree.(*ShardedPriceTreeAdapter); ok {
+		return NewShardedPriceTreeFromInterface(descending, sharded.tree.bucketSize)
+	}
+	return NewHashMapListPriceTree(descending)
+}
@@ -0,0 +1,61 @@
+package orderbook
+
+import (
+	"lightning-exchange/domain"
+	"math"
+	"math/bits"
+)
+
+// notional is a running sum of price * quantity in 128-bit two's complement
+// A book's exact notional can exceed int64 (large prices times large sizes); keeping the
+// running total wide makes every add reversible, so cancels restore the exact value.
+type notional struct {
+	hi, lo uint64
+}
+
+// add adds price * qty (either may be negative)
+func (n *notional) add(price, qty int64) {
+	hi, lo := bits.Mul64(absUint64(price), absUint64(qty))
+	if (price < 0) != (qty < 0) {
+		lo = ^lo + 1
+		hi = ^hi
+		if lo == 0 {
+			hi++
+		}
+	}
+	var carry uint64
+	n.lo, carry = bits.Add64(n.lo, lo, 0)
+	n.hi, _ = bits.Add64(n.hi, hi, carry)
+}
+
+// saturated returns the sum clamped to the int64 range
+func (n notional) saturated() int64 {
+	if int64(n.hi) == int64(n.lo)>>63 {
+		return int64(n.lo) // hi is the sign extension of lo: fits in int64
+	}
+	if int64(n.hi) < 0 {
+		return math.MinInt64
+	}
+	return math.MaxInt64
+}
+
+func absUint64(x int64) uint64 {
+	if x < 0 {
+		return uint64(-x)
+	}
+	return uint64(x)
+}
+
+// TotalNotional returns the sum of price * volume over every resting order on side
+// Hidden orders and iceberg reserves count: it measures exposure, not displayed depth.
+// The total is maintained incrementally on add, fill, reduce and removal, so the read is
+// O(1). The running sum is exact; a result beyond int64 saturates at math.MaxInt64.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) TotalNotional(side domain.Side) int64 {
+	return ob.notional[side].saturated()
+}
+
+// trackNotional adjusts side's running notional by price * qty
+func (ob *OrderBook) trackNotional(order *domain.Order, qty int64) {
+	ob.notional[order.Side].add(order.Price, qty)
+}
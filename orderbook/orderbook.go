@@ -1,7 +1,11 @@
 package orderbook
 
 import (
+	"container/list"
+	"iter"
 	"lightning-exchange/domain"
+	"strconv"
+	"time"
 )
 
 // IOrderBook defines the interface for an order book
@@ -24,7 +28,7 @@ type IOrderBook interface {
 
 // PriceLevel represents a price level in the order book
 type PriceLevel struct {
-	Price    int64
+	Price    domain.Price
 	Quantity int64
 	Orders   int // number of orders at this level
 }
@@ -38,6 +42,23 @@ type OrderBook struct {
 	bids   PriceTreeInterface // buy orders (descending price)
 	asks   PriceTreeInterface // sell orders (ascending price)
 	orders map[string]*domain.Order
+
+	inverted bool // PriceOrderingInverted: bids ascending, asks descending
+	maxDepth int  // price levels kept per side (0 = unlimited), see SetMaxDepth
+
+	userOrders map[string]int                      // resting order count per UserID
+	sessions   map[string]map[string]*domain.Order // SessionID -> resting orders, for cancel-on-disconnect
+
+	repairSeq int64      // trade ID counter for UncrossRepair
+	expiries  expiryHeap // GTD orders ordered by expiry time
+
+	hidden map[levelKey]hiddenLevel // Hidden (ExecHidden) volume per level, excluded from depth
+
+	notional [2]notional // Resting price * volume per side (indexed by domain.Side), see TotalNotional
+
+	onL3    func(L3Event)       // Optional order-by-order feed (nil = off)
+	seq     int64               // last book change sequence (see Seq)
+	onPrune func(*domain.Order) // Optional notification of orders pruned by SetMaxDepth (nil = off)
 }
 
 // NewOrderBook creates a new order book for a symbol
@@ -47,19 +68,55 @@ func NewOrderBook(symbol string) *OrderBook {
 		bids:   NewPriceTreeWithType(ShardedType, true),  // 分片树 + 位运算优化
 		asks:   NewPriceTreeWithType(ShardedType, false), // 分片树 + 位运算优化
 		orders: make(map[string]*domain.Order),
+
+		userOrders: make(map[string]int),
+		sessions:   make(map[string]map[string]*domain.Order),
 	}
 }
 
+// NewOrderBookWithTree creates an order book with an explicit price tree type and bucket size
+// bucketSize only applies to ShardedType (power of 2, <= 0 for DefaultBucketSize);
+// see BucketSizeForSpread for choosing it from the expected price spread
+func NewOrderBookWithTree(symbol string, treeType PriceTreeType, bucketSize int64) *OrderBook {
+	return NewOrderBookWithOrdering(symbol, treeType, bucketSize, PriceOrderingStandard)
+}
+
 // AddOrder adds a new order to the book
 // Lock-free: Only called by the matching thread
 func (ob *OrderBook) AddOrder(order *domain.Order) error {
+	newLevel := ob.maxDepth > 0 && ob.levelOf(order) == nil
+
 	ob.orders[order.ID] = order
+	ob.userOrders[order.UserID]++
+	if order.SessionID != "" {
+		session := ob.sessions[order.SessionID]
+		if session == nil {
+			session = make(map[string]*domain.Order)
+			ob.sessions[order.SessionID] = session
+		}
+		session[order.ID] = order
+	}
 
 	if order.Side == domain.SideBuy {
 		ob.bids.Insert(order)
 	} else {
 		ob.asks.Insert(order)
 	}
+	ob.trackExpiry(order)
+	ob.trackNotional(order, order.RemainingQuantity())
+	if order.IsHidden() {
+		ob.trackHidden(order, order.RemainingQuantity(), 1)
+	}
+	if order.IsIceberg() {
+		if order.ShownQty <= 0 || order.ShownQty > order.RemainingQuantity() {
+			order.ShownQty = min(order.DisplayQty, order.RemainingQuantity())
+		}
+		ob.trackReserve(order, reserve(order))
+	}
+	ob.emitL3(L3Add, order, publicQty(order), publicQty(order))
+	if newLevel {
+		ob.pruneBeyondDepth(order.Side)
+	}
 
 	return nil
 }
@@ -72,16 +129,176 @@ func (ob *OrderBook) CancelOrder(orderID string) error {
 		return nil
 	}
 
+	ob.emitL3(L3Cancel, order, publicQty(order), 0)
+	ob.removeOrder(order)
+	order.Cancel()
+
+	return nil
+}
+
+// ReduceOrder shrinks a resting order's quantity by delta, keeping its queue position
+// The level volume is adjusted accordingly; if nothing remains the order is removed
+// from the book and marked cancelled.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) ReduceOrder(order *domain.Order, delta int64) {
+	delta = min(delta, order.RemainingQuantity())
+	if delta <= 0 {
+		return
+	}
+	shown := publicQty(order)
+
+	if level := ob.levelOf(order); level != nil {
+		level.Volume -= delta
+		ob.trackNotional(order, -delta)
+	}
+	if order.IsHidden() {
+		ob.trackHidden(order, -delta, 0)
+	}
+	if order.IsIceberg() {
+		// Modify down takes from the reserve first, then from the displayed slice
+		fromReserve := min(delta, reserve(order))
+		ob.trackReserve(order, -fromReserve)
+		order.ShownQty -= delta - fromReserve
+	}
+	order.Quantity -= delta
+	ob.emitL3Change(L3Cancel, order, shown)
+
+	if order.RemainingQuantity() == 0 {
+		ob.removeOrder(order)
+		order.Cancel()
+	}
+}
+
+// FillOrder applies a fill to a resting order, keeping its level volume in sync
+// A fully filled order is removed from the book and keeps its Filled status.
+// An iceberg's slice is consumed but not refilled; the caller decides the next slice
+// (see RefillIceberg).
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) FillOrder(order *domain.Order, quantity int64) {
+	shown := publicQty(order)
+	if order.IsIceberg() {
+		// Fills take the displayed slice; any excess (e.g. an auction uncross) the reserve
+		shown := min(quantity, order.ShownQty)
+		order.ShownQty -= shown
+		ob.trackReserve(order, -(quantity - shown))
+	}
+	order.Fill(quantity)
+	if level := ob.levelOf(order); level != nil {
+		level.Volume -= quantity
+		ob.trackNotional(order, -quantity)
+	}
+	if order.IsHidden() {
+		ob.trackHidden(order, -quantity, 0)
+	}
+	ob.emitL3Change(L3Execute, order, shown)
+
+	if order.IsFilled() {
+		ob.removeOrder(order)
+	}
+}
+
+// GetLevel returns the price level at price on the given side (nil if none)
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) GetLevel(side domain.Side, price int64) *PriceLevel_ {
+	if side == domain.SideBuy {
+		return ob.bids.GetLevel(price)
+	}
+	return ob.asks.GetLevel(price)
+}
+
+// levelOf returns the price level a resting order belongs to
+func (ob *OrderBook) levelOf(order *domain.Order) *PriceLevel_ {
+	return ob.GetLevel(order.Side, order.Price)
+}
+
+// removeOrder unlinks an order from its price tree and the order index
+func (ob *OrderBook) removeOrder(order *domain.Order) {
+	ob.trackNotional(order, -order.RemainingQuantity())
+	if order.IsHidden() {
+		ob.trackHidden(order, -order.RemainingQuantity(), -1)
+	}
+	if order.IsIceberg() {
+		ob.trackReserve(order, -reserve(order))
+	}
 	if order.Side == domain.SideBuy {
 		ob.bids.Remove(order)
 	} else {
 		ob.asks.Remove(order)
 	}
 
-	delete(ob.orders, orderID)
-	order.Cancel()
+	delete(ob.orders, order.ID)
+	if ob.userOrders[order.UserID]--; ob.userOrders[order.UserID] == 0 {
+		delete(ob.userOrders, order.UserID)
+	}
+	if session := ob.sessions[order.SessionID]; session != nil {
+		delete(session, order.ID)
+		if len(session) == 0 {
+			delete(ob.sessions, order.SessionID)
+		}
+	}
+}
 
-	return nil
+// CancelSession cancels every resting order tagged with sessionID
+// Returns the number of orders cancelled
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) CancelSession(sessionID string) int {
+	session := ob.sessions[sessionID]
+	cancelled := len(session)
+	for id := range session {
+		ob.CancelOrder(id)
+	}
+	return cancelled
+}
+
+// CancelOlderThan cancels every resting order accepted before cutoff and returns their IDs
+// For sweeping abandoned orders after a mass disconnect. Age is the order's Timestamp
+// (its acceptance time); IDs are returned in price-time priority, bids first. Each
+// cancel is emitted as an L3Cancel like CancelOrder.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) CancelOlderThan(cutoff time.Time) []string {
+	var stale []string
+	for _, tree := range []PriceTreeInterface{ob.bids, ob.asks} {
+		for level := range tree.Levels() {
+			for e := level.Orders.Front(); e != nil; e = e.Next() {
+				if order := e.Value.(*domain.Order); order.Timestamp.Before(cutoff) {
+					stale = append(stale, order.ID)
+				}
+			}
+		}
+	}
+	// Collected first: cancelling while walking would unlink the levels being iterated
+	for _, id := range stale {
+		ob.CancelOrder(id)
+	}
+	return stale
+}
+
+// GetOrder returns a resting order by ID (nil if not in the book)
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) GetOrder(orderID string) *domain.Order {
+	return ob.orders[orderID]
+}
+
+// OpenOrderCount returns the number of orders resting in the book for a user
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) OpenOrderCount(userID string) int {
+	return ob.userOrders[userID]
+}
+
+// QueuePosition returns how many orders, and how much remaining quantity, are ahead of
+// an order in its price level's FIFO queue. found is false if the order isn't resting.
+// O(position): walks the level's list backwards from the order.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) QueuePosition(orderID string) (ordersAhead int, qtyAhead int64, found bool) {
+	order, exists := ob.orders[orderID]
+	if !exists || order.ListElement == nil {
+		return 0, 0, false
+	}
+	for e := order.ListElement.(*list.Element).Prev(); e != nil; e = e.Prev() {
+		ordersAhead++
+		qtyAhead += e.Value.(*domain.Order).RemainingQuantity()
+	}
+	return ordersAhead, qtyAhead, true
 }
 
 // GetBestBid returns the highest buy price
@@ -96,9 +313,42 @@ func (ob *OrderBook) GetBestAsk() int64 {
 	return ob.asks.GetBestPrice()
 }
 
+// IsOneSided reports which sides of the book hold no orders
+// A one-sided market (common at the open or in illiquid symbols) has exactly one true;
+// hidden orders count as resting liquidity.
+// Lock-free: O(1) via the trees' IsEmpty
+func (ob *OrderBook) IsOneSided() (bidsEmpty, asksEmpty bool) {
+	return ob.bids.IsEmpty(), ob.asks.IsEmpty()
+}
+
+// IsEmpty reports whether neither side of the book holds an order
+// Lock-free: O(1) via the trees' IsEmpty
+func (ob *OrderBook) IsEmpty() bool {
+	return ob.bids.IsEmpty() && ob.asks.IsEmpty()
+}
+
+// Microprice returns the size-weighted mid of the top of book
+// (askPrice*bidQty + bidPrice*askQty) / (bidQty + askQty): it leans toward the side
+// with less resting size, the one more likely to be taken next. Rounds toward zero.
+// Returns 0 if either side is empty.
+// Lock-free: O(1) via the cached best levels
+func (ob *OrderBook) Microprice() int64 {
+	bid, ask := ob.bids.GetBestLevel(), ob.asks.GetBestLevel()
+	if bid == nil || ask == nil || bid.Volume+ask.Volume <= 0 {
+		return 0
+	}
+	return (ask.Price*bid.Volume + bid.Price*ask.Volume) / (bid.Volume + ask.Volume)
+}
+
 // GetDepth returns the market depth
+// This is the public view: hidden (ExecHidden) orders are left out of each level's
+// quantity and order count, and levels holding only hidden orders are skipped.
 // Lock-free: Only called by the matching thread
 func (ob *OrderBook) GetDepth(levels int) (bids, asks []PriceLevel) {
+	if len(ob.hidden) > 0 {
+		return ob.displayedDepth(domain.SideBuy, levels), ob.displayedDepth(domain.SideSell, levels)
+	}
+
 	bidLevels := ob.bids.GetDepth(levels)
 	askLevels := ob.asks.GetDepth(levels)
 
@@ -124,6 +374,101 @@ func (ob *OrderBook) GetDepth(levels int) (bids, asks []PriceLevel) {
 	return bids, asks
 }
 
+// PeekMatch reports the first match an incoming order would get, without mutating anything
+// Mirrors the book side of the engine's first match: the order crosses the best opposite
+// level if it is a market order or its limit price Crosses that level, and it trades
+// against the level's first (oldest) order at the level price. Engine-level policies the
+// book doesn't know about are not applied: last-look vetoes, midpoint pricing of a
+// domain.ExecMidpoint resting order (MatchingEngine.PeekMatch applies both) and
+// self-trade prevention.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) PeekMatch(incoming *domain.Order) (willMatch bool, matchPrice domain.Price, matchQty int64) {
+	var level *PriceLevel_
+	if incoming.Side == domain.SideBuy {
+		level = ob.asks.GetBestLevel()
+		if level != nil && incoming.Type == domain.OrderTypeLimit && !ob.Crosses(incoming.Price, level.Price) {
+			return false, 0, 0
+		}
+	} else {
+		level = ob.bids.GetBestLevel()
+		if level != nil && incoming.Type == domain.OrderTypeLimit && !ob.Crosses(level.Price, incoming.Price) {
+			return false, 0, 0
+		}
+	}
+	if level == nil || level.Orders.Len() == 0 || incoming.RemainingQuantity() <= 0 {
+		return false, 0, 0
+	}
+
+	resting := level.Orders.Front().Value.(*domain.Order)
+	return true, level.Price, min(incoming.RemainingQuantity(), resting.MatchableQuantity())
+}
+
+// EstimateCostToFill simulates sweeping the book with an incoming order of targetQty
+// side is the incoming order's side: a buy consumes asks, a sell consumes bids.
+// Returns the total notional (sum of price * quantity) of the simulated fills, their
+// volume-weighted average price, and whether the book holds enough liquidity for the
+// full quantity (if not, cost and average cover only what is available).
+// Does not mutate the book. Fills are priced at the resting level, as in matching.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) EstimateCostToFill(side domain.Side, targetQty int64) (totalCost int64, avgPrice int64, fullyFilled bool) {
+	if targetQty <= 0 {
+		return 0, 0, true
+	}
+
+	tree := ob.asks
+	if side == domain.SideSell {
+		tree = ob.bids
+	}
+
+	remaining := targetQty
+	for _, level := range tree.GetDepth(tree.Size()) {
+		fill := min(remaining, level.Volume)
+		totalCost += fill * level.Price
+		remaining -= fill
+		if remaining == 0 {
+			break
+		}
+	}
+
+	if filled := targetQty - remaining; filled > 0 {
+		avgPrice = totalCost / filled
+	}
+	return totalCost, avgPrice, remaining == 0
+}
+
+// VolumeInRange returns the total resting volume on side with prices between
+// fromPrice and toPrice inclusive (the bounds may be given in either order)
+// Levels are walked from the best price and the walk stops at the first level past the
+// range, so cost is proportional to the levels between best and the far bound.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) VolumeInRange(side domain.Side, fromPrice, toPrice int64) int64 {
+	low, high := min(fromPrice, toPrice), max(fromPrice, toPrice)
+
+	tree, descending := ob.asks, ob.descending(side)
+	if side == domain.SideBuy {
+		tree = ob.bids
+	}
+
+	var volume int64
+	tree.Walk(func(level *PriceLevel_) bool {
+		if descending && level.Price < low || !descending && level.Price > high {
+			return false
+		}
+		if level.Price >= low && level.Price <= high {
+			volume += level.Volume
+		}
+		return true
+	})
+	return volume
+}
+
+// Levels yields side's price levels from the best price outward (see PriceTreeInterface.Levels)
+// The book must not be modified while iterating.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) Levels(side domain.Side) iter.Seq[*PriceLevel_] {
+	return ob.treeFor(side).Levels()
+}
+
 // GetBestBuyOrders returns orders at the best bid price
 // Lock-free: Only called by the matching thread
 func (ob *OrderBook) GetBestBuyOrders() []*domain.Order {
@@ -136,6 +481,30 @@ func (ob *OrderBook) GetBestSellOrders() []*domain.Order {
 	return ob.asks.GetBestOrders()
 }
 
+// GetTopOrders returns at most maxOrders orders from the front of side's best level
+// For UIs and algos that only need the head of the queue: unlike GetBestBuyOrders and
+// GetBestSellOrders it does not copy the whole level.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) GetTopOrders(side domain.Side, maxOrders int) []*domain.Order {
+	return ob.treeFor(side).GetTopOrders(maxOrders)
+}
+
+// RemoveEmptyLevel drops the level at price on side if it exists but holds no orders
+// Both trees remove a level as its last order leaves, so an empty level is an invariant
+// violation; the matching loop calls this to repair one instead of stopping a sweep on it.
+// Returns true if a level was removed.
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) RemoveEmptyLevel(side domain.Side, price domain.Price) bool {
+	tree := ob.treeFor(side)
+	level := tree.GetLevel(price)
+	if level == nil || level.Orders.Len() != 0 {
+		return false
+	}
+	// Remove with a detached order only unlinks the (empty) level
+	tree.Remove(&domain.Order{Side: side, Price: price})
+	return true
+}
+
 // GetBestBuyLevel returns the best bid price level (O(1))
 // Performance: Avoids allocating slice and copying orders
 func (ob *OrderBook) GetBestBuyLevel() *PriceLevel_ {
@@ -147,3 +516,104 @@ func (ob *OrderBook) GetBestBuyLevel() *PriceLevel_ {
 func (ob *OrderBook) GetBestSellLevel() *PriceLevel_ {
 	return ob.asks.GetBestLevel()
 }
+
+// SeedFromDepth initializes the book from an aggregate L2 snapshot
+// Each level becomes one synthetic resting order carrying the level's total volume,
+// marked Synthetic so it can be removed with ClearSyntheticOrders before real order flow starts.
+// Any previously seeded orders are cleared first; levels with non-positive quantity are skipped,
+// and levels repeated at the same price are merged into one order.
+// Lock-free: Only called by the matching thread (or before the engine is started)
+func (ob *OrderBook) SeedFromDepth(bids, asks []PriceLevel) {
+	ob.ClearSyntheticOrders()
+	ob.seedSide(domain.SideBuy, "SEED-B-", bids)
+	ob.seedSide(domain.SideSell, "SEED-S-", asks)
+}
+
+// seedSide adds one synthetic order per price on the given side
+// Order IDs are derived from the price, so repeated prices are summed first.
+func (ob *OrderBook) seedSide(side domain.Side, idPrefix string, levels []PriceLevel) {
+	var prices []int64
+	quantities := make(map[int64]int64, len(levels))
+	for _, level := range levels {
+		if level.Quantity <= 0 {
+			continue
+		}
+		if _, seen := quantities[level.Price]; !seen {
+			prices = append(prices, level.Price)
+		}
+		quantities[level.Price] += level.Quantity
+	}
+	for _, price := range prices {
+		id := idPrefix + strconv.FormatInt(price, 10)
+		order := domain.NewLimitOrder(id, ob.symbol, "", side, price, quantities[price])
+		order.Synthetic = true
+		ob.AddOrder(order)
+	}
+}
+
+// ClearSyntheticOrders removes all orders created by SeedFromDepth
+// Orders are cancelled in book order (bids then asks, best price first), so the L3
+// feed sees the same sequence of cancels every time. Returns the number of orders removed.
+func (ob *OrderBook) ClearSyntheticOrders() int {
+	var synthetic []*domain.Order
+	for _, side := range []domain.Side{domain.SideBuy, domain.SideSell} {
+		for level := range ob.Levels(side) {
+			for e := level.Orders.Front(); e != nil; e = e.Next() {
+				if order := e.Value.(*domain.Order); order.Synthetic {
+					synthetic = append(synthetic, order)
+				}
+			}
+		}
+	}
+	for _, order := range synthetic {
+		ob.CancelOrder(order.ID)
+	}
+	return len(synthetic)
+}
+
+// UncrossRepair restores the bid < ask invariant on a crossed book
+// A crossed book should never occur in normal operation; this is a recovery tool for
+// corrupted state (e.g. a bad snapshot load), not a hot path.
+// Crossing orders are matched in price-time priority at the price of the older (maker) order,
+// and the generated trades are returned. Returns nil if the book is not crossed.
+// Empty best levels are dropped (see RemoveEmptyLevel). Icebergs trade their displayed
+// slice, as in matching, and are refilled with a DisplayQty slice.
+func (ob *OrderBook) UncrossRepair() []*domain.Trade {
+	var trades []*domain.Trade
+
+	for {
+		bidLevel := ob.bids.GetBestLevel()
+		askLevel := ob.asks.GetBestLevel()
+		if bidLevel == nil || askLevel == nil || !ob.Crosses(bidLevel.Price, askLevel.Price) {
+			break
+		}
+		if bidLevel.Orders.Len() == 0 || askLevel.Orders.Len() == 0 {
+			if !ob.RemoveEmptyLevel(domain.SideBuy, bidLevel.Price) && !ob.RemoveEmptyLevel(domain.SideSell, askLevel.Price) {
+				break
+			}
+			continue
+		}
+
+		buyOrder := bidLevel.Orders.Front().Value.(*domain.Order)
+		sellOrder := askLevel.Orders.Front().Value.(*domain.Order)
+
+		price := buyOrder.Price
+		if sellOrder.Timestamp.Before(buyOrder.Timestamp) {
+			price = sellOrder.Price
+		}
+
+		quantity := min(buyOrder.MatchableQuantity(), sellOrder.MatchableQuantity())
+		ob.FillOrder(buyOrder, quantity)
+		ob.FillOrder(sellOrder, quantity)
+		ob.RefillIceberg(buyOrder, buyOrder.DisplayQty)
+		ob.RefillIceberg(sellOrder, sellOrder.DisplayQty)
+
+		ob.repairSeq++
+		tradeID := "REPAIR-" + strconv.FormatInt(ob.repairSeq, 10)
+		trade := domain.NewTrade(tradeID, ob.symbol, price, quantity, buyOrder, sellOrder)
+		trade.Seq = ob.seq
+		trades = append(trades, trade)
+	}
+
+	return trades
+}
@@ -0,0 +1,56 @@
+package orderbook
+
+import "lightning-exchange/domain"
+
+// PriceOrdering selects which direction of price is more aggressive on each side
+type PriceOrdering int
+
+const (
+	// PriceOrderingStandard: a higher price is better for the seller (default)
+	// Best bid is the highest, best ask the lowest; a buy crosses a sell when bid >= ask.
+	PriceOrderingStandard PriceOrdering = iota
+
+	// PriceOrderingInverted: a higher quoted price is better for the buyer, as for some
+	// inverse-quoted crypto derivatives. Best bid is the lowest, best ask the highest;
+	// a buy crosses a sell when bid <= ask. Applies to continuous matching; auction
+	// pricing (ComputeAuctionPrice) and tick snapping assume standard ordering.
+	PriceOrderingInverted
+)
+
+// NewOrderBookWithOrdering creates an order book with an explicit price ordering
+// The ordering decides the sort direction of each side's price tree and the crossing
+// test (Crosses); matching code consults the book instead of comparing prices itself.
+func NewOrderBookWithOrdering(symbol string, treeType PriceTreeType, bucketSize int64, ordering PriceOrdering) *OrderBook {
+	inverted := ordering == PriceOrderingInverted
+	return &OrderBook{
+		symbol:   symbol,
+		bids:     NewPriceTreeWithBucketSize(treeType, !inverted, bucketSize),
+		asks:     NewPriceTreeWithBucketSize(treeType, inverted, bucketSize),
+		orders:   make(map[string]*domain.Order),
+		inverted: inverted,
+
+		userOrders: make(map[string]int),
+		sessions:   make(map[string]map[string]*domain.Order),
+	}
+}
+
+// PriceOrdering returns the book's price ordering
+func (ob *OrderBook) PriceOrdering() PriceOrdering {
+	if ob.inverted {
+		return PriceOrderingInverted
+	}
+	return PriceOrderingStandard
+}
+
+// Crosses reports whether a buy at buyPrice is marketable against a sell at sellPrice
+func (ob *OrderBook) Crosses(buyPrice, sellPrice int64) bool {
+	if ob.inverted {
+		return buyPrice <= sellPrice
+	}
+	return buyPrice >= sellPrice
+}
+
+// descending reports whether side's levels are sorted from high to low price
+func (ob *OrderBook) descending(side domain.Side) bool {
+	return (side == domain.SideBuy) != ob.inverted
+}
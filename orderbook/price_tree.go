@@ -2,7 +2,9 @@ package orderbook
 
 import (
 	"container/list"
+	"iter"
 	"lightning-exchange/domain"
+	"unsafe"
 )
 
 // HashMapListPriceTree represents a price-ordered structure of orders
@@ -24,7 +26,7 @@ import (
 //   - Binance, Coinbase (cryptocurrency exchanges)
 //   - Traditional HFT firms
 type HashMapListPriceTree struct {
-	levels     map[int64]*PriceLevel_ // price -> PriceLevel (O(1) lookup)
+	levels     map[domain.Price]*PriceLevel_ // price -> PriceLevel (O(1) lookup)
 	bestPrice  *PriceLevel_            // pointer to best price level (O(1) access)
 	descending bool                    // true for bids (high to low), false for asks (low to high)
 }
@@ -35,7 +37,7 @@ var _ PriceTreeInterface = (*HashMapListPriceTree)(nil)
 // NewHashMapListPriceTree creates a new HashMap+List price tree
 func NewHashMapListPriceTree(descending bool) *HashMapListPriceTree {
 	return &HashMapListPriceTree{
-		levels:     make(map[int64]*PriceLevel_),
+		levels:     make(map[domain.Price]*PriceLevel_),
 		bestPrice:  nil,
 		descending: descending,
 	}
@@ -53,7 +55,7 @@ func NewPriceTree(descending bool) *PriceTree {
 // Forms a doubly linked list for efficient price ordering
 // Performance optimization: Orders store their list.Element for O(1) deletion
 type PriceLevel_ struct {
-	Price  int64
+	Price  domain.Price
 	Orders *list.List // FIFO queue for time priority
 	Volume int64
 
@@ -109,7 +111,7 @@ func (pt *HashMapListPriceTree) Remove(order *domain.Order) {
 
 // GetBestPrice returns the best price in the tree
 // Performance: O(1) - direct pointer access
-func (pt *HashMapListPriceTree) GetBestPrice() int64 {
+func (pt *HashMapListPriceTree) GetBestPrice() domain.Price {
 	if pt.bestPrice == nil {
 		return 0
 	}
@@ -137,9 +139,28 @@ func (pt *HashMapListPriceTree) GetBestOrders() []*domain.Order {
 	return orders
 }
 
+// GetTopOrders returns at most maxOrders orders from the front of the best level
+// Performance: O(maxOrders) - walks the FIFO list from its front
+func (pt *HashMapListPriceTree) GetTopOrders(maxOrders int) []*domain.Order {
+	return frontOrders(pt.bestPrice, maxOrders)
+}
+
+// frontOrders returns at most maxOrders orders of level in time priority (nil if none)
+func frontOrders(level *PriceLevel_, maxOrders int) []*domain.Order {
+	if level == nil || maxOrders <= 0 {
+		return nil
+	}
+
+	orders := make([]*domain.Order, 0, min(maxOrders, level.Orders.Len()))
+	for e := level.Orders.Front(); e != nil && len(orders) < maxOrders; e = e.Next() {
+		orders = append(orders, e.Value.(*domain.Order))
+	}
+	return orders
+}
+
 // GetLevel returns the price level at a specific price
 // Performance: O(1) via hashmap lookup
-func (pt *HashMapListPriceTree) GetLevel(price int64) *PriceLevel_ {
+func (pt *HashMapListPriceTree) GetLevel(price domain.Price) *PriceLevel_ {
 	return pt.levels[price]
 }
 
@@ -162,6 +183,22 @@ func (pt *HashMapListPriceTree) GetDepth(maxLevels int) []PriceLevel_ {
 	return depth
 }
 
+// Walk visits price levels from the best price outward, stopping when fn returns false
+// Performance: O(k) for k visited levels, no allocation
+func (pt *HashMapListPriceTree) Walk(fn func(level *PriceLevel_) bool) {
+	for current := pt.bestPrice; current != nil; current = current.NextPrice {
+		if !fn(current) {
+			return
+		}
+	}
+}
+
+// Levels yields price levels from the best price outward; break out of the range to stop early
+// Performance: O(k) for k visited levels, no allocation beyond the iterator closure
+func (pt *HashMapListPriceTree) Levels() iter.Seq[*PriceLevel_] {
+	return pt.Walk
+}
+
 // IsEmpty returns true if the tree has no orders
 // Performance: O(1)
 func (pt *HashMapListPriceTree) IsEmpty() bool {
@@ -174,6 +211,17 @@ func (pt *HashMapListPriceTree) Size() int {
 	return len(pt.levels)
 }
 
+// MemoryEstimate approximates the bytes used by the tree
+// Per level: hashmap entry + PriceLevel_ + its orders (see the memory model in memory.go)
+// Performance: O(n) in the number of resting orders
+func (pt *HashMapListPriceTree) MemoryEstimate() int64 {
+	total := int64(unsafe.Sizeof(*pt))
+	for _, level := range pt.levels {
+		total += levelIndexEntryBytes + levelMemory(level)
+	}
+	return total
+}
+
 // insertPriceLevel inserts a new price level into the doubly linked list
 // Performance: O(n) worst case, but typically O(1) as new orders are near best price
 func (pt *HashMapListPriceTree) insertPriceLevel(newLevel *PriceLevel_) {
@@ -229,7 +277,7 @@ func (pt *HashMapListPriceTree) removePriceLevel(level *PriceLevel_) {
 }
 
 // isBetterPrice returns true if price1 is better than price2
-func (pt *HashMapListPriceTree) isBetterPrice(price1, price2 int64) bool {
+func (pt *HashMapListPriceTree) isBetterPrice(price1, price2 domain.Price) bool {
 	if pt.descending {
 		return price1 > price2 // For bids, higher is better
 	}
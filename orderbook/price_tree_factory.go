@@ -2,7 +2,9 @@ package orderbook
 
 import (
 	"container/list"
+	"iter"
 	"lightning-exchange/domain"
+	"unsafe"
 )
 
 // PriceTreeType 定义价格树的实现类型
@@ -21,11 +23,32 @@ const (
 	ShardedType
 )
 
+// DefaultBucketSize 分片树默认 bucket 大小（2^7，可用位运算优化）
+const DefaultBucketSize int64 = 128
+
+// 自动调优时 bucket 大小的取值范围
+const (
+	MinBucketSize int64 = 16
+	MaxBucketSize int64 = 4096
+)
+
 // NewPriceTreeWithType 根据类型创建价格树
 func NewPriceTreeWithType(treeType PriceTreeType, descending bool) PriceTreeInterface {
+	return NewPriceTreeWithBucketSize(treeType, descending, DefaultBucketSize)
+}
+
+// NewPriceTreeWithBucketSize 根据类型创建价格树，并指定分片树的 bucket 大小
+// bucketSize 仅对 ShardedType 生效，必须是 2 的幂（用于位运算索引）；<= 0 时使用默认值
+func NewPriceTreeWithBucketSize(treeType PriceTreeType, descending bool, bucketSize int64) PriceTreeInterface {
 	switch treeType {
 	case ShardedType:
-		return NewShardedPriceTreeFromInterface(descending, 128) // bucket size = 128 (2^7，可用位运算优化)
+		if bucketSize <= 0 {
+			bucketSize = DefaultBucketSize
+		}
+		if bucketSize&(bucketSize-1) != 0 {
+			panic("bucket size must be power of 2")
+		}
+		return NewShardedPriceTreeFromInterface(descending, bucketSize)
 	case HashMapListType:
 		fallthrough
 	default:
@@ -33,6 +56,29 @@ func NewPriceTreeWithType(treeType PriceTreeType, descending bool) PriceTreeInte
 	}
 }
 
+// BucketSizeForSpread 根据预期的价格档位跨度（以 tick 计）选择 bucket 大小
+//
+// 取舍：
+//   - 每个 bucket 固定占用 bucketSize * 8 字节的指针数组（128 -> 1KB，1024 -> 8KB），
+//     与实际档位数量无关。价格集中时小 bucket 浪费更少
+//   - bucket 数量约为 spread / bucketSize，红黑树高度 O(log m)。价格分散时
+//     大 bucket 让树更矮，插入/删除新档位更快，但 bucket 内链表插入是 O(n)
+//
+// 规则：取 spread/8 向上取整到 2 的幂，使活跃区间大约落在 8 个 bucket 内，
+// 并限制在 [MinBucketSize, MaxBucketSize]。spread <= 0 时返回 DefaultBucketSize
+func BucketSizeForSpread(spread int64) int64 {
+	if spread <= 0 {
+		return DefaultBucketSize
+	}
+
+	target := (spread + 7) / 8
+	size := MinBucketSize
+	for size < target && size < MaxBucketSize {
+		size <<= 1
+	}
+	return size
+}
+
 // NewShardedPriceTreeFromInterface 创建分片价格树（实现接口）
 func NewShardedPriceTreeFromInterface(descending bool, bucketSize int64) PriceTreeInterface {
 	return &ShardedPriceTreeAdapter{
@@ -119,7 +165,7 @@ func (s *ShardedPriceTreeAdapter) Remove(order *domain.Order) {
 	}
 }
 
-func (s *ShardedPriceTreeAdapter) GetBestPrice() int64 {
+func (s *ShardedPriceTreeAdapter) GetBestPrice() domain.Price {
 	best := s.tree.GetBestPrice()
 	if best == nil {
 		return 0
@@ -145,7 +191,11 @@ func (s *ShardedPriceTreeAdapter) GetBestOrders() []*domain.Order {
 	return orders
 }
 
-func (s *ShardedPriceTreeAdapter) GetLevel(price int64) *PriceLevel_ {
+func (s *ShardedPriceTreeAdapter) GetTopOrders(maxOrders int) []*domain.Order {
+	return frontOrders(s.tree.GetBestPrice(), maxOrders)
+}
+
+func (s *ShardedPriceTreeAdapter) GetLevel(price domain.Price) *PriceLevel_ {
 	bucket, exists := s.tree.buckets.Get(price / s.tree.bucketSize)
 	if !exists {
 		return nil
@@ -180,6 +230,23 @@ func (s *ShardedPriceTreeAdapter) GetDepth(maxLevels int) []PriceLevel_ {
 	return result
 }
 
+// Walk 按优先级顺序遍历档位：外层按 bucket 顺序，内层沿 bucket 链表，fn 返回 false 时停止
+func (s *ShardedPriceTreeAdapter) Walk(fn func(level *PriceLevel_) bool) {
+	it := s.tree.buckets.Iterator()
+	for it.Next() {
+		for current := it.Value().bestPrice; current != nil; current = current.NextPrice {
+			if !fn(current) {
+				return
+			}
+		}
+	}
+}
+
+// Levels 按优先级顺序惰性产出档位，与 Walk 顺序一致；range 中 break 即停止遍历
+func (s *ShardedPriceTreeAdapter) Levels() iter.Seq[*PriceLevel_] {
+	return s.Walk
+}
+
 func (s *ShardedPriceTreeAdapter) IsEmpty() bool {
 	return s.tree.buckets.Empty()
 }
@@ -188,7 +255,23 @@ func (s *ShardedPriceTreeAdapter) Size() int {
 	count := 0
 	it := s.tree.buckets.Iterator()
 	for it.Next() {
-		count += len(it.Value().levels)
+		count += it.Value().size
 	}
 	return count
 }
+
+// MemoryEstimate 估算分片树占用的内存
+// 每个 bucket 固定占用 bucketSize 个指针的数组（默认 128，约 1KB），即使只有一个档位，
+// 因此档位稀疏分布时分片树的固定开销明显高于 HashMap+List
+func (s *ShardedPriceTreeAdapter) MemoryEstimate() int64 {
+	total := int64(unsafe.Sizeof(*s.tree))
+	it := s.tree.buckets.Iterator()
+	for it.Next() {
+		bucket := it.Value()
+		total += rbtNodeBytes + bucketBytes + int64(len(bucket.levels))*8
+		for current := bucket.bestPrice; current != nil; current = current.NextPrice {
+			total += levelMemory(current)
+		}
+	}
+	return total
+}
@@ -1,6 +1,9 @@
 package orderbook
 
-import "lightning-exchange/domain"
+import (
+	"iter"
+	"lightning-exchange/domain"
+)
 
 // PriceTreeInterface 定义价格树的接口
 // 支持多种实现：HashMap+List、红黑树、分片树等
@@ -12,23 +15,36 @@ type PriceTreeInterface interface {
 	Remove(order *domain.Order)
 	
 	// GetBestPrice 获取最佳价格（返回价格值）
-	GetBestPrice() int64
+	GetBestPrice() domain.Price
 	
 	// GetBestLevel 获取最佳价格档位
 	GetBestLevel() *PriceLevel_
 	
 	// GetBestOrders 获取最佳价格的所有订单（用于撮合）
 	GetBestOrders() []*domain.Order
+
+	// GetTopOrders 获取最佳价格队首的最多 maxOrders 个订单（按时间优先），不按整档分配切片
+	GetTopOrders(maxOrders int) []*domain.Order
 	
 	// GetLevel 获取指定价格的档位
-	GetLevel(price int64) *PriceLevel_
+	GetLevel(price domain.Price) *PriceLevel_
 	
 	// GetDepth 获取市场深度（前 N 档）
 	GetDepth(maxLevels int) []PriceLevel_
 	
+	// Walk 从最佳价格开始按优先级顺序遍历档位，fn 返回 false 时提前停止
+	Walk(fn func(level *PriceLevel_) bool)
+
+	// Levels 从最佳价格开始按优先级顺序惰性产出档位（range-over-func），不分配切片
+	// 可随时 break 提前结束，适合遍历任意深度的订单簿；遍历期间不得修改价格树
+	Levels() iter.Seq[*PriceLevel_]
+	
 	// IsEmpty 判断是否为空
 	IsEmpty() bool
 	
 	// Size 返回价格档位数量
 	Size() int
+
+	// MemoryEstimate 估算价格树占用的内存（字节），包含档位、链表节点和订单
+	MemoryEstimate() int64
 }
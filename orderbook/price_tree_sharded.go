@@ -1,6 +1,8 @@
 package orderbook
 
 import (
+	"lightning-exchange/domain"
+
 	rbt "github.com/emirpasic/gods/v2/trees/redblacktree"
 )
 
@@ -16,10 +18,10 @@ type ShardedPriceTree struct {
 }
 
 // Bucket 代表一个价格分片
-// 内部使用固定数组 + Doubly Linked List（用空间换时间）
+// 内部使用定长数组 + Doubly Linked List（用空间换时间）
 type Bucket struct {
 	bucketID   int64             // bucket ID (price / bucketSize)
-	levels     [128]*PriceLevel_ // 固定数组（128 = 2^7，可用位运算优化）
+	levels     []*PriceLevel_    // 定长数组（长度 = bucketSize，2 的幂，可用位运算优化）
 	bestPrice  *PriceLevel_      // bucket 内最佳价格（链表头）
 	size       int               // bucket 中的元素数量
 	isBuy      bool
@@ -63,6 +65,7 @@ func NewShardedPriceTree(isBuy bool, bucketSize int64) *ShardedPriceTree {
 func NewBucket(bucketID int64, isBuy bool, bucketSize int64) *Bucket {
 	return &Bucket{
 		bucketID:   bucketID,
+		levels:     make([]*PriceLevel_, bucketSize),
 		isBuy:      isBuy,
 		bucketSize: bucketSize,
 		bucketMask: bucketSize - 1, // 用于位运算：price & mask 等价于 price % bucketSize
@@ -71,7 +74,7 @@ func NewBucket(bucketID int64, isBuy bool, bucketSize int64) *Bucket {
 
 // Insert 插入价格档位
 // 性能：O(log m) + O(1) = O(log m)，m = bucket 数量
-func (spt *ShardedPriceTree) Insert(price int64, level *PriceLevel_) {
+func (spt *ShardedPriceTree) Insert(price domain.Price, level *PriceLevel_) {
 	bucketID := price / spt.bucketSize
 	
 	// 查找或创建 bucket - O(log m)
@@ -90,7 +93,7 @@ func (spt *ShardedPriceTree) Insert(price int64, level *PriceLevel_) {
 
 // Remove 删除价格档位
 // 性能：O(log m) + O(1) = O(log m)
-func (spt *ShardedPriceTree) Remove(price int64) {
+func (spt *ShardedPriceTree) Remove(price domain.Price) {
 	bucketID := price / spt.bucketSize
 	
 	// 查找 bucket - O(log m)
@@ -171,7 +174,7 @@ func (spt *ShardedPriceTree) isBetterBucket(newBucketID, existingBucketID int64)
 
 // Insert 在 bucket 内插入价格档位
 // 使用数组索引（位运算优化）+ Doubly Linked List 维护顺序
-func (b *Bucket) Insert(price int64, level *PriceLevel_) {
+func (b *Bucket) Insert(price domain.Price, level *PriceLevel_) {
 	// 使用位运算计算索引：price & mask 等价于 price % bucketSize
 	// 但位运算比取模快 5-10 倍
 	index := price & b.bucketMask
@@ -212,7 +215,7 @@ func (b *Bucket) Insert(price int64, level *PriceLevel_) {
 
 // Remove 从 bucket 删除价格档位
 // 使用链表的 O(1) 删除
-func (b *Bucket) Remove(price int64) {
+func (b *Bucket) Remove(price domain.Price) {
 	// 使用位运算计算索引
 	index := price & b.bucketMask
 	level := b.levels[index]
@@ -246,7 +249,7 @@ func (b *Bucket) updateBestPrice() {
 	// 这个方法保留用于兼容性，但实际上不需要了
 }
 
-func (b *Bucket) isBetterPrice(newPrice, existingPrice int64) bool {
+func (b *Bucket) isBetterPrice(newPrice, existingPrice domain.Price) bool {
 	if b.isBuy {
 		return newPrice > existingPrice
 	}
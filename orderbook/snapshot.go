@@ -0,0 +1,202 @@
+package orderbook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lightning-exchange/domain"
+	"time"
+)
+
+// SnapshotVersion is the snapshot format written by this build
+// Bump it whenever BookSnapshot/SnapshotOrder change shape, and register a migration
+// from the previous version in snapshotMigrations so older snapshots keep loading.
+const SnapshotVersion = 2
+
+var (
+	// ErrSnapshotVersion is returned for snapshots written by a newer (unknown) format version
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+
+	// ErrSnapshotSymbol is returned when a snapshot belongs to a different symbol
+	ErrSnapshotSymbol = errors.New("snapshot symbol mismatch")
+
+	// ErrBookNotEmpty is returned when loading a snapshot into a book that already has orders
+	ErrBookNotEmpty = errors.New("order book is not empty")
+)
+
+// BookSnapshot is the serializable state of an order book
+// Orders are listed in price-time priority (bids best first, then asks best first),
+// so replaying them in order reproduces each level's FIFO queue.
+type BookSnapshot struct {
+	Version int             `json:"version"`
+	Symbol  string          `json:"symbol"`
+	Orders  []SnapshotOrder `json:"orders"`
+}
+
+// SnapshotOrder is one resting order in a BookSnapshot
+type SnapshotOrder struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"user_id"`
+	Side      domain.Side     `json:"side"`
+	Price     int64           `json:"price"`
+	Quantity  int64           `json:"quantity"`
+	Filled    int64           `json:"filled"`
+	Timestamp time.Time       `json:"timestamp"`
+	ExpireAt  time.Time       `json:"expire_at,omitzero"`
+	Synthetic bool            `json:"synthetic,omitempty"`
+	ExecInst  domain.ExecInst `json:"exec_inst,omitempty"`
+	Tag       string          `json:"tag,omitempty"`
+
+	DisplayQty    int64 `json:"display_qty,omitempty"`
+	DisplayQtyMax int64 `json:"display_qty_max,omitempty"`
+	ShownQty      int64 `json:"shown_qty,omitempty"`
+}
+
+// snapshotMigrations upgrades a raw snapshot from version v to v+1 (keyed by v)
+var snapshotMigrations = map[int]func(raw map[string]json.RawMessage) error{
+	1: migrateSnapshotV1,
+}
+
+// migrateSnapshotV1 folds v1's per-order last_look flag into the v2 exec_inst bitfield
+func migrateSnapshotV1(raw map[string]json.RawMessage) error {
+	var orders []map[string]json.RawMessage
+	if data, ok := raw["orders"]; ok {
+		if err := json.Unmarshal(data, &orders); err != nil {
+			return err
+		}
+	}
+	for _, order := range orders {
+		var lastLook bool
+		if data, ok := order["last_look"]; ok {
+			if err := json.Unmarshal(data, &lastLook); err != nil {
+				return err
+			}
+			delete(order, "last_look")
+		}
+		if lastLook {
+			order["exec_inst"] = json.RawMessage(fmt.Sprint(uint16(domain.ExecLastLook)))
+		}
+	}
+	data, err := json.Marshal(orders)
+	if err != nil {
+		return err
+	}
+	raw["orders"] = data
+	return nil
+}
+
+// Snapshot captures the book's resting orders in price-time priority
+// Lock-free: Only called by the matching thread
+func (ob *OrderBook) Snapshot() BookSnapshot {
+	snapshot := BookSnapshot{
+		Version: SnapshotVersion,
+		Symbol:  ob.symbol,
+		Orders:  make([]SnapshotOrder, 0, len(ob.orders)),
+	}
+	for _, tree := range []PriceTreeInterface{ob.bids, ob.asks} {
+		for _, level := range tree.GetDepth(tree.Size()) {
+			for e := level.Orders.Front(); e != nil; e = e.Next() {
+				order := e.Value.(*domain.Order)
+				snapshot.Orders = append(snapshot.Orders, SnapshotOrder{
+					ID:        order.ID,
+					UserID:    order.UserID,
+					Side:      order.Side,
+					Price:     order.Price,
+					Quantity:  order.Quantity,
+					Filled:    order.Filled,
+					Timestamp: order.Timestamp,
+					ExpireAt:  order.ExpireAt,
+					Synthetic: order.Synthetic,
+					ExecInst:  order.ExecInst,
+					Tag:       order.Tag,
+
+					DisplayQty:    order.DisplayQty,
+					DisplayQtyMax: order.DisplayQtyMax,
+					ShownQty:      order.ShownQty,
+				})
+			}
+		}
+	}
+	return snapshot
+}
+
+// MarshalSnapshot serializes the book as a versioned snapshot
+func (ob *OrderBook) MarshalSnapshot() ([]byte, error) {
+	return json.Marshal(ob.Snapshot())
+}
+
+// DecodeSnapshot parses a serialized snapshot of any supported version
+// Older versions are migrated forward step by step to SnapshotVersion;
+// snapshots from a newer (unknown) version are rejected with ErrSnapshotVersion.
+func DecodeSnapshot(data []byte) (*BookSnapshot, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("decode snapshot version: %w", err)
+		}
+	}
+	if version < 1 || version > SnapshotVersion {
+		return nil, fmt.Errorf("%w: %d (this build reads 1..%d)", ErrSnapshotVersion, version, SnapshotVersion)
+	}
+
+	for ; version < SnapshotVersion; version++ {
+		migrate, ok := snapshotMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration from version %d", ErrSnapshotVersion, version)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, fmt.Errorf("migrate snapshot from version %d: %w", version, err)
+		}
+	}
+	raw["version"] = json.RawMessage(fmt.Sprint(SnapshotVersion))
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	var snapshot BookSnapshot
+	if err := json.Unmarshal(upgraded, &snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// LoadSnapshot restores a serialized snapshot into an empty book
+// Orders are re-inserted in snapshot order, preserving price-time priority.
+// No matching is performed: a crossed snapshot loads as a crossed book (see UncrossRepair).
+// Lock-free: Only called by the matching thread (or before the engine is started)
+func (ob *OrderBook) LoadSnapshot(data []byte) error {
+	snapshot, err := DecodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+	if snapshot.Symbol != ob.symbol {
+		return fmt.Errorf("%w: snapshot %q, book %q", ErrSnapshotSymbol, snapshot.Symbol, ob.symbol)
+	}
+	if len(ob.orders) > 0 {
+		return ErrBookNotEmpty
+	}
+
+	for _, s := range snapshot.Orders {
+		order := domain.NewLimitOrder(s.ID, ob.symbol, s.UserID, s.Side, s.Price, s.Quantity)
+		order.Filled = s.Filled
+		if order.Filled > 0 {
+			order.Status = domain.OrderStatusPartialFilled
+		}
+		order.Timestamp = s.Timestamp
+		order.ExpireAt = s.ExpireAt
+		order.Synthetic = s.Synthetic
+		order.ExecInst = s.ExecInst
+		order.Tag = s.Tag
+		order.DisplayQty = s.DisplayQty
+		order.DisplayQtyMax = s.DisplayQtyMax
+		order.ShownQty = s.ShownQty
+		ob.AddOrder(order)
+	}
+	return nil
+}
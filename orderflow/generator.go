@@ -0,0 +1,136 @@
+// Package orderflow generates reproducible synthetic order flow for benchmarks and tests
+//
+// A Generator seeded with the same Config always yields the same sequence of actions,
+// so benchmark runs are comparable across runs and code changes, and tests can replay
+// exactly the flow a benchmark used.
+package orderflow
+
+import (
+	"lightning-exchange/domain"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// ActionType is the kind of request a generated Action represents
+type ActionType int
+
+const (
+	ActionLimit  ActionType = iota // submit Order (limit)
+	ActionMarket                   // submit Order (market)
+	ActionCancel                   // cancel CancelID
+)
+
+// Action is one generated request
+type Action struct {
+	Type     ActionType
+	Order    *domain.Order // ActionLimit / ActionMarket; from the order pool, owned by the caller
+	CancelID string        // ActionCancel: a previously generated limit order (may be filled already)
+}
+
+// Config describes the order-flow distribution
+type Config struct {
+	Seed     int64
+	Symbol   string
+	IDPrefix string // prefix for generated order IDs (use one per generator when running several)
+	Users    int    // number of distinct UserIDs orders are spread over
+
+	MidPrice    domain.Price // centre of the limit price distribution
+	PriceStdDev float64      // standard deviation of limit prices around MidPrice, in ticks
+
+	MarketRatio float64 // fraction of actions that are market orders
+	CancelRatio float64 // fraction of actions that are cancels
+
+	MeanSize float64 // mean order size; sizes are 1 + exponential, so small orders dominate
+}
+
+// DefaultConfig returns a flow loosely modelled on a liquid spot market:
+// prices within a few ticks of mid, 5% market orders, 30% cancels, mean size 5
+func DefaultConfig() Config {
+	return Config{
+		Seed:        1,
+		Symbol:      "BTCUSDT",
+		IDPrefix:    "g",
+		Users:       1000,
+		MidPrice:    50000,
+		PriceStdDev: 20,
+		MarketRatio: 0.05,
+		CancelRatio: 0.30,
+		MeanSize:    5,
+	}
+}
+
+// recentOrders is how many recent limit order IDs are kept as cancel candidates
+const recentOrders = 4096
+
+// Generator produces a deterministic stream of actions
+// Not safe for concurrent use: give each producer goroutine its own Generator
+// (e.g. Seed+i and a distinct IDPrefix).
+type Generator struct {
+	cfg    Config
+	rng    *rand.Rand
+	seq    int64
+	recent []string // ring of recent limit order IDs
+	next   int
+}
+
+// NewGenerator creates a generator for cfg
+func NewGenerator(cfg Config) *Generator {
+	if cfg.Users <= 0 {
+		cfg.Users = 1
+	}
+	if cfg.MeanSize < 1 {
+		cfg.MeanSize = 1
+	}
+	return &Generator{
+		cfg:    cfg,
+		rng:    rand.New(rand.NewSource(cfg.Seed)),
+		recent: make([]string, 0, recentOrders),
+	}
+}
+
+// Next returns the next action
+func (g *Generator) Next() Action {
+	r := g.rng.Float64()
+	if r < g.cfg.CancelRatio && len(g.recent) > 0 {
+		return Action{Type: ActionCancel, CancelID: g.recent[g.rng.Intn(len(g.recent))]}
+	}
+
+	order := g.newOrder()
+	if r < g.cfg.CancelRatio+g.cfg.MarketRatio {
+		order.Type = domain.OrderTypeMarket
+		order.Price = 0
+		return Action{Type: ActionMarket, Order: order}
+	}
+
+	g.remember(order.ID)
+	return Action{Type: ActionLimit, Order: order}
+}
+
+// newOrder draws side, price, size and user for a limit order
+func (g *Generator) newOrder() *domain.Order {
+	g.seq++
+	side := domain.SideBuy
+	if g.rng.Intn(2) == 1 {
+		side = domain.SideSell
+	}
+
+	price := g.cfg.MidPrice + domain.Price(math.Round(g.rng.NormFloat64()*g.cfg.PriceStdDev))
+	if price < 1 {
+		price = 1
+	}
+	size := 1 + int64(math.Round(g.rng.ExpFloat64()*(g.cfg.MeanSize-1)))
+	user := "u" + strconv.Itoa(g.rng.Intn(g.cfg.Users))
+
+	return domain.NewLimitOrder(g.cfg.IDPrefix+strconv.FormatInt(g.seq, 10), g.cfg.Symbol, user, side, price, size)
+}
+
+// remember records a limit order ID as a future cancel candidate
+func (g *Generator) remember(id string) {
+	if len(g.recent) < recentOrders {
+		g.recent = append(g.recent, id)
+		return
+	}
+	g.recent[g.next] = id
+	g.next = (g.next + 1) % recentOrders
+}
@@ -0,0 +1,92 @@
+package orderflow
+
+import (
+	"lightning-exchange/domain"
+	"math"
+	"testing"
+)
+
+// flowSignature 生成 n 个动作
+func flowSignature(g *Generator, n int) []Action {
+	actions := make([]Action, n)
+	for i := range actions {
+		actions[i] = g.Next()
+	}
+	return actions
+}
+
+// TestGeneratorDeterministic 相同种子产生相同序列，不同种子产生不同序列
+func TestGeneratorDeterministic(t *testing.T) {
+	same := func(a, b []Action) bool {
+		for i := range a {
+			if a[i].Type != b[i].Type || a[i].CancelID != b[i].CancelID {
+				return false
+			}
+			if a[i].Order != nil {
+				x, y := a[i].Order, b[i].Order
+				if x.ID != y.ID || x.Side != y.Side || x.Price != y.Price || x.Quantity != y.Quantity || x.UserID != y.UserID {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	cfg := DefaultConfig()
+	first := flowSignature(NewGenerator(cfg), 5000)
+	second := flowSignature(NewGenerator(cfg), 5000)
+	if !same(first, second) {
+		t.Fatal("same seed produced different flows")
+	}
+
+	cfg.Seed = 2
+	if same(first, flowSignature(NewGenerator(cfg), 5000)) {
+		t.Error("different seeds produced identical flows")
+	}
+}
+
+// TestGeneratorDistribution 动作比例、价格和数量分布符合配置
+func TestGeneratorDistribution(t *testing.T) {
+	cfg := DefaultConfig()
+	g := NewGenerator(cfg)
+
+	const n = 100000
+	counts := make(map[ActionType]int)
+	var priceSum, priceSqSum, sizeSum float64
+	limits := 0
+	seen := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		action := g.Next()
+		counts[action.Type]++
+		switch action.Type {
+		case ActionLimit:
+			limits++
+			seen[action.Order.ID] = true
+			d := float64(action.Order.Price - cfg.MidPrice)
+			priceSum += d
+			priceSqSum += d * d
+			sizeSum += float64(action.Order.Quantity)
+		case ActionMarket:
+			if action.Order.Type != domain.OrderTypeMarket {
+				t.Fatal("market action carries a non-market order")
+			}
+		case ActionCancel:
+			if !seen[action.CancelID] {
+				t.Fatalf("cancel of an order that was never generated: %s", action.CancelID)
+			}
+		}
+	}
+
+	ratio := func(typ ActionType) float64 { return float64(counts[typ]) / n }
+	if math.Abs(ratio(ActionCancel)-cfg.CancelRatio) > 0.01 || math.Abs(ratio(ActionMarket)-cfg.MarketRatio) > 0.01 {
+		t.Errorf("action mix off: cancel %.3f market %.3f", ratio(ActionCancel), ratio(ActionMarket))
+	}
+	mean := priceSum / float64(limits)
+	stddev := math.Sqrt(priceSqSum/float64(limits) - mean*mean)
+	if math.Abs(mean) > 1 || math.Abs(stddev-cfg.PriceStdDev) > 1 {
+		t.Errorf("price distribution off: mean offset %.2f stddev %.2f", mean, stddev)
+	}
+	if avg := sizeSum / float64(limits); math.Abs(avg-cfg.MeanSize) > 0.2 {
+		t.Errorf("mean size %.2f, configured %.1f", avg, cfg.MeanSize)
+	}
+}